@@ -0,0 +1,164 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	backup "github.com/MottainaiCI/mottainai-server/pkg/backup"
+	database "github.com/MottainaiCI/mottainai-server/pkg/db"
+	s "github.com/MottainaiCI/mottainai-server/pkg/settings"
+	utils "github.com/MottainaiCI/mottainai-server/pkg/utils"
+
+	cobra "github.com/spf13/cobra"
+)
+
+const BACKUP_PASSPHRASE_ENV = "MOTTAINAI_BACKUP_PASSPHRASE"
+
+func backupPassphrase(flag string) string {
+	if len(flag) > 0 {
+		return flag
+	}
+	return os.Getenv(BACKUP_PASSPHRASE_ENV)
+}
+
+func newBackupCommand(config *s.Config) *cobra.Command {
+	var output, base string
+	var opts backup.BackupOptions
+
+	var cmd = &cobra.Command{
+		Use:   "backup",
+		Short: "Export the server state to an archive",
+		Long: `Export all the database collections and optionally the artefacts,
+namespaces and storages trees to a versioned archive.
+
+Secrets, tokens, nodes, users and webhooks are encrypted with a passphrase,
+read from --passphrase or from the ` + BACKUP_PASSPHRASE_ENV + ` environment
+variable, or omitted with --skip-secrets.
+
+With --since or --base only the tasks, artefacts and files modified after
+the given time are exported. The tiedot engine doesn't allow concurrent
+access: stop the server before taking a backup to get a consistent snapshot.`,
+		Example: `$> mottainai-server backup -o mottainai.tar.gz --files -c mottainai-server.yaml
+$> mottainai-server backup -o incr.tar.gz --base mottainai.tar.gz -c mottainai-server.yaml`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(output) == 0 {
+				utils.CheckError(errors.New("An output file is required"))
+			}
+			opts.Passphrase = backupPassphrase(opts.Passphrase)
+
+			if len(base) > 0 {
+				f, err := os.Open(base)
+				utils.CheckError(err)
+				m, err := backup.ReadManifest(f)
+				f.Close()
+				utils.CheckError(err)
+				opts.Since = m.Created
+			}
+
+			driver, err := database.NewDriver(config, config.GetDatabase().DBEngine)
+			utils.CheckError(err)
+			driver.GetAgent().Map(config)
+
+			f, err := os.OpenFile(output, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+			utils.CheckError(err)
+			defer f.Close()
+
+			m, err := backup.Backup(driver, config, f, opts)
+			utils.CheckError(err)
+
+			for coll, n := range m.Collections {
+				fmt.Printf("%-15s %d\n", coll, n)
+			}
+			for _, coll := range m.Skipped {
+				fmt.Printf("%-15s skipped\n", coll)
+			}
+			fmt.Println("Backup written to", output)
+		},
+	}
+
+	var flags = cmd.Flags()
+	flags.StringVarP(&output, "output", "o", "", "Archive to create")
+	flags.StringVar(&opts.Passphrase, "passphrase", "", "Passphrase to encrypt secrets, tokens, nodes, users and webhooks")
+	flags.BoolVar(&opts.SkipSensitive, "skip-secrets", false, "Omit secrets, tokens, nodes, users and webhooks from the archive")
+	flags.BoolVar(&opts.Files, "files", false, "Include the artefacts, namespaces and storages trees")
+	flags.StringVar(&opts.Since, "since", "", "Incremental backup of changes after this time ("+s.Timeformat+")")
+	flags.StringVar(&base, "base", "", "Incremental backup of changes after the given archive")
+
+	return cmd
+}
+
+func newRestoreCommand(config *s.Config) *cobra.Command {
+	var input, engine string
+	var opts backup.RestoreOptions
+
+	var cmd = &cobra.Command{
+		Use:   "restore",
+		Short: "Import the server state from an archive",
+		Long: `Import an archive created by the backup command.
+
+The target engine can differ from the one where the backup was taken.
+Existing documents with the same ID are replaced, so incremental archives
+can be restored on top of a full one. Stop the server before restoring.`,
+		Example: `$> mottainai-server restore -i mottainai.tar.gz --engine arangodb --files -c mottainai-server.yaml`,
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(input) == 0 {
+				utils.CheckError(errors.New("An input file is required"))
+			}
+			if len(engine) == 0 {
+				engine = config.GetDatabase().DBEngine
+			}
+			opts.Passphrase = backupPassphrase(opts.Passphrase)
+
+			driver, err := database.NewDriver(config, engine)
+			utils.CheckError(err)
+			driver.GetAgent().Map(config)
+			// Init creates the missing collections and indexes
+			driver.Init()
+
+			f, err := os.Open(input)
+			utils.CheckError(err)
+			defer f.Close()
+
+			m, err := backup.Restore(driver, config, f, opts)
+			utils.CheckError(err)
+
+			for coll, n := range m.Collections {
+				fmt.Printf("%-15s %d\n", coll, n)
+			}
+			fmt.Println("Restore completed")
+		},
+	}
+
+	var flags = cmd.Flags()
+	flags.StringVarP(&input, "input", "i", "", "Archive to restore")
+	flags.StringVar(&engine, "engine", "", "Target database engine (tiedot|arangodb), defaults to the configured one")
+	flags.StringVar(&opts.Passphrase, "passphrase", "", "Passphrase to decrypt secrets, tokens, nodes, users and webhooks")
+	flags.BoolVar(&opts.Files, "files", false, "Restore the artefacts, namespaces and storages trees")
+
+	return cmd
+}
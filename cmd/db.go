@@ -0,0 +1,199 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	database "github.com/MottainaiCI/mottainai-server/pkg/db"
+	dbcommon "github.com/MottainaiCI/mottainai-server/pkg/db/common"
+	s "github.com/MottainaiCI/mottainai-server/pkg/settings"
+	utils "github.com/MottainaiCI/mottainai-server/pkg/utils"
+
+	cobra "github.com/spf13/cobra"
+)
+
+func newDbCommand(config *s.Config) *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "db",
+		Short: "Database maintenance commands",
+	}
+
+	cmd.AddCommand(
+		newDbMigrateCommand(config),
+		newDbStatusCommand(config),
+	)
+
+	return cmd
+}
+
+func newDbStatusCommand(config *s.Config) *cobra.Command {
+	var engine string
+
+	var cmd = &cobra.Command{
+		Use:     "status",
+		Short:   "Show the schema version and the pending migrations",
+		Example: `$> mottainai-server db status -c mottainai-server.yaml`,
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(engine) == 0 {
+				engine = config.GetDatabase().DBEngine
+			}
+			driver, err := database.NewDriver(config, engine)
+			utils.CheckError(err)
+			driver.GetAgent().Map(config)
+
+			version, err := driver.SchemaVersion()
+			utils.CheckError(err)
+			fmt.Printf("Engine:         %s\n", engine)
+			fmt.Printf("Schema version: %d\n", version)
+			fmt.Printf("Latest version: %d\n", dbcommon.LatestSchemaVersion())
+
+			pending, err := dbcommon.PendingMigrations(driver)
+			utils.CheckError(err)
+			if len(pending) == 0 {
+				fmt.Println("No pending migrations")
+			}
+			for _, m := range pending {
+				fmt.Printf("Pending %3d: %s\n", m.Version, m.Description)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&engine, "engine", "", "Database engine (tiedot|arangodb), defaults to the configured one")
+
+	return cmd
+}
+
+func newDbMigrateCommand(config *s.Config) *cobra.Command {
+	var from, to string
+	var opts database.MigrateOptions
+
+	var cmd = &cobra.Command{
+		Use:   "migrate",
+		Short: "Apply the schema migrations or copy the collections between engines",
+		Long: `Without --from and --to, apply the pending schema migrations to the
+configured database. The server applies them also at startup.
+
+With --from and --to, copy all the collections between database engines,
+both configured in the database section of the configuration file.
+Both databases are brought to the latest schema before copying, with
+--dry-run their pending migrations are only shown.
+Document IDs are preserved, so the references between documents remain
+valid. Migrating to tiedot requires numeric IDs.`,
+		Example: `$> mottainai-server db migrate -c mottainai-server.yaml
+$> mottainai-server db migrate --from tiedot --to arangodb -c mottainai-server.yaml`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(from) == 0 && len(to) == 0 {
+				migrateSchema(config, opts.DryRun)
+				return
+			}
+			if len(from) == 0 || len(to) == 0 {
+				utils.CheckError(errors.New("Both source and target engines are required"))
+			}
+			if from == to {
+				utils.CheckError(errors.New("Source and target engines must be different"))
+			}
+
+			src, err := database.NewDriver(config, from)
+			utils.CheckError(err)
+			dst, err := database.NewDriver(config, to)
+			utils.CheckError(err)
+
+			src.GetAgent().Map(config)
+			dst.GetAgent().Map(config)
+			if opts.DryRun {
+				// The migrations of the schema are only reported
+				printPendingMigrations(from, src)
+				printPendingMigrations(to, dst)
+			} else {
+				// Init creates the missing collections and indexes and
+				// applies the schema migrations
+				src.Init()
+				dst.Init()
+			}
+
+			reports, err := database.Migrate(src, dst, opts)
+			for _, r := range reports {
+				fmt.Printf("%-15s source: %d copied: %d skipped: %d target: %d\n",
+					r.Collection, r.Source, r.Copied, r.Skipped, r.Target)
+			}
+			utils.CheckError(err)
+
+			if opts.DryRun {
+				fmt.Println("Dry run completed, no documents were written")
+			} else {
+				fmt.Println("Migration completed")
+			}
+		},
+	}
+
+	var flags = cmd.Flags()
+	flags.StringVar(&from, "from", "", "Source database engine (tiedot|arangodb)")
+	flags.StringVar(&to, "to", "", "Target database engine (tiedot|arangodb)")
+	flags.BoolVar(&opts.DryRun, "dry-run", false, "Check the migration without writing to the database")
+	flags.BoolVar(&opts.Resume, "resume", false, "Resume a previous migration skipping the documents already copied")
+
+	return cmd
+}
+
+func migrateSchema(config *s.Config, dryRun bool) {
+	driver, err := database.NewDriver(config, config.GetDatabase().DBEngine)
+	utils.CheckError(err)
+	driver.GetAgent().Map(config)
+
+	if printPendingMigrations("", driver) == 0 {
+		return
+	}
+	if dryRun {
+		fmt.Println("Dry run completed, no migrations were applied")
+		return
+	}
+
+	// Init creates the missing collections and applies the migrations
+	driver.Init()
+	version, err := driver.SchemaVersion()
+	utils.CheckError(err)
+	fmt.Printf("Schema migrated to version %d\n", version)
+}
+
+// printPendingMigrations shows the schema migrations not yet applied to the
+// database, without writing to it. It returns how many are pending.
+func printPendingMigrations(engine string, driver database.DatabaseDriver) int {
+	pending, err := dbcommon.PendingMigrations(driver)
+	utils.CheckError(err)
+
+	prefix := ""
+	if len(engine) > 0 {
+		prefix = engine + ": "
+	}
+	if len(pending) == 0 {
+		fmt.Println(prefix + "No pending migrations")
+	}
+	for _, m := range pending {
+		fmt.Printf("%sMigration %3d: %s\n", prefix, m.Version, m.Description)
+	}
+	return len(pending)
+}
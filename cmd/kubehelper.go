@@ -0,0 +1,76 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package cmd
+
+import (
+	"time"
+
+	s "github.com/MottainaiCI/mottainai-server/pkg/settings"
+	executors "github.com/MottainaiCI/mottainai-server/pkg/tasks/executors"
+	utils "github.com/MottainaiCI/mottainai-server/pkg/utils"
+
+	cobra "github.com/spf13/cobra"
+)
+
+func newKubeHelperCommand(config *s.Config) *cobra.Command {
+	var taskID, artefacts, storage, source string
+	var interval int
+
+	var cmd = &cobra.Command{
+		Use:    "kube-helper",
+		Short:  "Transfer task data inside Kubernetes task PODs",
+		Hidden: true,
+	}
+
+	var download = &cobra.Command{
+		Use:   "download",
+		Short: "Populate the task volumes",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			h := executors.NewKubernetesHelper(config, taskID)
+			utils.CheckError(h.Download(artefacts, storage, source))
+		},
+	}
+	download.Flags().StringVar(&storage, "storage", "", "Storage directory")
+	download.Flags().StringVar(&source, "source", "", "Directory where clone the task source")
+
+	var upload = &cobra.Command{
+		Use:   "upload",
+		Short: "Upload the task artefacts once the task is completed",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			h := executors.NewKubernetesHelper(config, taskID)
+			utils.CheckError(h.Upload(artefacts, time.Duration(interval)*time.Second))
+		},
+	}
+	upload.Flags().IntVar(&interval, "interval", 2, "Seconds between task status checks")
+
+	for _, c := range []*cobra.Command{download, upload} {
+		c.Flags().StringVar(&taskID, "task", "", "Task ID")
+		c.Flags().StringVar(&artefacts, "artefacts", "", "Artefacts directory")
+		c.MarkFlagRequired("task")
+		cmd.AddCommand(c)
+	}
+
+	return cmd
+}
@@ -86,8 +86,12 @@ func initCommand(rootCmd *cobra.Command, config *s.Config) {
 	config.Viper.BindPFlag("etcd-keyring", pflags.Lookup("etcd-keyring"))
 
 	rootCmd.AddCommand(
+		newBackupCommand(config),
 		newDaemonCommand(config),
+		newDbCommand(config),
+		newKubeHelperCommand(config),
 		newPrintCommand(config),
+		newRestoreCommand(config),
 		newWebCommand(config),
 		newWebHookCommand(config),
 	)
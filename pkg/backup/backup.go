@@ -0,0 +1,327 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	database "github.com/MottainaiCI/mottainai-server/pkg/db"
+	tiedot "github.com/MottainaiCI/mottainai-server/pkg/db/tiedot"
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+	"github.com/MottainaiCI/mottainai-server/pkg/utils"
+)
+
+// Version of the archive format, increased on incompatible changes
+const BACKUP_FORMAT_VERSION = 1
+
+const (
+	MANIFEST_FILE = "manifest.json"
+	DB_DIR        = "db"
+	FILES_DIR     = "files"
+)
+
+// Collections holding credentials (password hashes, webhook secrets...): they
+// are stored encrypted, or skipped when explicitly requested.
+var SensitiveCollections = []string{
+	tiedot.SecretColl, tiedot.TokenColl, tiedot.NodeColl, tiedot.EventSubscriptionColl,
+	tiedot.UserColl, tiedot.WebHookColl,
+}
+
+// Manifest is the first entry of the archive and describes its content.
+type Manifest struct {
+	Version       int            `json:"version"`
+	ServerVersion string         `json:"server_version"`
+	Created       string         `json:"created"`
+	Engine        string         `json:"engine"`
+	SchemaVersion int            `json:"schema_version"`
+	Since         string         `json:"since,omitempty"`
+	Collections   map[string]int `json:"collections"`
+	Encrypted     []string       `json:"encrypted,omitempty"`
+	Skipped       []string       `json:"skipped,omitempty"`
+	Salt          []byte         `json:"salt,omitempty"`
+	Trees         []string       `json:"trees,omitempty"`
+}
+
+func (m *Manifest) Incremental() bool {
+	return len(m.Since) > 0
+}
+
+// Document is a database document with its ID
+type Document struct {
+	ID  string                 `json:"id"`
+	Doc map[string]interface{} `json:"doc"`
+}
+
+type BackupOptions struct {
+	// Passphrase used to encrypt the sensitive collections
+	Passphrase string
+	// Omit the sensitive collections instead of encrypting them
+	SkipSensitive bool
+	// Include the artefacts, namespaces and storages trees
+	Files bool
+	// Incremental backup: only tasks, artefacts and files modified after
+	// this local time (in setting.Timeformat, like the task times) are
+	// included
+	Since string
+}
+
+// Trees returns the storage trees that can be included in an archive.
+func Trees(config *setting.Config) map[string]string {
+	return map[string]string{
+		"artefacts":  config.GetStorage().ArtefactPath,
+		"namespaces": config.GetStorage().NamespacePath,
+		"storages":   config.GetStorage().StoragePath,
+	}
+}
+
+// Backup writes to w a gzipped tar archive with all the collections of the
+// database and optionally the storage trees.
+func Backup(driver database.DatabaseDriver, config *setting.Config, w io.Writer, opts BackupOptions) (*Manifest, error) {
+	if len(opts.Passphrase) == 0 && !opts.SkipSensitive {
+		return nil, errors.New("A passphrase is required to backup secrets, tokens, nodes, users and webhooks")
+	}
+
+	var since time.Time
+	if len(opts.Since) > 0 {
+		t, err := time.ParseInLocation(setting.Timeformat, opts.Since, time.Local)
+		if err != nil {
+			return nil, errors.New("Invalid incremental time '" + opts.Since + "', expected format " + setting.Timeformat)
+		}
+		since = t
+	}
+
+	manifest := &Manifest{
+		Version:       BACKUP_FORMAT_VERSION,
+		ServerVersion: setting.MOTTAINAI_VERSION,
+		Created:       time.Now().Format(setting.Timeformat),
+		Engine:        config.GetDatabase().DBEngine,
+		Since:         opts.Since,
+		Collections:   make(map[string]int),
+	}
+
+	schema, err := driver.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	manifest.SchemaVersion = schema
+
+	var key []byte
+	if !opts.SkipSensitive {
+		salt, err := newSalt()
+		if err != nil {
+			return nil, err
+		}
+		manifest.Salt = salt
+		key, err = deriveKey(opts.Passphrase, salt)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The manifest has to be the first entry, so collections are read first
+	colls := make(map[string][]Document)
+	tasks := make(map[string]bool)
+	for _, coll := range tiedot.Collections {
+		if opts.SkipSensitive && utils.ArrayContainsString(SensitiveCollections, coll) {
+			manifest.Skipped = append(manifest.Skipped, coll)
+			continue
+		}
+
+		docs := make([]Document, 0)
+		for _, d := range driver.ListDocs(coll) {
+			doc, err := driver.GetDoc(coll, d.Id)
+			if err != nil {
+				return nil, fmt.Errorf("Failed reading document %s of %s: %s", d.Id, coll, err.Error())
+			}
+			for k := range doc {
+				if strings.HasPrefix(k, "_") {
+					delete(doc, k)
+				}
+			}
+
+			if !since.IsZero() {
+				switch coll {
+				case tiedot.TaskColl:
+					if !modifiedSince(doc, since, "created_time", "start_time", "end_time", "last_update_time") {
+						continue
+					}
+					tasks[d.Id] = true
+				case tiedot.ArtefactColl:
+					// Collections are processed after tasks
+					if !tasks[docField(doc, "task")] {
+						continue
+					}
+				}
+			}
+			docs = append(docs, Document{ID: d.Id, Doc: doc})
+		}
+		colls[coll] = docs
+		manifest.Collections[coll] = len(docs)
+		if !opts.SkipSensitive && utils.ArrayContainsString(SensitiveCollections, coll) {
+			manifest.Encrypted = append(manifest.Encrypted, coll)
+		}
+	}
+
+	trees := Trees(config)
+	if opts.Files {
+		for _, t := range []string{"artefacts", "namespaces", "storages"} {
+			if len(trees[t]) > 0 {
+				manifest.Trees = append(manifest.Trees, t)
+			}
+		}
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeEntry(tw, MANIFEST_FILE, data); err != nil {
+		return nil, err
+	}
+
+	for _, coll := range tiedot.Collections {
+		docs, ok := colls[coll]
+		if !ok {
+			continue
+		}
+		data, err := json.Marshal(docs)
+		if err != nil {
+			return nil, err
+		}
+		name := DB_DIR + "/" + coll + ".json"
+		if utils.ArrayContainsString(manifest.Encrypted, coll) {
+			data, err = encrypt(key, data)
+			if err != nil {
+				return nil, err
+			}
+			name += ".enc"
+		}
+		if err := writeEntry(tw, name, data); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, t := range manifest.Trees {
+		if err := writeTree(tw, trees[t], FILES_DIR+"/"+t, since); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// docField returns the string representation of a document field, numbers
+// decoded from json are float64.
+func docField(doc map[string]interface{}, field string) string {
+	switch v := doc[field].(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(v)
+	}
+	return ""
+}
+
+// modifiedSince reports whether one of the time fields of the document, in
+// local time, isn't before since.
+func modifiedSince(doc map[string]interface{}, since time.Time, fields ...string) bool {
+	for _, f := range fields {
+		t, err := time.ParseInLocation(setting.Timeformat, docField(doc, f), time.Local)
+		if err == nil && !t.Before(since) {
+			return true
+		}
+	}
+	return false
+}
+
+func writeEntry(tw *tar.Writer, name string, data []byte) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0600,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// writeTree adds the regular files of root modified after since to the archive.
+func writeTree(tw *tar.Writer, root, prefix string, since time.Time) error {
+	if _, err := os.Stat(root); os.IsNotExist(err) {
+		return nil
+	}
+
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || info.ModTime().Before(since) {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = prefix + "/" + filepath.ToSlash(rel)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+}
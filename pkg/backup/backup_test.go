@@ -0,0 +1,251 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package backup
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	database "github.com/MottainaiCI/mottainai-server/pkg/db"
+	dbcommon "github.com/MottainaiCI/mottainai-server/pkg/db/common"
+	tiedot "github.com/MottainaiCI/mottainai-server/pkg/db/tiedot"
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+)
+
+// memDriver implements the document primitives used by backup and restore
+type memDriver struct {
+	database.DatabaseDriver
+	colls  map[string]map[string]map[string]interface{}
+	schema int
+}
+
+func newMemDriver() *memDriver {
+	return &memDriver{colls: make(map[string]map[string]map[string]interface{})}
+}
+
+func (m *memDriver) ListDocs(coll string) []dbcommon.DocItem {
+	res := make([]dbcommon.DocItem, 0)
+	for id := range m.colls[coll] {
+		res = append(res, dbcommon.DocItem{Id: id})
+	}
+	return res
+}
+
+func (m *memDriver) GetDoc(coll, id string) (map[string]interface{}, error) {
+	doc := make(map[string]interface{})
+	for k, v := range m.colls[coll][id] {
+		doc[k] = v
+	}
+	return doc, nil
+}
+
+func (m *memDriver) InsertDocWithID(coll, id string, t map[string]interface{}) error {
+	if _, ok := m.colls[coll]; !ok {
+		m.colls[coll] = make(map[string]map[string]interface{})
+	}
+	m.colls[coll][id] = t
+	return nil
+}
+
+func (m *memDriver) ReplaceDoc(coll, id string, t map[string]interface{}) error {
+	return m.InsertDocWithID(coll, id, t)
+}
+
+func (m *memDriver) SchemaVersion() (int, error) {
+	return m.schema, nil
+}
+
+func (m *memDriver) SetSchemaVersion(v int) error {
+	m.schema = v
+	return nil
+}
+
+func newTestConfig(t *testing.T) (*setting.Config, string) {
+	dir, err := ioutil.TempDir("", "mottainai-backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := setting.NewConfig(nil)
+	config.Unmarshal()
+	config.GetStorage().ArtefactPath = filepath.Join(dir, "artefacts")
+	config.GetStorage().NamespacePath = filepath.Join(dir, "namespaces")
+	config.GetStorage().StoragePath = filepath.Join(dir, "storages")
+	return config, dir
+}
+
+func TestBackupRestore(t *testing.T) {
+	config, dir := newTestConfig(t)
+	defer os.RemoveAll(dir)
+
+	src := newMemDriver()
+	src.InsertDocWithID(tiedot.TaskColl, "1", map[string]interface{}{"name": "foo", "_rev": "x"})
+	src.InsertDocWithID(tiedot.SecretColl, "2", map[string]interface{}{"secret": "s3cr3t"})
+	src.InsertDocWithID(tiedot.UserColl, "3", map[string]interface{}{"password": "h4sh"})
+	src.InsertDocWithID(tiedot.WebHookColl, "4", map[string]interface{}{"key": "k3y"})
+
+	os.MkdirAll(filepath.Join(config.GetStorage().ArtefactPath, "1"), os.ModePerm)
+	ioutil.WriteFile(filepath.Join(config.GetStorage().ArtefactPath, "1", "out"), []byte("artefact"), 0644)
+
+	if _, err := Backup(src, config, &bytes.Buffer{}, BackupOptions{}); err == nil {
+		t.Error("Backup of secrets should require a passphrase")
+	}
+
+	var buf bytes.Buffer
+	m, err := Backup(src, config, &buf, BackupOptions{Passphrase: "pass", Files: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Collections[tiedot.TaskColl] != 1 || len(m.Encrypted) != 6 {
+		t.Error("Unexpected manifest", m)
+	}
+	for _, s := range []string{"s3cr3t", "h4sh", "k3y"} {
+		if bytes.Contains(buf.Bytes(), []byte(s)) {
+			t.Error("Credentials stored in clear", s)
+		}
+	}
+	archive := buf.Bytes()
+
+	if _, err := Restore(newMemDriver(), config, bytes.NewReader(archive), RestoreOptions{Passphrase: "wrong"}); err == nil {
+		t.Error("Restore with a wrong passphrase should fail")
+	}
+
+	os.RemoveAll(config.GetStorage().ArtefactPath)
+	dst := newMemDriver()
+	if _, err := Restore(dst, config, bytes.NewReader(archive), RestoreOptions{Passphrase: "pass", Files: true}); err != nil {
+		t.Fatal(err)
+	}
+	if dst.colls[tiedot.SecretColl]["2"]["secret"] != "s3cr3t" ||
+		dst.colls[tiedot.UserColl]["3"]["password"] != "h4sh" ||
+		dst.colls[tiedot.WebHookColl]["4"]["key"] != "k3y" {
+		t.Error("Credentials not restored", dst.colls)
+	}
+	if dst.colls[tiedot.TaskColl]["1"]["name"] != "foo" {
+		t.Error("Task not restored", dst.colls)
+	}
+	if _, ok := dst.colls[tiedot.TaskColl]["1"]["_rev"]; ok {
+		t.Error("Source metadata restored")
+	}
+	data, err := ioutil.ReadFile(filepath.Join(config.GetStorage().ArtefactPath, "1", "out"))
+	if err != nil || string(data) != "artefact" {
+		t.Error("Artefact not restored", err)
+	}
+}
+
+func TestRestoreNewerSchema(t *testing.T) {
+	config, dir := newTestConfig(t)
+	defer os.RemoveAll(dir)
+
+	src := newMemDriver()
+	src.schema = 2
+	src.InsertDocWithID(tiedot.TaskColl, "1", map[string]interface{}{"name": "foo"})
+
+	var buf bytes.Buffer
+	if _, err := Backup(src, config, &buf, BackupOptions{Passphrase: "pass"}); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := newMemDriver()
+	dst.schema = 1
+	if _, err := Restore(dst, config, &buf, RestoreOptions{Passphrase: "pass"}); err == nil {
+		t.Error("Restore of a newer schema should fail")
+	}
+	if len(dst.colls) != 0 || dst.schema != 1 {
+		t.Error("Database changed by a refused restore", dst.colls, dst.schema)
+	}
+}
+
+func TestBackupIncremental(t *testing.T) {
+	config, dir := newTestConfig(t)
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	src := newMemDriver()
+	src.InsertDocWithID(tiedot.TaskColl, "1", map[string]interface{}{
+		"created_time": now.Add(-48 * time.Hour).Format(setting.Timeformat)})
+	src.InsertDocWithID(tiedot.TaskColl, "2", map[string]interface{}{
+		"created_time": now.Add(-48 * time.Hour).Format(setting.Timeformat),
+		"end_time":     now.Format(setting.Timeformat)})
+	src.InsertDocWithID(tiedot.ArtefactColl, "3", map[string]interface{}{"task": "1"})
+	src.InsertDocWithID(tiedot.ArtefactColl, "4", map[string]interface{}{"task": "2"})
+	src.InsertDocWithID(tiedot.SecretColl, "5", map[string]interface{}{"secret": "s3cr3t"})
+	src.InsertDocWithID(tiedot.UserColl, "6", map[string]interface{}{"password": "h4sh"})
+
+	var buf bytes.Buffer
+	m, err := Backup(src, config, &buf, BackupOptions{
+		SkipSensitive: true,
+		Since:         now.Add(-time.Hour).Format(setting.Timeformat),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Incremental() || m.Collections[tiedot.TaskColl] != 1 || m.Collections[tiedot.ArtefactColl] != 1 {
+		t.Error("Unexpected manifest", m)
+	}
+	if len(m.Skipped) != 6 || len(m.Salt) != 0 {
+		t.Error("Sensitive collections not skipped", m)
+	}
+
+	dst := newMemDriver()
+	if _, err := Restore(dst, config, &buf, RestoreOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := dst.colls[tiedot.TaskColl]["2"]; !ok || len(dst.colls[tiedot.TaskColl]) != 1 {
+		t.Error("Unexpected tasks restored", dst.colls[tiedot.TaskColl])
+	}
+	if _, ok := dst.colls[tiedot.ArtefactColl]["4"]; !ok || len(dst.colls[tiedot.ArtefactColl]) != 1 {
+		t.Error("Unexpected artefacts restored", dst.colls[tiedot.ArtefactColl])
+	}
+	if len(dst.colls[tiedot.UserColl]) != 0 {
+		t.Error("Skipped users restored", dst.colls[tiedot.UserColl])
+	}
+}
+
+func TestBackupIncrementalBase(t *testing.T) {
+	config, dir := newTestConfig(t)
+	defer os.RemoveAll(dir)
+
+	// The task times are local, west of UTC they're behind the UTC ones
+	local := time.Local
+	time.Local = time.FixedZone("UTC-5", -5*60*60)
+	defer func() { time.Local = local }()
+
+	src := newMemDriver()
+	base, err := Backup(src, config, &bytes.Buffer{}, BackupOptions{SkipSensitive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src.InsertDocWithID(tiedot.TaskColl, "1", map[string]interface{}{
+		"end_time": time.Now().Add(time.Second).Format(setting.Timeformat)})
+	m, err := Backup(src, config, &bytes.Buffer{}, BackupOptions{SkipSensitive: true, Since: base.Created})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Collections[tiedot.TaskColl] != 1 {
+		t.Error("Task changed after the base backup missed", base.Created, m)
+	}
+}
@@ -0,0 +1,211 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	database "github.com/MottainaiCI/mottainai-server/pkg/db"
+	dbcommon "github.com/MottainaiCI/mottainai-server/pkg/db/common"
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+)
+
+type RestoreOptions struct {
+	// Passphrase used to decrypt the sensitive collections
+	Passphrase string
+	// Extract the storage trees included in the archive
+	Files bool
+}
+
+// ReadManifest returns the manifest of an archive.
+func ReadManifest(r io.Reader) (*Manifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	return readManifest(tar.NewReader(gz))
+}
+
+func readManifest(tr *tar.Reader) (*Manifest, error) {
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, err
+	}
+	if hdr.Name != MANIFEST_FILE {
+		return nil, errors.New("Invalid archive: missing manifest")
+	}
+	data, err := ioutil.ReadAll(tr)
+	if err != nil {
+		return nil, err
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	if m.Version > BACKUP_FORMAT_VERSION {
+		return nil, fmt.Errorf("Unsupported archive version %d, the newest supported is %d", m.Version, BACKUP_FORMAT_VERSION)
+	}
+	return &m, nil
+}
+
+// Restore loads an archive into the database, which can use a different
+// engine from the one where the backup was taken. Documents keep their IDs
+// and the ones already present are replaced, so incremental archives can be
+// applied on top of a full restore.
+func Restore(driver database.DatabaseDriver, config *setting.Config, r io.Reader, opts RestoreOptions) (*Manifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	manifest, err := readManifest(tr)
+	if err != nil {
+		return nil, err
+	}
+
+	// Documents from newer schemas can't be migrated back
+	current, err := driver.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	if manifest.SchemaVersion > current {
+		return nil, fmt.Errorf("The archive has schema version %d, newer than the database one (%d)",
+			manifest.SchemaVersion, current)
+	}
+
+	var key []byte
+	if len(manifest.Encrypted) > 0 {
+		if len(opts.Passphrase) == 0 {
+			return nil, errors.New("The archive contains encrypted collections, a passphrase is required")
+		}
+		key, err = deriveKey(opts.Passphrase, manifest.Salt)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	trees := Trees(config)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case strings.HasPrefix(hdr.Name, DB_DIR+"/"):
+			data, err := ioutil.ReadAll(tr)
+			if err != nil {
+				return nil, err
+			}
+			name := strings.TrimPrefix(hdr.Name, DB_DIR+"/")
+			if strings.HasSuffix(name, ".enc") {
+				name = strings.TrimSuffix(name, ".enc")
+				if data, err = decrypt(key, data); err != nil {
+					return nil, err
+				}
+			}
+			if err := restoreCollection(driver, strings.TrimSuffix(name, ".json"), data); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(hdr.Name, FILES_DIR+"/"):
+			if !opts.Files {
+				continue
+			}
+			parts := strings.SplitN(strings.TrimPrefix(hdr.Name, FILES_DIR+"/"), "/", 2)
+			root, ok := trees[parts[0]]
+			if len(parts) != 2 || !ok || len(root) == 0 {
+				continue
+			}
+			if err := extractFile(tr, hdr, root, parts[1]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Documents from older schemas have to be migrated again
+	if manifest.SchemaVersion < current {
+		if err := driver.SetSchemaVersion(manifest.SchemaVersion); err != nil {
+			return manifest, err
+		}
+		if _, err := dbcommon.MigrateSchema(driver); err != nil {
+			return manifest, err
+		}
+	}
+
+	return manifest, nil
+}
+
+func restoreCollection(driver database.DatabaseDriver, coll string, data []byte) error {
+	var docs []Document
+	if err := json.Unmarshal(data, &docs); err != nil {
+		return fmt.Errorf("Invalid data for %s: %s", coll, err.Error())
+	}
+
+	for _, d := range docs {
+		var err error
+		if old, gerr := driver.GetDoc(coll, d.ID); gerr == nil && len(old) > 0 {
+			err = driver.ReplaceDoc(coll, d.ID, d.Doc)
+		} else {
+			err = driver.InsertDocWithID(coll, d.ID, d.Doc)
+		}
+		if err != nil {
+			return fmt.Errorf("Failed restoring document %s of %s: %s", d.ID, coll, err.Error())
+		}
+	}
+	return nil
+}
+
+func extractFile(r io.Reader, hdr *tar.Header, root, name string) error {
+	dst := filepath.Join(root, filepath.FromSlash(name))
+	// Refuse entries escaping from the tree
+	if !strings.HasPrefix(dst, filepath.Clean(root)+string(os.PathSeparator)) {
+		return errors.New("Invalid archive entry: " + hdr.Name)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(hdr.Mode).Perm())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(f, r)
+	return err
+}
@@ -40,6 +40,7 @@ import (
 	"github.com/mxk/go-flowrate/flowrate"
 
 	event "github.com/MottainaiCI/mottainai-server/pkg/event"
+	nodes "github.com/MottainaiCI/mottainai-server/pkg/nodes"
 	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
 	schema "github.com/MottainaiCI/mottainai-server/routes/schema"
 
@@ -59,7 +60,7 @@ type HttpClient interface {
 	UploadFile(string, string) error
 	FailTask(string)
 	SetTaskField(string, string) (event.APIResponse, error)
-	RegisterNode(string, string) (event.APIResponse, error)
+	RegisterNode(string, string, nodes.NodeReport) (event.APIResponse, error)
 	Doc(string)
 	SetUploadChunkSize(int)
 	SetupTask() (event.APIResponse, error)
@@ -77,6 +78,11 @@ type HttpClient interface {
 	SettingUpdate(data map[string]interface{}) (event.APIResponse, error)
 	PlanDelete(id string) (event.APIResponse, error)
 	PlanCreate(taskdata map[string]interface{}) (event.APIResponse, error)
+	PlanRun(id string) (event.APIResponse, error)
+	PipelinePlanCreate(data map[string]interface{}) (event.APIResponse, error)
+	TaskTemplateCreate(data map[string]interface{}) (event.APIResponse, error)
+	TaskTemplateDelete(id string) (event.APIResponse, error)
+	TaskTemplateRun(id string, params map[string]string) (event.APIResponse, error)
 	SetBaseURL(url string)
 	SetAgent(a *anagent.Anagent)
 	SetActiveReport(b bool)
@@ -104,6 +110,10 @@ type HttpClient interface {
 	WebHookDeletePipeline(id string) (event.APIResponse, error)
 	WebHookEdit(data map[string]interface{}) (event.APIResponse, error)
 	WebHookCreate(t string) (event.APIResponse, error)
+	WebHookTaskPut(id string, data []byte) (event.APIResponse, error)
+	WebHookPipelinePut(id string, data []byte) (event.APIResponse, error)
+	WebHookTaskYaml(id string) ([]byte, error)
+	WebHookPipelineYaml(id string) ([]byte, error)
 	TokenDelete(id string) (event.APIResponse, error)
 	TokenCreate() (event.APIResponse, error)
 	UploadStorageFile(storageid, fullpath, relativepath string) error
@@ -353,6 +353,34 @@ var _ = Describe("Client", func() {
 				ev, err = fetcher.WebHookDelete(id)
 				ExpectSuccessfulResponse(ev, err)
 			})
+
+			It("Can put and get the defaults as YAML", func() {
+				fetcher, err := NewFakeClient()
+				Expect(err).ToNot(HaveOccurred())
+				fetcher.Doc(helpers.Tasks[0])
+
+				ev, err := fetcher.WebHookCreate("github")
+				ExpectSuccessfulResponse(ev, err)
+				id := ev.ID
+
+				ev, err = fetcher.WebHookTaskPut(id, []byte("script: [make]\nimage: alpine\n"))
+				ExpectSuccessfulResponse(ev, err)
+				y, err := fetcher.WebHookTaskYaml(id)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(y)).To(ContainSubstring("image: alpine"))
+
+				ev, err = fetcher.WebHookPipelinePut(id, []byte(`{"pipeline_name": "deploy", "tasks": {"up": {"image": "alpine"}}}`))
+				ExpectSuccessfulResponse(ev, err)
+				y, err = fetcher.WebHookPipelineYaml(id)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(y)).To(ContainSubstring("pipeline_name: deploy"))
+
+				ev, err = fetcher.WebHookTaskPut(id, []byte("scripts: [make]\n"))
+				Expect(err).To(HaveOccurred())
+
+				ev, err = fetcher.WebHookDelete(id)
+				ExpectSuccessfulResponse(ev, err)
+			})
 		})
 
 		Context("Plan", func() {
@@ -363,8 +391,70 @@ var _ = Describe("Client", func() {
 
 				ev, err := fetcher.PlanCreate(helpers.FixtureTaskData)
 				ExpectSuccessfulResponse(ev, err)
+				plan := ev.ID
+
+				ev, err = fetcher.PlanRun(plan)
+				ExpectSuccessfulResponse(ev, err)
+
+				ev, err = fetcher.PlanDelete(plan)
+				ExpectSuccessfulResponse(ev, err)
+			})
+
+			It("Can schedule pipelines", func() {
+				fetcher, err := NewFakeClient()
+				Expect(err).ToNot(HaveOccurred())
+				pipeline := &tasks.Pipeline{
+					Name: "Test",
+					Tasks: map[string]tasks.Task{
+						"test": tasks.Task{
+							Name: "test",
+						},
+					},
+				}
+				data := pipeline.ToMap(false)
+				data["planned"] = "@daily"
+				ev, err := fetcher.PipelinePlanCreate(data)
+				ExpectSuccessfulResponse(ev, err)
+				plan := ev.ID
+
+				ev, err = fetcher.PlanRun(plan)
+				ExpectSuccessfulResponse(ev, err)
+				Expect(ev.ObjType).To(Equal("pipeline"))
+
+				ev, err = fetcher.PlanDelete(plan)
+				ExpectSuccessfulResponse(ev, err)
+			})
+		})
+
+		Context("Task template", func() {
+			It("Can create, run and delete them", func() {
+				fetcher, err := NewFakeClient()
+				Expect(err).ToNot(HaveOccurred())
+				tmpl := map[string]interface{}{
+					"name": "build",
+					"parameters": []map[string]interface{}{
+						{"name": "version", "required": true},
+						{"name": "debug", "type": "bool", "default": "false"},
+					},
+					"task": map[string]interface{}{
+						"name":   "build {{ version }}",
+						"script": []string{"make VERSION={{ version }} DEBUG={{debug}}"},
+					},
+				}
+				ev, err := fetcher.TaskTemplateCreate(tmpl)
+				ExpectSuccessfulResponse(ev, err)
+				Expect(ev.ObjType).To(Equal("template"))
+				id := ev.ID
+
+				ev, err = fetcher.TaskTemplateRun(id, map[string]string{"version": "1.0"})
+				ExpectSuccessfulResponse(ev, err)
+				Expect(ev.ObjType).To(Equal("task"))
+
+				// By name, without the required parameter
+				ev, err = fetcher.TaskTemplateRun("build", map[string]string{})
+				Expect(err != nil || ev.Status != "ok").To(BeTrue())
 
-				ev, err = fetcher.PlanDelete(ev.ID)
+				ev, err = fetcher.TaskTemplateDelete(id)
 				ExpectSuccessfulResponse(ev, err)
 			})
 		})
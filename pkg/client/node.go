@@ -23,7 +23,10 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 package client
 
 import (
+	"strconv"
+
 	event "github.com/MottainaiCI/mottainai-server/pkg/event"
+	nodes "github.com/MottainaiCI/mottainai-server/pkg/nodes"
 	schema "github.com/MottainaiCI/mottainai-server/routes/schema"
 	v1 "github.com/MottainaiCI/mottainai-server/routes/schema/v1"
 )
@@ -63,13 +66,30 @@ func (d *Fetcher) NodesTask(key string, target interface{}) error {
 	return nil
 }
 
-func (f *Fetcher) RegisterNode(ID, hostname string) (event.APIResponse, error) {
+func (f *Fetcher) RegisterNode(ID, hostname string, report nodes.NodeReport) (event.APIResponse, error) {
+	queues := make([]string, 0)
+	for q, c := range report.Queues {
+		queues = append(queues, q+"="+strconv.Itoa(c))
+	}
+
 	req := schema.Request{
 		Route: v1.Schema.GetNodeRoute("register"),
 		Options: map[string]interface{}{
-			"key":      f.Config.GetAgent().AgentKey,
-			"nodeid":   ID,
-			"hostname": hostname,
+			"key":           f.Config.GetAgent().AgentKey,
+			"nodeid":        ID,
+			"hostname":      hostname,
+			"private_queue": report.PrivateQueue,
+			"labels":        report.Labels,
+			"version":       report.Version,
+			"executors":     report.Executors,
+			"queues":        queues,
+			"concurrency":   strconv.Itoa(report.Concurrency),
+			"running_tasks": report.RunningTasks,
+			"load":          report.Load,
+			"disk_total":    strconv.FormatUint(report.DiskTotal, 10),
+			"disk_free":     strconv.FormatUint(report.DiskFree, 10),
+			"mem_total":     strconv.FormatUint(report.MemTotal, 10),
+			"mem_available": strconv.FormatUint(report.MemAvailable, 10),
 		},
 	}
 
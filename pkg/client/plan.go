@@ -45,3 +45,24 @@ func (f *Fetcher) PlanCreate(taskdata map[string]interface{}) (event.APIResponse
 
 	return f.HandleAPIResponse(req)
 }
+
+func (f *Fetcher) PlanRun(id string) (event.APIResponse, error) {
+
+	req := schema.Request{
+		Route: v1.Schema.GetTaskRoute("plan_run"),
+		Options: map[string]interface{}{
+			":id": id,
+		},
+	}
+
+	return f.HandleAPIResponse(req)
+}
+
+func (f *Fetcher) PipelinePlanCreate(data map[string]interface{}) (event.APIResponse, error) {
+	req := schema.Request{
+		Route:   v1.Schema.GetTaskRoute("create_pipeline_plan"),
+		Options: data,
+	}
+
+	return f.HandleAPIResponse(req)
+}
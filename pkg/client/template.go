@@ -0,0 +1,81 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+
+	event "github.com/MottainaiCI/mottainai-server/pkg/event"
+	schema "github.com/MottainaiCI/mottainai-server/routes/schema"
+	v1 "github.com/MottainaiCI/mottainai-server/routes/schema/v1"
+)
+
+// TaskTemplateCreate creates a task template, or a new version of it, from
+// its JSON representation.
+func (f *Fetcher) TaskTemplateCreate(data map[string]interface{}) (event.APIResponse, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return event.APIResponse{}, err
+	}
+
+	req := schema.Request{
+		Route:   v1.Schema.GetTaskRoute("create_template"),
+		Options: map[string]interface{}{},
+		Body:    bytes.NewReader(b),
+
+		ContentType: "application/json",
+	}
+
+	return f.HandleAPIResponse(req)
+}
+
+func (f *Fetcher) TaskTemplateDelete(id string) (event.APIResponse, error) {
+
+	req := schema.Request{
+		Route: v1.Schema.GetTaskRoute("template_delete"),
+		Options: map[string]interface{}{
+			":id": id,
+		},
+	}
+
+	return f.HandleAPIResponse(req)
+}
+
+// TaskTemplateRun instantiates the template with the given ID, or the latest
+// version of the template with the given name, and runs it.
+func (f *Fetcher) TaskTemplateRun(id string, params map[string]string) (event.APIResponse, error) {
+	options := map[string]interface{}{
+		":id": id,
+	}
+	for k, v := range params {
+		options[k] = v
+	}
+
+	req := schema.Request{
+		Route:   v1.Schema.GetTaskRoute("template_run"),
+		Options: options,
+	}
+
+	return f.HandleAPIResponse(req)
+}
@@ -20,6 +20,10 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 package client
 
 import (
+	"bytes"
+	"io"
+	"io/ioutil"
+
 	event "github.com/MottainaiCI/mottainai-server/pkg/event"
 	schema "github.com/MottainaiCI/mottainai-server/routes/schema"
 	v1 "github.com/MottainaiCI/mottainai-server/routes/schema/v1"
@@ -103,3 +107,63 @@ func (f *Fetcher) WebHookCreate(t string) (event.APIResponse, error) {
 
 	return f.HandleAPIResponse(req)
 }
+
+// WebHookTaskPut replaces the default task of the webhook with the given YAML
+// or JSON document.
+func (f *Fetcher) WebHookTaskPut(id string, data []byte) (event.APIResponse, error) {
+	req := schema.Request{
+		Route: v1.Schema.GetWebHookRoute("put_task"),
+		Options: map[string]interface{}{
+			":id": id,
+		},
+		Body: bytes.NewReader(data),
+
+		ContentType: "application/yaml",
+	}
+
+	return f.HandleAPIResponse(req)
+}
+
+// WebHookPipelinePut replaces the default pipeline of the webhook with the
+// given YAML or JSON document.
+func (f *Fetcher) WebHookPipelinePut(id string, data []byte) (event.APIResponse, error) {
+	req := schema.Request{
+		Route: v1.Schema.GetWebHookRoute("put_pipeline"),
+		Options: map[string]interface{}{
+			":id": id,
+		},
+		Body: bytes.NewReader(data),
+
+		ContentType: "application/yaml",
+	}
+
+	return f.HandleAPIResponse(req)
+}
+
+func (f *Fetcher) WebHookTaskYaml(id string) ([]byte, error) {
+	return f.webHookDefaultYaml("task_yaml", id)
+}
+
+func (f *Fetcher) WebHookPipelineYaml(id string) ([]byte, error) {
+	return f.webHookDefaultYaml("pipeline_yaml", id)
+}
+
+func (f *Fetcher) webHookDefaultYaml(route, id string) ([]byte, error) {
+	req := schema.Request{
+		Route: v1.Schema.GetWebHookRoute(route),
+		Options: map[string]interface{}{
+			":id": id,
+		},
+	}
+
+	var res []byte
+	var err error
+
+	if herr := f.HandleRaw(req, func(b io.ReadCloser) error {
+		res, err = ioutil.ReadAll(b)
+		return err
+	}); herr != nil {
+		return nil, herr
+	}
+	return res, err
+}
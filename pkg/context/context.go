@@ -127,6 +127,24 @@ func (c *Context) NotFound() {
 	c.Handle(http.StatusNotFound, err, errors.New(err))
 }
 
+// Conflict reports a request conflicting with the current state of the
+// resource, e.g. an illegal task status transition.
+func (c *Context) Conflict(err error) {
+	var webconfig *setting.WebConfig
+	c.Invoke(func(config *setting.Config) {
+		webconfig = config.GetWeb()
+	})
+	if auth.IsAPIPath(c.Req.URL.Path, webconfig) {
+		c.JSON(http.StatusConflict, event.APIResponse{
+			Error:     err.Error(),
+			Status:    "error",
+			Processed: "true",
+		})
+		return
+	}
+	c.Error(http.StatusConflict, err.Error())
+}
+
 // Handle handles and logs error by given status.
 func (c *Context) Handle(status int, title string, err error) {
 	switch status {
@@ -34,9 +34,10 @@ import (
 	storage "github.com/MottainaiCI/mottainai-server/pkg/storage"
 	agenttasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
 	task "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+	user "github.com/MottainaiCI/mottainai-server/pkg/user"
 )
 
-const NameSpacesPrefix = "::"
+const NameSpacesPrefix = user.NameSpacesPrefix
 
 var noperm = map[string]string{
 	"message": "It seems you don't have enough permissions to perform this operation, i'm sorry.",
@@ -60,6 +61,24 @@ func (c *Context) CheckPipelinePermissions(pip *task.Pipeline) bool {
 	return false
 }
 
+func (c *Context) CheckTaskTemplatePermissions(tmpl *task.TaskTemplate) bool {
+	if !c.CheckUser() {
+		return false
+	}
+
+	if c.User.IsManagerOrAdmin() {
+		return true
+	}
+
+	// Return true if Admin or Owner of it
+	if c.User.ID == tmpl.Owner {
+		return true
+	}
+
+	c.NoPermission()
+	return false
+}
+
 func (c *Context) CheckUser() bool {
 	if c.User != nil {
 		return true
@@ -124,10 +143,7 @@ func (c *Context) CheckStorageBelongs(storage string) bool {
 }
 
 func (c *Context) CheckNamespaceBelongs(namespace string) bool {
-	if len(namespace) > 0 &&
-		!c.User.IsManagerOrAdmin() &&
-		!strings.HasPrefix(namespace, c.User.Name+NameSpacesPrefix) {
-
+	if !c.User.NamespaceBelongs(namespace) {
 		c.NoPermission()
 		return false
 	}
@@ -42,7 +42,8 @@ type Database struct {
 }
 
 var Collections = []string{WebHookColl, TaskColl, SecretColl,
-	UserColl, PlansColl, PipelinesColl, NodeColl, NamespaceColl, TokenColl, ArtefactColl, StorageColl, OrganizationColl, SettingColl}
+	UserColl, PlansColl, PipelinesColl, NodeColl, NamespaceColl, TokenColl, ArtefactColl, StorageColl, OrganizationColl, SettingColl, TaskTemplateColl,
+	EventSubscriptionColl}
 
 func New(db, u, p, cp, kp string, e []string) *Database {
 	return &Database{Anagent: anagent.New(), Database: db, Endpoints: e, CertPath: cp, KeyPath: kp, DBUser: u, DBPass: p}
@@ -89,7 +90,15 @@ func (d *Database) Init() {
 	d.IndexSetting()
 	d.IndexPipeline()
 	d.IndexSecret()
+	d.IndexTaskTemplate()
 	d.IndexWebHook()
+	d.IndexLease()
+	d.IndexEventSubscription()
+
+	// Bring the stored documents to the current schema
+	if _, err := dbcommon.MigrateSchema(d); err != nil {
+		panic(err)
+	}
 }
 
 func (d *Database) AddIndex(coll string, i []string) error {
@@ -200,6 +209,26 @@ func (d *Database) InsertDoc(coll string, t map[string]interface{}) (string, err
 	return meta.Key, err
 }
 
+// InsertDocWithID inserts a document using the given ID as document key.
+func (d *Database) InsertDocWithID(coll string, docID string, t map[string]interface{}) error {
+	col, err := d.UseCol(coll)
+	if err != nil {
+		return err
+	}
+
+	doc := make(map[string]interface{})
+	for k, v := range t {
+		doc[k] = v
+	}
+	delete(doc, "ID")
+	delete(doc, "id")
+	doc["_key"] = docID
+
+	ctx := context.Background()
+	_, err = col.CreateDocument(ctx, doc)
+	return err
+}
+
 func (d *Database) FindDoc(coll string, searchquery string) (map[string]struct{}, error) {
 	res := make(map[string]struct{})
 	ctx := context.Background()
@@ -262,6 +291,8 @@ func (d *Database) UpdateDoc(coll string, docID string, t map[string]interface{}
 	return d.ReplaceDoc(coll, docID, old)
 }
 
+// ReplaceDoc replaces the whole document: unlike a patch, keys removed from
+// nested objects (e.g. the tasks of a pipeline) don't survive.
 func (d *Database) ReplaceDoc(coll string, docID string, t map[string]interface{}) error {
 	col, err := d.UseCol(coll)
 	if err != nil {
@@ -270,7 +301,7 @@ func (d *Database) ReplaceDoc(coll string, docID string, t map[string]interface{
 
 	ctx := context.Background()
 
-	_, err = col.UpdateDocument(ctx, docID, t)
+	_, err = col.ReplaceDocument(ctx, docID, t)
 	if err != nil {
 		return err
 	}
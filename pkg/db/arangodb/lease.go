@@ -0,0 +1,91 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package arangodb
+
+import (
+	"context"
+	"time"
+
+	leader "github.com/MottainaiCI/mottainai-server/pkg/leader"
+	arango "github.com/arangodb/go-driver"
+)
+
+// LeaseColl holds the leader election leases. Like SchemaColl it's not part
+// of Collections, leases are meaningless outside of the running servers.
+var LeaseColl = "Leases"
+
+func (d *Database) IndexLease() {
+	ctx := context.Background()
+	if found, err := d.DB().CollectionExists(ctx, LeaseColl); err == nil && !found {
+		d.DB().CreateCollection(ctx, LeaseColl, &arango.CreateCollectionOptions{})
+	}
+}
+
+func (d *Database) AcquireLease(name, holder string, ttl time.Duration) (leader.Lease, error) {
+	lease := leader.NewLease(name, holder, ttl)
+	ctx := context.Background()
+
+	// The lease name is the document key, UPSERT on a single document is atomic
+	query := `UPSERT { _key: @name }
+INSERT { _key: @name, name: @name, holder: @holder, expires: @expires }
+UPDATE (OLD.holder == @holder || OLD.expires < @now) ? { holder: @holder, expires: @expires } : {}
+IN ` + LeaseColl + ` RETURN NEW`
+
+	cursor, err := d.DB().Query(ctx, query, map[string]interface{}{
+		"name":    name,
+		"holder":  holder,
+		"expires": lease.Expires,
+		"now":     time.Now().UnixNano() / int64(time.Millisecond),
+	})
+	if arango.IsConflict(err) {
+		// Another replica inserted the lease concurrently
+		return d.GetLease(name)
+	} else if err != nil {
+		return leader.Lease{}, err
+	}
+	defer cursor.Close()
+
+	var doc map[string]interface{}
+	if _, err := cursor.ReadDocument(ctx, &doc); err != nil {
+		return leader.Lease{}, err
+	}
+	return leader.NewLeaseFromMap(doc), nil
+}
+
+func (d *Database) GetLease(name string) (leader.Lease, error) {
+	doc, err := d.GetDoc(LeaseColl, name)
+	if arango.IsNotFound(err) {
+		return leader.Lease{Name: name}, nil
+	} else if err != nil {
+		return leader.Lease{}, err
+	}
+	return leader.NewLeaseFromMap(doc), nil
+}
+
+func (d *Database) ReleaseLease(name, holder string) error {
+	lease, err := d.GetLease(name)
+	if err != nil || lease.Holder != holder {
+		return err
+	}
+	return d.DeleteDoc(LeaseColl, name)
+}
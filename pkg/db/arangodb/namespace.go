@@ -23,8 +23,10 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 package arangodb
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
+	"strconv"
 
 	dbcommon "github.com/MottainaiCI/mottainai-server/pkg/db/common"
 
@@ -72,15 +74,12 @@ func (d *Database) UpdateNamespace(docID string, t map[string]interface{}) error
 
 func (d *Database) SearchNamespace(name string) (namespace.Namespace, error) {
 	queryResult, err := d.FindDoc("", `FOR c IN `+NamespaceColl+`
-		FILTER c.name == "`+name+`"
+		FILTER c.name == `+strconv.Quote(name)+`
 		RETURN c`)
 	if err != nil {
 		return namespace.Namespace{}, err
 	}
 	var res []namespace.Namespace
-	if err != nil {
-		return namespace.Namespace{}, err
-	}
 	// Query result are document IDs
 	for id, _ := range queryResult {
 
@@ -91,6 +90,9 @@ func (d *Database) SearchNamespace(name string) (namespace.Namespace, error) {
 		}
 		res = append(res, art)
 	}
+	if len(res) == 0 {
+		return namespace.Namespace{}, errors.New("No namespaces found")
+	}
 	return res[0], nil
 }
 
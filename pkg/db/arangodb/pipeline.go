@@ -23,6 +23,8 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 package arangodb
 
 import (
+	"strconv"
+
 	dbcommon "github.com/MottainaiCI/mottainai-server/pkg/db/common"
 
 	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
@@ -35,6 +37,8 @@ func (d *Database) IndexPipeline() {
 	d.AddIndex(PipelinesColl, []string{"status"})
 	d.AddIndex(PipelinesColl, []string{"result"})
 	d.AddIndex(PipelinesColl, []string{"result", "status"})
+	d.AddIndex(PipelinesColl, []string{"build_group"})
+	d.AddIndex(PipelinesColl, []string{"pipeline_name"})
 }
 
 func (d *Database) InsertPipeline(t *agenttasks.Pipeline) (string, error) {
@@ -81,6 +85,50 @@ func (d *Database) AllUserPipelines(config *setting.Config, id string) ([]agentt
 	return res, nil
 }
 
+func (d *Database) AllBuildGroupPipelines(config *setting.Config, group string) ([]agenttasks.Pipeline, error) {
+	queryResult, err := d.FindDoc("", `FOR c IN `+PipelinesColl+`
+		FILTER c.build_group == `+strconv.Quote(group)+`
+		RETURN c`)
+	if err != nil {
+		return []agenttasks.Pipeline{}, err
+	}
+	var res []agenttasks.Pipeline
+
+	// Query result are document IDs
+	for id := range queryResult {
+
+		// Read document
+		p, err := d.GetPipeline(config, id)
+		if err != nil {
+			return []agenttasks.Pipeline{}, err
+		}
+		res = append(res, p)
+	}
+	return res, nil
+}
+
+func (d *Database) AllNamePipelines(config *setting.Config, name string) ([]agenttasks.Pipeline, error) {
+	queryResult, err := d.FindDoc("", `FOR c IN `+PipelinesColl+`
+		FILTER c.pipeline_name == `+strconv.Quote(name)+`
+		RETURN c`)
+	if err != nil {
+		return []agenttasks.Pipeline{}, err
+	}
+	var res []agenttasks.Pipeline
+
+	// Query result are document IDs
+	for id := range queryResult {
+
+		// Read document
+		p, err := d.GetPipeline(config, id)
+		if err != nil {
+			return []agenttasks.Pipeline{}, err
+		}
+		res = append(res, p)
+	}
+	return res, nil
+}
+
 func (d *Database) UpdatePipeline(docID string, t map[string]interface{}) error {
 	return d.UpdateDoc(PipelinesColl, docID, t)
 }
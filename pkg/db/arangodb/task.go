@@ -23,13 +23,16 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 package arangodb
 
 import (
+	"context"
 	"errors"
+	"strconv"
 
 	dbcommon "github.com/MottainaiCI/mottainai-server/pkg/db/common"
 	agenttasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
 
 	"github.com/MottainaiCI/mottainai-server/pkg/artefact"
 	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+	arango "github.com/arangodb/go-driver"
 )
 
 var TaskColl = "Tasks"
@@ -41,6 +44,8 @@ func (d *Database) IndexTask() {
 	d.AddIndex(TaskColl, []string{"owner_id"})
 	d.AddIndex(TaskColl, []string{"node_id"})
 	d.AddIndex(TaskColl, []string{"result", "status"})
+	d.AddIndex(TaskColl, []string{"build_group"})
+	d.AddIndex(TaskColl, []string{"tag_namespace"})
 }
 
 func (d *Database) InsertTask(t *agenttasks.Task) (string, error) {
@@ -82,8 +87,47 @@ func (d *Database) DeleteTask(config *setting.Config, docID string) error {
 	return d.DeleteDoc(TaskColl, docID)
 }
 
+// UpdateTask patches the given fields, merged by the server so concurrent
+// updates of different fields don't overwrite each other. The values of the
+// fields are replaced, not merged.
 func (d *Database) UpdateTask(docID string, t map[string]interface{}) error {
-	return d.UpdateDoc(TaskColl, docID, t)
+	col, err := d.UseCol(TaskColl)
+	if err != nil {
+		return err
+	}
+	ctx := arango.WithMergeObjects(context.Background(), false)
+	_, err = col.UpdateDocument(ctx, docID, t)
+	return err
+}
+
+// CompareAndSwapTask updates the task only if its revision is still the
+// given one, and increments it.
+func (d *Database) CompareAndSwapTask(docID string, revision int, t map[string]interface{}) error {
+	query := `FOR t IN ` + TaskColl + `
+FILTER t._key == @key AND NOT_NULL(t.revision, 0) == @revision
+UPDATE t WITH MERGE(@patch, { revision: @revision + 1 }) IN ` + TaskColl + `
+OPTIONS { mergeObjects: false }
+RETURN NEW`
+
+	ctx := context.Background()
+	cursor, err := d.DB().Query(ctx, query, map[string]interface{}{
+		"key":      docID,
+		"revision": revision,
+		"patch":    t,
+	})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close()
+
+	if cursor.HasMore() {
+		return nil
+	}
+	// Either the task doesn't exist or the revision changed
+	if _, err := d.GetDoc(TaskColl, docID); err != nil {
+		return err
+	}
+	return dbcommon.ErrConflict
 }
 
 func (d *Database) GetTask(config *setting.Config, docID string) (agenttasks.Task, error) {
@@ -109,6 +153,14 @@ func (d *Database) GetTaskByStatus(config *setting.Config, status string) ([]age
 		query = `FOR c IN ` + TaskColl + `
 			FILTER c.status == "waiting"
 			RETURN c`
+	case "queued":
+		query = `FOR c IN ` + TaskColl + `
+			FILTER c.status == "queued"
+			RETURN c`
+	case "setup":
+		query = `FOR c IN ` + TaskColl + `
+			FILTER c.status == "setup"
+			RETURN c`
 	case "stop":
 		query = `FOR c IN ` + TaskColl + `
 			FILTER c.status == "stop"
@@ -223,6 +275,52 @@ func (d *Database) AllNodeTask(config *setting.Config, id string) ([]agenttasks.
 
 }
 
+func (d *Database) AllBuildGroupTasks(config *setting.Config, group string) ([]agenttasks.Task, error) {
+	queryResult, err := d.FindDoc("", `FOR c IN `+TaskColl+`
+		FILTER c.build_group == `+strconv.Quote(group)+`
+		RETURN c`)
+
+	var res []agenttasks.Task
+	if err != nil {
+		return res, err
+	}
+
+	// Query result are document IDs
+	for id := range queryResult {
+
+		// Read document
+		t, err := d.GetTask(config, id)
+		if err != nil {
+			return res, err
+		}
+		res = append(res, t)
+	}
+	return res, nil
+}
+
+func (d *Database) AllNamespaceTasks(config *setting.Config, name string) ([]agenttasks.Task, error) {
+	queryResult, err := d.FindDoc("", `FOR c IN `+TaskColl+`
+		FILTER c.tag_namespace == `+strconv.Quote(name)+`
+		RETURN c`)
+
+	var res []agenttasks.Task
+	if err != nil {
+		return res, err
+	}
+
+	// Query result are document IDs
+	for id := range queryResult {
+
+		// Read document
+		t, err := d.GetTask(config, id)
+		if err != nil {
+			return res, err
+		}
+		res = append(res, t)
+	}
+	return res, nil
+}
+
 func (d *Database) AllUserTask(config *setting.Config, id string) ([]agenttasks.Task, error) {
 
 	queryResult, err := d.FindDoc("", `FOR c IN `+TaskColl+`
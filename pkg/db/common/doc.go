@@ -22,7 +22,13 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 
 package dbcommon
 
+import "errors"
+
 type DocItem struct {
 	Id      string
 	Content interface{}
 }
+
+// ErrConflict is returned by the compare-and-swap updates when the document
+// was modified concurrently
+var ErrConflict = errors.New("Document was modified concurrently")
@@ -0,0 +1,128 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package dbcommon
+
+import (
+	"fmt"
+	"sort"
+)
+
+// SchemaStore is the subset of a database driver used by the schema
+// migrations.
+type SchemaStore interface {
+	SchemaVersion() (int, error)
+	SetSchemaVersion(int) error
+	ListDocs(string) []DocItem
+	GetDoc(string, string) (map[string]interface{}, error)
+	ReplaceDoc(string, string, map[string]interface{}) error
+}
+
+// Migration updates the documents stored with the previous schema version.
+// Migrations can run again on documents already migrated (e.g. after
+// restoring an old backup), so they must be idempotent.
+type Migration struct {
+	Version     int
+	Description string
+	Migrate     func(SchemaStore) error
+}
+
+var migrations = make([]Migration, 0)
+
+// RegisterMigration adds a migration to the registry, versions must be unique.
+func RegisterMigration(m Migration) {
+	for _, r := range migrations {
+		if r.Version == m.Version {
+			panic(fmt.Sprintf("Schema migration %d registered twice", m.Version))
+		}
+	}
+	migrations = append(migrations, m)
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+}
+
+// Migrations returns the registered migrations ordered by version.
+func Migrations() []Migration {
+	return migrations
+}
+
+// LatestSchemaVersion returns the schema version of the registered migrations.
+func LatestSchemaVersion() int {
+	if len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+// PendingMigrations returns the migrations not yet applied to the database.
+func PendingMigrations(s SchemaStore) ([]Migration, error) {
+	res := make([]Migration, 0)
+
+	version, err := s.SchemaVersion()
+	if err != nil {
+		return res, err
+	}
+	if version > LatestSchemaVersion() {
+		return res, fmt.Errorf("Database schema version %d is newer than the supported one (%d)",
+			version, LatestSchemaVersion())
+	}
+
+	for _, m := range migrations {
+		if m.Version > version {
+			res = append(res, m)
+		}
+	}
+	return res, nil
+}
+
+// MigrateSchema applies the pending migrations in order, storing the new
+// schema version after each one so an interrupted run resumes from the
+// failed migration. It returns the applied migrations.
+func MigrateSchema(s SchemaStore) ([]Migration, error) {
+	applied := make([]Migration, 0)
+
+	pending, err := PendingMigrations(s)
+	if err != nil {
+		return applied, err
+	}
+
+	for _, m := range pending {
+		if err := m.Migrate(s); err != nil {
+			return applied, fmt.Errorf("Schema migration %d (%s) failed: %s", m.Version, m.Description, err.Error())
+		}
+		if err := s.SetSchemaVersion(m.Version); err != nil {
+			return applied, err
+		}
+		applied = append(applied, m)
+	}
+	return applied, nil
+}
+
+// SchemaVersionFromDoc decodes the version stored in a schema document.
+func SchemaVersionFromDoc(doc map[string]interface{}) int {
+	switch v := doc["version"].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	}
+	return 0
+}
@@ -0,0 +1,101 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package dbcommon
+
+import (
+	"errors"
+	"testing"
+)
+
+type memStore struct {
+	version int
+	docs    map[string]map[string]interface{}
+}
+
+func (m *memStore) SchemaVersion() (int, error)  { return m.version, nil }
+func (m *memStore) SetSchemaVersion(v int) error { m.version = v; return nil }
+
+func (m *memStore) ListDocs(coll string) []DocItem {
+	res := make([]DocItem, 0)
+	for id := range m.docs {
+		res = append(res, DocItem{Id: id})
+	}
+	return res
+}
+
+func (m *memStore) GetDoc(coll, id string) (map[string]interface{}, error) {
+	return m.docs[id], nil
+}
+
+func (m *memStore) ReplaceDoc(coll, id string, t map[string]interface{}) error {
+	m.docs[id] = t
+	return nil
+}
+
+func TestMigrateSchema(t *testing.T) {
+	defer func(old []Migration) { migrations = old }(migrations)
+	migrations = make([]Migration, 0)
+
+	fail := true
+	order := make([]int, 0)
+	RegisterMigration(Migration{Version: 2, Migrate: func(s SchemaStore) error {
+		if fail {
+			return errors.New("failure")
+		}
+		order = append(order, 2)
+		return nil
+	}})
+	RegisterMigration(Migration{Version: 1, Migrate: func(s SchemaStore) error {
+		order = append(order, 1)
+		return nil
+	}})
+	if LatestSchemaVersion() != 2 {
+		t.Error("Unexpected latest version", LatestSchemaVersion())
+	}
+
+	s := &memStore{docs: make(map[string]map[string]interface{})}
+	if _, err := MigrateSchema(s); err == nil {
+		t.Error("Failed migration not reported")
+	}
+	if s.version != 1 {
+		t.Error("Version not stored after the successful migration", s.version)
+	}
+
+	fail = false
+	applied, err := MigrateSchema(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 1 || s.version != 2 || len(order) != 2 || order[0] != 1 || order[1] != 2 {
+		t.Error("Unexpected migrations", applied, order, s.version)
+	}
+
+	if pending, err := PendingMigrations(s); err != nil || len(pending) != 0 {
+		t.Error("Unexpected pending migrations", pending, err)
+	}
+
+	s.version = 3
+	if _, err := MigrateSchema(s); err == nil {
+		t.Error("Newer schema versions must be refused")
+	}
+}
@@ -24,9 +24,12 @@ package database
 
 import (
 	"errors"
+	"time"
 
 	"github.com/MottainaiCI/mottainai-server/pkg/artefact"
 	arango "github.com/MottainaiCI/mottainai-server/pkg/db/arangodb"
+	"github.com/MottainaiCI/mottainai-server/pkg/event"
+	leader "github.com/MottainaiCI/mottainai-server/pkg/leader"
 	"github.com/MottainaiCI/mottainai-server/pkg/namespace"
 	"github.com/MottainaiCI/mottainai-server/pkg/nodes"
 	organization "github.com/MottainaiCI/mottainai-server/pkg/organization"
@@ -46,6 +49,7 @@ import (
 type DatabaseDriver interface {
 	Init()
 	InsertDoc(string, map[string]interface{}) (string, error)
+	InsertDocWithID(string, string, map[string]interface{}) error
 	FindDoc(string, string) (map[string]struct{}, error)
 	DeleteDoc(string, string) error
 	UpdateDoc(string, string, map[string]interface{}) error
@@ -53,6 +57,14 @@ type DatabaseDriver interface {
 	GetDoc(string, string) (map[string]interface{}, error)
 	DropColl(string) error
 	ListDocs(string) []dbcommon.DocItem
+	// Schema
+	SchemaVersion() (int, error)
+	SetSchemaVersion(int) error
+
+	// Leader election
+	AcquireLease(name, holder string, ttl time.Duration) (leader.Lease, error)
+	GetLease(name string) (leader.Lease, error)
+	ReleaseLease(name, holder string) error
 	// Artefacts
 	CreateArtefact(map[string]interface{}) (string, error)
 	DeleteArtefact(string) error
@@ -101,6 +113,8 @@ type DatabaseDriver interface {
 	ClonePipeline(config *setting.Config, t string) (string, error)
 	DeletePipeline(docID string) error
 	AllUserPipelines(config *setting.Config, id string) ([]agenttasks.Pipeline, error)
+	AllBuildGroupPipelines(config *setting.Config, group string) ([]agenttasks.Pipeline, error)
+	AllNamePipelines(config *setting.Config, name string) ([]agenttasks.Pipeline, error)
 	UpdatePipeline(docID string, t map[string]interface{}) error
 	GetPipeline(config *setting.Config, docID string) (agenttasks.Pipeline, error)
 	ListPipelines() []dbcommon.DocItem
@@ -138,12 +152,15 @@ type DatabaseDriver interface {
 	CloneTask(config *setting.Config, t string) (string, error)
 	DeleteTask(config *setting.Config, docID string) error
 	UpdateTask(docID string, t map[string]interface{}) error
+	CompareAndSwapTask(docID string, revision int, t map[string]interface{}) error
 	GetTask(config *setting.Config, docID string) (agenttasks.Task, error)
 	GetTaskArtefacts(id string) ([]artefact.Artefact, error)
 	ListTasks() []dbcommon.DocItem
 	AllTasks(config *setting.Config) []agenttasks.Task
 	AllUserTask(config *setting.Config, id string) ([]agenttasks.Task, error)
 	AllNodeTask(config *setting.Config, id string) ([]agenttasks.Task, error)
+	AllBuildGroupTasks(config *setting.Config, group string) ([]agenttasks.Task, error)
+	AllNamespaceTasks(config *setting.Config, name string) ([]agenttasks.Task, error)
 	GetTaskByStatus(*setting.Config, string) ([]agenttasks.Task, error)
 
 	// Token
@@ -191,6 +208,16 @@ type DatabaseDriver interface {
 	ListPlans() []dbcommon.DocItem
 	AllPlans(config *setting.Config) []agenttasks.Plan
 
+	// Task templates
+	InsertTaskTemplate(t *agenttasks.TaskTemplate) (string, error)
+	CreateTaskTemplate(t map[string]interface{}) (string, error)
+	DeleteTaskTemplate(docID string) error
+	UpdateTaskTemplate(docID string, t map[string]interface{}) error
+	GetTaskTemplate(docID string) (agenttasks.TaskTemplate, error)
+	GetTaskTemplatesByName(name string) ([]agenttasks.TaskTemplate, error)
+	ListTaskTemplates() []dbcommon.DocItem
+	AllTaskTemplates() []agenttasks.TaskTemplate
+
 	// WebHook
 	InsertWebHook(t *webhook.WebHook) (string, error)
 	CreateWebHook(t map[string]interface{}) (string, error)
@@ -228,6 +255,14 @@ type DatabaseDriver interface {
 	CountSecrets() int
 	AllSecrets() []secret.Secret
 
+	// Event subscriptions
+	InsertEventSubscription(s *event.Subscription) (string, error)
+	CreateEventSubscription(t map[string]interface{}) (string, error)
+	DeleteEventSubscription(docID string) error
+	UpdateEventSubscription(docID string, t map[string]interface{}) error
+	GetEventSubscription(docID string) (event.Subscription, error)
+	AllEventSubscriptions() []event.Subscription
+
 	// TODO: See if it's correct expone this as method
 	GetAgent() *anagent.Anagent
 }
@@ -241,30 +276,39 @@ type Database struct {
 	Driver  DatabaseDriver
 	// TODO: Temporary insert Config. See if add a ConfigDatabase object.
 	Config *setting.Config
+
+	// Bus of the events of the server, nil outside of it, see SetEvents
+	Events *event.Bus
 }
 
 var DBInstance *Database
 
-func NewDatabase(config *setting.Config) *Database {
-	if DBInstance == nil {
-		DBInstance = &Database{Backend: config.GetDatabase().DBEngine, Config: config}
-	}
-	// TODO: refactor this
-	switch config.GetDatabase().DBEngine {
+// NewDriver returns the driver of the given engine configured with the
+// database settings.
+func NewDriver(config *setting.Config, engine string) (DatabaseDriver, error) {
+	switch engine {
 	case "tiedot":
-		DBInstance.Driver = tiedot.New(config.GetDatabase().DBPath)
+		return tiedot.New(config.GetDatabase().DBPath), nil
 	case "arangodb":
-		DBInstance.Driver = arango.New(config.GetDatabase().DatabaseName,
+		return arango.New(config.GetDatabase().DatabaseName,
 			config.GetDatabase().User, config.GetDatabase().Password,
 			config.GetDatabase().CertPath, config.GetDatabase().KeyPath,
-			config.GetDatabase().Endpoints)
+			config.GetDatabase().Endpoints), nil
 	default:
-		panic(errors.New("Invalid engine defined: '" + config.GetDatabase().DBEngine + "'"))
+		return nil, errors.New("Invalid engine defined: '" + engine + "'")
+	}
+}
+
+func NewDatabase(config *setting.Config) *Database {
+	if DBInstance == nil {
+		DBInstance = &Database{Backend: config.GetDatabase().DBEngine, Config: config}
 	}
 
-	if DBInstance.Driver == nil {
-		panic(errors.New("Error on initialize Database Driver"))
+	driver, err := NewDriver(config, config.GetDatabase().DBEngine)
+	if err != nil {
+		panic(err)
 	}
+	DBInstance.Driver = driver
 
 	DBInstance.Driver.GetAgent().Map(config)
 	DBInstance.Driver.Init()
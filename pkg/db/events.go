@@ -0,0 +1,171 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package database
+
+import (
+	"github.com/MottainaiCI/mottainai-server/pkg/event"
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+	agenttasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+)
+
+// eventDriver publishes the events of the tasks and of the artefacts written
+// through the driver, whichever route writes them.
+type eventDriver struct {
+	DatabaseDriver
+	bus    *event.Bus
+	config *setting.Config
+}
+
+// SetEvents publishes on the bus the events of the writes to the database.
+func (d *Database) SetEvents(bus *event.Bus) {
+	d.Events = bus
+	if ed, ok := d.Driver.(*eventDriver); ok {
+		ed.bus = bus
+		return
+	}
+	d.Driver = &eventDriver{DatabaseDriver: d.Driver, bus: bus, config: d.Config}
+}
+
+// TaskEventData returns the data of the events of a task.
+func TaskEventData(t agenttasks.Task) map[string]interface{} {
+	return map[string]interface{}{
+		"id":          t.ID,
+		"name":        t.Name,
+		"owner_id":    t.Owner,
+		"pipeline_id": t.PipelineID,
+		"queue":       t.Queue,
+		"node_id":     t.Node,
+		"status":      t.Status,
+		"result":      t.Result,
+		"exit_status": t.ExitStatus,
+	}
+}
+
+func (d *eventDriver) taskCreated(t agenttasks.Task) {
+	d.bus.Publish(event.TASK_CREATED, TaskEventData(t))
+}
+
+// statusChanged publishes the events of a task moved from a status to
+// another.
+func (d *eventDriver) statusChanged(docID, from, to string) {
+	if from == to {
+		return
+	}
+	t, err := d.DatabaseDriver.GetTask(d.config, docID)
+	if err != nil {
+		return
+	}
+
+	data := TaskEventData(t)
+	data["from"] = from
+	d.bus.Publish(event.TASK_STATUS_CHANGED, data)
+	if to == setting.TASK_STATE_RUNNING {
+		d.bus.Publish(event.TASK_STARTED, TaskEventData(t))
+	} else if agenttasks.IsFinalState(to) {
+		d.bus.Publish(event.TASK_FINISHED, TaskEventData(t))
+	}
+}
+
+// currentStatus returns the status of the task before an update changing
+// it, and false if the update leaves it as is.
+func (d *eventDriver) currentStatus(docID string, update map[string]interface{}) (string, bool) {
+	if _, ok := update["status"].(string); !ok {
+		return "", false
+	}
+	t, err := d.DatabaseDriver.GetTask(d.config, docID)
+	if err != nil {
+		return "", false
+	}
+	return t.Status, true
+}
+
+func (d *eventDriver) InsertTask(t *agenttasks.Task) (string, error) {
+	id, err := d.DatabaseDriver.InsertTask(t)
+	if err == nil {
+		task := *t
+		task.ID = id
+		d.taskCreated(task)
+	}
+	return id, err
+}
+
+func (d *eventDriver) CreateTask(t map[string]interface{}) (string, error) {
+	id, err := d.DatabaseDriver.CreateTask(t)
+	if err == nil {
+		task := agenttasks.NewTaskFromMap(t)
+		task.ID = id
+		d.taskCreated(task)
+	}
+	return id, err
+}
+
+func (d *eventDriver) CloneTask(config *setting.Config, t string) (string, error) {
+	id, err := d.DatabaseDriver.CloneTask(config, t)
+	if err == nil {
+		if task, err := d.DatabaseDriver.GetTask(config, id); err == nil {
+			d.taskCreated(task)
+		}
+	}
+	return id, err
+}
+
+func (d *eventDriver) UpdateTask(docID string, t map[string]interface{}) error {
+	from, changes := d.currentStatus(docID, t)
+	err := d.DatabaseDriver.UpdateTask(docID, t)
+	if err == nil && changes {
+		d.statusChanged(docID, from, t["status"].(string))
+	}
+	return err
+}
+
+func (d *eventDriver) CompareAndSwapTask(docID string, revision int, t map[string]interface{}) error {
+	from, changes := d.currentStatus(docID, t)
+	err := d.DatabaseDriver.CompareAndSwapTask(docID, revision, t)
+	if err == nil && changes {
+		d.statusChanged(docID, from, t["status"].(string))
+	}
+	return err
+}
+
+func (d *eventDriver) CreateArtefact(t map[string]interface{}) (string, error) {
+	id, err := d.DatabaseDriver.CreateArtefact(t)
+	if err == nil {
+		d.bus.Publish(event.ARTEFACT_UPLOADED, map[string]interface{}{
+			"id":      id,
+			"name":    t["name"],
+			"path":    t["path"],
+			"task_id": t["task"],
+		})
+	}
+	return id, err
+}
+
+// NamespaceTagged publishes the artefacts of a task published to a
+// namespace, either replacing its content or appended to it.
+func (d *Database) NamespaceTagged(name, taskID string, appended bool) {
+	d.Events.Publish(event.NAMESPACE_TAGGED, map[string]interface{}{
+		"namespace": name,
+		"task_id":   taskID,
+		"append":    appended,
+	})
+}
@@ -0,0 +1,125 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	tiedot "github.com/MottainaiCI/mottainai-server/pkg/db/tiedot"
+)
+
+type MigrateOptions struct {
+	// Only read the source and check the target, without writing documents
+	DryRun bool
+	// Skip the documents already copied by a previous run
+	Resume bool
+}
+
+// CollectionReport describes the migration of a collection.
+type CollectionReport struct {
+	Collection string
+	Source     int
+	Copied     int
+	Skipped    int
+	Target     int
+}
+
+// Migrate copies all the collections from a driver to another. Document IDs
+// are preserved, so references between documents (task->pipeline,
+// token->user, ...) stay valid without rewriting them.
+func Migrate(from, to DatabaseDriver, opts MigrateOptions) ([]CollectionReport, error) {
+	reports := make([]CollectionReport, 0)
+
+	for _, coll := range tiedot.Collections {
+		report, err := migrateCollection(from, to, coll, opts)
+		reports = append(reports, report)
+		if err != nil {
+			return reports, err
+		}
+	}
+
+	return reports, nil
+}
+
+func migrateCollection(from, to DatabaseDriver, coll string, opts MigrateOptions) (CollectionReport, error) {
+	report := CollectionReport{Collection: coll}
+
+	docs := from.ListDocs(coll)
+	report.Source = len(docs)
+
+	existing := make(map[string]bool)
+	for _, d := range to.ListDocs(coll) {
+		existing[d.Id] = true
+	}
+	report.Target = len(existing)
+
+	if len(existing) > 0 && !opts.Resume {
+		return report, fmt.Errorf("Collection %s is not empty on the target database, use resume to continue a previous migration", coll)
+	}
+
+	for _, d := range docs {
+		if existing[d.Id] {
+			report.Skipped++
+			continue
+		}
+
+		doc, err := from.GetDoc(coll, d.Id)
+		if err != nil {
+			return report, fmt.Errorf("Failed reading document %s from %s: %s", d.Id, coll, err.Error())
+		}
+		// Drop the metadata of the source engine
+		for k := range doc {
+			if strings.HasPrefix(k, "_") {
+				delete(doc, k)
+			}
+		}
+
+		if opts.DryRun {
+			if _, ok := to.(*tiedot.Database); ok {
+				if _, err := strconv.Atoi(d.Id); err != nil {
+					return report, fmt.Errorf("Document %s of %s can't be copied: tiedot supports only numeric IDs", d.Id, coll)
+				}
+			}
+			report.Copied++
+			continue
+		}
+		if err := to.InsertDocWithID(coll, d.Id, doc); err != nil {
+			return report, fmt.Errorf("Failed copying document %s of %s: %s", d.Id, coll, err.Error())
+		}
+		report.Copied++
+	}
+
+	if opts.DryRun {
+		return report, nil
+	}
+
+	report.Target = len(to.ListDocs(coll))
+	if report.Target != report.Source {
+		return report, fmt.Errorf("Count mismatch on %s: %d documents in the source, %d in the target",
+			coll, report.Source, report.Target)
+	}
+
+	return report, nil
+}
@@ -0,0 +1,141 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package database
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"testing"
+
+	dbcommon "github.com/MottainaiCI/mottainai-server/pkg/db/common"
+	tiedot "github.com/MottainaiCI/mottainai-server/pkg/db/tiedot"
+)
+
+// memDriver implements the document primitives used by the migration
+type memDriver struct {
+	DatabaseDriver
+	colls map[string]map[string]map[string]interface{}
+}
+
+func newMemDriver() *memDriver {
+	return &memDriver{colls: make(map[string]map[string]map[string]interface{})}
+}
+
+func (m *memDriver) ListDocs(coll string) []dbcommon.DocItem {
+	res := make([]dbcommon.DocItem, 0)
+	for id := range m.colls[coll] {
+		res = append(res, dbcommon.DocItem{Id: id})
+	}
+	return res
+}
+
+func (m *memDriver) GetDoc(coll, id string) (map[string]interface{}, error) {
+	doc := make(map[string]interface{})
+	for k, v := range m.colls[coll][id] {
+		doc[k] = v
+	}
+	return doc, nil
+}
+
+func (m *memDriver) InsertDocWithID(coll, id string, t map[string]interface{}) error {
+	if _, ok := m.colls[coll]; !ok {
+		m.colls[coll] = make(map[string]map[string]interface{})
+	}
+	m.colls[coll][id] = t
+	return nil
+}
+
+func TestMigrate(t *testing.T) {
+	src := newMemDriver()
+	dst := newMemDriver()
+
+	for i := 0; i < 10; i++ {
+		src.InsertDocWithID(tiedot.TaskColl, strconv.Itoa(i), map[string]interface{}{
+			"pipeline_id": "1", "_key": strconv.Itoa(i)})
+	}
+	src.InsertDocWithID(tiedot.PipelinesColl, "1", map[string]interface{}{"name": "foo"})
+
+	reports, err := Migrate(src, dst, MigrateOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != len(tiedot.Collections) || len(dst.colls) != 0 {
+		t.Error("Dry run wrote documents", dst.colls)
+	}
+
+	// Simulate an interrupted migration
+	dst.InsertDocWithID(tiedot.TaskColl, "3", map[string]interface{}{"pipeline_id": "1"})
+	if _, err := Migrate(src, dst, MigrateOptions{}); err == nil {
+		t.Error("Migration on a non empty target should fail without resume")
+	}
+
+	reports, err = Migrate(src, dst, MigrateOptions{Resume: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range reports {
+		if r.Collection == tiedot.TaskColl && (r.Copied != 9 || r.Skipped != 1 || r.Target != 10) {
+			t.Error("Unexpected report", r)
+		}
+	}
+
+	doc, _ := dst.GetDoc(tiedot.TaskColl, "5")
+	if doc["pipeline_id"] != "1" {
+		t.Error("Document not copied", doc)
+	}
+	if _, ok := doc["_key"]; ok {
+		t.Error("Source metadata copied", doc)
+	}
+}
+
+func TestMigrateDryRunUninitialized(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrate_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := newMemDriver()
+	src.InsertDocWithID(tiedot.TaskColl, "1", map[string]interface{}{"name": "foo"})
+
+	// The dry run doesn't initialize the target, its collections are missing
+	dst := tiedot.New(dir)
+	reports, err := Migrate(src, dst, MigrateOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range reports {
+		if r.Collection == tiedot.TaskColl && (r.Copied != 1 || r.Target != 0) {
+			t.Error("Unexpected report", r)
+		}
+	}
+	if cols := dst.DB().AllCols(); len(cols) != 0 {
+		t.Error("Dry run created collections", cols)
+	}
+
+	pending, err := dbcommon.PendingMigrations(dst)
+	if err != nil || len(pending) != len(dbcommon.Migrations()) {
+		t.Error("Expected all the migrations pending", pending, err)
+	}
+}
@@ -0,0 +1,60 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package database
+
+import (
+	"github.com/MottainaiCI/mottainai-server/pkg/namespace"
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+	agenttasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+)
+
+// FindNamespace returns the namespace document with the given name, if any.
+// Namespaces without a document are plain directories of the storage.
+func (d *Database) FindNamespace(name string) (namespace.Namespace, bool) {
+	ns, err := d.Driver.SearchNamespace(name)
+	if err != nil {
+		return namespace.Namespace{}, false
+	}
+	return ns, true
+}
+
+// LastNamespaceTag returns the task which published the content of the
+// namespace the last time, nil if none.
+func (d *Database) LastNamespaceTag(name string) (*agenttasks.Task, error) {
+	tasks, err := d.Driver.AllNamespaceTasks(d.Config, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var last *agenttasks.Task
+	for _, t := range tasks {
+		if t.Status != setting.TASK_STATE_DONE || !t.IsSuccess() {
+			continue
+		}
+		if last == nil || t.EndTime > last.EndTime {
+			task := t
+			last = &task
+		}
+	}
+	return last, nil
+}
@@ -0,0 +1,98 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package database
+
+import (
+	"sort"
+
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+	agenttasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+)
+
+// States of the tasks holding the lock of the namespace they publish to
+var namespaceHolderStates = []string{
+	setting.TASK_STATE_WAIT,
+	setting.TASK_STATE_SETUP,
+	setting.TASK_STATE_RUNNING,
+	setting.TASK_STATE_ASK_STOP,
+}
+
+// NamespaceHolders returns the tasks publishing to the namespace which
+// are still in progress.
+func (d *Database) NamespaceHolders(namespace string) ([]agenttasks.Task, error) {
+	holders := make([]agenttasks.Task, 0)
+	for _, status := range namespaceHolderStates {
+		tasks, err := d.Driver.GetTaskByStatus(d.Config, status)
+		if err != nil {
+			return holders, err
+		}
+		for _, t := range tasks {
+			if t.TagNamespace == namespace {
+				holders = append(holders, t)
+			}
+		}
+	}
+	return holders, nil
+}
+
+// NamespaceQueue returns the tasks queued behind the lock of the given
+// namespace, in the order they will be sent. With an empty namespace the
+// queued tasks of all the namespaces are returned.
+func (d *Database) NamespaceQueue(namespace string) ([]agenttasks.Task, error) {
+	tasks, err := d.Driver.GetTaskByStatus(d.Config, setting.TASK_STATE_QUEUED)
+	if err != nil {
+		return nil, err
+	}
+
+	queue := make([]agenttasks.Task, 0)
+	for _, t := range tasks {
+		if len(namespace) == 0 || t.TagNamespace == namespace {
+			queue = append(queue, t)
+		}
+	}
+	sort.SliceStable(queue, func(i, j int) bool {
+		if queue[i].QueuedTime == queue[j].QueuedTime {
+			return queue[i].ID < queue[j].ID
+		}
+		return queue[i].QueuedTime < queue[j].QueuedTime
+	})
+	return queue, nil
+}
+
+// QueuePosition returns the position (starting from 1) of the task in the
+// queue of its namespace, or 0 if it isn't queued.
+func (d *Database) QueuePosition(task agenttasks.Task) (int, error) {
+	if !task.IsQueued() {
+		return 0, nil
+	}
+	queue, err := d.NamespaceQueue(task.TagNamespace)
+	if err != nil {
+		return 0, err
+	}
+	for i, t := range queue {
+		if t.ID == task.ID {
+			return i + 1, nil
+		}
+	}
+	return 0, nil
+}
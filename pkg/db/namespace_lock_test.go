@@ -0,0 +1,93 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package database
+
+import (
+	"testing"
+
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+	agenttasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+)
+
+// statusDriver returns the given tasks filtered by status or namespace
+type statusDriver struct {
+	DatabaseDriver
+	tasks []agenttasks.Task
+}
+
+func (s *statusDriver) GetTaskByStatus(config *setting.Config, status string) ([]agenttasks.Task, error) {
+	res := make([]agenttasks.Task, 0)
+	for _, t := range s.tasks {
+		if t.Status == status {
+			res = append(res, t)
+		}
+	}
+	return res, nil
+}
+
+func (s *statusDriver) AllNamespaceTasks(config *setting.Config, name string) ([]agenttasks.Task, error) {
+	res := make([]agenttasks.Task, 0)
+	for _, t := range s.tasks {
+		if t.TagNamespace == name {
+			res = append(res, t)
+		}
+	}
+	return res, nil
+}
+
+func TestNamespaceQueue(t *testing.T) {
+	d := &Database{Driver: &statusDriver{tasks: []agenttasks.Task{
+		{ID: "1", TagNamespace: "foo", Status: setting.TASK_STATE_RUNNING},
+		{ID: "2", TagNamespace: "foo", Status: setting.TASK_STATE_QUEUED, QueuedTime: "20200101000000.000000002"},
+		{ID: "3", TagNamespace: "foo", Status: setting.TASK_STATE_QUEUED, QueuedTime: "20200101000000.000000001"},
+		{ID: "4", TagNamespace: "bar", Status: setting.TASK_STATE_QUEUED, QueuedTime: "20200101000000.000000000"},
+		{ID: "5", TagNamespace: "bar", Status: setting.TASK_STATE_DONE},
+	}}}
+
+	holders, err := d.NamespaceHolders("foo")
+	if err != nil || len(holders) != 1 || holders[0].ID != "1" {
+		t.Error("Expected task 1 holding the namespace", holders, err)
+	}
+	if holders, _ := d.NamespaceHolders("bar"); len(holders) != 0 {
+		t.Error("Expected no holders", holders)
+	}
+
+	queue, err := d.NamespaceQueue("foo")
+	if err != nil || len(queue) != 2 || queue[0].ID != "3" || queue[1].ID != "2" {
+		t.Error("Unexpected queue", queue, err)
+	}
+	if queue, _ := d.NamespaceQueue(""); len(queue) != 3 || queue[0].ID != "4" {
+		t.Error("Unexpected queue", queue)
+	}
+
+	for task, pos := range map[string]int{"1": 0, "2": 2, "3": 1, "4": 1} {
+		for _, tk := range d.Driver.(*statusDriver).tasks {
+			if tk.ID != task {
+				continue
+			}
+			if p, err := d.QueuePosition(tk); err != nil || p != pos {
+				t.Errorf("Task %s should be at position %d, got %d", task, pos, p)
+			}
+		}
+	}
+}
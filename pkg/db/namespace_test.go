@@ -0,0 +1,47 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package database
+
+import (
+	"testing"
+
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+	agenttasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+)
+
+func TestLastNamespaceTag(t *testing.T) {
+	d := &Database{Driver: &statusDriver{tasks: []agenttasks.Task{
+		{ID: "1", TagNamespace: "foo", Status: setting.TASK_STATE_DONE, ExitStatus: "0", EndTime: "20200101000000"},
+		{ID: "2", TagNamespace: "foo", Status: setting.TASK_STATE_DONE, ExitStatus: "0", EndTime: "20200102000000"},
+		{ID: "3", TagNamespace: "foo", Status: setting.TASK_STATE_DONE, ExitStatus: "1", EndTime: "20200103000000"},
+		{ID: "4", TagNamespace: "foo", Status: setting.TASK_STATE_RUNNING},
+		{ID: "5", TagNamespace: "bar", Status: setting.TASK_STATE_DONE, ExitStatus: "0", EndTime: "20200104000000"},
+	}}}
+
+	if last, err := d.LastNamespaceTag("foo"); err != nil || last == nil || last.ID != "2" {
+		t.Error("Expected task 2 as the last tag", last, err)
+	}
+	if last, err := d.LastNamespaceTag("baz"); err != nil || last != nil {
+		t.Error("Expected no tags", last, err)
+	}
+}
@@ -0,0 +1,81 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package database
+
+import (
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+	agenttasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+)
+
+// CreatePipelineWithTasks creates the tasks of the pipeline, waiting to be
+// sent by ProcessPipeline, and the pipeline document. The IDs of the new
+// tasks are set in the pipeline, the ID of the pipeline is returned.
+func (d *Database) CreatePipelineWithTasks(pip *agenttasks.Pipeline) (string, error) {
+	for i := range pip.Tasks {
+		t := pip.Tasks[i]
+		t.Status = setting.TASK_STATE_WAIT
+
+		id, err := d.Driver.CreateTask(t.ToMap())
+		if err != nil {
+			return "", err
+		}
+		t.ID = id
+		pip.Tasks[i] = t
+	}
+
+	docID, err := d.Driver.CreatePipeline(pip.ToMap(false))
+	if err != nil {
+		return "", err
+	}
+
+	// Update pipeline ID in every tasks
+	for _, t := range pip.Tasks {
+		err := d.Driver.UpdateTask(t.ID, map[string]interface{}{
+			"pipeline_id": docID,
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	return docID, nil
+}
+
+// LatestPipeline returns the latest pipeline created with the given name, nil
+// if none.
+func (d *Database) LatestPipeline(name string) *agenttasks.Pipeline {
+	pipelines, err := d.Driver.AllNamePipelines(d.Config, name)
+	if err != nil {
+		return nil
+	}
+
+	var latest *agenttasks.Pipeline
+	for _, p := range pipelines {
+		// The creation times sort as strings, the IDs break the ties
+		if latest == nil || p.CreatedTime > latest.CreatedTime ||
+			(p.CreatedTime == latest.CreatedTime && p.ID > latest.ID) {
+			pip := p
+			latest = &pip
+		}
+	}
+	return latest
+}
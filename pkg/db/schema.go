@@ -0,0 +1,148 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package database
+
+import (
+	"strings"
+
+	dbcommon "github.com/MottainaiCI/mottainai-server/pkg/db/common"
+	tiedot "github.com/MottainaiCI/mottainai-server/pkg/db/tiedot"
+	webhook "github.com/MottainaiCI/mottainai-server/pkg/webhook"
+)
+
+// Schema migrations, append new ones with the next version number and never
+// change the ones already released.
+func init() {
+	dbcommon.RegisterMigration(dbcommon.Migration{
+		Version:     1,
+		Description: "Add labels, draining state and reports to nodes",
+		Migrate: func(s dbcommon.SchemaStore) error {
+			return setDefaults(s, tiedot.NodeColl, map[string]interface{}{
+				"labels":        map[string]interface{}{},
+				"private_queue": "",
+				"draining":      false,
+				"report":        map[string]interface{}{},
+				"history":       []interface{}{},
+			})
+		},
+	})
+	dbcommon.RegisterMigration(dbcommon.Migration{
+		Version:     2,
+		Description: "Add the node selector to tasks",
+		Migrate: func(s dbcommon.SchemaStore) error {
+			return setDefaults(s, tiedot.TaskColl, map[string]interface{}{
+				"node_selector": []interface{}{},
+			})
+		},
+	})
+	dbcommon.RegisterMigration(dbcommon.Migration{
+		Version:     3,
+		Description: "Add the revision to tasks",
+		Migrate: func(s dbcommon.SchemaStore) error {
+			return setDefaults(s, tiedot.TaskColl, map[string]interface{}{
+				"revision": 0,
+			})
+		},
+	})
+	dbcommon.RegisterMigration(dbcommon.Migration{
+		Version:     4,
+		Description: "Store the webhook default tasks and pipelines as documents",
+		Migrate:     migrateWebHookDefaults,
+	})
+}
+
+// setDefaults adds the missing fields to all the documents of a collection.
+func setDefaults(s dbcommon.SchemaStore, coll string, defaults map[string]interface{}) error {
+	for _, item := range s.ListDocs(coll) {
+		doc, err := s.GetDoc(coll, item.Id)
+		if err != nil {
+			return err
+		}
+
+		changed := false
+		for k, v := range defaults {
+			if _, ok := doc[k]; !ok {
+				doc[k] = v
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+
+		if err := replaceDoc(s, coll, item.Id, doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceDoc stores the document without the fields handled by the driver.
+func replaceDoc(s dbcommon.SchemaStore, coll, id string, doc map[string]interface{}) error {
+	for k := range doc {
+		if strings.HasPrefix(k, "_") {
+			delete(doc, k)
+		}
+	}
+	return s.ReplaceDoc(coll, id, doc)
+}
+
+// migrateWebHookDefaults decodes the default tasks and pipelines of the
+// webhooks, previously stored as gob blobs. Blobs which can't be decoded are
+// moved to the legacy_ fields, to be recovered by hand.
+func migrateWebHookDefaults(s dbcommon.SchemaStore) error {
+	for _, item := range s.ListDocs(tiedot.WebHookColl) {
+		doc, err := s.GetDoc(tiedot.WebHookColl, item.Id)
+		if err != nil {
+			return err
+		}
+
+		changed := false
+		if blob, ok := doc["default_task"].(string); ok {
+			doc["default_task"] = nil
+			if t, err := webhook.DecodeLegacyTask(blob); err == nil {
+				doc["default_task"] = t.ToMap()
+			} else if len(blob) > 0 {
+				doc["legacy_default_task"] = blob
+			}
+			changed = true
+		}
+		if blob, ok := doc["default_pipeline"].(string); ok {
+			doc["default_pipeline"] = nil
+			if p, err := webhook.DecodeLegacyPipeline(blob); err == nil {
+				doc["default_pipeline"] = p.ToMap(true)
+			} else if len(blob) > 0 {
+				doc["legacy_default_pipeline"] = blob
+			}
+			changed = true
+		}
+		if !changed {
+			continue
+		}
+
+		if err := replaceDoc(s, tiedot.WebHookColl, item.Id, doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
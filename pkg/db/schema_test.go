@@ -0,0 +1,98 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package database
+
+import (
+	"encoding/json"
+	"testing"
+
+	tiedot "github.com/MottainaiCI/mottainai-server/pkg/db/tiedot"
+	agenttasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+	"github.com/MottainaiCI/mottainai-server/pkg/utils"
+	webhook "github.com/MottainaiCI/mottainai-server/pkg/webhook"
+)
+
+// ReplaceDoc round-trips the document through JSON, like the real drivers
+func (m *memDriver) ReplaceDoc(coll, id string, t map[string]interface{}) error {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	doc := make(map[string]interface{})
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return err
+	}
+	return m.InsertDocWithID(coll, id, doc)
+}
+
+func TestMigrateWebHookDefaults(t *testing.T) {
+	d := newMemDriver()
+
+	task, err := utils.SerializeToString(&agenttasks.Task{Name: "build", Script: []string{"make"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipeline, err := utils.SerializeToString(&agenttasks.Pipeline{
+		Name:  "deploy",
+		Tasks: map[string]agenttasks.Task{"up": {Image: "alpine"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d.InsertDocWithID(tiedot.WebHookColl, "1", map[string]interface{}{
+		"name": "gob", "default_task": task, "default_pipeline": pipeline, "_key": "1"})
+	d.InsertDocWithID(tiedot.WebHookColl, "2", map[string]interface{}{
+		"name": "empty", "default_task": "", "default_pipeline": ""})
+	d.InsertDocWithID(tiedot.WebHookColl, "3", map[string]interface{}{
+		"name": "broken", "default_task": "Zm9v"})
+
+	// Migrations must be idempotent
+	for i := 0; i < 2; i++ {
+		if err := migrateWebHookDefaults(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	doc, _ := d.GetDoc(tiedot.WebHookColl, "1")
+	if _, ok := doc["_key"]; ok {
+		t.Error("Driver fields should be stripped")
+	}
+	w := webhook.NewWebHookFromMap(doc)
+	if !w.HasTask() || w.Task.Name != "build" || len(w.Task.Script) != 1 {
+		t.Error("Task not migrated", w.Task)
+	}
+	if !w.HasPipeline() || w.Pipeline.Name != "deploy" || w.Pipeline.Tasks["up"].Image != "alpine" {
+		t.Error("Pipeline not migrated", w.Pipeline)
+	}
+
+	doc, _ = d.GetDoc(tiedot.WebHookColl, "2")
+	if w := webhook.NewWebHookFromMap(doc); w.HasTask() || w.HasPipeline() {
+		t.Error("Empty blobs should be dropped", doc)
+	}
+
+	doc, _ = d.GetDoc(tiedot.WebHookColl, "3")
+	if doc["default_task"] != nil || doc["legacy_default_task"] != "Zm9v" {
+		t.Error("Broken blobs should be moved aside", doc)
+	}
+}
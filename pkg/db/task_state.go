@@ -0,0 +1,88 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package database
+
+import (
+	dbcommon "github.com/MottainaiCI/mottainai-server/pkg/db/common"
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+	agenttasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+)
+
+// Compare-and-swap attempts of a task transition before giving up
+const TASK_TRANSITION_RETRIES = 5
+
+// TransitionTask moves a task to the given status, updating also the given
+// fields. The transition is checked against the task state machine and
+// applied with a compare-and-swap on the task revision, so concurrent
+// updates can't bring the task to an illegal state. Conflicts are reported
+// with an *agenttasks.TransitionError or dbcommon.ErrConflict, see IsConflict.
+func (d *Database) TransitionTask(docID, status string, fields map[string]interface{}) error {
+	for i := 0; i < TASK_TRANSITION_RETRIES; i++ {
+		task, err := d.Driver.GetTask(d.Config, docID)
+		if err != nil {
+			return err
+		}
+		task.ID = docID
+		if err := task.Transition(status); err != nil {
+			return err
+		}
+
+		update := map[string]interface{}{"status": status}
+		for k, v := range fields {
+			update[k] = v
+		}
+		err = d.Driver.CompareAndSwapTask(docID, task.Revision, update)
+		if err != dbcommon.ErrConflict {
+			return err
+		}
+	}
+	return dbcommon.ErrConflict
+}
+
+// StopTask asks the agent running the task to stop it. Queued tasks aren't
+// handled by any agent yet, so they are stopped right away. Stopping a task
+// which already ended is a no-op.
+func (d *Database) StopTask(docID string) error {
+	task, err := d.Driver.GetTask(d.Config, docID)
+	if err != nil {
+		return err
+	}
+	if agenttasks.IsFinalState(task.Status) {
+		return nil
+	}
+
+	status := setting.TASK_STATE_ASK_STOP
+	if task.IsQueued() {
+		status = setting.TASK_STATE_STOPPED
+	}
+	return d.TransitionTask(docID, status, nil)
+}
+
+// IsConflict returns true if the error is due to a conflicting task update.
+func IsConflict(err error) bool {
+	if err == dbcommon.ErrConflict {
+		return true
+	}
+	_, ok := err.(*agenttasks.TransitionError)
+	return ok
+}
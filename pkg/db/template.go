@@ -0,0 +1,79 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package database
+
+import (
+	"errors"
+	"time"
+
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+	agenttasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+)
+
+// latestTaskTemplate returns the template with the highest version among
+// the given ones.
+func latestTaskTemplate(templates []agenttasks.TaskTemplate) (agenttasks.TaskTemplate, bool) {
+	var latest agenttasks.TaskTemplate
+	found := false
+	for _, t := range templates {
+		if !found || t.Version > latest.Version {
+			latest = t
+			found = true
+		}
+	}
+	return latest, found
+}
+
+// GetTaskTemplateByRef returns the template with the given ID or, given a
+// template name, the latest version of it. Plans and webhooks referencing a
+// template by name follow its new versions, by ID they stick to one.
+func (d *Database) GetTaskTemplateByRef(ref string) (agenttasks.TaskTemplate, error) {
+	if t, err := d.Driver.GetTaskTemplate(ref); err == nil {
+		return t, nil
+	}
+
+	templates, err := d.Driver.GetTaskTemplatesByName(ref)
+	if err != nil {
+		return agenttasks.TaskTemplate{}, err
+	}
+	if t, ok := latestTaskTemplate(templates); ok {
+		return t, nil
+	}
+	return agenttasks.TaskTemplate{}, errors.New("No task template found: " + ref)
+}
+
+// CreateTaskTemplateVersion stores the template as the next version of the
+// templates with the same name, returning its ID.
+func (d *Database) CreateTaskTemplateVersion(t *agenttasks.TaskTemplate) (string, error) {
+	templates, err := d.Driver.GetTaskTemplatesByName(t.Name)
+	if err != nil {
+		return "", err
+	}
+
+	t.Version = 1
+	if latest, ok := latestTaskTemplate(templates); ok {
+		t.Version = latest.Version + 1
+	}
+	t.CreatedTime = time.Now().Format(setting.Timeformat)
+	return d.Driver.InsertTaskTemplate(t)
+}
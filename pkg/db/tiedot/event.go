@@ -0,0 +1,73 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package tiedot
+
+import (
+	"strconv"
+
+	"github.com/MottainaiCI/mottainai-server/pkg/event"
+)
+
+var EventSubscriptionColl = "EventSubscriptions"
+
+func (d *Database) IndexEventSubscription() {
+	d.AddIndex(EventSubscriptionColl, []string{"owner_id"})
+}
+
+func (d *Database) InsertEventSubscription(s *event.Subscription) (string, error) {
+	return d.CreateEventSubscription(s.ToMap())
+}
+
+func (d *Database) CreateEventSubscription(t map[string]interface{}) (string, error) {
+	return d.InsertDoc(EventSubscriptionColl, t)
+}
+
+func (d *Database) DeleteEventSubscription(docID string) error {
+	return d.DeleteDoc(EventSubscriptionColl, docID)
+}
+
+func (d *Database) UpdateEventSubscription(docID string, t map[string]interface{}) error {
+	return d.UpdateDoc(EventSubscriptionColl, docID, t)
+}
+
+func (d *Database) GetEventSubscription(docID string) (event.Subscription, error) {
+	doc, err := d.GetDoc(EventSubscriptionColl, docID)
+	if err != nil {
+		return event.Subscription{}, err
+	}
+	s := event.NewSubscriptionFromMap(doc)
+	s.ID = docID
+	return s, nil
+}
+
+func (d *Database) AllEventSubscriptions() []event.Subscription {
+	subs := make([]event.Subscription, 0)
+
+	d.DB().Use(EventSubscriptionColl).ForEachDoc(func(id int, docContent []byte) (willMoveOn bool) {
+		s := event.NewSubscriptionFromJson(docContent)
+		s.ID = strconv.Itoa(id)
+		subs = append(subs, s)
+		return true
+	})
+	return subs
+}
@@ -0,0 +1,75 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package tiedot
+
+import (
+	"os"
+	"testing"
+
+	event "github.com/MottainaiCI/mottainai-server/pkg/event"
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+)
+
+func TestInsertEventSubscription(t *testing.T) {
+
+	config := setting.NewConfig(nil)
+	// Set env variable
+	config.Viper.SetEnvPrefix(setting.MOTTAINAI_ENV_PREFIX)
+	config.Viper.AutomaticEnv()
+	config.Viper.SetTypeByDefaultValue(true)
+	config.Unmarshal()
+
+	config.GetDatabase().DBPath = "./DB"
+	db := New(config.GetDatabase().DBPath)
+	db.GetAgent().Map(config)
+	db.Init()
+	defer os.RemoveAll(config.GetDatabase().DBPath)
+
+	s := &event.Subscription{OwnerId: "1", URL: "http://example.com", Types: "task"}
+	id, err := db.InsertEventSubscription(s)
+	if err != nil {
+		t.Fatal("Failed insert", err)
+	}
+
+	err = db.UpdateEventSubscription(id, map[string]interface{}{"last_event_id": uint64(42)})
+	if err != nil {
+		t.Fatal("Failed update", err)
+	}
+
+	ss, err := db.GetEventSubscription(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ss.URL != s.URL || ss.OwnerId != s.OwnerId || ss.LastEventID != 42 {
+		t.Fatal("Failed insert", ss)
+	}
+
+	if len(db.AllEventSubscriptions()) != 1 {
+		t.Fatal("Expected one subscription")
+	}
+
+	db.DeleteEventSubscription(id)
+	if len(db.AllEventSubscriptions()) != 0 {
+		t.Fatal("Failed Remove")
+	}
+}
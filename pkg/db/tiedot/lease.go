@@ -0,0 +1,95 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package tiedot
+
+import (
+	"sync"
+	"time"
+
+	leader "github.com/MottainaiCI/mottainai-server/pkg/leader"
+	"github.com/MottainaiCI/mottainai-server/pkg/utils"
+)
+
+// LeaseColl holds the leader election leases. Like SchemaColl it's not part
+// of Collections, leases are meaningless outside of the running servers.
+var LeaseColl = "Leases"
+
+// tiedot can't be shared between processes, so a lock is enough to make
+// the lease updates atomic
+var leaseLock sync.Mutex
+
+func (d *Database) IndexLease() {
+	if !utils.ArrayContainsString(d.DB().AllCols(), LeaseColl) {
+		d.DB().Create(LeaseColl)
+	}
+}
+
+func (d *Database) findLease(name string) (string, leader.Lease) {
+	d.IndexLease()
+	for _, item := range d.ListDocs(LeaseColl) {
+		doc, err := d.GetDoc(LeaseColl, item.Id)
+		if err != nil {
+			continue
+		}
+		if l := leader.NewLeaseFromMap(doc); l.Name == name {
+			return item.Id, l
+		}
+	}
+	return "", leader.Lease{Name: name}
+}
+
+func (d *Database) AcquireLease(name, holder string, ttl time.Duration) (leader.Lease, error) {
+	leaseLock.Lock()
+	defer leaseLock.Unlock()
+
+	id, current := d.findLease(name)
+	if !current.CanAcquire(holder) {
+		return current, nil
+	}
+
+	lease := leader.NewLease(name, holder, ttl)
+	if len(id) == 0 {
+		_, err := d.InsertDoc(LeaseColl, lease.ToMap())
+		return lease, err
+	}
+	return lease, d.ReplaceDoc(LeaseColl, id, lease.ToMap())
+}
+
+func (d *Database) GetLease(name string) (leader.Lease, error) {
+	leaseLock.Lock()
+	defer leaseLock.Unlock()
+
+	_, lease := d.findLease(name)
+	return lease, nil
+}
+
+func (d *Database) ReleaseLease(name, holder string) error {
+	leaseLock.Lock()
+	defer leaseLock.Unlock()
+
+	id, current := d.findLease(name)
+	if len(id) == 0 || current.Holder != holder {
+		return nil
+	}
+	return d.DeleteDoc(LeaseColl, id)
+}
@@ -0,0 +1,71 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package tiedot
+
+import (
+	"testing"
+	"time"
+
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+)
+
+func TestLease(t *testing.T) {
+
+	config := setting.NewConfig(nil)
+	config.Unmarshal()
+
+	config.GetDatabase().DBPath = "./DB"
+	db := New(config.GetDatabase().DBPath)
+	db.GetAgent().Map(config)
+	db.Init()
+
+	l, err := db.AcquireLease("test", "a", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Holder != "a" {
+		t.Fatal("Lease not acquired", l)
+	}
+
+	if l, _ = db.AcquireLease("test", "b", time.Minute); l.Holder != "a" {
+		t.Fatal("Lease stolen", l)
+	}
+
+	if err := db.ReleaseLease("test", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if l, _ = db.GetLease("test"); l.Holder != "a" {
+		t.Fatal("Lease released by a different holder", l)
+	}
+
+	db.ReleaseLease("test", "a")
+	if l, _ = db.AcquireLease("test", "b", time.Millisecond); l.Holder != "b" {
+		t.Fatal("Released lease not acquired", l)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	if l, _ = db.AcquireLease("test", "a", time.Minute); l.Holder != "a" {
+		t.Fatal("Expired lease not acquired", l)
+	}
+	db.ReleaseLease("test", "a")
+}
@@ -23,6 +23,8 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 package tiedot
 
 import (
+	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -71,7 +73,8 @@ func (d *Database) UpdateNamespace(docID string, t map[string]interface{}) error
 }
 
 func (d *Database) SearchNamespace(name string) (namespace.Namespace, error) {
-	queryResult, err := d.FindDoc(NamespaceColl, `[{"eq": "`+name+`", "in": ["name"]}]`)
+	n, _ := json.Marshal(name)
+	queryResult, err := d.FindDoc(NamespaceColl, `[{"eq": `+string(n)+`, "in": ["name"]}]`)
 	var res []namespace.Namespace
 	if err != nil {
 		return namespace.Namespace{}, err
@@ -89,7 +92,12 @@ func (d *Database) SearchNamespace(name string) (namespace.Namespace, error) {
 		if err != nil {
 			return namespace.Namespace{}, err
 		}
-		res = append(res, namespace.NewFromMap(readBack))
+		t := namespace.NewFromMap(readBack)
+		t.ID = id
+		res = append(res, t)
+	}
+	if len(res) == 0 {
+		return namespace.Namespace{}, errors.New("No namespaces found")
 	}
 	return res[0], nil
 }
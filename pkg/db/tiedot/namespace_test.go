@@ -0,0 +1,57 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package tiedot
+
+import (
+	"os"
+	"testing"
+
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+)
+
+func TestSearchNamespace(t *testing.T) {
+	config := setting.NewConfig(nil)
+	config.Unmarshal()
+	config.GetDatabase().DBPath = "./DB"
+	db := New(config.GetDatabase().DBPath)
+	db.GetAgent().Map(config)
+	db.Init()
+	defer os.RemoveAll(config.GetDatabase().DBPath)
+
+	id, err := db.CreateNamespace(map[string]interface{}{"name": "foo", "visibility": "public"})
+	if err != nil {
+		t.Fatal("Failed insert", err)
+	}
+
+	ns, err := db.SearchNamespace("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ns.ID != id || !ns.IsPublic() {
+		t.Fatal("Failed search", ns)
+	}
+
+	if _, err := db.SearchNamespace("bar"); err == nil {
+		t.Fatal("Expected no namespaces")
+	}
+}
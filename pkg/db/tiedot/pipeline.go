@@ -23,6 +23,7 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 package tiedot
 
 import (
+	"encoding/json"
 	"strconv"
 
 	dbcommon "github.com/MottainaiCI/mottainai-server/pkg/db/common"
@@ -37,6 +38,8 @@ func (d *Database) IndexPipeline() {
 	d.AddIndex(PipelinesColl, []string{"status"})
 	d.AddIndex(PipelinesColl, []string{"result"})
 	d.AddIndex(PipelinesColl, []string{"result", "status"})
+	d.AddIndex(PipelinesColl, []string{"build_group"})
+	d.AddIndex(PipelinesColl, []string{"pipeline_name"})
 }
 
 func (d *Database) InsertPipeline(t *agenttasks.Pipeline) (string, error) {
@@ -80,6 +83,48 @@ func (d *Database) AllUserPipelines(config *setting.Config, id string) ([]agentt
 	return res, nil
 }
 
+func (d *Database) AllBuildGroupPipelines(config *setting.Config, group string) ([]agenttasks.Pipeline, error) {
+	g, _ := json.Marshal(group)
+	queryResult, err := d.FindDoc(PipelinesColl, `[{"eq": `+string(g)+`, "in": ["build_group"]}]`)
+	var res []agenttasks.Pipeline
+	if err != nil {
+		return res, err
+	}
+	for docid := range queryResult {
+
+		// Read document
+		t, err := d.GetPipeline(config, docid)
+		if err != nil {
+			return res, err
+		}
+		t.ID = docid
+
+		res = append(res, t)
+	}
+	return res, nil
+}
+
+func (d *Database) AllNamePipelines(config *setting.Config, name string) ([]agenttasks.Pipeline, error) {
+	n, _ := json.Marshal(name)
+	queryResult, err := d.FindDoc(PipelinesColl, `[{"eq": `+string(n)+`, "in": ["pipeline_name"]}]`)
+	var res []agenttasks.Pipeline
+	if err != nil {
+		return res, err
+	}
+	for docid := range queryResult {
+
+		// Read document
+		t, err := d.GetPipeline(config, docid)
+		if err != nil {
+			return res, err
+		}
+		t.ID = docid
+
+		res = append(res, t)
+	}
+	return res, nil
+}
+
 func (d *Database) UpdatePipeline(docID string, t map[string]interface{}) error {
 	return d.UpdateDoc(PipelinesColl, docID, t)
 }
@@ -0,0 +1,68 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package tiedot
+
+import (
+	"os"
+	"testing"
+
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+	task "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+)
+
+func TestNamePipelines(t *testing.T) {
+	config := setting.NewConfig(nil)
+	config.Unmarshal()
+	config.GetDatabase().DBPath = "./DB"
+	db := New(config.GetDatabase().DBPath)
+	db.GetAgent().Map(config)
+	db.Init()
+	defer os.RemoveAll(config.GetDatabase().DBPath)
+
+	var ids []string
+	for _, name := range []string{"foo", "foo", "bar"} {
+		id, err := db.InsertPipeline(&task.Pipeline{Name: name})
+		if err != nil {
+			t.Fatal("Failed insert", err)
+		}
+		ids = append(ids, id)
+	}
+
+	pipelines, err := db.AllNamePipelines(config, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pipelines) != 2 {
+		t.Fatal("Failed search", pipelines)
+	}
+	for _, p := range pipelines {
+		if p.Name != "foo" || (p.ID != ids[0] && p.ID != ids[1]) {
+			t.Fatal("Failed search", p)
+		}
+	}
+
+	pipelines, err = db.AllNamePipelines(config, "baz")
+	if err != nil || len(pipelines) != 0 {
+		t.Fatal("Failed search", pipelines, err)
+	}
+}
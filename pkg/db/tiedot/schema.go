@@ -0,0 +1,66 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package tiedot
+
+import (
+	dbcommon "github.com/MottainaiCI/mottainai-server/pkg/db/common"
+	"github.com/MottainaiCI/mottainai-server/pkg/utils"
+)
+
+// SchemaColl holds a single document with the schema version. It is not
+// part of Collections, so it isn't copied by migrations and backups.
+var SchemaColl = "Schema"
+
+func (d *Database) schemaDoc() (string, map[string]interface{}) {
+	if !utils.ArrayContainsString(d.DB().AllCols(), SchemaColl) {
+		return "", nil
+	}
+	for _, item := range d.ListDocs(SchemaColl) {
+		doc, err := d.GetDoc(SchemaColl, item.Id)
+		if err == nil {
+			return item.Id, doc
+		}
+	}
+	return "", nil
+}
+
+func (d *Database) SchemaVersion() (int, error) {
+	_, doc := d.schemaDoc()
+	return dbcommon.SchemaVersionFromDoc(doc), nil
+}
+
+func (d *Database) SetSchemaVersion(version int) error {
+	if !utils.ArrayContainsString(d.DB().AllCols(), SchemaColl) {
+		if err := d.DB().Create(SchemaColl); err != nil {
+			return err
+		}
+	}
+
+	id, _ := d.schemaDoc()
+	doc := map[string]interface{}{"version": version}
+	if len(id) == 0 {
+		_, err := d.InsertDoc(SchemaColl, doc)
+		return err
+	}
+	return d.ReplaceDoc(SchemaColl, id, doc)
+}
@@ -23,8 +23,10 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 package tiedot
 
 import (
+	"encoding/json"
 	"errors"
 	"strconv"
+	"sync"
 
 	dbcommon "github.com/MottainaiCI/mottainai-server/pkg/db/common"
 	agenttasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
@@ -42,6 +44,8 @@ func (d *Database) IndexTask() {
 	d.AddIndex(TaskColl, []string{"owner_id"})
 	d.AddIndex(TaskColl, []string{"node_id"})
 	d.AddIndex(TaskColl, []string{"result", "status"})
+	d.AddIndex(TaskColl, []string{"build_group"})
+	d.AddIndex(TaskColl, []string{"tag_namespace"})
 }
 
 func (d *Database) InsertTask(t *agenttasks.Task) (string, error) {
@@ -83,10 +87,36 @@ func (d *Database) DeleteTask(config *setting.Config, docID string) error {
 	return d.DeleteDoc(TaskColl, docID)
 }
 
+// taskLock serializes the read-modify-write updates of the tasks, tiedot
+// can't be shared between processes
+var taskLock sync.Mutex
+
 func (d *Database) UpdateTask(docID string, t map[string]interface{}) error {
+	taskLock.Lock()
+	defer taskLock.Unlock()
 	return d.UpdateDoc(TaskColl, docID, t)
 }
 
+// CompareAndSwapTask updates the task only if its revision is still the
+// given one, and increments it.
+func (d *Database) CompareAndSwapTask(docID string, revision int, t map[string]interface{}) error {
+	taskLock.Lock()
+	defer taskLock.Unlock()
+
+	doc, err := d.GetDoc(TaskColl, docID)
+	if err != nil {
+		return err
+	}
+	if agenttasks.NewTaskFromMap(doc).Revision != revision {
+		return dbcommon.ErrConflict
+	}
+	for k, v := range t {
+		doc[k] = v
+	}
+	doc["revision"] = revision + 1
+	return d.ReplaceDoc(TaskColl, docID, doc)
+}
+
 func (d *Database) GetTask(config *setting.Config, docID string) (agenttasks.Task, error) {
 	doc, err := d.GetDoc(TaskColl, docID)
 	if err != nil {
@@ -106,6 +136,10 @@ func (d *Database) GetTaskByStatus(config *setting.Config, status string) ([]age
 		query = `[{"eq": "running", "in": ["status"]}]`
 	case "waiting":
 		query = `[{"eq": "waiting", "in": ["status"]}]`
+	case "queued":
+		query = `[{"eq": "queued", "in": ["status"]}]`
+	case "setup":
+		query = `[{"eq": "setup", "in": ["status"]}]`
 	case "stop":
 		query = `[{"eq": "stop", "in": ["status"]}]`
 	case "stopped":
@@ -194,6 +228,46 @@ func (d *Database) AllNodeTask(config *setting.Config, id string) ([]agenttasks.
 	return res, nil
 }
 
+func (d *Database) AllBuildGroupTasks(config *setting.Config, group string) ([]agenttasks.Task, error) {
+	g, _ := json.Marshal(group)
+	queryResult, err := d.FindDoc(TaskColl, `[{"eq": `+string(g)+`, "in": ["build_group"]}]`)
+	var res []agenttasks.Task
+	if err != nil {
+		return res, err
+	}
+	for docid := range queryResult {
+
+		// Read document
+		t, err := d.GetTask(config, docid)
+		if err != nil {
+			return res, err
+		}
+
+		res = append(res, t)
+	}
+	return res, nil
+}
+
+func (d *Database) AllNamespaceTasks(config *setting.Config, name string) ([]agenttasks.Task, error) {
+	n, _ := json.Marshal(name)
+	queryResult, err := d.FindDoc(TaskColl, `[{"eq": `+string(n)+`, "in": ["tag_namespace"]}]`)
+	var res []agenttasks.Task
+	if err != nil {
+		return res, err
+	}
+	for docid := range queryResult {
+
+		// Read document
+		t, err := d.GetTask(config, docid)
+		if err != nil {
+			return res, err
+		}
+
+		res = append(res, t)
+	}
+	return res, nil
+}
+
 func (d *Database) AllUserTask(config *setting.Config, id string) ([]agenttasks.Task, error) {
 	queryResult, err := d.FindDoc(TaskColl, `[{"eq": "`+id+`", "in": ["owner_id"]}]`)
 	var res []agenttasks.Task
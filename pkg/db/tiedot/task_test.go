@@ -162,3 +162,35 @@ func TestUpdateTask(t *testing.T) {
 	}
 
 }
+
+func TestNamespaceTasks(t *testing.T) {
+	config := setting.NewConfig(nil)
+	config.Unmarshal()
+	config.GetDatabase().DBPath = "./DB"
+	db := New(config.GetDatabase().DBPath)
+	db.GetAgent().Map(config)
+	db.Init()
+	defer os.RemoveAll(config.GetDatabase().DBPath)
+
+	for _, ns := range []string{"foo", "foo", "foo::bar", `"foo"`} {
+		if _, err := db.InsertTask(&task.Task{TagNamespace: ns}); err != nil {
+			t.Fatal("Failed insert", err)
+		}
+	}
+
+	tasks, err := db.AllNamespaceTasks(config, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 2 {
+		t.Fatal("Failed search", tasks)
+	}
+
+	tasks, err = db.AllNamespaceTasks(config, `"foo"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 1 || tasks[0].TagNamespace != `"foo"` {
+		t.Fatal("Failed search", tasks)
+	}
+}
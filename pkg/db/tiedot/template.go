@@ -0,0 +1,99 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package tiedot
+
+import (
+	"strconv"
+
+	dbcommon "github.com/MottainaiCI/mottainai-server/pkg/db/common"
+
+	agenttasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+)
+
+var TaskTemplateColl = "TaskTemplates"
+
+func (d *Database) IndexTaskTemplate() {
+	d.AddIndex(TaskTemplateColl, []string{"name"})
+	d.AddIndex(TaskTemplateColl, []string{"owner_id"})
+}
+
+func (d *Database) InsertTaskTemplate(t *agenttasks.TaskTemplate) (string, error) {
+	return d.CreateTaskTemplate(t.ToMap())
+}
+
+func (d *Database) CreateTaskTemplate(t map[string]interface{}) (string, error) {
+	return d.InsertDoc(TaskTemplateColl, t)
+}
+
+func (d *Database) DeleteTaskTemplate(docID string) error {
+	return d.DeleteDoc(TaskTemplateColl, docID)
+}
+
+func (d *Database) UpdateTaskTemplate(docID string, t map[string]interface{}) error {
+	return d.UpdateDoc(TaskTemplateColl, docID, t)
+}
+
+func (d *Database) GetTaskTemplate(docID string) (agenttasks.TaskTemplate, error) {
+	doc, err := d.GetDoc(TaskTemplateColl, docID)
+	if err != nil {
+		return agenttasks.TaskTemplate{}, err
+	}
+	t := agenttasks.NewTaskTemplateFromMap(doc)
+	t.ID = docID
+	return t, err
+}
+
+func (d *Database) GetTaskTemplatesByName(name string) ([]agenttasks.TaskTemplate, error) {
+	var res []agenttasks.TaskTemplate
+
+	queryResult, err := d.FindDoc(TaskTemplateColl, `[{"eq": "`+name+`", "in": ["name"]}]`)
+	if err != nil {
+		return res, err
+	}
+
+	for docid := range queryResult {
+		t, err := d.GetTaskTemplate(docid)
+		if err != nil {
+			return res, err
+		}
+		res = append(res, t)
+	}
+	return res, nil
+}
+
+func (d *Database) ListTaskTemplates() []dbcommon.DocItem {
+	return d.ListDocs(TaskTemplateColl)
+}
+
+func (d *Database) AllTaskTemplates() []agenttasks.TaskTemplate {
+	templates := d.DB().Use(TaskTemplateColl)
+	templates_id := make([]agenttasks.TaskTemplate, 0)
+
+	templates.ForEachDoc(func(id int, docContent []byte) (willMoveOn bool) {
+		t := agenttasks.NewTaskTemplateFromJson(docContent)
+		t.ID = strconv.Itoa(id)
+		templates_id = append(templates_id, t)
+		return true
+	})
+	return templates_id
+}
@@ -24,6 +24,7 @@ package tiedot
 
 import (
 	"encoding/json"
+	"errors"
 	"strconv"
 
 	"github.com/HouzuoGuo/tiedot/db"
@@ -40,7 +41,8 @@ type Database struct {
 }
 
 var Collections = []string{WebHookColl, TaskColl, SecretColl,
-	UserColl, PlansColl, PipelinesColl, NodeColl, NamespaceColl, TokenColl, ArtefactColl, StorageColl, OrganizationColl, SettingColl}
+	UserColl, PlansColl, PipelinesColl, NodeColl, NamespaceColl, TokenColl, ArtefactColl, StorageColl, OrganizationColl, SettingColl, TaskTemplateColl,
+	EventSubscriptionColl}
 
 func New(path string) *Database {
 	return &Database{Anagent: anagent.New(), DBPath: path}
@@ -73,6 +75,14 @@ func (d *Database) Init() {
 	d.IndexPipeline()
 	d.IndexWebHook()
 	d.IndexSecret()
+	d.IndexTaskTemplate()
+	d.IndexLease()
+	d.IndexEventSubscription()
+
+	// Bring the stored documents to the current schema
+	if _, err := dbcommon.MigrateSchema(d); err != nil {
+		panic(err)
+	}
 }
 
 var MyDbInstance *db.DB
@@ -109,6 +119,15 @@ func (d *Database) InsertDoc(coll string, t map[string]interface{}) (string, err
 	return strconv.Itoa(id), err
 }
 
+// InsertDocWithID inserts a document keeping the given ID, which must be numeric.
+func (d *Database) InsertDocWithID(coll string, docID string, t map[string]interface{}) error {
+	uuid, err := strconv.Atoi(docID)
+	if err != nil {
+		return errors.New("Invalid document ID '" + docID + "': tiedot supports only numeric IDs")
+	}
+	return d.DB().Use(coll).InsertRecovery(uuid, t)
+}
+
 func (d *Database) FindDoc(coll string, searchquery string) (map[string]struct{}, error) {
 
 	var query interface{}
@@ -165,6 +184,10 @@ func (d *Database) GetDoc(coll string, docID string) (map[string]interface{}, er
 func (d *Database) ListDocs(coll string) []dbcommon.DocItem {
 	tasks := d.DB().Use(coll)
 	tasks_id := make([]dbcommon.DocItem, 0)
+	if tasks == nil {
+		// The collection isn't created yet
+		return tasks_id
+	}
 	tasks.ForEachDoc(func(id int, docContent []byte) (willMoveOn bool) {
 		tasks_id = append(tasks_id, dbcommon.DocItem{Id: strconv.Itoa(id), Content: string(docContent)})
 		return true
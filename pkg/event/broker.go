@@ -0,0 +1,148 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package event
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/streadway/amqp"
+)
+
+const (
+	// Topic exchange of the events on AMQP brokers, routed by event type
+	EVENTS_EXCHANGE = "mottainai.events"
+	// Channel of the events on Redis brokers
+	EVENTS_CHANNEL = "mottainai:events"
+)
+
+// NewBrokerSink returns the sink publishing the events on the broker of the
+// server, given its type and url.
+func NewBrokerSink(kind, url string) (Sink, error) {
+	switch {
+	case kind == "amqp":
+		return &AMQPSink{URL: url}, nil
+	case kind == "redis" || strings.HasPrefix(url, "redis://"):
+		return NewRedisSink(url), nil
+	}
+	return nil, errors.New("Events can't be published on the " + kind + " broker")
+}
+
+// AMQPSink publishes the events to EVENTS_EXCHANGE, reconnecting on
+// failures.
+type AMQPSink struct {
+	URL string
+
+	sync.Mutex
+	conn    *amqp.Connection
+	channel *amqp.Channel
+}
+
+func (s *AMQPSink) Name() string {
+	return "amqp"
+}
+
+func (s *AMQPSink) connect() error {
+	conn, err := amqp.Dial(s.URL)
+	if err != nil {
+		return err
+	}
+	channel, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	if err := channel.ExchangeDeclare(EVENTS_EXCHANGE, "topic", true, false, false, false, nil); err != nil {
+		conn.Close()
+		return err
+	}
+	s.conn, s.channel = conn, channel
+	return nil
+}
+
+func (s *AMQPSink) Publish(e Event) error {
+	s.Lock()
+	defer s.Unlock()
+
+	body, err := e.ToJson()
+	if err != nil {
+		return err
+	}
+	if s.channel == nil {
+		if err := s.connect(); err != nil {
+			return err
+		}
+	}
+
+	err = s.channel.Publish(EVENTS_EXCHANGE, e.Type, false, false, amqp.Publishing{
+		ContentType:  "application/json",
+		MessageId:    strconv.FormatUint(e.ID, 10),
+		Type:         e.Type,
+		Timestamp:    time.Now(),
+		DeliveryMode: amqp.Persistent,
+		Body:         body,
+	})
+	if err != nil {
+		// Reconnect on the next event
+		s.conn.Close()
+		s.conn, s.channel = nil, nil
+	}
+	return err
+}
+
+// RedisSink publishes the events to EVENTS_CHANNEL.
+type RedisSink struct {
+	pool *redis.Pool
+}
+
+// NewRedisSink connects to the redis url of the broker,
+// e.g. redis://password@host:6379/0
+func NewRedisSink(url string) *RedisSink {
+	return &RedisSink{pool: &redis.Pool{
+		MaxIdle:     1,
+		IdleTimeout: 240 * time.Second,
+		Dial: func() (redis.Conn, error) {
+			return redis.DialURL(url)
+		},
+	}}
+}
+
+func (s *RedisSink) Name() string {
+	return "redis"
+}
+
+func (s *RedisSink) Publish(e Event) error {
+	body, err := e.ToJson()
+	if err != nil {
+		return err
+	}
+
+	conn := s.pool.Get()
+	defer conn.Close()
+	_, err = conn.Do("PUBLISH", EVENTS_CHANNEL, body)
+	return err
+}
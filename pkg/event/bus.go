@@ -0,0 +1,196 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package event
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// Events kept for the consumers resuming the stream
+	BUS_BUFFER_SIZE = 1000
+	// Events waiting to be published to each sink or subscriber
+	BUS_QUEUE_SIZE = 1000
+)
+
+// ErrQueueFull is reported when a sink can't keep up with the events.
+var ErrQueueFull = errors.New("The queue of the sink is full, event dropped")
+
+// Sink receives the events published on the bus, e.g. a broker or the
+// HTTP subscriptions. Sinks are called from their own goroutine, in the
+// order of the events.
+type Sink interface {
+	Name() string
+	Publish(e Event) error
+}
+
+type sinkQueue struct {
+	sink Sink
+	c    chan Event
+}
+
+// Subscriber receives the events of the given types on C, until it's
+// removed from the bus. C is closed if the subscriber falls behind.
+type Subscriber struct {
+	C     chan Event
+	Types []string
+}
+
+// Bus assigns the IDs to the events and dispatches them to the sinks and the
+// subscribers, keeping the latest ones so consumers can resume from the last
+// event they got. IDs are monotonic within the server process: they start
+// from the startup time in microseconds, so they keep growing across
+// restarts.
+//
+// The kept events are in memory: a consumer can only resume against the
+// same replica and process, otherwise Since reports the events as lost.
+type Bus struct {
+	sync.Mutex
+	seed        uint64
+	lastID      uint64
+	buffer      []Event
+	sinks       []*sinkQueue
+	subscribers map[*Subscriber]bool
+
+	// Called on the failures of the sinks, if set
+	OnError func(sink string, e Event, err error)
+}
+
+func NewBus(seed uint64) *Bus {
+	return &Bus{seed: seed, lastID: seed, subscribers: make(map[*Subscriber]bool)}
+}
+
+// NewServerBus returns a bus whose IDs follow the ones of the previous
+// runs of the server.
+func NewServerBus() *Bus {
+	return NewBus(uint64(time.Now().UnixNano() / int64(time.Microsecond)))
+}
+
+func (b *Bus) onError(sink string, e Event, err error) {
+	if b.OnError != nil {
+		b.OnError(sink, e, err)
+	}
+}
+
+// AddSink starts publishing the events to the sink.
+func (b *Bus) AddSink(s Sink) {
+	q := &sinkQueue{sink: s, c: make(chan Event, BUS_QUEUE_SIZE)}
+	go func() {
+		for e := range q.c {
+			if err := s.Publish(e); err != nil {
+				b.onError(s.Name(), e, err)
+			}
+		}
+	}()
+
+	b.Lock()
+	defer b.Unlock()
+	b.sinks = append(b.sinks, q)
+}
+
+// Publish emits an event, returning it with its ID. Publishing on a nil bus
+// is a no-op, e.g. in the tools using the database without a server.
+func (b *Bus) Publish(kind string, data map[string]interface{}) Event {
+	if b == nil {
+		return Event{}
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	b.lastID++
+	e := NewEvent(b.lastID, kind, data)
+	b.buffer = append(b.buffer, e)
+	if len(b.buffer) > BUS_BUFFER_SIZE {
+		b.buffer = b.buffer[len(b.buffer)-BUS_BUFFER_SIZE:]
+	}
+
+	for _, q := range b.sinks {
+		select {
+		case q.c <- e:
+		default:
+			go b.onError(q.sink.Name(), e, ErrQueueFull)
+		}
+	}
+	for s := range b.subscribers {
+		if !e.Matches(s.Types) {
+			continue
+		}
+		select {
+		case s.C <- e:
+		default:
+			// The subscriber resumes from its last event
+			delete(b.subscribers, s)
+			close(s.C)
+		}
+	}
+	return e
+}
+
+// Since returns the kept events following the given ID, and false if some
+// of them were lost: already dropped from the buffer, or published by a
+// previous process (before a restart) or by another replica.
+func (b *Bus) Since(id uint64) ([]Event, bool) {
+	b.Lock()
+	defer b.Unlock()
+
+	events := make([]Event, 0)
+	for _, e := range b.buffer {
+		if e.ID > id {
+			events = append(events, e)
+		}
+	}
+	complete := id >= b.seed && id <= b.lastID &&
+		(len(b.buffer) == 0 || b.buffer[0].ID <= id+1)
+	return events, complete
+}
+
+// LastID returns the ID of the latest event.
+func (b *Bus) LastID() uint64 {
+	b.Lock()
+	defer b.Unlock()
+	return b.lastID
+}
+
+// Subscribe returns a subscriber to the events of the given types, see
+// Event.Matches.
+func (b *Bus) Subscribe(types []string) *Subscriber {
+	s := &Subscriber{C: make(chan Event, BUS_QUEUE_SIZE), Types: types}
+
+	b.Lock()
+	defer b.Unlock()
+	b.subscribers[s] = true
+	return s
+}
+
+// Unsubscribe removes the subscriber from the bus.
+func (b *Bus) Unsubscribe(s *Subscriber) {
+	b.Lock()
+	defer b.Unlock()
+	if b.subscribers[s] {
+		delete(b.subscribers, s)
+		close(s.C)
+	}
+}
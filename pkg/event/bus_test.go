@@ -0,0 +1,205 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package event_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	. "github.com/MottainaiCI/mottainai-server/pkg/event"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type recordSink struct {
+	sync.Mutex
+	events []Event
+}
+
+func (r *recordSink) Name() string { return "record" }
+
+func (r *recordSink) Publish(e Event) error {
+	r.Lock()
+	defer r.Unlock()
+	r.events = append(r.events, e)
+	return nil
+}
+
+func (r *recordSink) Events() []Event {
+	r.Lock()
+	defer r.Unlock()
+	return append([]Event{}, r.events...)
+}
+
+type memoryStore struct {
+	sync.Mutex
+	subs  []Subscription
+	state map[string]map[string]interface{}
+}
+
+func (m *memoryStore) AllEventSubscriptions() []Subscription {
+	return m.subs
+}
+
+func (m *memoryStore) UpdateEventSubscription(id string, t map[string]interface{}) error {
+	m.Lock()
+	defer m.Unlock()
+	m.state[id] = t
+	return nil
+}
+
+func (m *memoryStore) State(id string) map[string]interface{} {
+	m.Lock()
+	defer m.Unlock()
+	return m.state[id]
+}
+
+var _ = Describe("Event bus", func() {
+
+	Describe("Publish", func() {
+		It("Numbers the events", func() {
+			bus := NewBus(10)
+			e1 := bus.Publish(TASK_STARTED, map[string]interface{}{"id": "1"})
+			e2 := bus.Publish(TASK_FINISHED, map[string]interface{}{"id": "1"})
+			Expect(e1.ID).To(Equal(uint64(11)))
+			Expect(e2.ID).To(Equal(uint64(12)))
+			Expect(bus.LastID()).To(Equal(uint64(12)))
+		})
+
+		It("Is a no-op without a bus", func() {
+			var bus *Bus
+			Expect(bus.Publish(TASK_STARTED, nil).ID).To(Equal(uint64(0)))
+		})
+
+		It("Sends the events to the sinks", func() {
+			bus := NewBus(0)
+			sink := &recordSink{}
+			bus.AddSink(sink)
+			bus.Publish(NODE_LOST, map[string]interface{}{"id": "n"})
+			Eventually(sink.Events).Should(HaveLen(1))
+			Expect(sink.Events()[0].Type).To(Equal(NODE_LOST))
+		})
+	})
+
+	Describe("Since", func() {
+		It("Replays the following events", func() {
+			bus := NewBus(0)
+			for i := 0; i < 3; i++ {
+				bus.Publish(TASK_STARTED, nil)
+			}
+			events, complete := bus.Since(1)
+			Expect(complete).To(BeTrue())
+			Expect(events).To(HaveLen(2))
+			Expect(events[0].ID).To(Equal(uint64(2)))
+		})
+
+		It("Reports the dropped events", func() {
+			bus := NewBus(0)
+			for i := 0; i < BUS_BUFFER_SIZE+5; i++ {
+				bus.Publish(TASK_STARTED, nil)
+			}
+			_, complete := bus.Since(1)
+			Expect(complete).To(BeFalse())
+		})
+
+		It("Reports the events of other processes as lost", func() {
+			bus := NewBus(100)
+			_, complete := bus.Since(50)
+			Expect(complete).To(BeFalse())
+
+			bus.Publish(TASK_STARTED, nil)
+			_, complete = bus.Since(100)
+			Expect(complete).To(BeTrue())
+			_, complete = bus.Since(200)
+			Expect(complete).To(BeFalse())
+		})
+	})
+
+	Describe("Subscribe", func() {
+		It("Filters the events by type", func() {
+			bus := NewBus(0)
+			sub := bus.Subscribe(ParseTypes("task, node.lost"))
+			defer bus.Unsubscribe(sub)
+
+			bus.Publish(NODE_REGISTERED, nil)
+			bus.Publish(TASK_STARTED, nil)
+			bus.Publish(NODE_LOST, nil)
+
+			Expect((<-sub.C).Type).To(Equal(TASK_STARTED))
+			Expect((<-sub.C).Type).To(Equal(NODE_LOST))
+			Expect(sub.C).ToNot(Receive())
+		})
+	})
+})
+
+var _ = Describe("Subscription", func() {
+
+	It("Validates the URL", func() {
+		s := Subscription{URL: "ftp://example.com"}
+		Expect(s.Validate()).To(HaveOccurred())
+
+		s = Subscription{URL: "https://example.com/hook"}
+		Expect(s.Validate()).ToNot(HaveOccurred())
+		Expect(s.Secret).ToNot(BeEmpty())
+	})
+
+	It("Round trips through a map", func() {
+		s := Subscription{ID: "1", URL: "http://example.com", Types: "task", LastEventID: 4}
+		Expect(NewSubscriptionFromMap(s.ToMap())).To(Equal(s))
+	})
+
+	It("Delivers signed events", func() {
+		var body []byte
+		var signature, kind string
+		done := make(chan bool, 1)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ = ioutil.ReadAll(r.Body)
+			signature = r.Header.Get("X-Mottainai-Signature")
+			kind = r.Header.Get("X-Mottainai-Event")
+			done <- true
+		}))
+		defer server.Close()
+
+		store := &memoryStore{
+			subs: []Subscription{
+				{ID: "1", URL: server.URL, Secret: "s3cr3t", Types: "artefact"},
+				{ID: "2", URL: server.URL, Secret: "s3cr3t", Types: "node"},
+			},
+			state: make(map[string]map[string]interface{}),
+		}
+		sink := NewSubscriptionSink(store)
+		sink.RetryDelay = time.Millisecond
+
+		e := NewEvent(7, ARTEFACT_UPLOADED, map[string]interface{}{"name": "foo"})
+		Expect(sink.Publish(e)).ToNot(HaveOccurred())
+		Eventually(done).Should(Receive())
+
+		Expect(kind).To(Equal(ARTEFACT_UPLOADED))
+		Expect(signature).To(Equal("sha256=" + Sign("s3cr3t", body)))
+		Eventually(func() map[string]interface{} { return store.State("1") }).Should(HaveKeyWithValue("last_event_id", uint64(7)))
+		Expect(store.State("2")).To(BeNil())
+	})
+})
@@ -0,0 +1,88 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package event
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Types of the events emitted by the server
+const (
+	TASK_CREATED        = "task.created"
+	TASK_STARTED        = "task.started"
+	TASK_STATUS_CHANGED = "task.status_changed"
+	TASK_FINISHED       = "task.finished"
+	ARTEFACT_UPLOADED   = "artefact.uploaded"
+	NAMESPACE_TAGGED    = "namespace.tagged"
+	NODE_REGISTERED     = "node.registered"
+	NODE_LOST           = "node.lost"
+)
+
+// Event is something which happened in the server, as seen by the external
+// consumers. IDs increase monotonically, so consumers can resume the stream
+// from the last event they got.
+type Event struct {
+	ID   uint64                 `json:"id"`
+	Type string                 `json:"type"`
+	Time string                 `json:"time"`
+	Data map[string]interface{} `json:"data"`
+}
+
+func NewEvent(id uint64, kind string, data map[string]interface{}) Event {
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+	return Event{ID: id, Type: kind, Time: time.Now().UTC().Format(time.RFC3339), Data: data}
+}
+
+// Matches reports whether the event is one of the given types. A type
+// matches also its subtypes, e.g. "task" matches "task.created". No types
+// match all the events.
+func (e *Event) Matches(types []string) bool {
+	if len(types) == 0 {
+		return true
+	}
+	for _, t := range types {
+		if t == e.Type || strings.HasPrefix(e.Type, t+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Event) ToJson() ([]byte, error) {
+	return json.Marshal(e)
+}
+
+// ParseTypes splits a comma separated list of event types.
+func ParseTypes(s string) []string {
+	types := make([]string, 0)
+	for _, t := range strings.Split(s, ",") {
+		if t = strings.TrimSpace(t); len(t) > 0 {
+			types = append(types, t)
+		}
+	}
+	return types
+}
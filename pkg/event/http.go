@@ -0,0 +1,165 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package event
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SubscriptionStore holds the HTTP subscriptions, i.e. the database driver.
+type SubscriptionStore interface {
+	AllEventSubscriptions() []Subscription
+	UpdateEventSubscription(docID string, t map[string]interface{}) error
+}
+
+type delivery struct {
+	sub   Subscription
+	event Event
+}
+
+// SubscriptionSink delivers the events to the HTTP subscriptions, retrying
+// on failures. Each subscription has its own queue, so a slow endpoint
+// doesn't hold back the others.
+type SubscriptionSink struct {
+	Store      SubscriptionStore
+	Client     *http.Client
+	Attempts   int
+	RetryDelay time.Duration
+
+	sync.Mutex
+	queues map[string]chan delivery
+}
+
+func NewSubscriptionSink(store SubscriptionStore) *SubscriptionSink {
+	return &SubscriptionSink{
+		Store:      store,
+		Client:     &http.Client{Timeout: 30 * time.Second},
+		Attempts:   3,
+		RetryDelay: 5 * time.Second,
+		queues:     make(map[string]chan delivery),
+	}
+}
+
+func (s *SubscriptionSink) Name() string {
+	return "subscriptions"
+}
+
+func (s *SubscriptionSink) Publish(e Event) error {
+	var err error
+	for _, sub := range s.Store.AllEventSubscriptions() {
+		if !sub.Matches(&e) {
+			continue
+		}
+		if qerr := s.enqueue(delivery{sub: sub, event: e}); qerr != nil {
+			err = errors.New("Subscription " + sub.ID + ": " + qerr.Error())
+		}
+	}
+	return err
+}
+
+func (s *SubscriptionSink) enqueue(d delivery) error {
+	s.Lock()
+	defer s.Unlock()
+
+	q, ok := s.queues[d.sub.ID]
+	if !ok {
+		q = make(chan delivery, BUS_QUEUE_SIZE)
+		s.queues[d.sub.ID] = q
+		go s.run(d.sub.ID, q)
+	}
+	select {
+	case q <- d:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// run delivers the queued events of a subscription, until none is left.
+func (s *SubscriptionSink) run(id string, q chan delivery) {
+	for {
+		s.Lock()
+		if len(q) == 0 {
+			delete(s.queues, id)
+			s.Unlock()
+			return
+		}
+		s.Unlock()
+
+		d := <-q
+		state := map[string]interface{}{"last_event_id": d.event.ID, "last_error": ""}
+		if err := s.deliver(d); err != nil {
+			state["last_error"] = err.Error()
+		}
+		s.Store.UpdateEventSubscription(id, state)
+	}
+}
+
+func (s *SubscriptionSink) deliver(d delivery) error {
+	body, err := d.event.ToJson()
+	if err != nil {
+		return err
+	}
+
+	delay := s.RetryDelay
+	for i := 0; i < s.Attempts; i++ {
+		if i > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+		if err = s.post(d.sub, d.event, body); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (s *SubscriptionSink) post(sub Subscription, e Event, body []byte) error {
+	req, err := http.NewRequest("POST", sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Mottainai-Event", e.Type)
+	req.Header.Set("X-Mottainai-Delivery", strconv.FormatUint(e.ID, 10))
+	req.Header.Set("X-Mottainai-Signature", "sha256="+Sign(sub.Secret, body))
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.New("Delivery rejected with status " + strconv.Itoa(resp.StatusCode))
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package event
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/url"
+
+	"github.com/sethvargo/go-password/password"
+)
+
+// Subscription delivers the events to an HTTP endpoint. The deliveries are
+// signed with the secret of the subscription, see Sign.
+type Subscription struct {
+	ID      string `json:"id" form:"id"`
+	OwnerId string `json:"owner_id" form:"owner_id"`
+	URL     string `json:"url" form:"url"`
+	Secret  string `json:"secret" form:"secret"`
+
+	// Comma separated types of the delivered events, all when empty, see
+	// Event.Matches
+	Types string `json:"types" form:"types"`
+
+	// State of the deliveries
+	LastEventID uint64 `json:"last_event_id" form:"-"`
+	LastError   string `json:"last_error" form:"-"`
+}
+
+func NewSubscriptionFromMap(t map[string]interface{}) Subscription {
+	s := Subscription{}
+	s.ID, _ = t["id"].(string)
+	s.OwnerId, _ = t["owner_id"].(string)
+	s.URL, _ = t["url"].(string)
+	s.Secret, _ = t["secret"].(string)
+	s.Types, _ = t["types"].(string)
+	s.LastError, _ = t["last_error"].(string)
+	switch id := t["last_event_id"].(type) {
+	case float64:
+		s.LastEventID = uint64(id)
+	case uint64:
+		s.LastEventID = id
+	}
+	return s
+}
+
+func NewSubscriptionFromJson(data []byte) Subscription {
+	var s Subscription
+	json.Unmarshal(data, &s)
+	return s
+}
+
+func (s *Subscription) ToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"id":            s.ID,
+		"owner_id":      s.OwnerId,
+		"url":           s.URL,
+		"secret":        s.Secret,
+		"types":         s.Types,
+		"last_event_id": s.LastEventID,
+		"last_error":    s.LastError,
+	}
+}
+
+// Validate checks the endpoint of the subscription, generating its secret
+// if missing.
+func (s *Subscription) Validate() error {
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("Invalid subscription URL: " + s.URL)
+	}
+	if len(s.Secret) == 0 {
+		secret, err := password.Generate(32, 10, 0, false, false)
+		if err != nil {
+			return err
+		}
+		s.Secret = secret
+	}
+	return nil
+}
+
+// Matches reports whether the event is delivered to the subscription.
+func (s *Subscription) Matches(e *Event) bool {
+	return e.Matches(ParseTypes(s.Types))
+}
+
+// Sign returns the signature of a delivery, sent as
+// X-Mottainai-Signature: sha256=<signature>
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,122 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package leader
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Lease of the server side periodic jobs (plans, healthcheck)
+const PERIODIC_JOBS_LEASE = "periodic-jobs"
+
+// Elector keeps trying to acquire a lease, the replica holding it is the
+// leader. Followers take over within the lease time after the leader stops
+// renewing it.
+type Elector struct {
+	Name string
+	ID   string
+	TTL  time.Duration
+
+	backend Backend
+	sync.RWMutex
+	leader bool
+	lease  Lease
+}
+
+// ReplicaID identifies the current server process.
+func ReplicaID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+func NewElector(backend Backend, name, id string, ttl time.Duration) *Elector {
+	return &Elector{Name: name, ID: id, TTL: ttl, backend: backend}
+}
+
+// Renew tries to acquire or renew the lease, returning true if the replica
+// is the leader. Leadership is dropped on backend errors, as the lease
+// might expire meanwhile.
+func (e *Elector) Renew() (bool, error) {
+	lease, err := e.backend.AcquireLease(e.Name, e.ID, e.TTL)
+
+	e.Lock()
+	defer e.Unlock()
+	if err != nil {
+		e.leader = false
+		return false, err
+	}
+	e.lease = lease
+	e.leader = lease.Holder == e.ID && !lease.Expired()
+	return e.leader, nil
+}
+
+// Release gives up the leadership, letting another replica take over
+// without waiting for the lease to expire.
+func (e *Elector) Release() error {
+	e.Lock()
+	defer e.Unlock()
+	if !e.leader {
+		return nil
+	}
+	e.leader = false
+	return e.backend.ReleaseLease(e.Name, e.ID)
+}
+
+func (e *Elector) IsLeader() bool {
+	e.RLock()
+	defer e.RUnlock()
+	// The lease could have expired if renewals are failing or late
+	return e.leader && !e.lease.Expired()
+}
+
+// Leader returns the current lease, as stored in the backend.
+func (e *Elector) Leader() (Lease, error) {
+	return e.backend.GetLease(e.Name)
+}
+
+// Run renews the lease every third of the lease time until stop is
+// closed. onTick is called after each renewal.
+func (e *Elector) Run(stop <-chan struct{}, onTick func(leader bool, err error)) {
+	ticker := time.NewTicker(e.TTL / 3)
+	defer ticker.Stop()
+
+	for {
+		leader, err := e.Renew()
+		if onTick != nil {
+			onTick(leader, err)
+		}
+
+		select {
+		case <-stop:
+			e.Release()
+			return
+		case <-ticker.C:
+		}
+	}
+}
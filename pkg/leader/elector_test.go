@@ -0,0 +1,134 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package leader
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memBackend struct {
+	sync.Mutex
+	leases map[string]Lease
+	fail   bool
+}
+
+func (m *memBackend) AcquireLease(name, holder string, ttl time.Duration) (Lease, error) {
+	m.Lock()
+	defer m.Unlock()
+	if m.fail {
+		return Lease{}, errors.New("unavailable")
+	}
+	if cur, ok := m.leases[name]; ok && !cur.CanAcquire(holder) {
+		return cur, nil
+	}
+	m.leases[name] = NewLease(name, holder, ttl)
+	return m.leases[name], nil
+}
+
+func (m *memBackend) GetLease(name string) (Lease, error) {
+	m.Lock()
+	defer m.Unlock()
+	return m.leases[name], nil
+}
+
+func (m *memBackend) ReleaseLease(name, holder string) error {
+	m.Lock()
+	defer m.Unlock()
+	if m.leases[name].Holder == holder {
+		delete(m.leases, name)
+	}
+	return nil
+}
+
+func TestElector(t *testing.T) {
+	backend := &memBackend{leases: make(map[string]Lease)}
+	a := NewElector(backend, PERIODIC_JOBS_LEASE, "a", 20*time.Millisecond)
+	b := NewElector(backend, PERIODIC_JOBS_LEASE, "b", 20*time.Millisecond)
+
+	if ok, _ := a.Renew(); !ok || !a.IsLeader() {
+		t.Fatal("First replica is not the leader")
+	}
+	if ok, _ := b.Renew(); ok || b.IsLeader() {
+		t.Fatal("Two leaders elected")
+	}
+	if l, _ := b.Leader(); l.Holder != "a" {
+		t.Error("Unexpected leader", l)
+	}
+
+	// The leader stops renewing the lease
+	time.Sleep(30 * time.Millisecond)
+	if a.IsLeader() {
+		t.Error("Leadership kept after the lease expiration")
+	}
+	if ok, _ := b.Renew(); !ok {
+		t.Fatal("Failover didn't happen after the lease expiration")
+	}
+	if ok, _ := a.Renew(); ok {
+		t.Fatal("Two leaders elected")
+	}
+
+	backend.fail = true
+	if ok, err := b.Renew(); ok || err == nil || b.IsLeader() {
+		t.Error("Leadership kept on backend errors")
+	}
+	backend.fail = false
+
+	b.Renew()
+	b.Release()
+	if ok, _ := a.Renew(); !ok {
+		t.Error("Released lease not acquired")
+	}
+}
+
+func TestElectorRun(t *testing.T) {
+	backend := &memBackend{leases: make(map[string]Lease)}
+	e := NewElector(backend, PERIODIC_JOBS_LEASE, "a", 30*time.Millisecond)
+
+	stop := make(chan struct{})
+	ticks := make(chan bool, 10)
+	done := make(chan struct{})
+	go func() {
+		e.Run(stop, func(leader bool, err error) {
+			select {
+			case ticks <- leader:
+			default:
+			}
+		})
+		close(done)
+	}()
+
+	for i := 0; i < 3; i++ {
+		if !<-ticks {
+			t.Error("Lease not renewed")
+		}
+	}
+	close(stop)
+	<-done
+
+	if l, _ := backend.GetLease(PERIODIC_JOBS_LEASE); len(l.Holder) != 0 {
+		t.Error("Lease not released on stop", l)
+	}
+}
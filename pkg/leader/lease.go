@@ -0,0 +1,92 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package leader
+
+import (
+	"time"
+)
+
+// Lease is held by a replica until it expires or it's released. The
+// holder has to renew it before the expiration to keep the leadership.
+type Lease struct {
+	Name   string `json:"name" form:"name"`
+	Holder string `json:"holder" form:"holder"`
+	// Expiration time, in milliseconds since the epoch
+	Expires int64 `json:"expires" form:"expires"`
+}
+
+// Backend stores the leases, acquiring a lease has to be atomic between
+// the replicas.
+type Backend interface {
+	// AcquireLease takes or renews the lease for the holder if it's free,
+	// expired or already owned by it. It returns the current lease.
+	AcquireLease(name, holder string, ttl time.Duration) (Lease, error)
+	GetLease(name string) (Lease, error)
+	ReleaseLease(name, holder string) error
+}
+
+func NewLease(name, holder string, ttl time.Duration) Lease {
+	return Lease{
+		Name:    name,
+		Holder:  holder,
+		Expires: time.Now().Add(ttl).UnixNano() / int64(time.Millisecond),
+	}
+}
+
+func NewLeaseFromMap(t map[string]interface{}) Lease {
+	l := Lease{}
+	if s, ok := t["name"].(string); ok {
+		l.Name = s
+	}
+	if s, ok := t["holder"].(string); ok {
+		l.Holder = s
+	}
+	switch v := t["expires"].(type) {
+	case float64:
+		l.Expires = int64(v)
+	case int64:
+		l.Expires = v
+	}
+	return l
+}
+
+func (l Lease) ToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"name":    l.Name,
+		"holder":  l.Holder,
+		"expires": l.Expires,
+	}
+}
+
+func (l Lease) ExpiresAt() time.Time {
+	return time.Unix(0, l.Expires*int64(time.Millisecond))
+}
+
+func (l Lease) Expired() bool {
+	return time.Now().After(l.ExpiresAt())
+}
+
+// CanAcquire returns true if the holder can take or renew the lease.
+func (l Lease) CanAcquire(holder string) bool {
+	return len(l.Holder) == 0 || l.Holder == holder || l.Expired()
+}
@@ -0,0 +1,107 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package leader
+
+import (
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+const REDIS_LEASE_PREFIX = "mottainai:lease:"
+
+var (
+	acquireScript = redis.NewScript(1, `
+local cur = redis.call('GET', KEYS[1])
+if cur == false or cur == ARGV[1] then
+  redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+  cur = ARGV[1]
+end
+return {cur, redis.call('PTTL', KEYS[1])}`)
+
+	getScript = redis.NewScript(1, `
+return {redis.call('GET', KEYS[1]) or '', redis.call('PTTL', KEYS[1])}`)
+
+	releaseScript = redis.NewScript(1, `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  return redis.call('DEL', KEYS[1])
+end
+return 0`)
+)
+
+// RedisBackend stores the leases as expiring keys.
+type RedisBackend struct {
+	pool *redis.Pool
+}
+
+// NewRedisBackend connects to the redis url of the broker,
+// e.g. redis://password@host:6379/0
+func NewRedisBackend(url string) *RedisBackend {
+	return &RedisBackend{pool: &redis.Pool{
+		MaxIdle:     2,
+		IdleTimeout: 240 * time.Second,
+		Dial: func() (redis.Conn, error) {
+			return redis.DialURL(url)
+		},
+	}}
+}
+
+func (r *RedisBackend) lease(name string, reply interface{}, err error) (Lease, error) {
+	values, err := redis.Values(reply, err)
+	if err != nil {
+		return Lease{}, err
+	}
+	var holder string
+	var pttl int64
+	if _, err := redis.Scan(values, &holder, &pttl); err != nil {
+		return Lease{}, err
+	}
+	if len(holder) == 0 || pttl < 0 {
+		return Lease{Name: name}, nil
+	}
+	return NewLease(name, holder, time.Duration(pttl)*time.Millisecond), nil
+}
+
+func (r *RedisBackend) AcquireLease(name, holder string, ttl time.Duration) (Lease, error) {
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	reply, err := acquireScript.Do(conn, REDIS_LEASE_PREFIX+name, holder, int64(ttl/time.Millisecond))
+	return r.lease(name, reply, err)
+}
+
+func (r *RedisBackend) GetLease(name string) (Lease, error) {
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	reply, err := getScript.Do(conn, REDIS_LEASE_PREFIX+name)
+	return r.lease(name, reply, err)
+}
+
+func (r *RedisBackend) ReleaseLease(name, holder string) error {
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	_, err := releaseScript.Do(conn, REDIS_LEASE_PREFIX+name, holder)
+	return err
+}
@@ -30,6 +30,7 @@ import (
 
 	client "github.com/MottainaiCI/mottainai-server/pkg/client"
 	logging "github.com/MottainaiCI/mottainai-server/pkg/logging"
+	nodes "github.com/MottainaiCI/mottainai-server/pkg/nodes"
 	taskmanager "github.com/MottainaiCI/mottainai-server/pkg/tasks/manager"
 	logrus "github.com/sirupsen/logrus"
 
@@ -55,13 +56,21 @@ const MINTIMER = 50
 const R = 3.81199961
 const STEPS = 215
 
-func (m *MottainaiAgent) SetKeepAlive(ID, hostname string) {
-	m.Client.RegisterNode(ID, hostname)
+func (m *MottainaiAgent) SetKeepAlive(ID, hostname, privqueue string) {
+	m.Invoke(func(config *setting.Config, th *taskmanager.TaskHandler) {
+		if res, err := m.Client.RegisterNode(ID, hostname, NewNodeReport(config, th.Executors(), privqueue)); err == nil {
+			taskmanager.SetDraining(res.Status == nodes.NODE_STATUS_DRAINING)
+		}
+	})
 
 	var tid anagent.TimerID = "keepalive"
 
-	m.Timer(tid, time.Now(), time.Duration(MINTIMER*time.Second), true, func(a *anagent.Anagent, c *client.Fetcher) {
-		if res, err := c.RegisterNode(ID, hostname); err == nil {
+	m.Timer(tid, time.Now(), time.Duration(MINTIMER*time.Second), true, func(a *anagent.Anagent, c *client.Fetcher, config *setting.Config, th *taskmanager.TaskHandler) {
+		if res, err := c.RegisterNode(ID, hostname, NewNodeReport(config, th.Executors(), privqueue)); err == nil {
+			if draining := res.Status == nodes.NODE_STATUS_DRAINING; draining != taskmanager.IsDraining() {
+				log.INFO.Println("Node draining: ", draining)
+				taskmanager.SetDraining(draining)
+			}
 			d := time.Duration(MINTIMER * time.Second)
 			population := strings.Split(res.Data, ",")
 			if len(population) == 2 {
@@ -120,8 +129,9 @@ func (m *MottainaiAgent) Run() error {
 		log.INFO.Println("Worker ID: " + ID)
 		log.INFO.Println("Worker Hostname: " + hostname)
 
+		var privqueue string
 		if config.GetAgent().PrivateQueue != 0 {
-			privqueue := hostname + ID
+			privqueue = hostname + ID
 			b := server.Add(privqueue, config)
 			w := b.NewWorker(privqueue, config.GetAgent().PrivateQueue)
 			log.INFO.Println("Listening on private queue: " + privqueue)
@@ -129,7 +139,7 @@ func (m *MottainaiAgent) Run() error {
 		}
 
 		defaultWorker = broker.NewWorker(ID, config.GetAgent().AgentConcurrency)
-		m.SetKeepAlive(ID, hostname)
+		m.SetKeepAlive(ID, hostname, privqueue)
 
 		for q, concurrent := range config.GetAgent().Queues {
 			log.INFO.Println("Listening on queue ", q, " with concurrency ", concurrent)
@@ -0,0 +1,112 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package mottainai
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	nodes "github.com/MottainaiCI/mottainai-server/pkg/nodes"
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+	taskmanager "github.com/MottainaiCI/mottainai-server/pkg/tasks/manager"
+)
+
+const MB = 1024 * 1024
+
+// NewNodeReport collects the inventory and health status of the agent
+// sent to the server on each keepalive.
+func NewNodeReport(config *setting.Config, executors []string, privqueue string) nodes.NodeReport {
+	report := nodes.NodeReport{
+		Version:      setting.MOTTAINAI_VERSION,
+		Executors:    executors,
+		Queues:       config.GetAgent().Queues,
+		Concurrency:  config.GetAgent().AgentConcurrency,
+		RunningTasks: taskmanager.RunningTasks(),
+		PrivateQueue: privqueue,
+		Labels:       NodeLabels(config, executors),
+	}
+
+	report.DiskTotal, report.DiskFree, _ = diskUsage(config.GetAgent().BuildPath)
+	report.MemTotal, report.MemAvailable, _ = memoryUsage()
+	report.Load, _ = loadAverage()
+
+	return report
+}
+
+// diskUsage returns total and available space in MB of the filesystem
+// containing path.
+func diskUsage(path string) (uint64, uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, 0, err
+	}
+	bsize := uint64(stat.Bsize)
+	return stat.Blocks * bsize / MB, stat.Bavail * bsize / MB, nil
+}
+
+// memoryUsage returns total and available memory in MB.
+func memoryUsage() (uint64, uint64, error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	var total, available uint64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		// Values are expressed in kB
+		v, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			total = v / 1024
+		case "MemAvailable:":
+			available = v / 1024
+		}
+	}
+	return total, available, scanner.Err()
+}
+
+// loadAverage returns the load average of the last minute.
+func loadAverage() (float64, error) {
+	data, err := ioutil.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, nil
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
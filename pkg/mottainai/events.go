@@ -0,0 +1,126 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package mottainai
+
+import (
+	"sync"
+	"time"
+
+	database "github.com/MottainaiCI/mottainai-server/pkg/db"
+	"github.com/MottainaiCI/mottainai-server/pkg/event"
+	logging "github.com/MottainaiCI/mottainai-server/pkg/logging"
+	"github.com/MottainaiCI/mottainai-server/pkg/nodes"
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+	"github.com/MottainaiCI/mottainai-server/pkg/utils"
+	logrus "github.com/sirupsen/logrus"
+)
+
+// Last reports of the nodes already published as lost, so every outage is
+// published once
+var (
+	lostNodes     = make(map[string]string)
+	lostNodesLock sync.Mutex
+)
+
+// SetupEvents maps the event bus of the server, which publishes also the
+// events of the writes to the database.
+func (m *Mottainai) SetupEvents() {
+	bus := event.NewServerBus()
+	m.Invoke(func(d *database.Database, l *logging.Logger) {
+		bus.OnError = func(sink string, e event.Event, err error) {
+			l.WithFields(logrus.Fields{
+				"component": "events",
+				"sink":      sink,
+				"event_id":  e.ID,
+				"type":      e.Type,
+				"error":     err.Error(),
+			}).Warn("Could not publish the event")
+		}
+		d.SetEvents(bus)
+	})
+	m.Map(bus)
+}
+
+// StartEventSinks starts publishing the events to the configured sinks.
+func (m *Mottainai) StartEventSinks() {
+	m.Invoke(func(bus *event.Bus, d *database.Database, config *setting.Config, l *logging.Logger) {
+		sinks := config.GetWeb().EventSinks
+		if utils.ArrayContainsString(sinks, "broker") {
+			sink, err := event.NewBrokerSink(config.GetBroker().Type, config.GetBroker().Broker)
+			if err != nil {
+				l.WithFields(logrus.Fields{
+					"component": "events",
+					"error":     err.Error(),
+				}).Warn("Events aren't published on the broker")
+			} else {
+				bus.AddSink(sink)
+			}
+		}
+		if utils.ArrayContainsString(sinks, "subscriptions") {
+			bus.AddSink(event.NewSubscriptionSink(d.Driver))
+		}
+	})
+}
+
+// nodeExpired reports whether the node missed the deadline of its reports.
+func nodeExpired(config *setting.Config, n nodes.Node) bool {
+	return n.Expired(config.GetWeb().NodeDeadline)
+}
+
+// NodeReported publishes the registration of a node which reports for the
+// first time, or again after missing the deadline of its reports. The node
+// is the one stored before the report.
+func NodeReported(d *database.Database, n nodes.Node) {
+	lostNodesLock.Lock()
+	_, lost := lostNodes[n.ID]
+	delete(lostNodes, n.ID)
+	lostNodesLock.Unlock()
+
+	if len(n.LastReport) > 0 && !lost && !nodeExpired(d.Config, n) {
+		return
+	}
+	d.Events.Publish(event.NODE_REGISTERED, map[string]interface{}{
+		"id":       n.ID,
+		"node_id":  n.NodeID,
+		"hostname": n.Hostname,
+	})
+}
+
+// nodeLost publishes a node which missed the deadline of its reports, once
+// per outage.
+func nodeLost(d *database.Database, n nodes.Node, since time.Duration) {
+	lostNodesLock.Lock()
+	defer lostNodesLock.Unlock()
+	if lostNodes[n.ID] == n.LastReport {
+		return
+	}
+	lostNodes[n.ID] = n.LastReport
+
+	d.Events.Publish(event.NODE_LOST, map[string]interface{}{
+		"id":          n.ID,
+		"node_id":     n.NodeID,
+		"hostname":    n.Hostname,
+		"last_report": n.LastReport,
+		"since":       int(since.Seconds()),
+	})
+}
@@ -0,0 +1,193 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package mottainai
+
+import (
+	stdctx "context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+	"golang.org/x/oauth2"
+
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+)
+
+// The installation endpoints need the preview of the apps
+const githubAppMediaType = "application/vnd.github.machine-man-preview+json"
+
+type installationToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// GitHubApp authenticates as a GitHub App, which is the only way to send
+// check runs and to receive their re-run requests.
+type GitHubApp struct {
+	ID      int64
+	Key     *rsa.PrivateKey
+	BaseURL *url.URL
+
+	sync.Mutex
+	// Installation tokens by owner/repo
+	tokens map[string]installationToken
+}
+
+// NewGitHubApp returns the App configured in the settings, nil if there's
+// none.
+func NewGitHubApp(config *setting.Config) (*GitHubApp, error) {
+	web := config.GetWeb()
+	if web.GitHubAppID == 0 || len(web.GitHubAppPrivateKeyFile) == 0 {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadFile(web.GitHubAppPrivateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ParseGitHubAppKey(data)
+	if err != nil {
+		return nil, err
+	}
+	return &GitHubApp{ID: web.GitHubAppID, Key: key}, nil
+}
+
+// ParseGitHubAppKey parses the PEM private key generated by GitHub.
+func ParseGitHubAppKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("Invalid GitHub App private key")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("The GitHub App private key isn't a RSA key")
+	}
+	return rsaKey, nil
+}
+
+// JWT returns the token authenticating the App itself, valid for a few
+// minutes.
+func (a *GitHubApp) JWT() (string, error) {
+	now := time.Now()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		// Allow some clock drift
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": strconv.FormatInt(a.ID, 10),
+	})
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." +
+		base64.RawURLEncoding.EncodeToString(claims)
+
+	hash := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, a.Key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func (a *GitHubApp) newClient(httpClient *http.Client) *github.Client {
+	client := github.NewClient(httpClient)
+	if a.BaseURL != nil {
+		client.BaseURL = a.BaseURL
+	}
+	return client
+}
+
+func (a *GitHubApp) appRequest(method, urlStr string, v interface{}) error {
+	jwt, err := a.JWT()
+	if err != nil {
+		return err
+	}
+	client := a.newClient(nil)
+	req, err := client.NewRequest(method, urlStr, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", githubAppMediaType)
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	_, err = client.Do(stdctx.Background(), req, v)
+	return err
+}
+
+// installationToken exchanges the JWT of the App for a token of its
+// installation on the repository, reused until it expires.
+func (a *GitHubApp) installationToken(owner, repo string) (string, error) {
+	a.Lock()
+	defer a.Unlock()
+	if a.tokens == nil {
+		a.tokens = make(map[string]installationToken)
+	}
+
+	key := owner + "/" + repo
+	if t, ok := a.tokens[key]; ok && time.Now().Add(time.Minute).Before(t.ExpiresAt) {
+		return t.Token, nil
+	}
+
+	installation := struct {
+		ID int64 `json:"id"`
+	}{}
+	if err := a.appRequest("GET", fmt.Sprintf("repos/%s/%s/installation", owner, repo), &installation); err != nil {
+		return "", err
+	}
+
+	t := installationToken{}
+	if err := a.appRequest("POST", fmt.Sprintf("app/installations/%d/access_tokens", installation.ID), &t); err != nil {
+		return "", err
+	}
+	a.tokens[key] = t
+	return t.Token, nil
+}
+
+// Client returns a client authenticated as the installation of the App on
+// the repository.
+func (a *GitHubApp) Client(owner, repo string) (*github.Client, error) {
+	token, err := a.installationToken(owner, repo)
+	if err != nil {
+		return nil, err
+	}
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
+	return a.newClient(oauth2.NewClient(oauth2.NoContext, ts)), nil
+}
@@ -0,0 +1,72 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package mottainai_test
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/MottainaiCI/mottainai-server/pkg/mottainai"
+)
+
+var _ = Describe("GitHub App", func() {
+	key, _ := rsa.GenerateKey(rand.Reader, 1024)
+
+	It("Parses the private key", func() {
+		data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+		parsed, err := ParseGitHubAppKey(data)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(parsed.N).To(Equal(key.N))
+
+		_, err = ParseGitHubAppKey([]byte("foo"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Signs the JWT of the App", func() {
+		app := &GitHubApp{ID: 42, Key: key}
+		jwt, err := app.JWT()
+		Expect(err).ToNot(HaveOccurred())
+
+		parts := strings.Split(jwt, ".")
+		Expect(parts).To(HaveLen(3))
+		hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		Expect(rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, hash[:], signature)).ToNot(HaveOccurred())
+
+		data, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		claims := map[string]interface{}{}
+		Expect(json.Unmarshal(data, &claims)).ToNot(HaveOccurred())
+		Expect(claims["iss"]).To(Equal("42"))
+		Expect(claims["exp"].(float64) - claims["iat"].(float64)).To(BeNumerically("<=", 600))
+	})
+})
@@ -0,0 +1,80 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package mottainai
+
+import (
+	"io/ioutil"
+	"runtime"
+	"strconv"
+	"strings"
+
+	nodes "github.com/MottainaiCI/mottainai-server/pkg/nodes"
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+	agenttasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+)
+
+// NodeLabels returns the labels reported by the agent on registration:
+// the custom labels from the configuration plus the executors supported,
+// architecture, kernel and free disk space of the build path (in GB).
+// Builtin labels take precedence over custom ones.
+func NodeLabels(config *setting.Config, executors []string) []string {
+	labels := make(map[string]string)
+	for k, v := range config.GetAgent().Labels {
+		labels[k] = v
+	}
+
+	for _, e := range executors {
+		labels["executor."+e] = "true"
+	}
+	labels["arch"] = runtime.GOARCH
+	labels["os"] = runtime.GOOS
+
+	if release, err := ioutil.ReadFile("/proc/sys/kernel/osrelease"); err == nil {
+		labels["kernel"] = strings.TrimSpace(string(release))
+	}
+
+	if _, free, err := diskUsage(config.GetAgent().BuildPath); err == nil {
+		labels["disk.free_gb"] = strconv.FormatUint(free/1024, 10)
+	}
+
+	return nodes.LabelList(labels)
+}
+
+// NodeSelectorQueue returns the queue satisfying the node selectors of the
+// given tasks, or an empty string if none of them carries a selector.
+// Tasks are routed on the private queue of a node that matches all the
+// selectors, supports the tasks executors and didn't miss the
+// web.node_deadline of its reports.
+func NodeSelectorQueue(config *setting.Config, nodelist []nodes.Node, tasks ...agenttasks.Task) (string, error) {
+	selector := make([]string, 0)
+	executors := make([]string, 0)
+	for _, t := range tasks {
+		selector = append(selector, t.NodeSelector...)
+		executors = append(executors, "executor."+t.Type)
+	}
+	if len(selector) == 0 {
+		return "", nil
+	}
+
+	return nodes.SelectQueue(nodelist, append(selector, executors...), config.GetWeb().NodeDeadline)
+}
@@ -0,0 +1,76 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package mottainai_test
+
+import (
+	"time"
+
+	node "github.com/MottainaiCI/mottainai-server/pkg/nodes"
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+	agenttasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/MottainaiCI/mottainai-server/pkg/mottainai"
+)
+
+var _ = Describe("Node selector", func() {
+	config := setting.NewConfig(nil)
+	config.Unmarshal()
+	now := time.Now().Format(setting.Timeformat)
+	nodes := []node.Node{
+		{PrivateQueue: "docker-amd64", LastReport: now,
+			Labels: node.ParseLabels([]string{"arch=amd64", "executor.docker=true"})},
+		{PrivateQueue: "podman-arm64", LastReport: now,
+			Labels: node.ParseLabels([]string{"arch=arm64", "executor.podman=true"})},
+		{PrivateQueue: "docker-s390x", LastReport: "20200101000000",
+			Labels: node.ParseLabels([]string{"arch=s390x", "executor.docker=true"})},
+	}
+
+	Context("Without a node selector", func() {
+		It("Doesn't compute a queue", func() {
+			q, err := NodeSelectorQueue(config, nodes, agenttasks.Task{Type: "docker"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(q).To(Equal(""))
+		})
+	})
+
+	Context("With a node selector", func() {
+		It("Routes to the private queue of the matching node", func() {
+			q, err := NodeSelectorQueue(config, nodes, agenttasks.Task{Type: "podman", NodeSelector: []string{"arch=arm64"}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(q).To(Equal("podman-arm64"))
+		})
+
+		It("Skips the nodes which missed the deadline of their reports", func() {
+			_, err := NodeSelectorQueue(config, nodes, agenttasks.Task{Type: "docker", NodeSelector: []string{"arch=s390x"}})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("Requires the node to support the task executor", func() {
+			_, err := NodeSelectorQueue(config, nodes, agenttasks.Task{Type: "docker", NodeSelector: []string{"arch=arm64"}})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("No registered node satisfies"))
+		})
+	})
+})
@@ -0,0 +1,130 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package mottainai
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	database "github.com/MottainaiCI/mottainai-server/pkg/db"
+	leader "github.com/MottainaiCI/mottainai-server/pkg/leader"
+	logging "github.com/MottainaiCI/mottainai-server/pkg/logging"
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+	logrus "github.com/sirupsen/logrus"
+)
+
+// NewLeaderBackend returns the configured storage of the leases.
+func NewLeaderBackend(config *setting.Config, d *database.Database) (leader.Backend, error) {
+	switch config.GetWeb().LeaderBackend {
+	case "", "database":
+		return d.Driver, nil
+	case "redis":
+		if !strings.HasPrefix(config.GetBroker().Broker, "redis://") {
+			return nil, errors.New("The redis leader backend requires a redis broker")
+		}
+		return leader.NewRedisBackend(config.GetBroker().Broker), nil
+	}
+	return nil, errors.New("Invalid leader backend: " + config.GetWeb().LeaderBackend)
+}
+
+// StartLeaderElection maps the elector of the periodic jobs and keeps
+// renewing its lease until stop is closed. The leader also reloads the
+// plans when they are changed through another replica.
+func (m *Mottainai) StartLeaderElection(stop <-chan struct{}) error {
+	var rerr error
+	m.Invoke(func(config *setting.Config, d *database.Database, l *logging.Logger) {
+		backend, err := NewLeaderBackend(config, d)
+		if err != nil {
+			rerr = err
+			return
+		}
+
+		lease := time.Duration(config.GetWeb().LeaderLease) * time.Second
+		elector := leader.NewElector(backend, leader.PERIODIC_JOBS_LEASE, leader.ReplicaID(), lease)
+		m.Map(elector)
+
+		l.WithFields(logrus.Fields{
+			"component": "leader",
+			"replica":   elector.ID,
+			"backend":   config.GetWeb().LeaderBackend,
+			"lease":     lease.String(),
+		}).Info("Starting leader election")
+
+		wasLeader := false
+		go elector.Run(stop, func(isLeader bool, err error) {
+			if err != nil {
+				l.WithFields(logrus.Fields{
+					"component": "leader",
+					"error":     err,
+				}).Warn("Failed renewing the lease")
+			}
+			if isLeader != wasLeader {
+				msg := "Lost leadership"
+				if isLeader {
+					msg = "Acquired leadership"
+				}
+				l.WithFields(logrus.Fields{
+					"component": "leader",
+					"replica":   elector.ID,
+				}).Info(msg)
+				wasLeader = isLeader
+				if isLeader {
+					go m.CatchUpPlans()
+				}
+			}
+			if isLeader && m.plansChanged() {
+				m.ReloadCron()
+			}
+		})
+	})
+	return rerr
+}
+
+// IsLeader returns true if this replica runs the periodic jobs. Without an
+// elector (e.g. a server not started with Start) the replica is the leader.
+func (m *Mottainai) IsLeader() bool {
+	res := true
+	m.Invoke(func(e *leader.Elector) {
+		res = e.IsLeader()
+	})
+	return res
+}
+
+func (m *Mottainai) plansFingerprint() string {
+	plans := make([]string, 0)
+	m.Invoke(func(d *database.Database, config *setting.Config) {
+		for _, p := range d.Driver.AllPlans(config) {
+			plans = append(plans, planFingerprint(p))
+		}
+	})
+	sort.Strings(plans)
+	return strings.Join(plans, ";")
+}
+
+func (m *Mottainai) plansChanged() bool {
+	cronLock.Lock()
+	defer cronLock.Unlock()
+	return m.plansFingerprint() != loadedPlans
+}
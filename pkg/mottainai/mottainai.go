@@ -28,6 +28,9 @@ import (
 	"net/http"
 	"os"
 	"path"
+	"sort"
+	"strings"
+	"sync"
 
 	logging "github.com/MottainaiCI/mottainai-server/pkg/logging"
 	taskmanager "github.com/MottainaiCI/mottainai-server/pkg/tasks/manager"
@@ -74,6 +77,7 @@ func Classic(config *setting.Config) *Mottainai {
 	database.NewDatabase(config)
 
 	m.Map(database.DBInstance)
+	m.SetupEvents()
 	m.Use(logging.MacaronLogger())
 	m.Use(macaron.Recovery())
 
@@ -256,6 +260,7 @@ func (m *Mottainai) Start() error {
 		m.Map(c)
 		m.Map(m)
 		m.Map(m.Macaron)
+		m.StartEventSinks()
 		c.Start()
 		m.LoadPlans()
 		// For now
@@ -267,7 +272,15 @@ func (m *Mottainai) Start() error {
 			"component": "core",
 			"url":       m.url(),
 		}).Info("WebUI listening")
+		stop := make(chan struct{})
+		if err := m.StartLeaderElection(stop); err != nil {
+			l.WithFields(logrus.Fields{
+				"component": "leader",
+				"error":     err,
+			}).Fatal("Failed to start leader election")
+		}
 		m.HealthCheckRun(config.GetWeb().HealthCheckInterval) // Start server HealthCheck daemon
+		m.NamespaceLockRun()
 
 		//m.Run()
 		var err error
@@ -284,6 +297,7 @@ func (m *Mottainai) Start() error {
 				"error":     err,
 			}).Fatal("Failed to start server")
 		}
+		close(stop)
 		c.Stop()
 	})
 
@@ -313,13 +327,44 @@ func (m *Mottainai) ProcessPipeline(docID string) (bool, error) {
 			return
 		}
 
-		if err := m.processablePipeline(docID); err != nil {
+		// Pipelines publishing to a namespace in use wait for its lock
+		queued, err := m.acquirePipelineNamespaces(d, pip)
+		if database.IsConflict(err) {
+			rerr = err
+			result = false
+			return
+		} else if err != nil {
 			for _, t := range pip.Tasks {
-				m.FailTask(t.ID, err.Error())
+				m.FailTask(t.ID, "Failed to get task information while checking if it is processable or not")
 			}
 			rerr = err
 			result = false
 			return
+		} else if queued {
+			l.WithFields(logrus.Fields{
+				"component":   "core",
+				"pipeline_id": docID,
+			}).Info("Pipeline queued behind the namespace lock")
+			result = false
+			return
+		}
+
+		tasks := make([]agenttasks.Task, 0)
+		for _, t := range pip.Tasks {
+			tasks = append(tasks, t)
+		}
+		// All the pipeline tasks are sent on the same queue, so the node
+		// has to satisfy the selectors of every task
+		nq, err := NodeSelectorQueue(config, d.Driver.AllNodes(), tasks...)
+		if err != nil {
+			for _, t := range pip.Tasks {
+				m.FailTask(t.ID, "Could not send pipeline: "+err.Error())
+			}
+			rerr = errors.New("Could not send pipeline: " + err.Error())
+			result = false
+			return
+		} else if len(nq) > 0 {
+			pip.Queue = nq
 		}
 
 		var broker *Broker
@@ -442,131 +487,40 @@ func (m *Mottainai) FailTask(task, reason string) {
 			"task_id":   task,
 			"error":     reason,
 		}).Error(reason)
-		d.Driver.UpdateTask(task, map[string]interface{}{
-			"result": "error",
-			"status": "done",
+		err := d.TransitionTask(task, setting.TASK_STATE_DONE, map[string]interface{}{
+			"result": setting.TASK_RESULT_ERROR,
 			"output": reason,
 		})
-	})
-}
-
-func overlappingTasks(taskList []*agenttasks.Task, currentTask agenttasks.Task, s setting.Setting) bool {
-
-	// If setting is enabled, make it pass only if in append mode
-	if s.IsEnabled() && currentTask.IsPublishAppendMode() {
-		return false
-	}
-
-	// consider overlapping if setting is disabled and namespace overlaps
-	for _, t := range taskList {
-		if t.TagNamespace == currentTask.TagNamespace {
-			return true
-		}
-	}
-
-	return false
-}
-
-func (m *Mottainai) getPendingTasks() ([]*agenttasks.Task, error) {
-	var t []*agenttasks.Task
-	var resultError error
-	m.Invoke(func(d *database.Database) {
-
-		// Check for waiting/running tasks and do not send in such case
-		wtasks, err := d.Driver.GetTaskByStatus(d.Config, "waiting")
-		if err != nil {
-			resultError = errors.New("Failed to get task by status")
-			return
-		}
-		for _, k := range wtasks {
-			t = append(t, &k)
-		}
-
-		rtasks, err := d.Driver.GetTaskByStatus(d.Config, "running")
-		if err != nil {
-			resultError = errors.New("Failed to get task by status")
-			return
-		}
-		for _, k := range rtasks {
-			t = append(t, &k)
-		}
-
-	})
-	return t, resultError
-}
-
-func (m *Mottainai) processableTask(docID string) error {
-	// TODO: Add proper locks to db schema, this is racy
-	var resultError error
-	m.Invoke(func(d *database.Database) {
-
-		// Check setting if we have to process this.
-		if protectOverwrite, _ := d.Driver.GetSettingByKey(setting.SYSTEM_PROTECT_NAMESPACE_OVERWRITE); protectOverwrite.IsDisabled() {
-			return
-		}
-		parallelAppend, _ := d.Driver.GetSettingByKey(setting.SYSTEM_PROTECT_NAMESPACE_PARALLEL_APPEND)
-
-		task, err := d.Driver.GetTask(d.Config, docID)
-		if err != nil {
-			resultError = errors.New("Failed to get task information while checking if it is processable or not")
-			return
-		}
-
-		// Check for waiting/running tasks and do not send in such case
-		p, err := m.getPendingTasks()
 		if err != nil {
-			resultError = errors.New("Failed to get task information while checking if it is processable or not")
-			return
-		}
-		if overlappingTasks(p, task, parallelAppend) {
-			resultError = errors.New("Task targeting same namespace is waiting to start")
-			return
-		}
-
-	})
-	return resultError
-}
-
-func (m *Mottainai) processablePipeline(docID string) error {
-	// TODO: Add proper locks to db schema, this is racy
-	var resultError error
-	m.Invoke(func(d *database.Database) {
-
-		// Check setting if we have to process this.
-		if protectOverwrite, _ := d.Driver.GetSettingByKey(setting.SYSTEM_PROTECT_NAMESPACE_OVERWRITE); protectOverwrite.IsDisabled() {
-			return
-		}
-		parallelAppend, _ := d.Driver.GetSettingByKey(setting.SYSTEM_PROTECT_NAMESPACE_PARALLEL_APPEND)
-
-		pip, err := d.Driver.GetPipeline(d.Config, docID)
-		if err != nil {
-			resultError = errors.New("Failed to get task information while checking if it is processable or not")
-			return
-		}
-
-		p, err := m.getPendingTasks()
-		if err != nil {
-			resultError = errors.New("Failed to get task information while checking if it is processable or not")
+			l.WithFields(logrus.Fields{
+				"component": "core",
+				"task_id":   task,
+				"error":     err.Error(),
+			}).Warn("Could not mark the task as failed")
 			return
 		}
-		for _, t := range pip.Tasks {
-			if overlappingTasks(p, t, parallelAppend) {
-				resultError = errors.New("Task targeting same namespace is waiting to start")
-				return
-			}
-		}
-
+		go m.NotifyTask(task)
 	})
-	return resultError
 }
 
 func (m *Mottainai) SendTask(docID string) (bool, error) {
 	result := false
-	var err error
+	var rerr error
 	m.Invoke(func(d *database.Database, server *MottainaiServer, l *logging.Logger, th *taskmanager.TaskHandler, config *setting.Config) {
 
-		if err := m.processableTask(docID); err != nil {
-			m.FailTask(docID, err.Error())
+		// Tasks publishing to a namespace in use wait for its lock
+		queued, err := m.acquireNamespace(d, docID)
+		if database.IsConflict(err) {
+			rerr = err
+			return
+		} else if err != nil {
+			m.FailTask(docID, "Failed to get task information while checking if it is processable or not")
+			return
+		} else if queued {
+			l.WithFields(logrus.Fields{
+				"component": "core",
+				"task_id":   docID,
+			}).Info("Task queued behind the namespace lock")
 			return
 		}
 
@@ -583,6 +537,16 @@ func (m *Mottainai) SendTask(docID string) (bool, error) {
 			q = task.Queue
 		}
 
+		// The node selector takes precedence over the requested queue
+		nq, serr := NodeSelectorQueue(config, d.Driver.AllNodes(), task)
+		if serr != nil {
+			rerr = errors.New("Could not send task: " + serr.Error())
+			m.FailTask(docID, rerr.Error())
+			return
+		} else if len(nq) > 0 {
+			q = nq
+		}
+
 		l.WithFields(logrus.Fields{
 			"component": "core",
 			"task_id":   docID,
@@ -590,8 +554,6 @@ func (m *Mottainai) SendTask(docID string) (bool, error) {
 		}).Info("Sending task")
 		broker := server.Get(q, config)
 
-		d.Driver.UpdateTask(docID, map[string]interface{}{"status": "waiting", "result": "none"})
-
 		l.WithFields(logrus.Fields{
 			"component": "core",
 			"task_id":   docID,
@@ -616,36 +578,62 @@ func (m *Mottainai) SendTask(docID string) (bool, error) {
 			"task_id":   docID,
 		}).Info("Task sent")
 	})
-	return result, err
+	return result, rerr
 }
 
+var (
+	// cronLock serializes the reloads of the plans, loadedPlans is the
+	// fingerprint of the plans in the cron
+	cronLock    sync.Mutex
+	loadedPlans string
+)
+
 func (m *Mottainai) LoadPlans() {
-	m.Invoke(func(c *cron.Cron, d *database.Database, l *logging.Logger, config *setting.Config) {
+	cronLock.Lock()
+	defer cronLock.Unlock()
+	m.loadPlans()
+}
 
+func (m *Mottainai) loadPlans() {
+	m.Invoke(func(c *cron.Cron, d *database.Database, l *logging.Logger, config *setting.Config) {
+		loaded := make([]string, 0)
 		for _, plan := range d.Driver.AllPlans(config) {
+			if plan.IsManual() {
+				continue
+			}
 			l.WithFields(logrus.Fields{
 				"component": "core",
 				"plan_id":   plan.ID,
 			}).Debug("Loading plan")
+			schedule, err := plan.Schedule()
+			if err != nil {
+				l.WithFields(logrus.Fields{
+					"component": "core",
+					"plan_id":   plan.ID,
+					"error":     err,
+				}).Error("Invalid plan schedule")
+				continue
+			}
 			id := plan.ID
-			c.AddFunc(plan.Planned, func() {
-				plan, _ := d.Driver.GetPlan(config, id)
-				plan.Task.Reset()
-				docID, _ := d.Driver.CreateTask(plan.Task.ToMap())
-				m.SendTask(docID)
-			})
+			c.Schedule(schedule, cron.FuncJob(func() {
+				m.runPlannedTask(id)
+			}))
+			loaded = append(loaded, planFingerprint(plan))
 		}
-
+		sort.Strings(loaded)
+		loadedPlans = strings.Join(loaded, ";")
 	})
 }
 
 func (m *Mottainai) ReloadCron() {
+	cronLock.Lock()
+	defer cronLock.Unlock()
 
 	m.Invoke(func(c *cron.Cron, d *database.Database) {
 		c.Stop()
 		c = cron.New()
 		m.Map(c)
-		m.LoadPlans()
+		m.loadPlans()
 		c.Start()
 	})
 
@@ -0,0 +1,327 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package mottainai
+
+import (
+	"net/url"
+	"sort"
+	"time"
+
+	database "github.com/MottainaiCI/mottainai-server/pkg/db"
+	dbcommon "github.com/MottainaiCI/mottainai-server/pkg/db/common"
+	leader "github.com/MottainaiCI/mottainai-server/pkg/leader"
+	logging "github.com/MottainaiCI/mottainai-server/pkg/logging"
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+	agenttasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+	"github.com/mudler/anagent"
+	logrus "github.com/sirupsen/logrus"
+)
+
+// Seconds between the checks of the queues of the namespace locks
+const NAMESPACE_LOCK_INTERVAL = 10
+
+// Prefix of the leases serializing the checks of the lock of a namespace
+// between the replicas, so two tasks sent together can't both take it
+const NAMESPACE_LOCK_LEASE = "namespace_lock:"
+
+// Seconds a lease of a namespace is held at most, if the replica checking
+// its lock dies meanwhile
+const NAMESPACE_LOCK_LEASE_TTL = 30
+
+// lockNamespaces takes the leases of the given namespaces for the holder,
+// waiting for the ones checked by other replicas. The returned function
+// releases them.
+func lockNamespaces(d *database.Database, holder string, namespaces ...string) (func(), error) {
+	sort.Strings(namespaces)
+	ttl := time.Duration(NAMESPACE_LOCK_LEASE_TTL) * time.Second
+
+	taken := make([]string, 0)
+	release := func() {
+		for _, name := range taken {
+			d.Driver.ReleaseLease(name, holder)
+		}
+	}
+	for _, namespace := range namespaces {
+		name := NAMESPACE_LOCK_LEASE + url.QueryEscape(namespace)
+		if len(taken) > 0 && taken[len(taken)-1] == name {
+			continue
+		}
+
+		deadline := time.Now().Add(ttl)
+		for {
+			lease, err := d.Driver.AcquireLease(name, holder, ttl)
+			if err != nil {
+				release()
+				return nil, err
+			}
+			if lease.Holder == holder {
+				break
+			}
+			if time.Now().After(deadline) {
+				release()
+				return nil, dbcommon.ErrConflict
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		taken = append(taken, name)
+	}
+	return release, nil
+}
+
+// sameBuild returns true if the tasks are the same, or belong to the same
+// pipeline.
+func sameBuild(a, b agenttasks.Task) bool {
+	return a.ID == b.ID || (len(a.PipelineID) > 0 && a.PipelineID == b.PipelineID)
+}
+
+// namespaceLocked returns true if the task has to wait for the lock of the
+// namespace it publishes to: another task publishing there is in progress,
+// or was queued before. The tasks of a pipeline don't lock each other.
+func namespaceLocked(d *database.Database, task agenttasks.Task) (bool, error) {
+	if len(task.TagNamespace) == 0 {
+		return false, nil
+	}
+
+	// Check setting if we have to process this.
+	if protectOverwrite, _ := d.Driver.GetSettingByKey(setting.SYSTEM_PROTECT_NAMESPACE_OVERWRITE); protectOverwrite.IsDisabled() {
+		return false, nil
+	}
+	// If setting is enabled, make it pass only if in append mode
+	if parallelAppend, _ := d.Driver.GetSettingByKey(setting.SYSTEM_PROTECT_NAMESPACE_PARALLEL_APPEND); parallelAppend.IsEnabled() && task.IsPublishAppendMode() {
+		return false, nil
+	}
+
+	holders, err := d.NamespaceHolders(task.TagNamespace)
+	if err != nil {
+		return false, err
+	}
+	for _, t := range holders {
+		if !sameBuild(t, task) {
+			return true, nil
+		}
+	}
+
+	queue, err := d.NamespaceQueue(task.TagNamespace)
+	if err != nil {
+		return false, err
+	}
+	return len(queue) > 0 && !sameBuild(queue[0], task), nil
+}
+
+// acquireNamespace moves the task to the waiting state, or queues it behind
+// the lock of its namespace. It returns true if the task was queued.
+func (m *Mottainai) acquireNamespace(d *database.Database, docID string) (bool, error) {
+	task, err := d.Driver.GetTask(d.Config, docID)
+	if err != nil {
+		return false, err
+	}
+	task.ID = docID
+
+	if len(task.TagNamespace) > 0 {
+		release, err := lockNamespaces(d, leader.ReplicaID()+"/"+docID, task.TagNamespace)
+		if err != nil {
+			return false, err
+		}
+		defer release()
+	}
+
+	// Refuse to send again tasks still in progress
+	if !agenttasks.IsSendable(task.Status) {
+		return false, &agenttasks.TransitionError{ID: docID, From: task.Status, To: setting.TASK_STATE_WAIT}
+	}
+
+	locked, err := namespaceLocked(d, task)
+	if err != nil {
+		return false, err
+	}
+
+	// The notifications are sent again once the task ends
+	update := map[string]interface{}{
+		"status":              setting.TASK_STATE_WAIT,
+		"result":              setting.TASK_RESULT_UNKNOWN,
+		"notification_status": []string{},
+	}
+	if locked {
+		if task.IsQueued() {
+			return true, nil
+		}
+		update["status"] = setting.TASK_STATE_QUEUED
+		update["queued_time"] = time.Now().UTC().Format(setting.QueueTimeformat)
+	}
+
+	// Checking the revision, the same queued task can't be sent twice
+	// by different replicas
+	return locked, d.Driver.CompareAndSwapTask(docID, task.Revision, update)
+}
+
+// acquirePipelineNamespaces queues the tasks of the pipeline publishing to
+// a namespace if any of them has to wait for its lock, otherwise it moves
+// them back to the waiting state. It returns true if the pipeline was
+// queued.
+func (m *Mottainai) acquirePipelineNamespaces(d *database.Database, pip agenttasks.Pipeline) (bool, error) {
+	namespaces := make([]string, 0)
+	for _, t := range pip.Tasks {
+		if len(t.TagNamespace) > 0 {
+			namespaces = append(namespaces, t.TagNamespace)
+		}
+	}
+	if len(namespaces) == 0 {
+		return false, nil
+	}
+
+	release, err := lockNamespaces(d, leader.ReplicaID()+"/"+pip.ID, namespaces...)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+
+	tasks := make([]agenttasks.Task, 0)
+	locked := false
+	for _, pt := range pip.Tasks {
+		if len(pt.TagNamespace) == 0 {
+			continue
+		}
+		t, err := d.Driver.GetTask(d.Config, pt.ID)
+		if err != nil {
+			return false, err
+		}
+		t.ID = pt.ID
+		tasks = append(tasks, t)
+
+		l, err := namespaceLocked(d, t)
+		if err != nil {
+			return false, err
+		}
+		locked = locked || l
+	}
+
+	queued := time.Now().UTC().Format(setting.QueueTimeformat)
+	for _, t := range tasks {
+		var err error
+		if !locked {
+			err = d.TransitionTask(t.ID, setting.TASK_STATE_WAIT, nil)
+		} else if !t.IsQueued() {
+			err = d.TransitionTask(t.ID, setting.TASK_STATE_QUEUED, map[string]interface{}{"queued_time": queued})
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+	return locked, nil
+}
+
+// failQueued fails a task which waited too long for the lock of its
+// namespace, with all the tasks of its pipeline.
+func (m *Mottainai) failQueued(d *database.Database, task agenttasks.Task, reason string) {
+	if len(task.PipelineID) == 0 {
+		m.FailTask(task.ID, reason)
+		return
+	}
+	pip, err := d.Driver.GetPipeline(d.Config, task.PipelineID)
+	if err != nil {
+		m.FailTask(task.ID, reason)
+		return
+	}
+	for _, t := range pip.Tasks {
+		m.FailTask(t.ID, reason)
+	}
+}
+
+// ReleaseNamespaces sends the first queued task (or pipeline) of the given
+// namespace (or of all the namespaces, if empty) once the namespace lock is
+// free, and fails the tasks which waited longer than
+// web.namespace_lock_timeout.
+func (m *Mottainai) ReleaseNamespaces(namespace string) {
+	m.Invoke(func(d *database.Database, config *setting.Config, l *logging.Logger) {
+		queue, err := d.NamespaceQueue(namespace)
+		if err != nil {
+			l.WithFields(logrus.Fields{
+				"component": "namespace_lock",
+				"error":     err,
+			}).Error("Failed to get the queued tasks")
+			return
+		}
+
+		timeout := time.Duration(config.GetWeb().NamespaceLockTimeout) * time.Second
+		released := make(map[string]bool)
+		pipelines := make(map[string]bool)
+		for _, t := range queue {
+			// The tasks of a pipeline are handled together
+			if len(t.PipelineID) > 0 && pipelines[t.PipelineID] {
+				released[t.TagNamespace] = true
+				continue
+			}
+
+			queued, err := time.Parse(setting.QueueTimeformat, t.QueuedTime)
+			if timeout > 0 && err == nil && time.Now().UTC().Sub(queued) > timeout {
+				if len(t.PipelineID) > 0 {
+					pipelines[t.PipelineID] = true
+				}
+				m.failQueued(d, t, "Timed out waiting for the lock of namespace "+t.TagNamespace)
+				continue
+			}
+
+			// Only the head of each queue can take the lock
+			if released[t.TagNamespace] {
+				continue
+			}
+			released[t.TagNamespace] = true
+
+			if len(t.PipelineID) > 0 {
+				pipelines[t.PipelineID] = true
+				if _, err := m.ProcessPipeline(t.PipelineID); err != nil && !database.IsConflict(err) {
+					l.WithFields(logrus.Fields{
+						"component":   "namespace_lock",
+						"pipeline_id": t.PipelineID,
+						"namespace":   t.TagNamespace,
+						"error":       err,
+					}).Error("Failed to send the queued pipeline")
+				}
+				continue
+			}
+
+			if _, err := m.SendTask(t.ID); err != nil && !database.IsConflict(err) {
+				l.WithFields(logrus.Fields{
+					"component": "namespace_lock",
+					"task_id":   t.ID,
+					"namespace": t.TagNamespace,
+					"error":     err,
+				}).Error("Failed to send the queued task")
+			}
+		}
+	})
+}
+
+// NamespaceLockRun periodically releases the namespace locks of the tasks
+// which ended.
+func (m *Mottainai) NamespaceLockRun() {
+	runner := anagent.New()
+	runner.TimerSeconds(int64(NAMESPACE_LOCK_INTERVAL), true, func() {
+		// Only the leader replica releases the queued tasks
+		if m.IsLeader() {
+			m.ReleaseNamespaces("")
+		}
+	})
+
+	go runner.Start()
+}
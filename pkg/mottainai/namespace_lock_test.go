@@ -0,0 +1,101 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package mottainai_test
+
+import (
+	"io/ioutil"
+	"os"
+
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+	agenttasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+	taskmanager "github.com/MottainaiCI/mottainai-server/pkg/tasks/manager"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/MottainaiCI/mottainai-server/pkg/mottainai"
+	helpers "github.com/MottainaiCI/mottainai-server/tests/helpers"
+)
+
+var _ = Describe("Namespace lock", func() {
+
+	dir, _ := ioutil.TempDir("", "namespace_lock_test")
+	defer os.RemoveAll(dir) // clean up
+	helpers.InitConfig(dir)
+	m := Classic(helpers.Config)
+	db := helpers.InitDB(helpers.Config)
+	m.Map(NewServer())
+	m.Map(taskmanager.DefaultTaskHandler(helpers.Config))
+
+	Context("When a task publishing to the namespace is running", func() {
+		It("Queues the pipelines publishing there", func() {
+			_, err := db.Driver.CreateSetting(map[string]interface{}{
+				"key":   setting.SYSTEM_PROTECT_NAMESPACE_OVERWRITE,
+				"value": "true",
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = db.Driver.CreateTask(map[string]interface{}{
+				"status":        setting.TASK_STATE_RUNNING,
+				"tag_namespace": "foo",
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			pip := &agenttasks.Pipeline{
+				Name: "publish",
+				Tasks: map[string]agenttasks.Task{
+					"build":   {Type: "docker", TagNamespace: "foo"},
+					"publish": {Type: "docker", TagNamespace: "foo"},
+					"test":    {Type: "docker"},
+				},
+				Chain: []string{"build", "publish", "test"},
+			}
+			id, err := db.CreatePipelineWithTasks(pip)
+			Expect(err).ToNot(HaveOccurred())
+
+			sent, err := m.ProcessPipeline(id)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sent).To(BeFalse())
+
+			for name, status := range map[string]string{
+				"build":   setting.TASK_STATE_QUEUED,
+				"publish": setting.TASK_STATE_QUEUED,
+				"test":    setting.TASK_STATE_WAIT,
+			} {
+				t, err := db.Driver.GetTask(helpers.Config, pip.Tasks[name].ID)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(t.Status).Should(Equal(status))
+			}
+
+			queue, err := db.NamespaceQueue("foo")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(queue).Should(HaveLen(2))
+			Expect(queue[0].PipelineID).Should(Equal(id))
+
+			// The pipeline stays queued while the lock is held
+			m.ReleaseNamespaces("foo")
+			queue, err = db.NamespaceQueue("foo")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(queue).Should(HaveLen(2))
+		})
+	})
+})
@@ -0,0 +1,248 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package mottainai
+
+import (
+	"sync"
+
+	database "github.com/MottainaiCI/mottainai-server/pkg/db"
+	logging "github.com/MottainaiCI/mottainai-server/pkg/logging"
+	notification "github.com/MottainaiCI/mottainai-server/pkg/notification"
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+	agenttasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+	logrus "github.com/sirupsen/logrus"
+)
+
+// Serializes the checks of the pipelines whose tasks end together, so their
+// notifications are sent once
+var pipelineNotifyLock sync.Mutex
+
+// taskResult returns the result of an ended task for the notification rules.
+func taskResult(t *agenttasks.Task) string {
+	if t.IsDone() && t.IsSuccess() && t.Result != setting.TASK_RESULT_ERROR {
+		return agenttasks.NOTIFY_ON_SUCCESS
+	}
+	return agenttasks.NOTIFY_ON_FAILURE
+}
+
+// pipelineResult returns the result of the pipeline for the notification
+// rules, empty while some of its tasks are still in progress.
+func pipelineResult(d *database.Database, pip agenttasks.Pipeline) string {
+	ans := agenttasks.NOTIFY_ON_SUCCESS
+	for _, pt := range pip.Tasks {
+		t, err := d.Driver.GetTask(d.Config, pt.ID)
+		if err != nil || !agenttasks.IsFinalState(t.Status) {
+			return ""
+		}
+		if taskResult(&t) == agenttasks.NOTIFY_ON_FAILURE {
+			ans = agenttasks.NOTIFY_ON_FAILURE
+		}
+	}
+	return ans
+}
+
+// previousTaskResult returns the result of the latest task ended before the
+// given one with the same name and owner, empty if none.
+func previousTaskResult(d *database.Database, task agenttasks.Task) string {
+	if task.Name == "" {
+		return ""
+	}
+	tasks, err := d.Driver.GetTaskByStatus(d.Config, setting.TASK_STATE_DONE)
+	if err != nil {
+		return ""
+	}
+
+	var previous *agenttasks.Task
+	for _, t := range tasks {
+		if t.ID == task.ID || t.Name != task.Name || t.Owner != task.Owner ||
+			t.EndTime > task.EndTime {
+			continue
+		}
+		if previous == nil || t.EndTime > previous.EndTime {
+			p := t
+			previous = &p
+		}
+	}
+	if previous == nil {
+		return ""
+	}
+	return taskResult(previous)
+}
+
+// previousPipelineResult returns the result of the latest pipeline created
+// before the given one with the same name and owner, empty if none.
+func previousPipelineResult(d *database.Database, pip agenttasks.Pipeline) string {
+	if pip.Name == "" {
+		return ""
+	}
+
+	var previous *agenttasks.Pipeline
+	for _, p := range d.Driver.AllPipelines(d.Config) {
+		if p.ID == pip.ID || p.Name != pip.Name || p.Owner != pip.Owner ||
+			p.CreatedTime > pip.CreatedTime {
+			continue
+		}
+		if previous == nil || p.CreatedTime > previous.CreatedTime {
+			prev := p
+			previous = &prev
+		}
+	}
+	if previous == nil {
+		return ""
+	}
+	return pipelineResult(d, *previous)
+}
+
+// matchingNotifications returns the rules matching the event.
+func matchingNotifications(rules []agenttasks.Notification, e *notification.Event) []agenttasks.Notification {
+	ans := make([]agenttasks.Notification, 0)
+	for _, n := range rules {
+		if n.Matches(e.Result, e.Previous) {
+			ans = append(ans, n)
+		}
+	}
+	return ans
+}
+
+// deliverNotifications sends the notifications, calling update with the
+// status of their delivery, first as pending and then once all of them are
+// done. Nothing is sent if the pending status can't be written.
+func deliverNotifications(config *setting.Config, l *logging.Logger, rules []agenttasks.Notification, e *notification.Event, update func([]string) error) error {
+	status := make([]string, len(rules))
+	for i, n := range rules {
+		status[i] = n.String() + ": pending"
+	}
+	if err := update(status); err != nil {
+		return err
+	}
+
+	for i, n := range rules {
+		var err error
+		status[i], err = notification.Deliver(config, n, e)
+		if err != nil {
+			l.WithFields(logrus.Fields{
+				"component":    "notification",
+				"id":           e.ID,
+				"kind":         e.Kind,
+				"notification": n.String(),
+				"error":        err.Error(),
+			}).Warn("Could not deliver the notification")
+		}
+	}
+	return update(status)
+}
+
+// NotifyTask sends the notifications of a task which just ended, and the ones
+// of its pipeline when it was the last of its tasks in progress.
+func (m *Mottainai) NotifyTask(docID string) {
+	m.Invoke(func(d *database.Database, config *setting.Config, l *logging.Logger) {
+		task, err := d.Driver.GetTask(config, docID)
+		if err != nil {
+			return
+		}
+
+		for i := 0; i < database.TASK_TRANSITION_RETRIES; i++ {
+			if i > 0 {
+				if task, err = d.Driver.GetTask(config, docID); err != nil {
+					return
+				}
+			}
+			if !task.IsDone() || len(task.Notifications) == 0 || len(task.NotificationStatus) > 0 {
+				break
+			}
+
+			e := &notification.Event{
+				Kind:     notification.EVENT_TASK,
+				ID:       task.ID,
+				Name:     task.Name,
+				Result:   taskResult(&task),
+				Previous: previousTaskResult(d, task),
+				URL:      config.GetWeb().BuildAbsURL("/tasks/display/" + task.ID),
+				Task:     &task,
+			}
+			rules := matchingNotifications(task.Notifications, e)
+			if len(rules) == 0 {
+				break
+			}
+
+			// The pending status marks the task as notified: writing it
+			// checking the revision, concurrent updates of the task (also
+			// from other replicas) can't notify it twice
+			first := true
+			err = deliverNotifications(config, l, rules, e, func(status []string) error {
+				if first {
+					first = false
+					return d.Driver.CompareAndSwapTask(docID, task.Revision, map[string]interface{}{"notification_status": status})
+				}
+				return d.Driver.UpdateTask(docID, map[string]interface{}{"notification_status": status})
+			})
+			if !database.IsConflict(err) {
+				break
+			}
+		}
+
+		if task.PipelineID != "" {
+			m.notifyPipeline(d, config, l, task.PipelineID)
+		}
+	})
+}
+
+func (m *Mottainai) notifyPipeline(d *database.Database, config *setting.Config, l *logging.Logger, id string) {
+	pipelineNotifyLock.Lock()
+	pip, err := d.Driver.GetPipeline(config, id)
+	if err != nil || len(pip.Notifications) == 0 || len(pip.NotificationStatus) > 0 {
+		pipelineNotifyLock.Unlock()
+		return
+	}
+	result := pipelineResult(d, pip)
+	if result == "" {
+		pipelineNotifyLock.Unlock()
+		return
+	}
+
+	e := &notification.Event{
+		Kind:     notification.EVENT_PIPELINE,
+		ID:       pip.ID,
+		Name:     pip.Name,
+		Result:   result,
+		Previous: previousPipelineResult(d, pip),
+		URL:      config.GetWeb().BuildAbsURL("/pipeline/" + pip.ID),
+		Pipeline: &pip,
+	}
+	rules := matchingNotifications(pip.Notifications, e)
+	if len(rules) == 0 {
+		pipelineNotifyLock.Unlock()
+		return
+	}
+
+	// The pending status marks the pipeline as notified
+	first := true
+	deliverNotifications(config, l, rules, e, func(status []string) error {
+		err := d.Driver.UpdatePipeline(id, map[string]interface{}{"notification_status": status})
+		if first {
+			first = false
+			pipelineNotifyLock.Unlock()
+		}
+		return err
+	})
+}
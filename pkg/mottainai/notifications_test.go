@@ -0,0 +1,90 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package mottainai_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/MottainaiCI/mottainai-server/pkg/mottainai"
+	helpers "github.com/MottainaiCI/mottainai-server/tests/helpers"
+)
+
+var _ = Describe("Task notifications", func() {
+
+	dir, _ := ioutil.TempDir("", "notifications_test")
+	defer os.RemoveAll(dir) // clean up
+	helpers.InitConfig(dir)
+	m := Classic(helpers.Config)
+	db := helpers.InitDB(helpers.Config)
+
+	var sent int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&sent, 1)
+	}))
+
+	Context("When the task ends", func() {
+		It("Notifies it once", func() {
+			defer srv.Close()
+
+			id, err := db.Driver.CreateTask(map[string]interface{}{
+				"status": setting.TASK_STATE_DONE,
+				"result": setting.TASK_RESULT_SUCCESS,
+				"notifications": []interface{}{
+					map[string]interface{}{"on": "always", "channel": "http", "target": srv.URL},
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			var wg sync.WaitGroup
+			for i := 0; i < 5; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					m.NotifyTask(id)
+				}()
+			}
+			wg.Wait()
+			Expect(atomic.LoadInt32(&sent)).Should(Equal(int32(1)))
+
+			t, err := db.Driver.GetTask(helpers.Config, id)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(t.NotificationStatus).Should(HaveLen(1))
+			Expect(t.NotificationStatus[0]).Should(ContainSubstring("delivered"))
+
+			// Sending the task again clears the status of its notifications
+			err = db.Driver.UpdateTask(id, map[string]interface{}{"notification_status": []string{}})
+			Expect(err).ToNot(HaveOccurred())
+			m.NotifyTask(id)
+			Expect(atomic.LoadInt32(&sent)).Should(Equal(int32(2)))
+		})
+	})
+})
@@ -0,0 +1,286 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package mottainai
+
+import (
+	"errors"
+	"time"
+
+	database "github.com/MottainaiCI/mottainai-server/pkg/db"
+	logging "github.com/MottainaiCI/mottainai-server/pkg/logging"
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+	agenttasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+	user "github.com/MottainaiCI/mottainai-server/pkg/user"
+	logrus "github.com/sirupsen/logrus"
+)
+
+// ErrPlanOverlap is returned running a plan with the skip overlap policy
+// while the task of its previous run is still in progress.
+var ErrPlanOverlap = errors.New("The previous run of the plan is still in progress")
+
+func planFingerprint(plan agenttasks.Plan) string {
+	return plan.ID + "=" + plan.Planned + "@" + plan.Timezone
+}
+
+// lastRunInProgress returns the tasks of the previous run of the plan which
+// are still in progress.
+func lastRunInProgress(d *database.Database, plan agenttasks.Plan) []string {
+	ids := make([]string, 0)
+	// Templates can instantiate either, the last run is the latest one
+	if (plan.IsPipeline() || plan.HasTemplate()) && len(plan.LastPipeline) > 0 {
+		if pip, err := d.Driver.GetPipeline(d.Config, plan.LastPipeline); err == nil {
+			for _, t := range pip.Tasks {
+				ids = append(ids, t.ID)
+			}
+		}
+	}
+	if !plan.IsPipeline() && len(plan.LastTask) > 0 {
+		ids = append(ids, plan.LastTask)
+	}
+
+	running := make([]string, 0)
+	for _, id := range ids {
+		t, err := d.Driver.GetTask(d.Config, id)
+		if err == nil && len(t.Status) > 0 && !agenttasks.IsFinalState(t.Status) {
+			running = append(running, id)
+		}
+	}
+	return running
+}
+
+// checkPlanNamespaces checks that the owner of the plan can publish to the
+// namespaces of the tasks of a run. The tasks of template plans are checked
+// on every run, as new versions of the template can change them.
+func checkPlanNamespaces(d *database.Database, plan agenttasks.Plan, tasks ...agenttasks.Task) error {
+	var owner *user.User
+	for _, t := range tasks {
+		if len(t.TagNamespace) == 0 {
+			continue
+		}
+		if owner == nil {
+			u, err := d.Driver.GetUser(plan.Owner)
+			if err != nil {
+				return err
+			}
+			owner = &u
+		}
+		if !owner.NamespaceBelongs(t.TagNamespace) {
+			return errors.New("The owner of the plan can't publish to the namespace " + t.TagNamespace)
+		}
+	}
+	return nil
+}
+
+// newPlanRun returns the task, or the pipeline, to create for a run of the
+// plan.
+func newPlanRun(d *database.Database, plan agenttasks.Plan) (*agenttasks.Task, *agenttasks.Pipeline, error) {
+	// Rules of the notifications of the plan, added to its runs
+	var notifications []agenttasks.Notification
+	if plan.Task != nil {
+		notifications = plan.Notifications
+	}
+
+	if !plan.HasTemplate() {
+		if plan.IsPipeline() {
+			pip := plan.NewPipelineRun()
+			pip.Notifications = append(pip.Notifications, notifications...)
+			return nil, pip, nil
+		}
+		plan.Task.Reset()
+		return plan.Task, nil, nil
+	}
+
+	tmpl, err := d.GetTaskTemplateByRef(plan.Template)
+	if err != nil {
+		return nil, nil, err
+	}
+	params, err := agenttasks.ParseTemplateParams(plan.TemplateParams)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if tmpl.IsPipeline() {
+		pip, err := tmpl.NewPipeline(params)
+		if err != nil {
+			return nil, nil, err
+		}
+		pip.PlanID = plan.ID
+		pip.Owner = plan.Owner
+		pip.Notifications = append(pip.Notifications, notifications...)
+		for name, t := range pip.Tasks {
+			if err := checkPlanNamespaces(d, plan, t); err != nil {
+				return nil, nil, err
+			}
+			t.Owner = plan.Owner
+			pip.Tasks[name] = t
+		}
+		return nil, pip, nil
+	}
+
+	task, err := tmpl.NewTask(params)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkPlanNamespaces(d, plan, *task); err != nil {
+		return nil, nil, err
+	}
+	task.Owner = plan.Owner
+	task.Notifications = append(task.Notifications, notifications...)
+	return task, nil, nil
+}
+
+// RunPlan creates and sends a task (or a pipeline) from the plan, following
+// its overlap policy, and records the run in the plan. It returns the ID of
+// the task or of the pipeline.
+func (m *Mottainai) RunPlan(id string) (string, error) {
+	var docID string
+	var rerr error
+	m.Invoke(func(d *database.Database, config *setting.Config, l *logging.Logger) {
+		plan, err := d.Driver.GetPlan(config, id)
+		if err != nil {
+			rerr = err
+			return
+		}
+		fields := plan.Tick(time.Now())
+
+		running := lastRunInProgress(d, plan)
+		if len(running) > 0 && plan.OverlapPolicy == agenttasks.PLAN_OVERLAP_SKIP {
+			// Skipped runs are recorded too, so they aren't caught up
+			d.Driver.UpdatePlan(id, fields)
+			rerr = ErrPlanOverlap
+			return
+		} else if len(running) > 0 && plan.OverlapPolicy == agenttasks.PLAN_OVERLAP_CANCEL {
+			for _, t := range running {
+				l.WithFields(logrus.Fields{
+					"component": "plan",
+					"plan_id":   id,
+					"task_id":   t,
+				}).Info("Stopping the previous run of the plan")
+				if err := d.StopTask(t); err != nil && !database.IsConflict(err) {
+					rerr = err
+					return
+				}
+			}
+		}
+
+		task, pip, err := newPlanRun(d, plan)
+		if err != nil {
+			rerr = err
+			return
+		}
+
+		if pip != nil {
+			docID, err = d.CreatePipelineWithTasks(pip)
+			if err != nil {
+				rerr = err
+				return
+			}
+			fields["last_pipeline"] = docID
+			if err := d.Driver.UpdatePlan(id, fields); err != nil {
+				rerr = err
+				return
+			}
+
+			m.ProcessPipeline(docID)
+			return
+		}
+
+		docID, err = d.Driver.CreateTask(task.ToMap())
+		if err != nil {
+			rerr = err
+			return
+		}
+		fields["last_task"] = docID
+		if err := d.Driver.UpdatePlan(id, fields); err != nil {
+			rerr = err
+			return
+		}
+
+		m.SendTask(docID)
+	})
+	return docID, rerr
+}
+
+// runPlannedTask is the job of the cron entry of a plan.
+func (m *Mottainai) runPlannedTask(id string) {
+	// Every replica has the plans loaded, only the leader runs them
+	if !m.IsLeader() {
+		return
+	}
+
+	_, err := m.RunPlan(id)
+	if err == nil {
+		return
+	}
+	m.Invoke(func(l *logging.Logger) {
+		entry := l.WithFields(logrus.Fields{
+			"component": "plan",
+			"plan_id":   id,
+		})
+		if err == ErrPlanOverlap {
+			entry.Info("Skipping the plan run, the previous one is still in progress")
+		} else {
+			entry.WithField("error", err).Error("Failed running the plan")
+		}
+	})
+}
+
+// CatchUpPlans runs the plans which missed runs while no leader was up,
+// following their catch-up policy.
+func (m *Mottainai) CatchUpPlans() {
+	m.Invoke(func(d *database.Database, config *setting.Config, l *logging.Logger) {
+		now := time.Now()
+		for _, plan := range d.Driver.AllPlans(config) {
+			entry := l.WithFields(logrus.Fields{
+				"component": "plan",
+				"plan_id":   plan.ID,
+			})
+
+			missed, err := plan.MissedRuns(now)
+			if err != nil {
+				entry.WithField("error", err).Warn("Failed checking the missed runs of the plan")
+				continue
+			} else if missed == 0 {
+				continue
+			}
+
+			runs := plan.CatchUpRuns(missed)
+			entry.WithFields(logrus.Fields{
+				"missed": missed,
+				"runs":   runs,
+			}).Info("Catching up the missed runs of the plan")
+
+			if runs == 0 {
+				// Skipped runs are recorded too, so they aren't caught up
+				// again on the next restart
+				d.Driver.UpdatePlan(plan.ID, plan.Tick(now))
+			}
+			for i := 0; i < runs; i++ {
+				if _, err := m.RunPlan(plan.ID); err != nil {
+					entry.WithField("error", err).Warn("Failed catching up the plan")
+					break
+				}
+			}
+		}
+	})
+}
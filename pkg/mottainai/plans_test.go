@@ -0,0 +1,100 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package mottainai_test
+
+import (
+	"io/ioutil"
+	"os"
+	"time"
+
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+	agenttasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+	user "github.com/MottainaiCI/mottainai-server/pkg/user"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/MottainaiCI/mottainai-server/pkg/mottainai"
+	helpers "github.com/MottainaiCI/mottainai-server/tests/helpers"
+)
+
+var _ = Describe("Plans", func() {
+
+	dir, _ := ioutil.TempDir("", "plans_test")
+	defer os.RemoveAll(dir) // clean up
+	helpers.InitConfig(dir)
+	m := Classic(helpers.Config)
+	db := helpers.InitDB(helpers.Config)
+
+	Context("When a plan without catch-up missed some runs", func() {
+		It("Records them as skipped", func() {
+			last := time.Now().Add(-3 * time.Hour).Format(setting.Timeformat)
+			plan := &agenttasks.Plan{
+				Task:          &agenttasks.Task{Type: "docker"},
+				Planned:       "@hourly",
+				CatchUpPolicy: agenttasks.PLAN_CATCHUP_NONE,
+				LastRun:       last,
+			}
+			id, err := db.Driver.CreatePlan(plan.ToMap())
+			Expect(err).ToNot(HaveOccurred())
+
+			m.CatchUpPlans()
+
+			*plan, err = db.Driver.GetPlan(helpers.Config, id)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(plan.LastRun).ShouldNot(Equal(last))
+			Expect(plan.NextRun).ShouldNot(BeEmpty())
+
+			missed, err := plan.MissedRuns(time.Now())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(missed).Should(Equal(0))
+			Expect(plan.LastTask).Should(BeEmpty())
+		})
+	})
+
+	Context("When the template of a plan publishes to a namespace of another user", func() {
+		It("Refuses to run it", func() {
+			owner, err := db.Driver.InsertUser(&user.User{Name: "foo", Password: "foo"})
+			Expect(err).ToNot(HaveOccurred())
+
+			tmpl := &agenttasks.TaskTemplate{
+				Name: "publish",
+				Task: &agenttasks.Task{Type: "docker", TagNamespace: "bar::release"},
+			}
+			_, err = db.CreateTaskTemplateVersion(tmpl)
+			Expect(err).ToNot(HaveOccurred())
+
+			plan := &agenttasks.Plan{
+				Task:     &agenttasks.Task{Owner: owner},
+				Template: "publish",
+			}
+			id, err := db.Driver.CreatePlan(plan.ToMap())
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = m.RunPlan(id)
+			Expect(err).To(HaveOccurred())
+			for _, t := range db.Driver.AllTasks(helpers.Config) {
+				Expect(t.TagNamespace).ShouldNot(Equal("bar::release"))
+			}
+		})
+	})
+})
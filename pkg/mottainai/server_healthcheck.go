@@ -46,7 +46,12 @@ func (m *Mottainai) HealthCheckRun(interval int) error {
 	})
 
 	runner := anagent.New()
-	runner.TimerSeconds(int64(interval), true, func() { m.Invoke(m.HealthCheck) })
+	runner.TimerSeconds(int64(interval), true, func() {
+		// Only the leader replica checks the deadlines
+		if m.IsLeader() {
+			m.Invoke(m.HealthCheck)
+		}
+	})
 
 	go runner.Start()
 
@@ -77,11 +82,15 @@ func (m *Mottainai) HealthCheck(d *database.Database, config *setting.Config) er
 }
 
 func MarkTaskAborted(id, reason string, d *database.Database) error {
-	return d.Driver.UpdateTask(id, map[string]interface{}{
-		"status": setting.TASK_STATE_STOPPED,
+	err := d.TransitionTask(id, setting.TASK_STATE_STOPPED, map[string]interface{}{
 		"result": setting.TASK_RESULT_ERROR,
 		"output": "Task exceeded deadline: " + reason,
 	})
+	if database.IsConflict(err) {
+		// The task finished meanwhile
+		return nil
+	}
+	return err
 }
 
 func (m *Mottainai) CheckTasksDeadline(d *database.Database, config *setting.Config) error {
@@ -130,6 +139,8 @@ func (m *Mottainai) CheckNodesDeadline(d *database.Database, config *setting.Con
 		now := time.Now()
 
 		if int(now.Sub(last_update).Seconds()) > config.GetWeb().NodeDeadline {
+			nodeLost(d, n, now.Sub(last_update))
+
 			// If node is down, check among its tasks
 			//  tasks, _ := d.Driver.AllNodeTask(db.Config, node.NodeID)
 			// Probably there will be less running rather then hosts presents in the cluster
@@ -58,6 +58,13 @@ func SetupWebHook(m *Mottainai) {
 
 		m.Map(tc)
 		m.Map(client)
+
+		// Without an App the check runs are disabled, see NewGitHubApp
+		app, err := NewGitHubApp(config)
+		if err != nil {
+			log.Println("Invalid GitHub App:", err)
+		}
+		m.Map(app)
 	})
 
 	a := anagent.New()
@@ -34,7 +34,7 @@ type Namespace struct {
 	ID         string `json:"ID"`
 	Name       string `form:"name" json:"name"`
 	Path       string `json:"path" form:"path"`
-	Visibility string `json:"visbility" form:"visbility"`
+	Visibility string `json:"visibility" form:"visibility"`
 	Owner      string `json:"owner_id" form:"owner_id"`
 	//TaskID string `json:"taskid" form:"taskid"`
 }
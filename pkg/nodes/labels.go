@@ -0,0 +1,142 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package nodes
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ParseLabels converts a list of key=value strings to a label map.
+// Entries without a value are stored with an empty value.
+func ParseLabels(list []string) map[string]string {
+	labels := make(map[string]string)
+	for _, l := range list {
+		kv := strings.SplitN(l, "=", 2)
+		if len(kv[0]) == 0 {
+			continue
+		}
+		if len(kv) == 2 {
+			labels[kv[0]] = kv[1]
+		} else {
+			labels[kv[0]] = ""
+		}
+	}
+	return labels
+}
+
+// LabelList is the inverse of ParseLabels, returns a sorted list of key=value strings.
+func LabelList(labels map[string]string) []string {
+	list := make([]string, 0, len(labels))
+	for k, v := range labels {
+		list = append(list, k+"="+v)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// MatchLabel checks a single selector expression against the labels.
+// Supported expressions are: key (label is present), key=value, key!=value
+// and the numeric comparisons key>=N and key<=N.
+func MatchLabel(labels map[string]string, expr string) (bool, error) {
+	for _, op := range []string{">=", "<=", "!=", "="} {
+		i := strings.Index(expr, op)
+		if i == -1 {
+			continue
+		}
+		key, value := expr[:i], expr[i+len(op):]
+		if len(key) == 0 {
+			return false, errors.New("Invalid node selector: " + expr)
+		}
+		l, ok := labels[key]
+
+		switch op {
+		case "=":
+			return ok && l == value, nil
+		case "!=":
+			return !ok || l != value, nil
+		default:
+			want, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return false, errors.New("Invalid numeric node selector: " + expr)
+			}
+			if !ok {
+				return false, nil
+			}
+			have, err := strconv.ParseFloat(l, 64)
+			if err != nil {
+				return false, nil
+			}
+			if op == ">=" {
+				return have >= want, nil
+			}
+			return have <= want, nil
+		}
+	}
+
+	if len(expr) == 0 {
+		return false, errors.New("Invalid node selector: empty expression")
+	}
+	_, ok := labels[expr]
+	return ok, nil
+}
+
+// Match returns true if the node labels satisfy all the selector expressions.
+func (n *Node) Match(selector []string) (bool, error) {
+	for _, s := range selector {
+		ok, err := MatchLabel(n.Labels, s)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// SelectQueue returns the private queue of one of the registered nodes
+// satisfying the selector. Nodes that never reported or missed the deadline
+// of their reports, that are draining or that don't listen on a private
+// queue can't be targeted and are skipped.
+func SelectQueue(nodes []Node, selector []string, deadline int) (string, error) {
+	candidates := make([]string, 0)
+	for _, n := range nodes {
+		if len(n.PrivateQueue) == 0 || len(n.LastReport) == 0 || n.Draining || n.Expired(deadline) {
+			continue
+		}
+		ok, err := n.Match(selector)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			candidates = append(candidates, n.PrivateQueue)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return "", errors.New("No registered node satisfies the node selector: " + strings.Join(selector, ", "))
+	}
+
+	return candidates[rand.Intn(len(candidates))], nil
+}
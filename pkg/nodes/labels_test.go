@@ -0,0 +1,97 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package nodes
+
+import (
+	"testing"
+	"time"
+
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+)
+
+func TestMatchLabel(t *testing.T) {
+	labels := ParseLabels([]string{"arch=amd64", "disk.free_gb=50", "gpu", "executor.docker=true"})
+
+	for expr, expected := range map[string]bool{
+		"arch=amd64":       true,
+		"arch=arm64":       false,
+		"arch!=arm64":      true,
+		"gpu":              true,
+		"kvm":              false,
+		"disk.free_gb>=20": true,
+		"disk.free_gb>=80": false,
+		"disk.free_gb<=50": true,
+		"missing>=1":       false,
+	} {
+		res, err := MatchLabel(labels, expr)
+		if err != nil {
+			t.Error(expr, err)
+		}
+		if res != expected {
+			t.Error("Unexpected match result for", expr, res)
+		}
+	}
+
+	if _, err := MatchLabel(labels, "disk.free_gb>=lots"); err == nil {
+		t.Error("Expected an error with a non numeric comparison")
+	}
+	if _, err := MatchLabel(labels, "=amd64"); err == nil {
+		t.Error("Expected an error with an empty key")
+	}
+}
+
+func TestSelectQueue(t *testing.T) {
+	list := []Node{
+		{Hostname: "a", PrivateQueue: "a1", LastReport: "20200101000000",
+			Labels: ParseLabels([]string{"arch=amd64"})},
+		{Hostname: "b", PrivateQueue: "b1", LastReport: "20200101000000",
+			Labels: ParseLabels([]string{"arch=arm64"})},
+		{Hostname: "c", LastReport: "20200101000000",
+			Labels: ParseLabels([]string{"arch=ppc64le"})},
+	}
+
+	q, err := SelectQueue(list, []string{"arch=arm64"}, 0)
+	if err != nil {
+		t.Error(err)
+	}
+	if q != "b1" {
+		t.Error("Unexpected queue", q)
+	}
+
+	// Node without private queue can't be targeted
+	if _, err := SelectQueue(list, []string{"arch=ppc64le"}, 0); err == nil {
+		t.Error("Expected an error when no node can satisfy the selector")
+	}
+	if _, err := SelectQueue(list, []string{"arch=s390x"}, 0); err == nil {
+		t.Error("Expected an error when no node can satisfy the selector")
+	}
+
+	// Nodes which missed the deadline of their reports are skipped
+	if _, err := SelectQueue(list, []string{"arch=arm64"}, 3600); err == nil {
+		t.Error("Expected an error when the matching node is lost")
+	}
+	list[1].LastReport = time.Now().Format(setting.Timeformat)
+	if q, err := SelectQueue(list, []string{"arch=arm64"}, 3600); err != nil || q != "b1" {
+		t.Error("Unexpected queue", q, err)
+	}
+}
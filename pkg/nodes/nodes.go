@@ -25,6 +25,9 @@ package nodes
 import (
 	"encoding/json"
 	"reflect"
+	"time"
+
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
 )
 
 type Node struct {
@@ -36,6 +39,24 @@ type Node struct {
 	Owner      int    `json:"owner" form:"owner"`
 	Hostname   string `json:"hostname" form:"hostname"`
 	LastReport string `json:"last_report" form:"last_report"`
+
+	// Labels reported by the agent, used to route tasks with a node selector
+	Labels       map[string]string `json:"labels" form:"labels"`
+	PrivateQueue string            `json:"private_queue" form:"private_queue"`
+
+	// A draining node completes the running tasks and doesn't accept new ones
+	Draining bool `json:"draining" form:"draining"`
+
+	// Last report received by the agent and the previous ones
+	Report  NodeReport   `json:"report" form:"report"`
+	History []NodeReport `json:"history" form:"history"`
+}
+
+// Expired reports whether the node missed the deadline (in seconds, 0
+// disables it) of its reports.
+func (n *Node) Expired(deadline int) bool {
+	last, err := time.Parse(setting.Timeformat, n.LastReport)
+	return err == nil && deadline != 0 && int(time.Since(last).Seconds()) > deadline
 }
 
 func NewFromJson(data []byte) Node {
@@ -54,8 +75,14 @@ func NewNodeFromMap(t map[string]interface{}) Node {
 		nodeid      string
 		hostname    string
 		last_report string
+		privqueue   string
+		draining    bool
+		report      NodeReport
+		history     []NodeReport
 	)
 
+	labels := make(map[string]string)
+
 	if str, ok := t["user"].(string); ok {
 		user = str
 	}
@@ -77,19 +104,43 @@ func NewNodeFromMap(t map[string]interface{}) Node {
 	if str, ok := t["last_report"].(string); ok {
 		last_report = str
 	}
+	if str, ok := t["private_queue"].(string); ok {
+		privqueue = str
+	}
+	if b, ok := t["draining"].(bool); ok {
+		draining = b
+	}
+	decodeInterface(t["report"], &report)
+	decodeInterface(t["history"], &history)
+	if m, ok := t["labels"].(map[string]interface{}); ok {
+		for k, v := range m {
+			if str, ok := v.(string); ok {
+				labels[k] = str
+			}
+		}
+	} else if m, ok := t["labels"].(map[string]string); ok {
+		for k, v := range m {
+			labels[k] = v
+		}
+	}
 	var id string
 	if str, ok := t["id"].(string); ok {
 		id = str
 	}
 	node := Node{
-		Owner:      owner,
-		Pass:       pass,
-		Key:        key,
-		User:       user,
-		Hostname:   hostname,
-		LastReport: last_report,
-		NodeID:     nodeid,
-		ID:         id,
+		Owner:        owner,
+		Pass:         pass,
+		Key:          key,
+		User:         user,
+		Hostname:     hostname,
+		LastReport:   last_report,
+		NodeID:       nodeid,
+		ID:           id,
+		Labels:       labels,
+		PrivateQueue: privqueue,
+		Draining:     draining,
+		Report:       report,
+		History:      history,
 	}
 	return node
 }
@@ -0,0 +1,77 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package nodes
+
+import (
+	"encoding/json"
+)
+
+// Number of reports kept in the node history
+const NODE_HISTORY_SIZE = 100
+
+// Status returned to the agents of draining nodes on registration
+const NODE_STATUS_DRAINING = "draining"
+
+// NodeReport is the inventory and health status sent by the agents on each
+// keepalive. Sizes are expressed in MB.
+type NodeReport struct {
+	Time         string         `json:"time" form:"time"`
+	Version      string         `json:"version" form:"version"`
+	Executors    []string       `json:"executors" form:"executors"`
+	Queues       map[string]int `json:"queues" form:"queues"`
+	Concurrency  int            `json:"concurrency" form:"concurrency"`
+	RunningTasks []string       `json:"running_tasks" form:"running_tasks"`
+	Load         float64        `json:"load" form:"load"`
+	DiskTotal    uint64         `json:"disk_total" form:"disk_total"`
+	DiskFree     uint64         `json:"disk_free" form:"disk_free"`
+	MemTotal     uint64         `json:"mem_total" form:"mem_total"`
+	MemAvailable uint64         `json:"mem_available" form:"mem_available"`
+
+	// Sent on registration but stored on the node, see Node.Labels
+	// and Node.PrivateQueue
+	PrivateQueue string   `json:"-" form:"-"`
+	Labels       []string `json:"-" form:"-"`
+}
+
+// AppendReport returns the history with the report appended, keeping
+// only the last NODE_HISTORY_SIZE entries.
+func AppendReport(history []NodeReport, r NodeReport) []NodeReport {
+	history = append(history, r)
+	if len(history) > NODE_HISTORY_SIZE {
+		history = history[len(history)-NODE_HISTORY_SIZE:]
+	}
+	return history
+}
+
+// decodeInterface converts back the reports of the documents coming from
+// the database, which are decoded as generic maps.
+func decodeInterface(i interface{}, target interface{}) {
+	if i == nil {
+		return
+	}
+	data, err := json.Marshal(i)
+	if err != nil {
+		return
+	}
+	json.Unmarshal(data, target)
+}
@@ -0,0 +1,68 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package nodes
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+)
+
+func TestNodeFromDocument(t *testing.T) {
+	n := Node{
+		Hostname: "foo",
+		Draining: true,
+		Report:   NodeReport{Version: "0.1", Queues: map[string]int{"iso": 2}, RunningTasks: []string{"1"}},
+		History:  []NodeReport{{Time: "1", Load: 0.5}, {Time: "2", DiskFree: 10}},
+	}
+
+	// Documents are decoded from the database as generic maps
+	data, _ := json.Marshal(n.ToMap())
+	doc := make(map[string]interface{})
+	json.Unmarshal(data, &doc)
+
+	res := NewNodeFromMap(doc)
+	if !res.Draining || res.Hostname != "foo" {
+		t.Error("Unexpected node", res)
+	}
+	if res.Report.Version != "0.1" || res.Report.Queues["iso"] != 2 || res.Report.RunningTasks[0] != "1" {
+		t.Error("Unexpected report", res.Report)
+	}
+	if len(res.History) != 2 || res.History[0].Load != 0.5 || res.History[1].DiskFree != 10 {
+		t.Error("Unexpected history", res.History)
+	}
+}
+
+func TestAppendReport(t *testing.T) {
+	var history []NodeReport
+	for i := 0; i < NODE_HISTORY_SIZE+10; i++ {
+		history = AppendReport(history, NodeReport{Time: strconv.Itoa(i)})
+	}
+
+	if len(history) != NODE_HISTORY_SIZE {
+		t.Error("History not bounded", len(history))
+	}
+	if history[len(history)-1].Time != strconv.Itoa(NODE_HISTORY_SIZE+9) || history[0].Time != "10" {
+		t.Error("Unexpected history order")
+	}
+}
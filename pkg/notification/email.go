@@ -0,0 +1,69 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package notification
+
+import (
+	"errors"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+)
+
+// EmailMessage returns the email sent for the event.
+func EmailMessage(from, to string, e *Event) []byte {
+	var msg strings.Builder
+	msg.WriteString("From: " + from + "\r\n")
+	msg.WriteString("To: " + to + "\r\n")
+	msg.WriteString("Subject: " + e.Subject() + "\r\n")
+	msg.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(e.Subject() + "\r\n")
+	if e.Previous != "" {
+		msg.WriteString("Previous build: " + e.Previous + "\r\n")
+	}
+	if e.URL != "" {
+		msg.WriteString("\r\n" + e.URL + "\r\n")
+	}
+	return []byte(msg.String())
+}
+
+func sendEmail(config *setting.Config, to string, e *Event) error {
+	web := config.GetWeb()
+	if web.SMTPServer == "" {
+		return errors.New("No SMTP server configured")
+	}
+
+	var auth smtp.Auth
+	if web.SMTPUser != "" {
+		host, _, err := net.SplitHostPort(web.SMTPServer)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", web.SMTPUser, web.SMTPPassword, host)
+	}
+	return smtp.SendMail(web.SMTPServer, auth, web.SMTPFrom, []string{to}, EmailMessage(web.SMTPFrom, to, e))
+}
@@ -0,0 +1,100 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package notification
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"text/template"
+	"time"
+)
+
+// Body of the HTTP callbacks without a template
+const DEFAULT_CALLBACK_BODY = `{"kind": {{json .Kind}}, "id": {{json .ID}}, "name": {{json .Name}}, "result": {{json .Result}}, "previous": {{json .Previous}}, "url": {{json .URL}}}`
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+var callbackFuncs = template.FuncMap{
+	// Quotes the values in the JSON bodies
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// CallbackBody renders the template of the body of an HTTP callback, which
+// must be JSON.
+func CallbackBody(body string, e *Event) ([]byte, error) {
+	if body == "" {
+		body = DEFAULT_CALLBACK_BODY
+	}
+	tmpl, err := template.New("body").Funcs(callbackFuncs).Parse(body)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, e); err != nil {
+		return nil, err
+	}
+	if !json.Valid(buf.Bytes()) {
+		return nil, errors.New("The notification body isn't valid JSON: " + buf.String())
+	}
+	return buf.Bytes(), nil
+}
+
+func sendCallback(url, body string, e *Event) error {
+	data, err := CallbackBody(body, e)
+	if err != nil {
+		return err
+	}
+	return postJSON(url, data)
+}
+
+// sendChat posts the message to a Slack compatible incoming webhook, as
+// also served by the Matrix bridges.
+func sendChat(url string, e *Event) error {
+	data, err := json.Marshal(map[string]string{"text": e.Message()})
+	if err != nil {
+		return err
+	}
+	return postJSON(url, data)
+}
+
+func postJSON(url string, data []byte) error {
+	resp, err := httpClient.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.New("Notification rejected with status " + strconv.Itoa(resp.StatusCode))
+	}
+	return nil
+}
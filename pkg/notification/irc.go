@@ -0,0 +1,125 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package notification
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+)
+
+// Time given to the IRC servers to register the client
+var ircTimeout = 30 * time.Second
+
+// IRCChannel returns the address of the server and the channel of an
+// irc://host:port/channel target. The channel may also be given as the
+// fragment, i.e. irc://host/#channel.
+func IRCChannel(target string) (string, string, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", "", err
+	}
+	channel := strings.TrimPrefix(u.Path, "/")
+	if channel == "" {
+		channel = u.Fragment
+	}
+	if u.Host == "" || channel == "" {
+		return "", "", errors.New("Invalid IRC channel: " + target)
+	}
+
+	addr := u.Host
+	if u.Port() == "" {
+		port := "6667"
+		if u.Scheme == "ircs" {
+			port = "6697"
+		}
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+	return addr, "#" + strings.TrimPrefix(channel, "#"), nil
+}
+
+// sendIRC joins the channel just to send the message, as the IRC servers
+// keep no history for the clients which aren't connected.
+func sendIRC(config *setting.Config, target string, e *Event) error {
+	addr, channel, err := IRCChannel(target)
+	if err != nil {
+		return err
+	}
+	u, _ := url.Parse(target)
+
+	dialer := &net.Dialer{Timeout: ircTimeout}
+	var conn net.Conn
+	if u.Scheme == "ircs" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: u.Hostname()})
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(ircTimeout))
+
+	nick := config.GetWeb().IRCNick
+	if u.User != nil && u.User.Username() != "" {
+		nick = u.User.Username()
+	}
+	if password, ok := u.User.Password(); ok {
+		fmt.Fprintf(conn, "PASS %s\r\n", password)
+	}
+	fmt.Fprintf(conn, "NICK %s\r\n", nick)
+	fmt.Fprintf(conn, "USER %s 0 * :Mottainai\r\n", nick)
+
+	r := bufio.NewReader(conn)
+	for registered := false; !registered; {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return errors.New("IRC registration failed: " + err.Error())
+		}
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) > 1 && fields[0] == "PING":
+			fmt.Fprintf(conn, "PONG %s\r\n", fields[1])
+		case len(fields) > 1 && fields[1] == "001":
+			registered = true
+		case len(fields) > 1 && fields[1] == "433":
+			// Nickname in use, e.g. by another replica
+			nick += "_"
+			fmt.Fprintf(conn, "NICK %s\r\n", nick)
+		case len(fields) > 0 && fields[0] == "ERROR":
+			return errors.New("IRC registration failed: " + strings.TrimSpace(line))
+		}
+	}
+
+	fmt.Fprintf(conn, "JOIN %s\r\n", channel)
+	fmt.Fprintf(conn, "PRIVMSG %s :%s\r\n", channel, e.Message())
+	_, err = fmt.Fprintf(conn, "QUIT\r\n")
+	return err
+}
@@ -0,0 +1,128 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package notification
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+	agenttasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+)
+
+// Kinds of the ended builds
+const (
+	EVENT_TASK     = "task"
+	EVENT_PIPELINE = "pipeline"
+)
+
+// Attempts of each delivery. The first retry waits RetryDelay, the next
+// ones twice as long as the previous.
+var (
+	Attempts   = 3
+	RetryDelay = 10 * time.Second
+)
+
+// Replaces the line breaks of the names, which end the email headers and
+// the IRC commands
+var lineBreaks = strings.NewReplacer("\r", " ", "\n", " ")
+
+// Event is a task or a pipeline which ended. It's the data of the templates
+// of the HTTP callbacks.
+type Event struct {
+	Kind string
+	ID   string
+	Name string
+
+	// Either NOTIFY_ON_SUCCESS or NOTIFY_ON_FAILURE, and the result of the
+	// previous build with the same name, empty if unknown
+	Result   string
+	Previous string
+
+	URL      string
+	Task     *agenttasks.Task
+	Pipeline *agenttasks.Pipeline
+}
+
+// Fixed reports whether the build succeeded after a failed one.
+func (e *Event) Fixed() bool {
+	return e.Result == agenttasks.NOTIFY_ON_SUCCESS && e.Previous == agenttasks.NOTIFY_ON_FAILURE
+}
+
+// Subject is a one line summary of the event.
+func (e *Event) Subject() string {
+	name := e.Name
+	if name == "" {
+		name = e.ID
+	}
+	name = lineBreaks.Replace(name)
+	state := "failed"
+	if e.Fixed() {
+		state = "is fixed"
+	} else if e.Result == agenttasks.NOTIFY_ON_SUCCESS {
+		state = "succeeded"
+	}
+	return fmt.Sprintf("[Mottainai] %s %s %s", e.Kind, name, state)
+}
+
+// Message is the text sent to the chats.
+func (e *Event) Message() string {
+	if e.URL == "" {
+		return e.Subject()
+	}
+	return e.Subject() + ": " + lineBreaks.Replace(e.URL)
+}
+
+// Send delivers the notification once.
+func Send(config *setting.Config, n agenttasks.Notification, e *Event) error {
+	switch n.Channel {
+	case agenttasks.NOTIFY_EMAIL:
+		return sendEmail(config, n.Target, e)
+	case agenttasks.NOTIFY_HTTP:
+		return sendCallback(n.Target, n.Body, e)
+	case agenttasks.NOTIFY_SLACK, agenttasks.NOTIFY_MATRIX:
+		return sendChat(n.Target, e)
+	case agenttasks.NOTIFY_IRC:
+		return sendIRC(config, n.Target, e)
+	}
+	return errors.New("Invalid notification channel: " + n.Channel)
+}
+
+// Deliver sends the notification, retrying on failures. It returns the
+// status of the delivery, as shown on the task or the pipeline.
+func Deliver(config *setting.Config, n agenttasks.Notification, e *Event) (string, error) {
+	var err error
+	delay := RetryDelay
+	for i := 0; i < Attempts; i++ {
+		if i > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+		if err = Send(config, n, e); err == nil {
+			return n.String() + ": delivered", nil
+		}
+	}
+	return fmt.Sprintf("%s: failed after %d attempts: %s", n.String(), Attempts, err.Error()), err
+}
@@ -0,0 +1,225 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package notification
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+	agenttasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+)
+
+func newTestEvent() *Event {
+	return &Event{
+		Kind:     EVENT_TASK,
+		ID:       "42",
+		Name:     "build \"app\"",
+		Result:   agenttasks.NOTIFY_ON_SUCCESS,
+		Previous: agenttasks.NOTIFY_ON_FAILURE,
+		URL:      "http://ci/tasks/display/42",
+		Task:     &agenttasks.Task{Image: "alpine"},
+	}
+}
+
+// newTestServer records the bodies of the requests, rejecting the given
+// number of them first.
+func newTestServer(failures int) (*httptest.Server, chan []byte) {
+	bodies := make(chan []byte, 10)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		bodies <- body
+	}))
+	return s, bodies
+}
+
+func TestEventMessage(t *testing.T) {
+	e := newTestEvent()
+	if e.Message() != "[Mottainai] task build \"app\" is fixed: http://ci/tasks/display/42" {
+		t.Error("Invalid message", e.Message())
+	}
+	e.Previous = ""
+	if !strings.Contains(e.Subject(), "succeeded") {
+		t.Error("Invalid subject", e.Subject())
+	}
+
+	msg := string(EmailMessage("ci@example.com", "dev@example.com", e))
+	if !strings.Contains(msg, "To: dev@example.com\r\n") ||
+		!strings.Contains(msg, "Subject: "+e.Subject()+"\r\n") ||
+		!strings.Contains(msg, e.URL) {
+		t.Error("Invalid email", msg)
+	}
+}
+
+func TestCallbackBody(t *testing.T) {
+	body, err := CallbackBody("", newTestEvent())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data map[string]string
+	if err := json.Unmarshal(body, &data); err != nil {
+		t.Fatal(err)
+	}
+	if data["name"] != "build \"app\"" || data["result"] != "success" || data["previous"] != "failure" {
+		t.Error("Invalid body", string(body))
+	}
+
+	body, err = CallbackBody(`{"image": {{json .Task.Image}}}`, newTestEvent())
+	if err != nil || string(body) != `{"image": "alpine"}` {
+		t.Error("Invalid body", string(body), err)
+	}
+	if _, err := CallbackBody(`{"name": {{.Name}}}`, newTestEvent()); err == nil {
+		t.Error("Invalid JSON body accepted")
+	}
+}
+
+func TestDeliverRetries(t *testing.T) {
+	RetryDelay = time.Millisecond
+	s, bodies := newTestServer(2)
+	defer s.Close()
+
+	n := agenttasks.Notification{On: agenttasks.NOTIFY_ON_FIXED, Channel: agenttasks.NOTIFY_SLACK, Target: s.URL}
+	status, err := Deliver(setting.NewConfig(nil), n, newTestEvent())
+	if err != nil || status != "slack on fixed: delivered" {
+		t.Fatal("Notification not delivered", status, err)
+	}
+	var data map[string]string
+	json.Unmarshal(<-bodies, &data)
+	if data["text"] != newTestEvent().Message() {
+		t.Error("Invalid chat message", data)
+	}
+
+	s2, _ := newTestServer(Attempts)
+	defer s2.Close()
+	n.Target = s2.URL
+	status, err = Deliver(setting.NewConfig(nil), n, newTestEvent())
+	if err == nil || !strings.HasPrefix(status, "slack on fixed: failed after 3 attempts") {
+		t.Error("Invalid status", status, err)
+	}
+}
+
+// newIRCServer records the lines sent by a client until it quits.
+func newIRCServer(t *testing.T) (net.Listener, chan []string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		lines := make([]string, 0)
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				break
+			}
+			line = strings.TrimSpace(line)
+			lines = append(lines, line)
+			if strings.HasPrefix(line, "USER ") {
+				conn.Write([]byte("PING :server\r\n:server 001 mottainai :Welcome\r\n"))
+			}
+			if line == "QUIT" {
+				break
+			}
+		}
+		received <- lines
+	}()
+	return l, received
+}
+
+func TestIRC(t *testing.T) {
+	addr, channel, err := IRCChannel("irc://irc.example.com/#ci")
+	if err != nil || addr != "irc.example.com:6667" || channel != "#ci" {
+		t.Error("Invalid IRC channel", addr, channel, err)
+	}
+	addr, channel, _ = IRCChannel("ircs://irc.example.com:7000/ci")
+	if addr != "irc.example.com:7000" || channel != "#ci" {
+		t.Error("Invalid IRC channel", addr, channel)
+	}
+
+	l, received := newIRCServer(t)
+	defer l.Close()
+
+	e := newTestEvent()
+	config := setting.NewConfig(nil)
+	config.GetWeb().IRCNick = "mottainai"
+	if err := sendIRC(config, "irc://"+l.Addr().String()+"/ci", e); err != nil {
+		t.Fatal(err)
+	}
+	lines := <-received
+	expected := []string{"NICK mottainai", "USER mottainai 0 * :Mottainai", "PONG :server",
+		"JOIN #ci", "PRIVMSG #ci :" + e.Message(), "QUIT"}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Error("Invalid IRC session", lines)
+	}
+}
+
+func TestLineBreaks(t *testing.T) {
+	e := newTestEvent()
+	e.Name = "app\r\nBcc: all@example.com\nQUIT"
+	if strings.ContainsAny(e.Subject(), "\r\n") || strings.ContainsAny(e.Message(), "\r\n") {
+		t.Fatal("Expected the line breaks replaced", e.Message())
+	}
+
+	msg := string(EmailMessage("ci@example.com", "dev@example.com", e))
+	headers := strings.Split(strings.SplitN(msg, "\r\n\r\n", 2)[0], "\r\n")
+	for _, h := range headers {
+		if strings.HasPrefix(h, "Bcc:") {
+			t.Error("Injected email header", msg)
+		}
+	}
+	if len(headers) != 5 {
+		t.Error("Invalid email headers", headers)
+	}
+
+	l, received := newIRCServer(t)
+	defer l.Close()
+	config := setting.NewConfig(nil)
+	config.GetWeb().IRCNick = "mottainai"
+	if err := sendIRC(config, "irc://"+l.Addr().String()+"/ci", e); err != nil {
+		t.Fatal(err)
+	}
+	lines := <-received
+	expected := []string{"NICK mottainai", "USER mottainai 0 * :Mottainai", "PONG :server",
+		"JOIN #ci", "PRIVMSG #ci :" + e.Message(), "QUIT"}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Error("Injected IRC command", lines)
+	}
+}
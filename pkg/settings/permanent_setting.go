@@ -29,6 +29,9 @@ const SYSTEM_WEBHOOK_PR_ENABLED = "system.webhook.pull_request"
 const SYSTEM_WEBHOOK_INTERNAL_ONLY = "system.webhook.internal_only"
 const SYSTEM_WEBHOOK_DEFAULT_QUEUE = "system.webhook.default_queue"
 
+// Report the tasks started by the GitHub webhooks as check runs too
+const SYSTEM_WEBHOOK_GITHUB_CHECKS = "system.webhook.github_checks"
+
 const SYSTEM_PROTECT_NAMESPACE_OVERWRITE = "system.namespace.protect_overwrite"
 const SYSTEM_PROTECT_NAMESPACE_PARALLEL_APPEND = "system.namespace.protect_overwrite.parallel_append"
 
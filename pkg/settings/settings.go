@@ -37,6 +37,8 @@ const (
 	MOTTAINAI_CONFIGPATH = "/etc/mottainai"
 
 	Timeformat = "20060102150405"
+	// Tasks queued in the same second keep their order
+	QueueTimeformat = "20060102150405.000000000"
 )
 
 // Web UI Settings
@@ -69,12 +71,35 @@ type WebConfig struct {
 	WebHookGitHubSecret    string `mapstructure:"github_secret"`
 	WebHookToken           string `mapstructure:"webhook_token"`
 
+	// GitHub App sending the check runs, which need its installation tokens
+	GitHubAppID             int64  `mapstructure:"github_app_id"`
+	GitHubAppPrivateKeyFile string `mapstructure:"github_app_private_key"`
+
 	LockPath     string `mapstructure:"lock_path"`
 	UploadTmpDir string `mapstructure:"upload_tmpdir"`
 
 	HealthCheckInterval int `mapstructure:"healthcheck_interval"`
 	TaskDeadline        int `mapstructure:"task_deadline"`
 	NodeDeadline        int `mapstructure:"node_deadline"`
+
+	// Seconds a task waits for the lock of the namespace it publishes to
+	NamespaceLockTimeout int `mapstructure:"namespace_lock_timeout"`
+
+	// Leader election of the periodic jobs between replicas
+	LeaderBackend string `mapstructure:"leader_backend"`
+	LeaderLease   int    `mapstructure:"leader_lease"`
+
+	// Delivery of the notifications of the tasks and the pipelines.
+	// The SMTP server is given as host:port
+	SMTPServer   string `mapstructure:"smtp_server"`
+	SMTPUser     string `mapstructure:"smtp_user"`
+	SMTPPassword string `mapstructure:"smtp_password"`
+	SMTPFrom     string `mapstructure:"smtp_from"`
+	IRCNick      string `mapstructure:"irc_nick"`
+
+	// Sinks of the event stream besides the SSE endpoint: broker and/or
+	// subscriptions
+	EventSinks []string `mapstructure:"event_sinks"`
 }
 
 type StorageConfig struct {
@@ -144,6 +169,9 @@ type AgentConfig struct {
 	UploadChunkSize    int            `mapstructure:"upload_chunk_size"`
 	SupportedExecutors []string       `mapstructure:"executor"`
 
+	// Custom labels reported to the server, matched against task node selectors
+	Labels map[string]string `mapstructure:"labels"`
+
 	// List of command to execute before execute a task
 	PreTaskHookExec []string `mapstructure:"pre_task_hook_exec"`
 
@@ -156,11 +184,28 @@ type AgentConfig struct {
 	DockerCapsDrop    []string `mapstructure:"docker_caps_drop"`
 	DefaultTaskQuota  string   `mapstructure:"default_task_quota"`
 
+	PodmanEndpoint   string   `mapstructure:"podman_endpoint"`
+	PodmanRootless   bool     `mapstructure:"podman_rootless"`
+	PodmanUsernsMode string   `mapstructure:"podman_userns"`
+	PodmanCaps       []string `mapstructure:"podman_caps"`
+	PodmanCapsDrop   []string `mapstructure:"podman_caps_drop"`
+
+	// Unprivileged user used by the shell executor, required when
+	// the agent runs as root
+	ShellUser string `mapstructure:"shell_user"`
+
 	KubeConfigPath   string `mapstructure:"kubeconfig"`
 	KubeNamespace    string `mapstructure:"kube_namespace"`
 	KubeStorageClass string `mapstructure:"kube_storageclass"`
 	KubeDropletImage string `mapstructure:"kube_droplet_image"`
 
+	// Volume type used for task data: pvc or ephemeral
+	KubeVolumeType string `mapstructure:"kube_volume_type"`
+	// Transfer mode of artefacts and sources: kubectl or helper
+	KubeTransferMode string            `mapstructure:"kube_transfer_mode"`
+	KubeHelperImage  string            `mapstructure:"kube_helper_image"`
+	KubeNodeSelector map[string]string `mapstructure:"kube_node_selector"`
+
 	LxdEndpoint            string            `mapstructure:"lxd_endpoint"`
 	LxdConfigDir           string            `mapstructure:"lxd_config_dir"`
 	LxdProfiles            []string          `mapstructure:"lxd_profiles"`
@@ -247,11 +292,22 @@ func GenDefault(viper *v.Viper) {
 	viper.SetDefault("web.github_secret", "")
 	viper.SetDefault("web.github_token_user", "")
 	viper.SetDefault("web.webhook_token", "")
+	viper.SetDefault("web.github_app_id", 0)
+	viper.SetDefault("web.github_app_private_key", "")
 	viper.SetDefault("web.lock_path", "/srv/mottainai/lock")
 	viper.SetDefault("web.upload_tmpdir", "/var/tmp")
 	viper.SetDefault("web.task_deadline", 21600) // 6h
 	viper.SetDefault("web.node_deadline", 21600)
 	viper.SetDefault("web.healthcheck_interval", 800)
+	viper.SetDefault("web.namespace_lock_timeout", 21600)
+	viper.SetDefault("web.leader_backend", "database")
+	viper.SetDefault("web.leader_lease", 30)
+	viper.SetDefault("web.smtp_server", "")
+	viper.SetDefault("web.smtp_user", "")
+	viper.SetDefault("web.smtp_password", "")
+	viper.SetDefault("web.smtp_from", "mottainai@localhost")
+	viper.SetDefault("web.irc_nick", "mottainai")
+	viper.SetDefault("web.event_sinks", []string{"broker", "subscriptions"})
 
 	viper.SetDefault("storage.type", "dir")
 	viper.SetDefault("storage.artefact_path", "./artefact")
@@ -301,11 +357,21 @@ func GenDefault(viper *v.Viper) {
 	viper.SetDefault("agent.docker_in_docker_endpoint", "/var/run/docker.sock")
 	viper.SetDefault("agent.docker_caps", []string{"SYS_PTRACE"})
 	viper.SetDefault("agent.docker_caps_drop", []string{})
+	viper.SetDefault("agent.podman_endpoint", "")
+	viper.SetDefault("agent.podman_rootless", true)
+	viper.SetDefault("agent.podman_userns", "")
+	viper.SetDefault("agent.podman_caps", []string{})
+	viper.SetDefault("agent.podman_caps_drop", []string{})
+	viper.SetDefault("agent.shell_user", "")
 	viper.SetDefault("agent.kubeconfig", "")
 	viper.SetDefault("agent.kube_namespace", "default")
 	viper.SetDefault("agent.kube_storageclass", "standard")
 	viper.SetDefault("agent.default_task_quota", "100Gi")
 	viper.SetDefault("agent.kube_droplet_image", "busybox:latest")
+	viper.SetDefault("agent.kube_volume_type", "pvc")
+	viper.SetDefault("agent.kube_transfer_mode", "kubectl")
+	viper.SetDefault("agent.kube_helper_image", "mottainaici/server:latest")
+	viper.SetDefault("agent.kube_node_selector", map[string]string{})
 
 	viper.SetDefault("agent.lxd_endpoint", "")
 	viper.SetDefault("agent.lxd_config_dir", "/srv/mottainai/lxc/")
@@ -318,6 +384,7 @@ func GenDefault(viper *v.Viper) {
 
 	viper.SetDefault("agent.pre_task_hook_exec", []string{})
 	viper.SetDefault("agent.executor", []string{})
+	viper.SetDefault("agent.labels", map[string]string{})
 
 	viper.SetDefault("general.tls_cert", "")
 	viper.SetDefault("general.tls_key", "")
@@ -449,12 +516,26 @@ web:
   github_token_user: %s
   github_secret: %s
   webhook_token: %s
+  github_app_id: %d
+  github_app_private_key: %s
 
   lock_path: %s
 
   task_deadline: %d
   node_deadline: %d
   healthcheck_interval: %d
+  namespace_lock_timeout: %d
+
+  leader_backend: %s
+  leader_lease: %d
+
+  smtp_server: %s
+  smtp_user: %s
+  smtp_password: %s
+  smtp_from: %s
+  irc_nick: %s
+
+  event_sinks: %v
 `,
 		c.Protocol, c.AppSubURL,
 		c.HTTPAddr, c.HTTPPort,
@@ -465,7 +546,11 @@ web:
 		c.AccessToken, c.WebHookGitHubToken,
 		c.WebHookGitHubTokenUser,
 		c.WebHookGitHubSecret,
-		c.WebHookGitHubToken, c.LockPath, c.TaskDeadline, c.NodeDeadline, c.HealthCheckInterval)
+		c.WebHookGitHubToken, c.GitHubAppID, c.GitHubAppPrivateKeyFile,
+		c.LockPath, c.TaskDeadline, c.NodeDeadline, c.HealthCheckInterval,
+		c.NamespaceLockTimeout, c.LeaderBackend, c.LeaderLease,
+		c.SMTPServer, c.SMTPUser, c.SMTPPassword, c.SMTPFrom, c.IRCNick,
+		c.EventSinks)
 
 	return ans
 }
@@ -556,6 +641,7 @@ agent:
   upload_speed_limit: %d
   queues: %v
   upload_chunk_size: %d
+  labels: %v
 
   docker_endpoint: %s
   docker_keepimg: %t
@@ -565,6 +651,14 @@ agent:
   docker_caps: %s
   docker_caps_drop: %s
 
+  podman_endpoint: %s
+  podman_rootless: %t
+  podman_userns: %s
+  podman_caps: %s
+  podman_caps_drop: %s
+
+  shell_user: %s
+
   lxd_endpoint: %s
   lxd_config_dir: %s
   lxd_profiles: %s
@@ -579,10 +673,13 @@ agent:
 `, c.SecretKey, c.BuildPath,
 		c.AgentConcurrency, c.AgentKey, c.ApiKey,
 		c.PrivateQueue, c.StandAlone, c.DownloadRateLimit,
-		c.UploadRateLimit, c.Queues, c.UploadChunkSize,
+		c.UploadRateLimit, c.Queues, c.UploadChunkSize, c.Labels,
 		c.DockerEndpoint, c.DockerKeepImg,
 		c.DockerPriviledged, c.DockerInDocker,
 		c.DockerEndpointDiD, c.DockerCaps, c.DockerCapsDrop,
+		c.PodmanEndpoint, c.PodmanRootless, c.PodmanUsernsMode,
+		c.PodmanCaps, c.PodmanCapsDrop,
+		c.ShellUser,
 		c.LxdEndpoint, c.LxdConfigDir, c.LxdProfiles, c.LxdEphemeralContainers,
 		c.LxdCacheRegistry, c.CacheRegistryCredentials,
 		c.HealthCheckExec, c.HealthCheckCleanPath,
@@ -30,6 +30,7 @@ const TASK_STATE_SETUP = "setup"
 const TASK_STATE_STOPPED = "stopped"
 const TASK_STATE_ASK_STOP = "stop"
 const TASK_STATE_WAIT = "waiting"
+const TASK_STATE_QUEUED = "queued"
 
 const TASK_RESULT_FAILED = "failed"
 const TASK_RESULT_ERROR = "error"
@@ -0,0 +1,84 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package agenttasks
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+)
+
+// ANNOTATIONS_FILE is the artefact where a task writes its annotations of
+// the sources, e.g. the findings of a linter: a JSON list of Annotation.
+const ANNOTATIONS_FILE = "mottainai-annotations.json"
+
+const (
+	ANNOTATION_NOTICE  = "notice"
+	ANNOTATION_WARNING = "warning"
+	ANNOTATION_FAILURE = "failure"
+)
+
+type Annotation struct {
+	Path      string `json:"path"`
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+	Level     string `json:"annotation_level"`
+	Message   string `json:"message"`
+	Title     string `json:"title,omitempty"`
+}
+
+// ReadAnnotations returns the annotations found in the artefacts of the
+// task. Entries without a path, a line or a message are dropped.
+func (t *Task) ReadAnnotations(artefactPath string) ([]Annotation, error) {
+	data, err := ioutil.ReadFile(path.Join(artefactPath, t.ID, ANNOTATIONS_FILE))
+	if os.IsNotExist(err) {
+		return []Annotation{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var all []Annotation
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+
+	res := make([]Annotation, 0, len(all))
+	for _, a := range all {
+		if a.Path == "" || a.Message == "" || a.StartLine <= 0 {
+			continue
+		}
+		if a.EndLine < a.StartLine {
+			a.EndLine = a.StartLine
+		}
+		switch a.Level {
+		case ANNOTATION_NOTICE, ANNOTATION_WARNING, ANNOTATION_FAILURE:
+		case "error":
+			a.Level = ANNOTATION_FAILURE
+		default:
+			a.Level = ANNOTATION_WARNING
+		}
+		res = append(res, a)
+	}
+	return res, nil
+}
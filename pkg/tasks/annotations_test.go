@@ -0,0 +1,67 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package agenttasks
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestReadAnnotations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "annotations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	task := &Task{ID: "1"}
+	if a, err := task.ReadAnnotations(dir); err != nil || len(a) != 0 {
+		t.Fatal("Missing annotations should be empty", a, err)
+	}
+
+	os.MkdirAll(path.Join(dir, "1"), os.ModePerm)
+	err = ioutil.WriteFile(path.Join(dir, "1", ANNOTATIONS_FILE), []byte(`[
+  {"path": "main.go", "start_line": 3, "annotation_level": "error", "message": "unused variable"},
+  {"path": "main.go", "start_line": 7, "end_line": 9, "message": "too complex"},
+  {"path": "README.md", "message": "no line"}
+]`), os.ModePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := task.ReadAnnotations(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a) != 2 {
+		t.Fatal("Invalid annotations", a)
+	}
+	if a[0].Level != ANNOTATION_FAILURE || a[0].EndLine != 3 {
+		t.Error("Invalid annotation", a[0])
+	}
+	if a[1].Level != ANNOTATION_WARNING || a[1].EndLine != 9 {
+		t.Error("Invalid annotation", a[1])
+	}
+}
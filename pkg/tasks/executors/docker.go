@@ -156,6 +156,22 @@ func (d *DockerExecutor) Play(docID string) (int, error) {
 		return 1, err
 	}
 
+	var mounts []string
+	if d.Config.GetAgent().DockerInDocker {
+		mounts = append(mounts, d.Config.GetAgent().DockerEndpointDiD+":/var/run/docker.sock")
+	}
+
+	return d.PlayContainer(task_info, &docker.HostConfig{
+		Privileged: d.Config.GetAgent().DockerPriviledged,
+		CapAdd:     d.Config.GetAgent().DockerCaps,
+		CapDrop:    d.Config.GetAgent().DockerCapsDrop,
+	}, mounts, d.Config.GetAgent().DockerInDocker)
+}
+
+// PlayContainer runs the task in a container created with the given
+// host configuration. Binds are resolved from the task instruction and
+// extended with the additional mounts.
+func (d *DockerExecutor) PlayContainer(task_info tasks.Task, hostConfig *docker.HostConfig, mounts []string, hostmapping bool) (int, error) {
 	instruction := NewInstructionFromTask(task_info)
 
 	d.Context.ResolveMounts(instruction)
@@ -169,10 +185,10 @@ func (d *DockerExecutor) Play(docID string) (int, error) {
 	mapping := d.Context.ResolveArtefactsMounts(ArtefactMapping{
 		ArtefactPath: task_info.ArtefactPath,
 		StoragePath:  task_info.StoragePath,
-	}, instruction, d.Config.GetAgent().DockerInDocker)
+	}, instruction, hostmapping)
 
-	if d.Config.GetAgent().DockerInDocker {
-		instruction.AddMount(d.Config.GetAgent().DockerEndpointDiD + ":/var/run/docker.sock")
+	for _, m := range mounts {
+		instruction.AddMount(m)
 	}
 
 	instruction.SetTaskEnvVariables(&task_info, d.Context)
@@ -184,6 +200,7 @@ func (d *DockerExecutor) Play(docID string) (int, error) {
 	}
 	d.Report(">> Creating container..")
 
+	hostConfig.Binds = instruction.MountsList()
 	container, err := d.DockerClient.CreateContainer(docker.CreateContainerOptions{
 		Config: &docker.Config{
 			Image:      image,
@@ -192,12 +209,7 @@ func (d *DockerExecutor) Play(docID string) (int, error) {
 			Entrypoint: instruction.EntrypointList(),
 			Env:        instruction.EnvironmentList(),
 		},
-		HostConfig: &docker.HostConfig{
-			Privileged: d.Config.GetAgent().DockerPriviledged,
-			Binds:      instruction.MountsList(),
-			CapAdd:     d.Config.GetAgent().DockerCaps,
-			CapDrop:    d.Config.GetAgent().DockerCapsDrop,
-		},
+		HostConfig: hostConfig,
 	})
 	if err != nil {
 		d.Report("Creating container error: " + err.Error())
@@ -345,94 +345,10 @@ func (d *TaskExecutor) Setup(docID string) error {
 
 	// Fetch git repo (for now only one supported) and checkout commit
 	if len(task_info.Source) > 0 {
-		d.Report("> Cloning git repo: " + task_info.Source + " in : " + tmp_buildpath)
-
 		d.Context.SourceDir = path.Join(tmp_buildpath, "target_repo")
-		if err := os.Mkdir(d.Context.SourceDir, os.ModePerm); err != nil {
+		if err := d.CloneRepository(task_info, d.Context.SourceDir); err != nil {
 			return err
 		}
-		opts := &git.CloneOptions{
-			URL:      task_info.Source,
-			Progress: d,
-		}
-
-		if task_info.PrivKey != "" {
-
-			auth := task_info.PrivKey
-			var s secret.Secret
-			req := schema.Request{
-				Route:   v1.Schema.GetSecretRoute("show"),
-				Target:  &s,
-				Options: map[string]interface{}{"id": task_info.PrivKey},
-			}
-			err := fetcher.Handle(req)
-
-			if err == nil && s.Secret != "" {
-				d.Report("Found secret by id.")
-				auth = s.Secret
-			} else {
-				req := schema.Request{
-					Route:   v1.Schema.GetSecretRoute("show_by_name"),
-					Target:  &s,
-					Options: map[string]interface{}{"name": task_info.PrivKey},
-				}
-				err := fetcher.Handle(req)
-				if err == nil && s.Secret != "" {
-					d.Report("Found secret by name.")
-					auth = s.Secret
-				}
-			}
-
-			if strings.HasPrefix(auth, "auth:") {
-				d.Report("Found secret with auth prefix.")
-				a := strings.TrimPrefix(auth, "auth:")
-				data := strings.Split(a, ":")
-				if len(data) != 2 {
-					return errors.New("Invalid credentials")
-				}
-				opts.Auth = &http.BasicAuth{Username: data[0], Password: data[1]}
-
-			} else {
-				d.Report("Found private key for repository.")
-				signer, err := ssh.ParsePrivateKey([]byte(auth))
-				if err != nil {
-					return err
-				}
-				sshAuth := &ssh2.PublicKeys{
-					User:   "git",
-					Signer: signer,
-					// TODO: This could be avoid if we use a directory that
-					// contains valid certificates. See if there is a way to
-					// accept only valid certificate and/or configure this through
-					// agent configuration option.
-					HostKeyCallbackHelper: ssh2.HostKeyCallbackHelper{
-						HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-					},
-				}
-				opts.Auth = sshAuth
-			}
-		}
-		// TODO: This should go in a go routine and wait for ending
-		r, err := git.PlainClone(d.Context.SourceDir, false, opts)
-		if err != nil {
-			return err
-		}
-
-		if len(task_info.Commit) > 0 {
-
-			w, err := r.Worktree()
-			if err != nil {
-				return err
-			}
-
-			err = w.Checkout(&git.CheckoutOptions{
-				Hash: plumbing.NewHash(task_info.Commit),
-			})
-			if err != nil {
-				return err
-			}
-
-		}
 	}
 
 	//cwd, _ := os.Getwd()
@@ -464,6 +380,99 @@ func (d *TaskExecutor) Setup(docID string) error {
 	return nil
 }
 
+// CloneRepository clones the task source repository in dir and checkouts
+// the task commit, if any.
+func (d *TaskExecutor) CloneRepository(task_info tasks.Task, dir string) error {
+	d.Report("> Cloning git repo: " + task_info.Source + " in : " + dir)
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	opts := &git.CloneOptions{
+		URL:      task_info.Source,
+		Progress: d,
+	}
+
+	if task_info.PrivKey != "" {
+
+		auth := task_info.PrivKey
+		var s secret.Secret
+		req := schema.Request{
+			Route:   v1.Schema.GetSecretRoute("show"),
+			Target:  &s,
+			Options: map[string]interface{}{"id": task_info.PrivKey},
+		}
+		err := d.MottainaiClient.Handle(req)
+
+		if err == nil && s.Secret != "" {
+			d.Report("Found secret by id.")
+			auth = s.Secret
+		} else {
+			req := schema.Request{
+				Route:   v1.Schema.GetSecretRoute("show_by_name"),
+				Target:  &s,
+				Options: map[string]interface{}{"name": task_info.PrivKey},
+			}
+			err := d.MottainaiClient.Handle(req)
+			if err == nil && s.Secret != "" {
+				d.Report("Found secret by name.")
+				auth = s.Secret
+			}
+		}
+
+		if strings.HasPrefix(auth, "auth:") {
+			d.Report("Found secret with auth prefix.")
+			a := strings.TrimPrefix(auth, "auth:")
+			data := strings.Split(a, ":")
+			if len(data) != 2 {
+				return errors.New("Invalid credentials")
+			}
+			opts.Auth = &http.BasicAuth{Username: data[0], Password: data[1]}
+
+		} else {
+			d.Report("Found private key for repository.")
+			signer, err := ssh.ParsePrivateKey([]byte(auth))
+			if err != nil {
+				return err
+			}
+			sshAuth := &ssh2.PublicKeys{
+				User:   "git",
+				Signer: signer,
+				// TODO: This could be avoid if we use a directory that
+				// contains valid certificates. See if there is a way to
+				// accept only valid certificate and/or configure this through
+				// agent configuration option.
+				HostKeyCallbackHelper: ssh2.HostKeyCallbackHelper{
+					HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+				},
+			}
+			opts.Auth = sshAuth
+		}
+	}
+	// TODO: This should go in a go routine and wait for ending
+	r, err := git.PlainClone(dir, false, opts)
+	if err != nil {
+		return err
+	}
+
+	if len(task_info.Commit) > 0 {
+
+		w, err := r.Worktree()
+		if err != nil {
+			return err
+		}
+
+		err = w.Checkout(&git.CheckoutOptions{
+			Hash: plumbing.NewHash(task_info.Commit),
+		})
+		if err != nil {
+			return err
+		}
+
+	}
+	return nil
+}
+
 // Implement Write method as io.Writer
 func (t *TaskExecutor) Write(p []byte) (int, error) {
 	t.Report(string(p[0 : len(p)-1]))
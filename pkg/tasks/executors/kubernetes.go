@@ -29,6 +29,7 @@ import (
 	"os/exec"
 	"path"
 	"strconv"
+	"strings"
 	"time"
 
 	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
@@ -44,19 +45,32 @@ import (
 	cp "k8s.io/kubernetes/pkg/kubectl/cmd/cp"
 )
 
+const (
+	KUBE_VOLUME_PVC       = "pvc"
+	KUBE_VOLUME_EPHEMERAL = "ephemeral"
+
+	KUBE_TRANSFER_KUBECTL = "kubectl"
+	KUBE_TRANSFER_HELPER  = "helper"
+)
+
 type KubernetesExecutor struct {
 	*TaskExecutor
 	Namespace, StorageClass                       string
+	VolumeType, TransferMode, HelperImage         string
 	PodID, ArtefactPVCID, StoragePVCID, RepoPVCID string
-	KubernetesClient                              *kubernetes.Clientset
+	SecretID                                      string
+	KubernetesClient                              kubernetes.Interface
 	KubernetesConfig                              *rest.Config
-	UsedPODs, UsedPVCs                            []string
+	UsedPODs, UsedPVCs, UsedSecrets               []string
 }
 
 func NewKubernetesExecutor(config *setting.Config) *KubernetesExecutor {
 	return &KubernetesExecutor{
 		Namespace:    config.GetAgent().KubeNamespace,
 		StorageClass: config.GetAgent().KubeStorageClass,
+		VolumeType:   config.GetAgent().KubeVolumeType,
+		TransferMode: config.GetAgent().KubeTransferMode,
+		HelperImage:  config.GetAgent().KubeHelperImage,
 
 		TaskExecutor: &TaskExecutor{
 			Context: NewExecutorContext(),
@@ -64,34 +78,49 @@ func NewKubernetesExecutor(config *setting.Config) *KubernetesExecutor {
 		}}
 }
 
+func (d *KubernetesExecutor) IsHelperTransfer() bool {
+	return d.TransferMode == KUBE_TRANSFER_HELPER
+}
+
+func (d *KubernetesExecutor) IsEphemeral() bool {
+	return d.VolumeType == KUBE_VOLUME_EPHEMERAL
+}
+
 func (d *KubernetesExecutor) Setup(docID string) error {
 	d.PodID = docID + "-job"
 	d.ArtefactPVCID = d.PodID + "-pvc-artefacts"
 	d.StoragePVCID = d.PodID + "-pvc-storage"
 	d.RepoPVCID = d.PodID + "-pvc-repodata"
+	d.SecretID = d.PodID + "-helper"
 
-	var err error
-	if d.Config.GetAgent().KubeConfigPath == "" {
-		d.KubernetesConfig, err = rest.InClusterConfig()
-		if err != nil {
-			return err
+	if d.IsEphemeral() && !d.IsHelperTransfer() {
+		return errors.New("ephemeral volumes require kube_transfer_mode: " + KUBE_TRANSFER_HELPER)
+	}
+
+	// A client could be already injected (e.g. a fake clientset)
+	if d.KubernetesClient == nil {
+		var err error
+		if d.Config.GetAgent().KubeConfigPath == "" {
+			d.KubernetesConfig, err = rest.InClusterConfig()
+			if err != nil {
+				return err
+			}
+
+		} else {
+			d.KubernetesConfig, err = clientcmd.BuildConfigFromFlags("", d.Config.GetAgent().KubeConfigPath)
+			if err != nil {
+				return err
+			}
 		}
 
-	} else {
-		d.KubernetesConfig, err = clientcmd.BuildConfigFromFlags("", d.Config.GetAgent().KubeConfigPath)
+		clientset, err := kubernetes.NewForConfig(d.KubernetesConfig)
 		if err != nil {
 			return err
 		}
+		d.KubernetesClient = clientset
 	}
 
-	clientset, err := kubernetes.NewForConfig(d.KubernetesConfig)
-	if err != nil {
-		return err
-	}
-
-	d.TaskExecutor.Setup(docID)
-	d.KubernetesClient = clientset
-	return nil
+	return d.TaskExecutor.Setup(docID)
 }
 
 func (d *KubernetesExecutor) WaitUntilRunning(pod, namespace string) error {
@@ -109,6 +138,12 @@ func (d *KubernetesExecutor) WaitUntilRunning(pod, namespace string) error {
 		if p.Status.Phase != apiv1.PodPending {
 			break
 		}
+
+		task_info, err := tasks.FetchTask(d.MottainaiClient)
+		if err == nil && task_info.IsStopped() {
+			return errors.New(ABORT_EXECUTION_ERROR)
+		}
+		time.Sleep(2 * time.Second)
 	}
 
 	if p.Status.Phase != apiv1.PodRunning { //something went wrong, but we want to catch the error from the handle, which grabs exit code already
@@ -167,6 +202,99 @@ func getVolume(name, path string) (apiv1.Volume, apiv1.VolumeMount) {
 	return vol, mount
 }
 
+func getEphemeralVolume(name, path, size string) (apiv1.Volume, apiv1.VolumeMount, error) {
+	mount := apiv1.VolumeMount{
+		Name:      name,
+		MountPath: path,
+	}
+
+	emptyDir := &apiv1.EmptyDirVolumeSource{}
+	if size != "" {
+		quantity, err := resource.ParseQuantity(size)
+		if err != nil {
+			return apiv1.Volume{}, mount, errors.Wrap(err, "invalid quantity")
+		}
+		emptyDir.SizeLimit = &quantity
+	}
+
+	vol := apiv1.Volume{
+		Name:         name,
+		VolumeSource: apiv1.VolumeSource{EmptyDir: emptyDir},
+	}
+
+	return vol, mount, nil
+}
+
+// TaskVolume returns the volume with the given name mounted on path,
+// backed by a PVC or by an ephemeral volume depending on VolumeType.
+func (d *KubernetesExecutor) TaskVolume(name, path, size string) (apiv1.Volume, apiv1.VolumeMount, error) {
+	if d.IsEphemeral() {
+		return getEphemeralVolume(name, path, size)
+	}
+	vol, mount := getVolume(name, path)
+	return vol, mount, nil
+}
+
+// NodeSelector merges the node selector of the agent with the
+// key=value constraints defined in the task.
+func (d *KubernetesExecutor) NodeSelector(task_info tasks.Task) map[string]string {
+	selector := map[string]string{}
+	for k, v := range d.Config.GetAgent().KubeNodeSelector {
+		selector[k] = v
+	}
+	for _, s := range task_info.KubeNodeSelector {
+		kv := strings.SplitN(s, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			continue
+		}
+		selector[kv[0]] = kv[1]
+	}
+	if len(selector) == 0 {
+		return nil
+	}
+	return selector
+}
+
+// ParseTolerations parses tolerations in the form key[=value][:effect].
+// A toleration without value uses the Exists operator.
+func ParseTolerations(specs []string) ([]apiv1.Toleration, error) {
+	var res []apiv1.Toleration
+
+	for _, s := range specs {
+		t := apiv1.Toleration{Operator: apiv1.TolerationOpExists}
+
+		if i := strings.LastIndex(s, ":"); i != -1 {
+			t.Effect = apiv1.TaintEffect(s[i+1:])
+			s = s[:i]
+			switch t.Effect {
+			case apiv1.TaintEffectNoSchedule, apiv1.TaintEffectPreferNoSchedule, apiv1.TaintEffectNoExecute:
+			default:
+				return nil, errors.New("invalid toleration effect: " + string(t.Effect))
+			}
+		}
+
+		kv := strings.SplitN(s, "=", 2)
+		t.Key = kv[0]
+		if len(kv) == 2 {
+			if t.Key == "" {
+				return nil, errors.New("invalid toleration: value without key")
+			}
+			t.Operator = apiv1.TolerationOpEqual
+			t.Value = kv[1]
+		}
+		res = append(res, t)
+	}
+
+	return res, nil
+}
+
+func (d *KubernetesExecutor) Quota(task_info tasks.Task) string {
+	if task_info.Quota != "" {
+		return task_info.Quota
+	}
+	return d.Config.GetAgent().DefaultTaskQuota
+}
+
 func (d *KubernetesExecutor) CreatePVC(id, size string) error {
 	quantity, err := resource.ParseQuantity(size)
 	if err != nil {
@@ -201,6 +329,124 @@ func (d *KubernetesExecutor) DeletePVC(id string) error {
 	return nil
 }
 
+// CreateHelperSecret stores the agent API key used by the helper
+// containers to talk with the Mottainai API.
+func (d *KubernetesExecutor) CreateHelperSecret() error {
+	_, err := d.KubernetesClient.CoreV1().Secrets(d.Namespace).Create(&apiv1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      d.SecretID,
+			Namespace: d.Namespace,
+		},
+		StringData: map[string]string{
+			"api_key": d.Config.GetAgent().ApiKey,
+		},
+	})
+	if err != nil {
+		return errors.Wrap(err, "error creating secret "+d.SecretID)
+	}
+	d.UsedSecrets = append(d.UsedSecrets, d.SecretID)
+	return nil
+}
+
+func (d *KubernetesExecutor) DeleteSecret(id string) error {
+	err := d.KubernetesClient.CoreV1().Secrets(d.Namespace).Delete(id, &metav1.DeleteOptions{})
+	if err != nil {
+		return errors.Wrap(err, "error deleting secret "+id)
+	}
+	return nil
+}
+
+func (d *KubernetesExecutor) helperEnv() []apiv1.EnvVar {
+	return []apiv1.EnvVar{
+		{Name: "MOTTAINAI_WEB__APPLICATION_URL", Value: d.Config.GetWeb().AppURL},
+		{Name: "MOTTAINAI_AGENT__UPLOAD_CHUNK_SIZE", Value: strconv.Itoa(d.Config.GetAgent().UploadChunkSize)},
+		{
+			Name: "MOTTAINAI_AGENT__API_KEY",
+			ValueFrom: &apiv1.EnvVarSource{
+				SecretKeyRef: &apiv1.SecretKeySelector{
+					LocalObjectReference: apiv1.LocalObjectReference{Name: d.SecretID},
+					Key:                  "api_key",
+				},
+			},
+		},
+	}
+}
+
+// HelperContainers returns the init container that populates the task
+// volumes and the sidecar that uploads the artefacts once the task
+// container is terminated. Both talk directly with the Mottainai API.
+func (d *KubernetesExecutor) HelperContainers(task_info tasks.Task, volumeMounts []apiv1.VolumeMount, srcMapping ArtefactMapping) (apiv1.Container, apiv1.Container) {
+	artefacts := d.Context.ContainerPath(srcMapping.GetArtefactPath())
+
+	download := []string{"mottainai-server", "kube-helper", "download",
+		"--task", task_info.ID,
+		"--artefacts", artefacts,
+		"--storage", d.Context.ContainerPath(srcMapping.GetStoragePath()),
+	}
+	if len(task_info.Source) > 0 {
+		download = append(download, "--source", d.Context.RootTaskDir)
+	}
+
+	fetcher := apiv1.Container{
+		Name:         d.PodID + "-fetch",
+		Image:        d.HelperImage,
+		Command:      download,
+		Env:          d.helperEnv(),
+		VolumeMounts: volumeMounts,
+	}
+
+	uploader := apiv1.Container{
+		Name:  d.PodID + "-upload",
+		Image: d.HelperImage,
+		Command: []string{"mottainai-server", "kube-helper", "upload",
+			"--task", task_info.ID,
+			"--artefacts", artefacts,
+		},
+		Env:          d.helperEnv(),
+		VolumeMounts: volumeMounts,
+	}
+
+	return fetcher, uploader
+}
+
+// JobPod returns the POD definition of the task.
+func (d *KubernetesExecutor) JobPod(task_info tasks.Task, instruction Instruction, volumes []apiv1.Volume, volumeMounts []apiv1.VolumeMount, srcMapping ArtefactMapping) (*apiv1.Pod, error) {
+	tolerations, err := ParseTolerations(task_info.KubeTolerations)
+	if err != nil {
+		return nil, err
+	}
+
+	pod := &apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      d.PodID,
+			Namespace: d.Namespace,
+			Labels:    map[string]string{"mottainai-job" + d.PodID: "true"},
+		},
+		Spec: apiv1.PodSpec{
+			RestartPolicy: apiv1.RestartPolicyNever,
+			Volumes:       volumes,
+			NodeSelector:  d.NodeSelector(task_info),
+			Tolerations:   tolerations,
+			Containers: []apiv1.Container{{
+				Name:         d.PodID,
+				Command:      instruction.EntrypointList(),
+				Args:         instruction.CommandList(),
+				Image:        task_info.Image,
+				WorkingDir:   d.Context.HostPath(task_info.Directory),
+				TTY:          true,
+				VolumeMounts: volumeMounts,
+			},
+			}}}
+
+	if d.IsHelperTransfer() {
+		fetcher, uploader := d.HelperContainers(task_info, volumeMounts, srcMapping)
+		pod.Spec.InitContainers = []apiv1.Container{fetcher}
+		pod.Spec.Containers = append(pod.Spec.Containers, uploader)
+	}
+
+	return pod, nil
+}
+
 func (d *KubernetesExecutor) PopulateArtefacts(volumes []apiv1.Volume, volumeMounts []apiv1.VolumeMount, srcMapping, outMapping ArtefactMapping) error {
 
 	//  Artefact Uploader
@@ -300,69 +546,75 @@ func (d *KubernetesExecutor) Play(docID string) (int, error) {
 	instruction.Report(d)
 	d.Context.Report(d)
 
-	if err := d.DownloadArtefacts(outMapping.ArtefactPath, outMapping.StoragePath); err != nil {
+	p, err := d.CreateJobPod(task_info, instruction, srcMapping, outMapping)
+	if err != nil {
 		return 1, err
 	}
+	err = d.AttachContainerReport()
+	if err != nil {
+		return 1, errors.Wrap(err, "Error attaching stdout to pod "+d.PodID)
+	}
 
-	for _, s := range []string{d.ArtefactPVCID, d.StoragePVCID, d.RepoPVCID} {
-		if task_info.Quota != "" {
-			err := d.CreatePVC(s, task_info.Quota)
-			if err != nil {
-				return 1, err
-			}
-		} else {
-			err := d.CreatePVC(s, d.Config.GetAgent().DefaultTaskQuota)
-			if err != nil {
-				return 1, err
-			}
+	return d.Handle(p, instruction, srcMapping, outMapping)
+}
+
+// CreateJobPod creates the volumes and the pod running the task, which are
+// removed by CleanUpContainer.
+func (d *KubernetesExecutor) CreateJobPod(task_info tasks.Task, instruction Instruction, srcMapping, outMapping ArtefactMapping) (*apiv1.Pod, error) {
+	if d.IsHelperTransfer() {
+		// Artefacts are fetched by the helper init container
+		if err := d.CreateHelperSecret(); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := d.DownloadArtefacts(outMapping.ArtefactPath, outMapping.StoragePath); err != nil {
+			return nil, err
 		}
-		d.UsedPVCs = append(d.UsedPVCs, s)
 	}
 
-	artefactsVolume, artefactsVolumeMount := getVolume(d.ArtefactPVCID, d.Context.ContainerPath(srcMapping.GetArtefactPath()))
-	storageVolume, storageVolumeMount := getVolume(d.StoragePVCID, d.Context.ContainerPath(srcMapping.GetStoragePath()))
-	repoVolume, repoVolumeMount := getVolume(d.RepoPVCID, d.Context.RootTaskDir)
-
-	volumes := []apiv1.Volume{artefactsVolume, storageVolume, repoVolume}
-	volumesMounts := []apiv1.VolumeMount{artefactsVolumeMount, storageVolumeMount, repoVolumeMount}
+	if !d.IsEphemeral() {
+		for _, s := range []string{d.ArtefactPVCID, d.StoragePVCID, d.RepoPVCID} {
+			if err := d.CreatePVC(s, d.Quota(task_info)); err != nil {
+				return nil, err
+			}
+			d.UsedPVCs = append(d.UsedPVCs, s)
+		}
+	}
 
-	if err := d.PopulateArtefacts(volumes, volumesMounts, srcMapping, outMapping); err != nil {
-		return 1, err
+	var volumes []apiv1.Volume
+	var volumesMounts []apiv1.VolumeMount
+	for _, v := range []struct{ name, path string }{
+		{d.ArtefactPVCID, d.Context.ContainerPath(srcMapping.GetArtefactPath())},
+		{d.StoragePVCID, d.Context.ContainerPath(srcMapping.GetStoragePath())},
+		{d.RepoPVCID, d.Context.RootTaskDir},
+	} {
+		vol, mount, err := d.TaskVolume(v.name, v.path, d.Quota(task_info))
+		if err != nil {
+			return nil, err
+		}
+		volumes = append(volumes, vol)
+		volumesMounts = append(volumesMounts, mount)
 	}
 
-	//ctx.SourceDir + ":" + ctx.RootTaskDir
-	p, err := d.KubernetesClient.CoreV1().Pods(d.Namespace).Create(&apiv1.Pod{
+	if !d.IsHelperTransfer() {
+		if err := d.PopulateArtefacts(volumes, volumesMounts, srcMapping, outMapping); err != nil {
+			return nil, err
+		}
+	}
 
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      d.PodID,
-			Namespace: d.Namespace,
-			Labels:    map[string]string{"mottainai-job" + d.PodID: "true"},
-		},
-		Spec: apiv1.PodSpec{
-			RestartPolicy: apiv1.RestartPolicyNever,
-			Volumes:       volumes,
-			Containers: []apiv1.Container{{
-				Name:         d.PodID,
-				Command:      instruction.EntrypointList(),
-				Args:         instruction.CommandList(),
-				Image:        task_info.Image,
-				WorkingDir:   d.Context.HostPath(task_info.Directory),
-				TTY:          true,
-				VolumeMounts: volumesMounts,
-			},
-			}}})
+	pod, err := d.JobPod(task_info, instruction, volumes, volumesMounts, srcMapping)
 	if err != nil {
-		return 1, err
+		return nil, err
 	}
-	d.UsedPODs = append(d.UsedPODs, d.PodID)
-	//time.Sleep(10 * time.Second)
-	err = d.AttachContainerReport()
+
+	p, err := d.KubernetesClient.CoreV1().Pods(d.Namespace).Create(pod)
 	if err != nil {
-		return 1, errors.Wrap(err, "Error attaching stdout to pod "+d.PodID)
+		return nil, err
 	}
-
-	return d.Handle(p, instruction, srcMapping, outMapping)
+	d.UsedPODs = append(d.UsedPODs, d.PodID)
+	return p, nil
 }
+
 func (d *KubernetesExecutor) Clean() error {
 	if err := d.TaskExecutor.Clean(); err != nil {
 		return err
@@ -370,6 +622,15 @@ func (d *KubernetesExecutor) Clean() error {
 	return d.CleanUpContainer()
 }
 
+func containerTermination(p *apiv1.Pod, name string) *apiv1.ContainerStateTerminated {
+	for _, s := range p.Status.ContainerStatuses {
+		if s.Name == name {
+			return s.State.Terminated
+		}
+	}
+	return nil
+}
+
 func (d *KubernetesExecutor) Handle(p *apiv1.Pod, i Instruction, srcMapping, outMapping ArtefactMapping) (int, error) {
 
 	starttime := time.Now()
@@ -378,6 +639,7 @@ func (d *KubernetesExecutor) Handle(p *apiv1.Pod, i Instruction, srcMapping, out
 		return 1, err
 	}
 
+	signaled := false
 	for {
 		p, err = d.KubernetesClient.CoreV1().Pods(d.Namespace).Get(d.PodID, metav1.GetOptions{})
 		if err != nil {
@@ -401,7 +663,16 @@ func (d *KubernetesExecutor) Handle(p *apiv1.Pod, i Instruction, srcMapping, out
 		}
 		timedout := (task_info.TimeOut != 0 && (now.Sub(starttime).Seconds() > task_info.TimeOut))
 		if task_info.IsStopped() || timedout {
-			return d.HandleTaskStop(true)
+			// Don't wait for the cleanup phase to stop the workload
+			d.DeletePOD(d.PodID, d.Namespace)
+			return d.HandleTaskStop(timedout)
+		}
+
+		// The upload sidecar waits for the exit status of the task
+		// before uploading the artefacts.
+		if t := containerTermination(p, d.PodID); t != nil && d.IsHelperTransfer() && !signaled {
+			d.ExitStatus(int(t.ExitCode))
+			signaled = true
 		}
 
 		if p.Status.Phase != apiv1.PodPending && p.Status.Phase != apiv1.PodRunning {
@@ -412,6 +683,19 @@ func (d *KubernetesExecutor) Handle(p *apiv1.Pod, i Instruction, srcMapping, out
 
 	d.Report("Container execution terminated")
 
+	t := containerTermination(p, d.PodID)
+	if t == nil {
+		return 1, errors.New("No exit status found for POD " + d.PodID)
+	}
+
+	if d.IsHelperTransfer() {
+		if u := containerTermination(p, d.PodID+"-upload"); u == nil || u.ExitCode != 0 {
+			return 1, errors.New("Upload of artifacts failed")
+		}
+		d.Report("Upload of artifacts terminated")
+		return int(t.ExitCode), nil
+	}
+
 	//  Artefact Uploader
 	d.Report("Creating uploader droplet")
 
@@ -463,7 +747,7 @@ func (d *KubernetesExecutor) Handle(p *apiv1.Pod, i Instruction, srcMapping, out
 
 	// END Uploader Artefacts
 
-	return int(p.Status.ContainerStatuses[0].State.Terminated.ExitCode), nil
+	return int(t.ExitCode), nil
 
 }
 
@@ -529,6 +813,12 @@ func (d *KubernetesExecutor) CleanUpContainer() error {
 			d.Report("Error deleting PVC " + gcPVC + ": " + err.Error())
 		}
 	}
+	for _, gcSecret := range d.UsedSecrets {
+		err := d.DeleteSecret(gcSecret)
+		if err != nil {
+			d.Report("Error deleting Secret " + gcSecret + ": " + err.Error())
+		}
+	}
 
 	return nil
 }
@@ -0,0 +1,91 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package agenttasks
+
+import (
+	"time"
+
+	"github.com/MottainaiCI/mottainai-server/pkg/client"
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+	tasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+)
+
+// KubernetesHelper runs inside the helper containers of a Kubernetes
+// task POD and moves the task data from and to the Mottainai API.
+type KubernetesHelper struct {
+	*TaskExecutor
+}
+
+func NewKubernetesHelper(config *setting.Config, taskID string) *KubernetesHelper {
+	h := &KubernetesHelper{
+		TaskExecutor: &TaskExecutor{
+			Context: NewExecutorContext(),
+			Config:  config,
+		}}
+	h.Context.StandardOutput = true
+	h.MottainaiClient = client.NewTokenClient(
+		config.GetWeb().AppURL,
+		config.GetAgent().ApiKey, config)
+	h.MottainaiClient.SetUploadChunkSize(config.GetAgent().UploadChunkSize)
+	h.MottainaiClient.Doc(taskID)
+	return h
+}
+
+// Download clones the task source in sourcedir (if not empty) and
+// downloads the artefacts and storages required by the task.
+func (h *KubernetesHelper) Download(artefactdir, storagedir, sourcedir string) error {
+	task_info, err := tasks.FetchTask(h.MottainaiClient)
+	if err != nil {
+		return err
+	}
+
+	if len(sourcedir) > 0 && len(task_info.Source) > 0 {
+		if err := h.CloneRepository(task_info, sourcedir); err != nil {
+			return err
+		}
+	}
+
+	return h.DownloadArtefacts(artefactdir, storagedir)
+}
+
+// Upload waits until the agent sets the exit status of the task and
+// then uploads the artefacts. Nothing is uploaded if the task is stopped.
+func (h *KubernetesHelper) Upload(artefactdir string, interval time.Duration) error {
+	for {
+		task_info, err := tasks.FetchTask(h.MottainaiClient)
+		if err != nil {
+			return err
+		}
+		if task_info.IsStopped() {
+			h.Report("Task stopped, skipping upload of artifacts")
+			return nil
+		}
+		if len(task_info.ExitStatus) > 0 {
+			break
+		}
+		time.Sleep(interval)
+	}
+
+	h.Report("Upload of artifacts starts")
+	return h.UploadArtefacts(artefactdir)
+}
@@ -0,0 +1,277 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package agenttasks
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+	tasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+	fakes "github.com/MottainaiCI/mottainai-server/tests/fakes"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseTolerations(t *testing.T) {
+	tolerations, err := ParseTolerations([]string{"gpu", "arch=arm64:NoSchedule", ":NoExecute"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tolerations) != 3 {
+		t.Fatal("Expected 3 tolerations, got", len(tolerations))
+	}
+	if tolerations[0].Key != "gpu" || tolerations[0].Operator != apiv1.TolerationOpExists || tolerations[0].Effect != "" {
+		t.Error("Invalid toleration", tolerations[0])
+	}
+	if tolerations[1].Key != "arch" || tolerations[1].Value != "arm64" ||
+		tolerations[1].Operator != apiv1.TolerationOpEqual || tolerations[1].Effect != apiv1.TaintEffectNoSchedule {
+		t.Error("Invalid toleration", tolerations[1])
+	}
+	if tolerations[2].Key != "" || tolerations[2].Effect != apiv1.TaintEffectNoExecute {
+		t.Error("Invalid toleration", tolerations[2])
+	}
+
+	if _, err := ParseTolerations([]string{"foo:Never"}); err == nil {
+		t.Error("Invalid effect accepted")
+	}
+}
+
+func TestKubernetesPodSpec(t *testing.T) {
+	config := setting.NewConfig(nil)
+	config.Unmarshal()
+	config.GetAgent().KubeNodeSelector = map[string]string{"pool": "ci", "arch": "amd64"}
+	config.GetAgent().KubeVolumeType = KUBE_VOLUME_EPHEMERAL
+	config.GetAgent().KubeTransferMode = KUBE_TRANSFER_HELPER
+
+	d := NewKubernetesExecutor(config)
+	d.PodID = "1-job"
+	d.SecretID = "1-job-helper"
+	d.Context.RootTaskDir = "/build/1"
+
+	task := tasks.Task{
+		ID:               "1",
+		Image:            "alpine",
+		Source:           "https://example.com/repo.git",
+		Script:           []string{"make"},
+		KubeNodeSelector: []string{"arch=arm64", "invalid"},
+		KubeTolerations:  []string{"arch=arm64:NoSchedule"},
+	}
+
+	selector := d.NodeSelector(task)
+	if len(selector) != 2 || selector["arch"] != "arm64" || selector["pool"] != "ci" {
+		t.Error("Invalid node selector", selector)
+	}
+
+	vol, mount, err := d.TaskVolume("artefacts", "/build/1/artefacts", "1Gi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vol.EmptyDir == nil || vol.EmptyDir.SizeLimit.String() != "1Gi" || vol.PersistentVolumeClaim != nil {
+		t.Error("Expected ephemeral volume", vol)
+	}
+	if mount.MountPath != "/build/1/artefacts" {
+		t.Error("Invalid mount path", mount.MountPath)
+	}
+
+	pod, err := d.JobPod(task, NewInstructionFromTask(task), []apiv1.Volume{vol}, []apiv1.VolumeMount{mount}, ArtefactMapping{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pod.Spec.Tolerations) != 1 || pod.Spec.NodeSelector["arch"] != "arm64" {
+		t.Error("Scheduling constraints not applied", pod.Spec)
+	}
+	if len(pod.Spec.InitContainers) != 1 || len(pod.Spec.Containers) != 2 {
+		t.Fatal("Helper containers not found", pod.Spec)
+	}
+	if pod.Spec.Containers[0].Name != d.PodID || pod.Spec.Containers[1].Name != d.PodID+"-upload" {
+		t.Error("Invalid containers", pod.Spec.Containers)
+	}
+	download := pod.Spec.InitContainers[0].Command
+	if download[len(download)-2] != "--source" || download[len(download)-1] != "/build/1" {
+		t.Error("Source not fetched by the helper", download)
+	}
+
+	d.TransferMode = KUBE_TRANSFER_KUBECTL
+	d.VolumeType = KUBE_VOLUME_PVC
+	vol, _, _ = d.TaskVolume("artefacts", "/build/1/artefacts", "1Gi")
+	if vol.PersistentVolumeClaim == nil || vol.PersistentVolumeClaim.ClaimName != "artefacts" {
+		t.Error("Expected PVC volume", vol)
+	}
+	pod, _ = d.JobPod(task, NewInstructionFromTask(task), []apiv1.Volume{vol}, []apiv1.VolumeMount{mount}, ArtefactMapping{})
+	if len(pod.Spec.InitContainers) != 0 || len(pod.Spec.Containers) != 1 {
+		t.Error("Helper containers without helper transfer mode", pod.Spec)
+	}
+}
+
+func TestKubernetesEphemeralRequiresHelper(t *testing.T) {
+	config := setting.NewConfig(nil)
+	config.Unmarshal()
+	config.GetAgent().KubeVolumeType = KUBE_VOLUME_EPHEMERAL
+
+	d := NewKubernetesExecutor(config)
+	if err := d.Setup("1"); err == nil {
+		t.Error("Ephemeral volumes accepted without helper transfer")
+	}
+}
+
+func TestKubernetesCreateJobPod(t *testing.T) {
+	for _, volumeType := range []string{KUBE_VOLUME_EPHEMERAL, KUBE_VOLUME_PVC} {
+		dir, err := ioutil.TempDir("", "kubernetes_test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		config := setting.NewConfig(nil)
+		config.Unmarshal()
+		config.GetAgent().BuildPath = dir
+		config.GetAgent().KubeNamespace = "ci"
+		config.GetAgent().KubeNodeSelector = map[string]string{"pool": "ci"}
+		config.GetAgent().KubeVolumeType = volumeType
+		config.GetAgent().KubeTransferMode = KUBE_TRANSFER_HELPER
+
+		task := tasks.Task{
+			ID:               "1",
+			Type:             "kubernetes",
+			Image:            "alpine",
+			Script:           []string{"make"},
+			Quota:            "1Gi",
+			KubeNodeSelector: []string{"arch=arm64"},
+			KubeTolerations:  []string{"arch=arm64:NoSchedule"},
+		}
+		data, _ := json.Marshal(task)
+		f := &fakes.FakeHttpClient{}
+		f.GetTaskReturns(data, nil)
+
+		client := fake.NewSimpleClientset()
+		d := NewKubernetesExecutor(config)
+		d.KubernetesClient = client
+		d.MottainaiClient = f
+		d.Context.StandardOutput = false
+		if err := d.Setup("1"); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := d.CreateJobPod(task, NewInstructionFromTask(task), ArtefactMapping{}, ArtefactMapping{}); err != nil {
+			t.Fatal(err)
+		}
+
+		pod, err := client.CoreV1().Pods("ci").Get(d.PodID, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Artefacts and sources are transferred by the helper containers
+		if len(pod.Spec.InitContainers) != 1 || len(pod.Spec.Containers) != 2 {
+			t.Fatal("Helper containers not found", pod.Spec)
+		}
+		if _, err := client.CoreV1().Secrets("ci").Get(d.SecretID, metav1.GetOptions{}); err != nil {
+			t.Error("Helper secret not created", err)
+		}
+		env := pod.Spec.InitContainers[0].Env
+		if ref := env[len(env)-1].ValueFrom; ref == nil || ref.SecretKeyRef.Name != d.SecretID {
+			t.Error("Helper API key not read from the secret", env)
+		}
+
+		// Scheduling constraints of the agent and of the task
+		if len(pod.Spec.Tolerations) != 1 || pod.Spec.NodeSelector["arch"] != "arm64" ||
+			pod.Spec.NodeSelector["pool"] != "ci" {
+			t.Error("Scheduling constraints not applied", pod.Spec)
+		}
+
+		pvcs, _ := client.CoreV1().PersistentVolumeClaims("ci").List(metav1.ListOptions{})
+		if len(pod.Spec.Volumes) != 3 {
+			t.Fatal("Invalid volumes", pod.Spec.Volumes)
+		}
+		for _, vol := range pod.Spec.Volumes {
+			if volumeType == KUBE_VOLUME_EPHEMERAL &&
+				(vol.EmptyDir == nil || vol.EmptyDir.SizeLimit.String() != "1Gi") {
+				t.Error("Expected ephemeral volume", vol)
+			}
+			if volumeType == KUBE_VOLUME_PVC &&
+				(vol.PersistentVolumeClaim == nil || vol.PersistentVolumeClaim.ClaimName != vol.Name) {
+				t.Error("Expected PVC volume", vol)
+			}
+		}
+		if volumeType == KUBE_VOLUME_EPHEMERAL && len(pvcs.Items) != 0 {
+			t.Error("PVCs created for ephemeral volumes", pvcs.Items)
+		}
+		if volumeType == KUBE_VOLUME_PVC && len(pvcs.Items) != 3 {
+			t.Error("PVCs not created", pvcs.Items)
+		}
+
+		if err := d.CleanUpContainer(); err != nil {
+			t.Fatal(err)
+		}
+		pods, _ := client.CoreV1().Pods("ci").List(metav1.ListOptions{})
+		pvcs, _ = client.CoreV1().PersistentVolumeClaims("ci").List(metav1.ListOptions{})
+		secrets, _ := client.CoreV1().Secrets("ci").List(metav1.ListOptions{})
+		if len(pods.Items) != 0 || len(pvcs.Items) != 0 || len(secrets.Items) != 0 {
+			t.Error("Resources not cleaned up", pods.Items, pvcs.Items, secrets.Items)
+		}
+	}
+}
+
+func TestKubernetesHandleStop(t *testing.T) {
+	for _, task := range []tasks.Task{
+		{ID: "1", Status: setting.TASK_STATE_ASK_STOP},
+		{ID: "1", Status: setting.TASK_STATE_RUNNING, TimeOut: 1},
+	} {
+		config := setting.NewConfig(nil)
+		config.Unmarshal()
+
+		data, _ := json.Marshal(task)
+		f := &fakes.FakeHttpClient{}
+		f.GetTaskReturns(data, nil)
+
+		client := fake.NewSimpleClientset(&apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "1-job", Namespace: "ci"},
+			Status:     apiv1.PodStatus{Phase: apiv1.PodRunning},
+		})
+		d := NewKubernetesExecutor(config)
+		d.KubernetesClient = client
+		d.MottainaiClient = f
+		d.Context.StandardOutput = false
+		d.Namespace = "ci"
+		d.PodID = "1-job"
+
+		res, err := d.Handle(nil, NewInstructionFromTask(task), ArtefactMapping{}, ArtefactMapping{})
+		if err == nil || err.Error() != ABORT_EXECUTION_ERROR {
+			t.Error("Task not aborted", err)
+		}
+		// Only timeouts are reported as failures
+		if task.TimeOut == 0 && res != 0 || task.TimeOut != 0 && res != 1 {
+			t.Error("Invalid exit status", res)
+		}
+		if f.AbortTaskCallCount() != 1 {
+			t.Error("Task abort not reported")
+		}
+		if _, err := client.CoreV1().Pods("ci").Get("1-job", metav1.GetOptions{}); err == nil {
+			t.Error("Pod not deleted when stopping the task")
+		}
+	}
+}
@@ -0,0 +1,106 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package agenttasks
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+	tasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// PodmanExecutor runs tasks with Podman through its Docker compatible
+// REST API, so image caching and artefacts handling are shared with
+// the DockerExecutor. Privileged containers and Docker in Docker are
+// never used.
+type PodmanExecutor struct {
+	*DockerExecutor
+}
+
+func NewPodmanExecutor(config *setting.Config) *PodmanExecutor {
+	return &PodmanExecutor{
+		DockerExecutor: NewDockerExecutor(config),
+	}
+}
+
+// PodmanEndpoint returns the configured endpoint or the socket of the
+// rootless Podman service of the current user.
+func PodmanEndpoint(config *setting.Config) string {
+	if len(config.GetAgent().PodmanEndpoint) > 0 {
+		return config.GetAgent().PodmanEndpoint
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); len(dir) > 0 {
+		return "unix://" + dir + "/podman/podman.sock"
+	}
+	return "unix:///run/podman/podman.sock"
+}
+
+func IsRootless(info *docker.DockerInfo) bool {
+	for _, o := range info.SecurityOptions {
+		if strings.Contains(o, "rootless") {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *PodmanExecutor) Setup(docID string) error {
+	if err := d.TaskExecutor.Setup(docID); err != nil {
+		return err
+	}
+
+	endpoint := PodmanEndpoint(d.Config)
+	client, err := docker.NewClient(endpoint)
+	if err != nil {
+		return errors.New("Endpoint:" + endpoint + " Error: " + err.Error())
+	}
+	d.DockerClient = client
+
+	if d.Config.GetAgent().PodmanRootless {
+		info, err := client.Info()
+		if err != nil {
+			return errors.New("Endpoint:" + endpoint + " Error: " + err.Error())
+		}
+		if !IsRootless(info) {
+			return errors.New("Podman service at " + endpoint + " is not running rootless")
+		}
+	}
+	return nil
+}
+
+func (d *PodmanExecutor) Play(docID string) (int, error) {
+	task_info, err := tasks.FetchTask(d.MottainaiClient)
+	if err != nil {
+		return 1, err
+	}
+
+	return d.PlayContainer(task_info, &docker.HostConfig{
+		Privileged: false,
+		UsernsMode: d.Config.GetAgent().PodmanUsernsMode,
+		CapAdd:     d.Config.GetAgent().PodmanCaps,
+		CapDrop:    d.Config.GetAgent().PodmanCapsDrop,
+	}, []string{}, false)
+}
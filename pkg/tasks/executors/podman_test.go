@@ -0,0 +1,55 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package agenttasks
+
+import (
+	"os"
+	"testing"
+
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+func TestPodmanEndpoint(t *testing.T) {
+	config := setting.NewConfig(nil)
+	config.Unmarshal()
+
+	os.Setenv("XDG_RUNTIME_DIR", "/run/user/1000")
+	if e := PodmanEndpoint(config); e != "unix:///run/user/1000/podman/podman.sock" {
+		t.Error("Invalid rootless endpoint", e)
+	}
+
+	config.GetAgent().PodmanEndpoint = "tcp://127.0.0.1:8080"
+	if e := PodmanEndpoint(config); e != "tcp://127.0.0.1:8080" {
+		t.Error("Configured endpoint not used", e)
+	}
+}
+
+func TestIsRootless(t *testing.T) {
+	if IsRootless(&docker.DockerInfo{SecurityOptions: []string{"name=seccomp,profile=default"}}) {
+		t.Error("Rootful service detected as rootless")
+	}
+	if !IsRootless(&docker.DockerInfo{SecurityOptions: []string{"name=seccomp,profile=default", "name=rootless"}}) {
+		t.Error("Rootless service not detected")
+	}
+}
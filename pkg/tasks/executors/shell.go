@@ -0,0 +1,253 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package agenttasks
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+	tasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+)
+
+// ShellExecutor runs the task script directly on the agent host, in the
+// task build directory and as the user defined by shell_user.
+// It is meant only for trusted agents and it is never enabled by default.
+type ShellExecutor struct {
+	*TaskExecutor
+}
+
+func NewShellExecutor(config *setting.Config) *ShellExecutor {
+	return &ShellExecutor{
+		TaskExecutor: &TaskExecutor{
+			Context: NewExecutorContext(),
+			Config:  config,
+		}}
+}
+
+// hostPath joins p to base, refusing paths which escape from base as
+// there is no container boundary on the host.
+func hostPath(base, p string) (string, error) {
+	joined := filepath.Join(base, p)
+	rel, err := filepath.Rel(base, joined)
+	if err != nil {
+		return "", err
+	}
+	if rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", errors.New("Path " + p + " is outside of " + base)
+	}
+	return joined, nil
+}
+
+// WorkDir returns the host directory where the task script is executed.
+func (d *ShellExecutor) WorkDir(task_info tasks.Task) (string, error) {
+	dir := d.Context.BuildDir
+	if len(d.Context.SourceDir) > 0 {
+		dir = d.Context.SourceDir
+	}
+	return hostPath(filepath.Clean(dir), task_info.Directory)
+}
+
+// ResolveArtefacts returns the host directories of artefacts and storage.
+// Absolute paths are kept inside the work directory too.
+func (d *ShellExecutor) ResolveArtefacts(workdir string, m ArtefactMapping) (ArtefactMapping, error) {
+	artefacts, err := hostPath(workdir, m.GetArtefactPath())
+	if err != nil {
+		return ArtefactMapping{}, err
+	}
+	storage, err := hostPath(workdir, m.GetStoragePath())
+	if err != nil {
+		return ArtefactMapping{}, err
+	}
+	d.Context.TargetArtefactDir = artefacts
+	d.Context.TargetStorageDir = storage
+
+	return ArtefactMapping{
+		ArtefactPath: d.Context.TargetArtefactDir,
+		StoragePath:  d.Context.TargetStorageDir,
+	}, nil
+}
+
+// Credential returns the credential of the configured shell_user,
+// nil means that the task runs as the agent user.
+// Tasks are never executed as root.
+func (d *ShellExecutor) Credential() (*syscall.Credential, *user.User, error) {
+	name := d.Config.GetAgent().ShellUser
+	if len(name) == 0 {
+		u, err := user.Current()
+		if err != nil {
+			return nil, nil, err
+		}
+		if u.Uid == "0" {
+			return nil, nil, errors.New("shell_user is required when the agent runs as root")
+		}
+		return nil, u, nil
+	}
+
+	u, err := user.Lookup(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, nil, err
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return nil, nil, err
+	}
+	if uid == 0 {
+		return nil, nil, errors.New("shell_user can't be root")
+	}
+
+	return &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}, u, nil
+}
+
+func chownTree(dir string, cred *syscall.Credential) error {
+	return filepath.Walk(dir, func(p string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Lchown(p, int(cred.Uid), int(cred.Gid))
+	})
+}
+
+func (d *ShellExecutor) Play(docID string) (int, error) {
+	task_info, err := tasks.FetchTask(d.MottainaiClient)
+	if err != nil {
+		return 1, err
+	}
+
+	cred, u, err := d.Credential()
+	if err != nil {
+		return 1, err
+	}
+
+	instruction := NewInstructionFromTask(task_info)
+	workdir, err := d.WorkDir(task_info)
+	if err != nil {
+		return 1, err
+	}
+	mapping, err := d.ResolveArtefacts(workdir, ArtefactMapping{
+		ArtefactPath: task_info.ArtefactPath,
+		StoragePath:  task_info.StoragePath,
+	})
+	if err != nil {
+		return 1, err
+	}
+	for _, dir := range []string{workdir, mapping.ArtefactPath, mapping.StoragePath} {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return 1, err
+		}
+	}
+
+	instruction.SetTaskEnvVariables(&task_info, d.Context)
+	instruction.Report(d)
+	d.Context.Report(d)
+
+	if err := d.DownloadArtefacts(mapping.ArtefactPath, mapping.StoragePath); err != nil {
+		return 1, err
+	}
+
+	if cred != nil {
+		if err := chownTree(d.Context.RootTaskDir, cred); err != nil {
+			return 1, err
+		}
+	}
+
+	args := instruction.ExecutionCommandList()
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Dir = workdir
+	cmd.Stdout = d
+	cmd.Stderr = d
+	// Don't leak the agent environment to the task
+	cmd.Env = append([]string{
+		"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
+		"HOME=" + u.HomeDir,
+		"USER=" + u.Username,
+	}, instruction.EnvironmentList()...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true, Credential: cred}
+
+	d.Report(">> Running on host as " + u.Username + " in " + workdir)
+	if err := cmd.Start(); err != nil {
+		return 1, err
+	}
+
+	return d.Handle(cmd, mapping)
+}
+
+func (d *ShellExecutor) Handle(cmd *exec.Cmd, mapping ArtefactMapping) (int, error) {
+	starttime := time.Now()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	for {
+		select {
+		case err := <-done:
+			d.Report("Execution terminated")
+			exitCode := 0
+			if err != nil {
+				exitErr, ok := err.(*exec.ExitError)
+				if !ok {
+					return 1, err
+				}
+				exitCode = 1
+				if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+					exitCode = status.ExitStatus()
+				}
+			}
+
+			d.Report("Upload of artifacts starts")
+			if err := d.UploadArtefacts(mapping.ArtefactPath); err != nil {
+				return 1, err
+			}
+			d.Report("Upload of artifacts terminated")
+
+			return exitCode, nil
+		case <-time.After(1 * time.Second):
+		}
+
+		task_info, err := tasks.FetchTask(d.MottainaiClient)
+		if err != nil {
+			d.Report(err.Error())
+			continue
+		}
+		timedout := (task_info.TimeOut != 0 && (time.Now().Sub(starttime).Seconds() > task_info.TimeOut))
+		if task_info.IsStopped() || timedout {
+			// Kill the whole process group of the task
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+			<-done
+			return d.HandleTaskStop(timedout)
+		}
+	}
+}
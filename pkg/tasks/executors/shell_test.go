@@ -0,0 +1,183 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package agenttasks
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+	tasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+	fakes "github.com/MottainaiCI/mottainai-server/tests/fakes"
+)
+
+// shellTestConfig runs the test tasks as nobody when the tests run as root.
+func shellTestConfig() *setting.Config {
+	config := setting.NewConfig(nil)
+	config.Unmarshal()
+	if os.Geteuid() == 0 {
+		config.GetAgent().ShellUser = "nobody"
+	}
+	return config
+}
+
+func TestShellExecutor(t *testing.T) {
+	config := shellTestConfig()
+
+	dir, err := ioutil.TempDir("", "shell_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	task := tasks.Task{
+		ID:          "1",
+		Type:        "shell",
+		Script:      []string{"mkdir -p artefacts", "echo $MOTTAINAI_TASK_ID > artefacts/id", "exit 3"},
+		Environment: []string{"FOO=bar"},
+	}
+	data, _ := json.Marshal(task)
+
+	f := &fakes.FakeHttpClient{}
+	f.GetTaskReturns(data, nil)
+	var uploaded []string
+	f.UploadFileCalls(func(p, folder string) error {
+		uploaded = append(uploaded, p)
+		return nil
+	})
+
+	e := NewShellExecutor(config)
+	e.MottainaiClient = f
+	e.Context.StandardOutput = false
+	e.Context.RootTaskDir = dir
+	e.Context.BuildDir = path.Join(dir, "root")
+
+	res, err := e.Play("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != 3 {
+		t.Error("Invalid exit status", res)
+	}
+
+	id, err := ioutil.ReadFile(path.Join(dir, "root", "artefacts", "id"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(id) != "1\n" {
+		t.Error("MOTTAINAI_TASK_ID not set", string(id))
+	}
+	if len(uploaded) == 0 {
+		t.Error("Artefacts not uploaded")
+	}
+}
+
+func TestShellExecutorStop(t *testing.T) {
+	config := shellTestConfig()
+
+	dir, err := ioutil.TempDir("", "shell_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	task := tasks.Task{ID: "1", Type: "shell", Script: []string{"sleep 60"}}
+	data, _ := json.Marshal(task)
+	task.Status = setting.TASK_STATE_ASK_STOP
+	stopped, _ := json.Marshal(task)
+
+	f := &fakes.FakeHttpClient{}
+	f.GetTaskReturns(stopped, nil)
+	f.GetTaskReturnsOnCall(0, data, nil)
+
+	e := NewShellExecutor(config)
+	e.MottainaiClient = f
+	e.Context.StandardOutput = false
+	e.Context.RootTaskDir = dir
+	e.Context.BuildDir = path.Join(dir, "root")
+
+	res, err := e.Play("1")
+	if err == nil || err.Error() != ABORT_EXECUTION_ERROR {
+		t.Error("Task not aborted", err)
+	}
+	if res != 0 {
+		t.Error("Stop is not an error", res)
+	}
+	if f.AbortTaskCallCount() != 1 {
+		t.Error("Task not marked as aborted")
+	}
+}
+
+func TestShellExecutorPaths(t *testing.T) {
+	e := NewShellExecutor(shellTestConfig())
+	e.Context.BuildDir = "/build/1/root"
+
+	workdir, err := e.WorkDir(tasks.Task{Directory: "src/../app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if workdir != "/build/1/root/app" {
+		t.Error("Invalid work directory", workdir)
+	}
+	if _, err := e.WorkDir(tasks.Task{Directory: "../../"}); err == nil {
+		t.Error("Work directory outside of the build directory accepted")
+	}
+
+	mapping, err := e.ResolveArtefacts(workdir, ArtefactMapping{ArtefactPath: "/out", StoragePath: "data/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mapping.ArtefactPath != "/build/1/root/app/out" || mapping.StoragePath != "/build/1/root/app/data" {
+		t.Error("Invalid artefact mapping", mapping)
+	}
+	for _, m := range []ArtefactMapping{
+		{ArtefactPath: "../artefacts"},
+		{StoragePath: "/storage/../../../etc"},
+	} {
+		if _, err := e.ResolveArtefacts(workdir, m); err == nil {
+			t.Error("Artefact mapping outside of the work directory accepted", m)
+		}
+	}
+}
+
+func TestShellExecutorRoot(t *testing.T) {
+	config := setting.NewConfig(nil)
+	config.Unmarshal()
+	e := NewShellExecutor(config)
+
+	_, _, err := e.Credential()
+	if os.Geteuid() == 0 && err == nil {
+		t.Error("Tasks allowed to run as root without shell_user")
+	}
+	if os.Geteuid() != 0 && err != nil {
+		t.Error("Tasks refused to run as the agent user", err)
+	}
+
+	config.GetAgent().ShellUser = "root"
+	if _, _, err := e.Credential(); err == nil {
+		t.Error("Tasks allowed to run as root")
+	}
+}
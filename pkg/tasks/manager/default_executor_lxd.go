@@ -55,12 +55,17 @@ func SupportedExecutors(config *setting.Config) *TaskHandler {
 		switch ex {
 		case "docker":
 			se["docker"] = DockerPlayer(config)
+		case "podman":
+			se["podman"] = PodmanPlayer(config)
 		case "libvirt":
 			se["libvirt_vagrant"] = LibvirtPlayer(config)
 		case "virtualbox":
 			se["virtualbox_vagrant"] = VirtualBoxPlayer(config)
 		case "kubernetes":
 			se["kubernetes"] = KubernetesPlayer(config)
+		case "shell":
+			// Runs on the agent host: only available when explicitly enabled
+			se["shell"] = ShellPlayer(config)
 		case "lxd":
 			se["lxd"] = LxdPlayer(config)
 		}
@@ -79,6 +84,7 @@ func GenDefaultTaskHandler(config *setting.Config) *TaskHandler {
 
 		"docker_execute": DockerPlayer(config),
 		"docker":         DockerPlayer(config),
+		"podman":         PodmanPlayer(config),
 		"kubernetes":     KubernetesPlayer(config),
 
 		"libvirt_execute": LibvirtPlayer(config),
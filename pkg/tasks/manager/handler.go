@@ -24,6 +24,7 @@ package agenttasks
 
 import (
 	"errors"
+	"sort"
 	"strconv"
 
 	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
@@ -54,6 +55,20 @@ func (h *TaskHandler) Exists(s string) bool {
 	return false
 }
 
+// Executors returns the sorted list of task types handled, without the
+// internal ones used to report task results.
+func (h *TaskHandler) Executors() []string {
+	res := make([]string, 0)
+	for t := range h.Tasks {
+		if t == "error" || t == "success" {
+			continue
+		}
+		res = append(res, t)
+	}
+	sort.Strings(res)
+	return res
+}
+
 func (h *TaskHandler) Handler(s string) Handler {
 	if f, ok := h.Tasks[s]; ok {
 		return f.(Handler)
@@ -109,6 +124,40 @@ func DockerPlayer(config *setting.Config) func(args ...interface{}) (int, error)
 	}
 }
 
+func PodmanPlayer(config *setting.Config) func(args ...interface{}) (int, error) {
+	return func(args ...interface{}) (int, error) {
+		docID, e, err := HandleArgs(args...)
+		player := NewPlayer(docID)
+		executor := executors.NewPodmanExecutor(config)
+		executor.MottainaiClient = client.NewTokenClient(
+			config.GetWeb().AppURL,
+			config.GetAgent().ApiKey, config)
+		if err != nil {
+			player.EarlyFail(executor, docID, err.Error())
+			return e, err
+		}
+
+		return player.Start(executor)
+	}
+}
+
+func ShellPlayer(config *setting.Config) func(args ...interface{}) (int, error) {
+	return func(args ...interface{}) (int, error) {
+		docID, e, err := HandleArgs(args...)
+		player := NewPlayer(docID)
+		executor := executors.NewShellExecutor(config)
+		executor.MottainaiClient = client.NewTokenClient(
+			config.GetWeb().AppURL,
+			config.GetAgent().ApiKey, config)
+		if err != nil {
+			player.EarlyFail(executor, docID, err.Error())
+			return e, err
+		}
+
+		return player.Start(executor)
+	}
+}
+
 func KubernetesPlayer(config *setting.Config) func(args ...interface{}) (int, error) {
 	return func(args ...interface{}) (int, error) {
 		docID, e, err := HandleArgs(args...)
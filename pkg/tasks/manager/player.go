@@ -27,6 +27,7 @@ import (
 	"strconv"
 
 	executors "github.com/MottainaiCI/mottainai-server/pkg/tasks/executors"
+	machinerytasks "github.com/RichardKnop/machinery/v1/tasks"
 )
 
 const SETUP_ERROR_MESSAGE = "Setup phase error: "
@@ -46,6 +47,12 @@ func (p *Player) EarlyFail(e executors.Executor, TaskID, reason string) {
 }
 
 func (p *Player) Start(e executors.Executor) (int, error) {
+	if IsDraining() {
+		return 0, machinerytasks.NewErrRetryTaskLater("Node is draining", DRAIN_RETRY_DELAY)
+	}
+	trackTask(p.TaskID)
+	defer untrackTask(p.TaskID)
+
 	defer e.Clean()
 	err := e.Setup(p.TaskID)
 	if err != nil {
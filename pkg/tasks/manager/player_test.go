@@ -25,6 +25,8 @@ package agenttasks
 import (
 	"errors"
 	"testing"
+
+	machinerytasks "github.com/RichardKnop/machinery/v1/tasks"
 )
 
 type TestExecutor struct {
@@ -99,3 +101,22 @@ func TestPlayer(t *testing.T) {
 	}
 
 }
+
+func TestPlayerDraining(t *testing.T) {
+	te := &TestExecutor{}
+	player := &Player{TaskID: "foo"}
+
+	SetDraining(true)
+	defer SetDraining(false)
+
+	_, err := player.Start(te)
+	if _, ok := err.(machinerytasks.ErrRetryTaskLater); !ok {
+		t.Error("Draining node should send back the task to the queue", err)
+	}
+	if te.Cleanup {
+		t.Error("Task started while draining")
+	}
+	if len(RunningTasks()) != 0 {
+		t.Error("Unexpected running tasks", RunningTasks())
+	}
+}
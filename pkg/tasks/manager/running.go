@@ -0,0 +1,77 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package agenttasks
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Delay before a task received by a draining node is sent back to the queue
+const DRAIN_RETRY_DELAY = 30 * time.Second
+
+var (
+	runningMutex sync.Mutex
+	running      = map[string]bool{}
+	draining     int32
+)
+
+func trackTask(id string) {
+	runningMutex.Lock()
+	defer runningMutex.Unlock()
+	running[id] = true
+}
+
+func untrackTask(id string) {
+	runningMutex.Lock()
+	defer runningMutex.Unlock()
+	delete(running, id)
+}
+
+// RunningTasks returns the sorted IDs of the tasks executed by the agent.
+func RunningTasks() []string {
+	runningMutex.Lock()
+	defer runningMutex.Unlock()
+	res := make([]string, 0, len(running))
+	for id := range running {
+		res = append(res, id)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// SetDraining toggles the draining mode: the running tasks are completed
+// while the new ones are sent back to the queue.
+func SetDraining(b bool) {
+	var v int32
+	if b {
+		v = 1
+	}
+	atomic.StoreInt32(&draining, v)
+}
+
+func IsDraining() bool {
+	return atomic.LoadInt32(&draining) == 1
+}
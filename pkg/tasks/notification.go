@@ -0,0 +1,170 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package agenttasks
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// When the notifications are sent, see Notification.Matches
+const (
+	NOTIFY_ON_FAILURE = "failure"
+	NOTIFY_ON_SUCCESS = "success"
+	NOTIFY_ON_FIXED   = "fixed"
+	NOTIFY_ON_ALWAYS  = "always"
+)
+
+// Channels delivering the notifications
+const (
+	NOTIFY_EMAIL  = "email"
+	NOTIFY_HTTP   = "http"
+	NOTIFY_SLACK  = "slack"
+	NOTIFY_MATRIX = "matrix"
+	NOTIFY_IRC    = "irc"
+)
+
+// Notification is a rule sending a message when a task or a pipeline ends.
+type Notification struct {
+	On      string `json:"on"`
+	Channel string `json:"channel"`
+
+	// Recipient of the message: the email address, the URL of the HTTP
+	// callback or of the incoming webhook, or irc://host:port/channel
+	Target string `json:"target"`
+
+	// Template of the JSON body of the HTTP callbacks, see the notification
+	// package for its data
+	Body string `json:"body,omitempty"`
+}
+
+// Validate checks the notification rule.
+func (n *Notification) Validate() error {
+	switch n.On {
+	case NOTIFY_ON_FAILURE, NOTIFY_ON_SUCCESS, NOTIFY_ON_FIXED, NOTIFY_ON_ALWAYS:
+	default:
+		return errors.New("Invalid notification event: " + n.On)
+	}
+
+	switch n.Channel {
+	case NOTIFY_EMAIL:
+		if !strings.Contains(n.Target, "@") {
+			return errors.New("Invalid notification email address: " + n.Target)
+		}
+	case NOTIFY_HTTP, NOTIFY_SLACK, NOTIFY_MATRIX:
+		u, err := url.Parse(n.Target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return errors.New("Invalid notification URL: " + n.Target)
+		}
+	case NOTIFY_IRC:
+		u, err := url.Parse(n.Target)
+		if err != nil || (u.Scheme != "irc" && u.Scheme != "ircs") || u.Host == "" {
+			return errors.New("Invalid notification IRC channel: " + n.Target)
+		}
+	default:
+		return errors.New("Invalid notification channel: " + n.Channel)
+	}
+	return nil
+}
+
+// Matches reports whether the notification is sent for a build with the
+// given result, either NOTIFY_ON_SUCCESS or NOTIFY_ON_FAILURE, following a
+// build with the previous result, empty if unknown.
+func (n *Notification) Matches(result, previous string) bool {
+	switch n.On {
+	case NOTIFY_ON_ALWAYS:
+		return true
+	case NOTIFY_ON_FIXED:
+		return result == NOTIFY_ON_SUCCESS && previous == NOTIFY_ON_FAILURE
+	}
+	return n.On == result
+}
+
+// String describes the notification in its delivery status, without the
+// target which may hold credentials, e.g. in the URL of the webhooks.
+func (n *Notification) String() string {
+	return n.Channel + " on " + n.On
+}
+
+func (n *Notification) ToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"on":      n.On,
+		"channel": n.Channel,
+		"target":  n.Target,
+		"body":    n.Body,
+	}
+}
+
+// NewNotificationsFromMap returns the notification rules stored in a
+// document.
+func NewNotificationsFromMap(v interface{}) []Notification {
+	ans := make([]Notification, 0)
+	switch arr := v.(type) {
+	case []Notification:
+		ans = append(ans, arr...)
+	case []interface{}:
+		for _, i := range arr {
+			m, ok := i.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			n := Notification{}
+			n.On, _ = m["on"].(string)
+			n.Channel, _ = m["channel"].(string)
+			n.Target, _ = m["target"].(string)
+			n.Body, _ = m["body"].(string)
+			ans = append(ans, n)
+		}
+	}
+	return ans
+}
+
+// ParseNotifications parses and validates notification rules given as a JSON
+// array.
+func ParseNotifications(s string) ([]Notification, error) {
+	ans := make([]Notification, 0)
+	if strings.TrimSpace(s) == "" {
+		return ans, nil
+	}
+	if err := json.Unmarshal([]byte(s), &ans); err != nil {
+		return nil, errors.New("Invalid notifications: " + err.Error())
+	}
+	for i := range ans {
+		if err := ans[i].Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return ans, nil
+}
+
+// NotificationsToMap returns the notification rules as stored in the
+// documents.
+func NotificationsToMap(notifications []Notification) []interface{} {
+	ans := make([]interface{}, 0)
+	for i := range notifications {
+		ans = append(ans, notifications[i].ToMap())
+	}
+	return ans
+}
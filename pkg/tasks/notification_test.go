@@ -0,0 +1,96 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package agenttasks
+
+import (
+	"testing"
+)
+
+func TestNotificationMatches(t *testing.T) {
+	for _, c := range []struct {
+		on, result, previous string
+		matches              bool
+	}{
+		{NOTIFY_ON_FAILURE, NOTIFY_ON_FAILURE, "", true},
+		{NOTIFY_ON_FAILURE, NOTIFY_ON_SUCCESS, NOTIFY_ON_FAILURE, false},
+		{NOTIFY_ON_SUCCESS, NOTIFY_ON_SUCCESS, "", true},
+		{NOTIFY_ON_FIXED, NOTIFY_ON_SUCCESS, NOTIFY_ON_FAILURE, true},
+		{NOTIFY_ON_FIXED, NOTIFY_ON_SUCCESS, NOTIFY_ON_SUCCESS, false},
+		{NOTIFY_ON_FIXED, NOTIFY_ON_SUCCESS, "", false},
+		{NOTIFY_ON_ALWAYS, NOTIFY_ON_FAILURE, "", true},
+	} {
+		n := Notification{On: c.on}
+		if n.Matches(c.result, c.previous) != c.matches {
+			t.Error("Invalid match", c)
+		}
+	}
+}
+
+func TestParseNotifications(t *testing.T) {
+	notifications, err := ParseNotifications(`[
+		{"on": "failure", "channel": "email", "target": "dev@example.com"},
+		{"on": "fixed", "channel": "irc", "target": "irc://irc.example.com/#ci"},
+		{"on": "always", "channel": "http", "target": "https://example.com/hook", "body": "{}"}
+	]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notifications) != 3 || notifications[2].Body != "{}" {
+		t.Fatal("Invalid notifications", notifications)
+	}
+
+	for _, s := range []string{
+		`[{"on": "sometimes", "channel": "email", "target": "dev@example.com"}]`,
+		`[{"on": "failure", "channel": "fax", "target": "123"}]`,
+		`[{"on": "failure", "channel": "slack", "target": "ftp://example.com"}]`,
+		`[{"on": "failure", "channel": "irc", "target": "https://example.com"}]`,
+		`{"on": "failure"}`,
+	} {
+		if _, err := ParseNotifications(s); err == nil {
+			t.Error("Invalid notifications accepted", s)
+		}
+	}
+}
+
+func TestTaskNotifications(t *testing.T) {
+	task := &Task{
+		Name:               "build",
+		Notifications:      []Notification{{On: NOTIFY_ON_FAILURE, Channel: NOTIFY_SLACK, Target: "https://example.com/hook"}},
+		NotificationStatus: []string{"slack on failure: delivered"},
+	}
+
+	m := task.ToMap()
+	m["notifications"] = NotificationsToMap(task.Notifications)
+	m["notification_status"] = []interface{}{"slack on failure: delivered"}
+	loaded := NewTaskFromMap(m)
+	if len(loaded.Notifications) != 1 || loaded.Notifications[0] != task.Notifications[0] ||
+		len(loaded.NotificationStatus) != 1 {
+		t.Fatal("Notifications not loaded", loaded.Notifications, loaded.NotificationStatus)
+	}
+
+	// The delivery status isn't cloned with the task
+	loaded.Reset()
+	if len(loaded.NotificationStatus) != 0 || len(loaded.Notifications) != 1 {
+		t.Error("Invalid reset", loaded.Notifications, loaded.NotificationStatus)
+	}
+}
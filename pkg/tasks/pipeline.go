@@ -24,6 +24,7 @@ package agenttasks
 
 import (
 	"encoding/json"
+	"errors"
 	"reflect"
 	"strconv"
 	"time"
@@ -33,6 +34,13 @@ import (
 	"io/ioutil"
 )
 
+// Who sees the status in the badges of the pipelines and webhooks,
+// BADGES_PRIVATE when empty
+const (
+	BADGES_PRIVATE = "private"
+	BADGES_PUBLIC  = "public"
+)
+
 type Pipeline struct {
 	ID string `json:"ID" form:"ID"` // ARMv7l overflows :(
 
@@ -52,6 +60,22 @@ type Pipeline struct {
 	StartTime   string `json:"start_time" form:"start_time"`
 	EndTime     string `json:"end_time" form:"end_time"`
 	Concurrency string `json:"concurrency" form:"concurrency"`
+
+	// Plan which started the pipeline, if any
+	PlanID string `json:"plan_id" form:"plan_id"`
+
+	// Rules of the notifications sent when all the tasks end, with the
+	// status of their delivery
+	Notifications      []Notification `json:"notifications" form:"notifications"`
+	NotificationStatus []string       `json:"notification_status" form:"notification_status"`
+
+	// See Task.BuildGroup
+	BuildGroup   string `json:"build_group" form:"build_group"`
+	SupersededBy string `json:"superseded_by" form:"superseded_by"`
+
+	// BADGES_PUBLIC shows the status of the pipeline in its badge to the
+	// visitors which aren't signed in
+	Badges string `json:"badges" form:"badges"`
 }
 
 func PipelineFromJsonFile(file string) (*Pipeline, error) {
@@ -78,6 +102,34 @@ func PipelineFromYamlFile(file string) (*Pipeline, error) {
 	return t, nil
 }
 
+// NewPipelineFromYaml parses a pipeline from YAML or JSON, rejecting unknown
+// fields and pipelines without tasks.
+func NewPipelineFromYaml(data []byte) (*Pipeline, error) {
+	var t Pipeline
+	if err := unmarshalStrict(data, &t); err != nil {
+		return nil, err
+	}
+	if len(t.Tasks) == 0 {
+		return nil, errors.New("The pipeline has no tasks")
+	}
+	return &t, nil
+}
+
+// HasPublicBadges reports whether the owner of the pipeline opted in to show
+// its status to the visitors which aren't signed in.
+func (t *Pipeline) HasPublicBadges() bool {
+	return t.Badges == BADGES_PUBLIC
+}
+
+// ValidateBadges checks a visibility of the badges.
+func ValidateBadges(badges string) error {
+	switch badges {
+	case "", BADGES_PRIVATE, BADGES_PUBLIC:
+		return nil
+	}
+	return errors.New("Invalid badges visibility: " + badges)
+}
+
 func (t *Pipeline) Trials() int {
 
 	ret, err := strconv.Atoi(t.Retry)
@@ -93,6 +145,38 @@ func (t *Pipeline) Reset() {
 	t.CreatedTime = time.Now().Format("20060102150405")
 	t.EndTime = ""
 	t.StartTime = ""
+	t.NotificationStatus = []string{}
+}
+
+// Retain keeps only the tasks for which keep returns true, removing the
+// other ones from the chain, chord and group too.
+func (t *Pipeline) Retain(keep func(name string, task Task) bool) {
+	for name, task := range t.Tasks {
+		if !keep(name, task) {
+			delete(t.Tasks, name)
+		}
+	}
+
+	filter := func(names []string) []string {
+		ans := make([]string, 0)
+		for _, n := range names {
+			if _, ok := t.Tasks[n]; ok {
+				ans = append(ans, n)
+			}
+		}
+		return ans
+	}
+	t.Chain = filter(t.Chain)
+	t.Chord = filter(t.Chord)
+	t.Group = filter(t.Group)
+}
+
+// FilterPaths removes the tasks which the changed files don't start, see
+// Task.MatchPaths.
+func (t *Pipeline) FilterPaths(files []string) {
+	t.Retain(func(name string, task Task) bool {
+		return task.MatchPaths(files)
+	})
 }
 
 type PipelineForm struct {
@@ -162,6 +246,10 @@ func NewPipelineFromMap(t map[string]interface{}) Pipeline {
 			}
 		}
 
+		if typeField.Type == reflect.TypeOf(u.Notifications) {
+			valueField.Set(reflect.ValueOf(NewNotificationsFromMap(t[tag.Get("form")])))
+		}
+
 		if typeField.Type.Kind() == reflect.ValueOf(u.Tasks).Kind() {
 			if b, ok := t[tag.Get("form")].(map[string]interface{}); ok {
 
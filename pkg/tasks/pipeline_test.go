@@ -61,3 +61,53 @@ func TestPipeline(t *testing.T) {
 		t.Error("Invalid namespace for ", pipe2.Tasks["test1"])
 	}
 }
+
+func TestNewPipelineFromYaml(t *testing.T) {
+	pipe, err := NewPipelineFromYaml([]byte(`
+pipeline_name: deploy
+chain: [build, up]
+tasks:
+  build:
+    script: [make]
+  up:
+    image: alpine
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pipe.Name != "deploy" || len(pipe.Chain) != 2 || pipe.Tasks["up"].Image != "alpine" {
+		t.Error("Invalid pipeline", pipe)
+	}
+
+	if _, err := NewPipelineFromYaml([]byte(`{"pipeline_name": "json", "tasks": {"a": {"image": "alpine"}}}`)); err != nil {
+		t.Error("JSON should be accepted", err)
+	}
+	if _, err := NewPipelineFromYaml([]byte("pipeline_name: empty\n")); err == nil {
+		t.Error("Pipelines without tasks should be rejected")
+	}
+	if _, err := NewPipelineFromYaml([]byte("tasks:\n  a:\n    imag: alpine\n")); err == nil {
+		t.Error("Unknown fields should be rejected")
+	}
+	if _, err := NewTaskFromYaml([]byte("script: [make]\nimage: alpine\n")); err != nil {
+		t.Error(err)
+	}
+	if _, err := NewTaskFromYaml([]byte("scripts: [make]\n")); err == nil {
+		t.Error("Unknown task fields should be rejected")
+	}
+}
+
+func TestPipelineFilterPaths(t *testing.T) {
+	p := &Pipeline{
+		Chain: []string{"api", "web", "docs"},
+		Tasks: map[string]Task{
+			"api":  {Paths: []string{"services/api/**"}},
+			"web":  {Paths: []string{"services/web/**"}},
+			"docs": {PathsIgnore: []string{"services/**"}},
+		},
+	}
+
+	p.FilterPaths([]string{"services/api/main.go"})
+	if len(p.Tasks) != 1 || len(p.Chain) != 1 || p.Chain[0] != "api" {
+		t.Fatal("Invalid filtered pipeline", p.Chain, p.Tasks)
+	}
+}
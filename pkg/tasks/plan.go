@@ -0,0 +1,217 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package agenttasks
+
+import (
+	"errors"
+	"time"
+
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+	"github.com/robfig/cron"
+)
+
+// What to do when a plan ticks while the task of the previous run is still
+// in progress
+const (
+	PLAN_OVERLAP_ALLOW  = "allow"
+	PLAN_OVERLAP_SKIP   = "skip"
+	PLAN_OVERLAP_CANCEL = "cancel"
+)
+
+// Which of the runs missed while no server was up are run on startup
+const (
+	PLAN_CATCHUP_NONE = "none"
+	PLAN_CATCHUP_ONCE = "once"
+	PLAN_CATCHUP_ALL  = "all"
+)
+
+// Maximum number of missed runs caught up with PLAN_CATCHUP_ALL
+const PLAN_CATCHUP_MAX = 10
+
+// PipelinePlanForm is the form creating a plan which runs a pipeline.
+type PipelinePlanForm struct {
+	*PipelineForm
+	Planned       string `form:"planned"`
+	Timezone      string `form:"timezone"`
+	OverlapPolicy string `form:"overlap_policy"`
+	CatchUpPolicy string `form:"catch_up_policy"`
+}
+
+// locationSchedule evaluates a schedule in the timezone of the plan
+type locationSchedule struct {
+	cron.Schedule
+	location *time.Location
+}
+
+func (s locationSchedule) Next(t time.Time) time.Time {
+	return s.Schedule.Next(t.In(s.location))
+}
+
+// Location returns the timezone of the plan.
+func (p *Plan) Location() (*time.Location, error) {
+	if len(p.Timezone) == 0 {
+		return time.Local, nil
+	}
+	return time.LoadLocation(p.Timezone)
+}
+
+// Schedule returns the schedule of the plan, evaluated in its timezone.
+func (p *Plan) Schedule() (cron.Schedule, error) {
+	location, err := p.Location()
+	if err != nil {
+		return nil, err
+	}
+	schedule, err := cron.Parse(p.Planned)
+	if err != nil {
+		return nil, err
+	}
+	return locationSchedule{Schedule: schedule, location: location}, nil
+}
+
+// IsManual returns true if the plan has no schedule, and runs only when
+// asked to.
+func (p *Plan) IsManual() bool {
+	return len(p.Planned) == 0
+}
+
+// IsPipeline returns true if the plan runs a pipeline instead of a task.
+func (p *Plan) IsPipeline() bool {
+	return p.Pipeline != nil
+}
+
+// HasTemplate returns true if the plan instantiates a task template
+// instead of running its own task or pipeline.
+func (p *Plan) HasTemplate() bool {
+	return len(p.Template) > 0
+}
+
+// NewPipelineRun returns a fresh copy of the pipeline of the plan, linked
+// to the plan and owned by the plan owner.
+func (p *Plan) NewPipelineRun() *Pipeline {
+	pip := *p.Pipeline
+	pip.ID = ""
+	pip.PlanID = p.ID
+	pip.Owner = p.Owner
+	pip.Reset()
+
+	pip.Tasks = make(map[string]Task)
+	for name, t := range p.Pipeline.Tasks {
+		t.Reset()
+		t.ID = ""
+		t.Owner = p.Owner
+		pip.Tasks[name] = t
+	}
+	return &pip
+}
+
+// Validate checks the schedule, the timezone and the policies of the plan.
+func (p *Plan) Validate() error {
+	if _, err := p.Schedule(); err != nil && !p.IsManual() {
+		return errors.New("Invalid plan schedule: " + err.Error())
+	}
+	if _, err := p.Location(); err != nil {
+		return errors.New("Invalid plan timezone: " + err.Error())
+	}
+	switch p.OverlapPolicy {
+	case "", PLAN_OVERLAP_ALLOW, PLAN_OVERLAP_SKIP, PLAN_OVERLAP_CANCEL:
+	default:
+		return errors.New("Invalid overlap policy: " + p.OverlapPolicy)
+	}
+	if p.IsPipeline() && len(p.Pipeline.Tasks) == 0 {
+		return errors.New("The pipeline of the plan has no tasks")
+	}
+	if _, err := ParseTemplateParams(p.TemplateParams); err != nil {
+		return err
+	}
+	switch p.CatchUpPolicy {
+	case "", PLAN_CATCHUP_NONE, PLAN_CATCHUP_ONCE, PLAN_CATCHUP_ALL:
+	default:
+		return errors.New("Invalid catch-up policy: " + p.CatchUpPolicy)
+	}
+	return nil
+}
+
+// NextRunAfter returns the first run of the plan after the given time, in
+// the format of NextRun, or an empty string if the plan won't run.
+func (p *Plan) NextRunAfter(t time.Time) string {
+	schedule, err := p.Schedule()
+	if err != nil {
+		return ""
+	}
+	next := schedule.Next(t)
+	if next.IsZero() {
+		return ""
+	}
+	return next.Local().Format(setting.Timeformat)
+}
+
+// MissedRuns returns the number of runs due between the last run of the
+// plan and now, up to PLAN_CATCHUP_MAX + 1. Plans which never ran have no
+// missed runs.
+func (p *Plan) MissedRuns(now time.Time) (int, error) {
+	if len(p.LastRun) == 0 || p.IsManual() {
+		return 0, nil
+	}
+	last, err := time.ParseInLocation(setting.Timeformat, p.LastRun, time.Local)
+	if err != nil {
+		return 0, err
+	}
+	schedule, err := p.Schedule()
+	if err != nil {
+		return 0, err
+	}
+
+	missed := 0
+	for next := schedule.Next(last); !next.IsZero() && !next.After(now); next = schedule.Next(next) {
+		missed++
+		if missed > PLAN_CATCHUP_MAX {
+			break
+		}
+	}
+	return missed, nil
+}
+
+// CatchUpRuns returns how many of the missed runs have to be run now,
+// according to the catch-up policy.
+func (p *Plan) CatchUpRuns(missed int) int {
+	switch p.CatchUpPolicy {
+	case PLAN_CATCHUP_ONCE:
+		if missed > 0 {
+			return 1
+		}
+	case PLAN_CATCHUP_ALL:
+		if missed > PLAN_CATCHUP_MAX {
+			return PLAN_CATCHUP_MAX
+		}
+		return missed
+	}
+	return 0
+}
+
+// Tick returns the fields recording a run of the plan at the given time.
+func (p *Plan) Tick(now time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"last_run": now.Local().Format(setting.Timeformat),
+		"next_run": p.NextRunAfter(now),
+	}
+}
@@ -0,0 +1,149 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package agenttasks
+
+import (
+	"testing"
+	"time"
+
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+)
+
+func TestPlanSchedule(t *testing.T) {
+	plan := &Plan{Task: &Task{}, Planned: "0 0 12 * * *", Timezone: "Asia/Tokyo"}
+	if err := plan.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Plan times are local, like the task times
+	local := time.Local
+	time.Local = time.FixedZone("UTC-5", -5*60*60)
+	defer func() { time.Local = local }()
+
+	// Noon in Tokyo is 3 AM UTC, 10 PM of the day before in UTC-5
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	if next := plan.NextRunAfter(now); next != "20191231220000" {
+		t.Error("Unexpected next run", next)
+	}
+
+	for _, p := range []*Plan{
+		{Task: &Task{}, Planned: "foo"},
+		{Task: &Task{}, Planned: "@daily", Timezone: "Foo/Bar"},
+		{Task: &Task{}, Planned: "@daily", OverlapPolicy: "foo"},
+		{Task: &Task{}, Planned: "@daily", CatchUpPolicy: "foo"},
+	} {
+		if p.Validate() == nil {
+			t.Errorf("Plan %+v should be invalid", p)
+		}
+	}
+
+	if manual := (&Plan{Task: &Task{}}); manual.Validate() != nil || manual.NextRunAfter(now) != "" {
+		t.Error("Plans without schedule should run only manually")
+	}
+}
+
+func TestPlanCatchUp(t *testing.T) {
+	local := time.Local
+	time.Local = time.FixedZone("UTC-5", -5*60*60)
+	defer func() { time.Local = local }()
+
+	plan := &Plan{Task: &Task{}, Planned: "@hourly", Timezone: "UTC"}
+	now := time.Date(2020, 1, 1, 12, 30, 0, 0, time.UTC)
+
+	if missed, err := plan.MissedRuns(now); err != nil || missed != 0 {
+		t.Error("Plans which never ran have no missed runs", missed, err)
+	}
+
+	plan.LastRun = now.Add(-3 * time.Hour).Local().Format(setting.Timeformat)
+	missed, err := plan.MissedRuns(now)
+	if err != nil || missed != 3 {
+		t.Error("Expected 3 missed runs", missed, err)
+	}
+
+	plan.LastRun = now.Add(-48 * time.Hour).Local().Format(setting.Timeformat)
+	if missed, _ := plan.MissedRuns(now); missed != PLAN_CATCHUP_MAX+1 {
+		t.Error("Missed runs should be capped", missed)
+	}
+
+	for policy, runs := range map[string]int{
+		"":                0,
+		PLAN_CATCHUP_NONE: 0,
+		PLAN_CATCHUP_ONCE: 1,
+		PLAN_CATCHUP_ALL:  3,
+	} {
+		plan.CatchUpPolicy = policy
+		if r := plan.CatchUpRuns(3); r != runs {
+			t.Errorf("Policy '%s' should catch up %d runs, got %d", policy, runs, r)
+		}
+	}
+	plan.CatchUpPolicy = PLAN_CATCHUP_ALL
+	if r := plan.CatchUpRuns(PLAN_CATCHUP_MAX + 1); r != PLAN_CATCHUP_MAX {
+		t.Error("Catch up should be capped", r)
+	}
+
+	fields := plan.Tick(now)
+	if fields["last_run"] != "20200101073000" || fields["next_run"] != "20200101080000" {
+		t.Error("Unexpected tick", fields)
+	}
+}
+
+func TestPipelinePlan(t *testing.T) {
+	plan := &Plan{
+		Task:    &Task{ID: "1", Owner: "2", Name: "nightly"},
+		Planned: "@daily",
+		Pipeline: &Pipeline{
+			Name:  "nightly",
+			Chain: []string{"build", "test"},
+			Tasks: map[string]Task{
+				"build": {Name: "build", Image: "foo", Status: setting.TASK_STATE_DONE},
+				"test":  {Name: "test", Image: "bar"},
+			},
+		},
+	}
+	if err := plan.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The pipeline survives the round trip to the database
+	stored := NewPlanFromMap(plan.ToMap())
+	if !stored.IsPipeline() || len(stored.Pipeline.Tasks) != 2 || stored.Pipeline.Tasks["test"].Image != "bar" {
+		t.Fatalf("Unexpected stored plan %+v", stored.Pipeline)
+	}
+	stored.ID = plan.ID
+
+	run := stored.NewPipelineRun()
+	if run.PlanID != "1" || run.Owner != "2" || len(run.CreatedTime) == 0 {
+		t.Error("The run should be linked to the plan", run)
+	}
+	if run.Tasks["build"].Status != "" || run.Tasks["build"].Owner != "2" {
+		t.Error("The tasks of the run should be fresh", run.Tasks["build"])
+	}
+	if stored.Pipeline.Tasks["build"].Status != setting.TASK_STATE_DONE {
+		t.Error("The plan pipeline shouldn't change")
+	}
+
+	plan.Pipeline.Tasks = map[string]Task{}
+	if plan.Validate() == nil {
+		t.Error("Pipelines without tasks should be refused")
+	}
+}
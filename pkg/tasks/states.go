@@ -0,0 +1,90 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package agenttasks
+
+import (
+	"fmt"
+
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+	"github.com/MottainaiCI/mottainai-server/pkg/utils"
+)
+
+// transitions lists the states reachable from each task state. New tasks
+// have an empty status, finished tasks can only be sent (or queued) again.
+// The tasks of the pipelines are created waiting, and are queued if they
+// can't take the lock of their namespace.
+var transitions = map[string][]string{
+	"": {setting.TASK_STATE_WAIT, setting.TASK_STATE_QUEUED, setting.TASK_STATE_SETUP, setting.TASK_STATE_RUNNING,
+		setting.TASK_STATE_DONE, setting.TASK_STATE_ASK_STOP, setting.TASK_STATE_STOPPED},
+	setting.TASK_STATE_QUEUED: {setting.TASK_STATE_WAIT, setting.TASK_STATE_DONE, setting.TASK_STATE_STOPPED},
+	setting.TASK_STATE_WAIT: {setting.TASK_STATE_QUEUED, setting.TASK_STATE_SETUP, setting.TASK_STATE_RUNNING,
+		setting.TASK_STATE_DONE, setting.TASK_STATE_ASK_STOP, setting.TASK_STATE_STOPPED},
+	setting.TASK_STATE_SETUP: {setting.TASK_STATE_RUNNING,
+		setting.TASK_STATE_DONE, setting.TASK_STATE_ASK_STOP, setting.TASK_STATE_STOPPED},
+	setting.TASK_STATE_RUNNING:  {setting.TASK_STATE_DONE, setting.TASK_STATE_ASK_STOP, setting.TASK_STATE_STOPPED},
+	setting.TASK_STATE_ASK_STOP: {setting.TASK_STATE_DONE, setting.TASK_STATE_STOPPED},
+	setting.TASK_STATE_DONE:     {setting.TASK_STATE_WAIT, setting.TASK_STATE_QUEUED},
+	setting.TASK_STATE_STOPPED:  {setting.TASK_STATE_WAIT, setting.TASK_STATE_QUEUED},
+}
+
+// TransitionError is returned when a task can't move to the requested state.
+type TransitionError struct {
+	ID   string
+	From string
+	To   string
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("Task %s can't change status from '%s' to '%s'", e.ID, e.From, e.To)
+}
+
+// CanTransition returns true if a task can move between the two states.
+// Setting the current state again is always allowed.
+func CanTransition(from, to string) bool {
+	if _, known := transitions[to]; !known {
+		return false
+	}
+	if from == to {
+		return true
+	}
+	return utils.ArrayContainsString(transitions[from], to)
+}
+
+// IsFinalState returns true if the task won't change unless sent again.
+func IsFinalState(status string) bool {
+	return status == setting.TASK_STATE_DONE || status == setting.TASK_STATE_STOPPED
+}
+
+// IsSendable returns true if the task can be sent to the broker: it never
+// ran, it is queued behind a namespace lock or it already ended.
+func IsSendable(status string) bool {
+	return status == "" || status == setting.TASK_STATE_QUEUED || IsFinalState(status)
+}
+
+// Transition checks if the task can move to the given state.
+func (t *Task) Transition(to string) error {
+	if !CanTransition(t.Status, to) {
+		return &TransitionError{ID: t.ID, From: t.Status, To: to}
+	}
+	return nil
+}
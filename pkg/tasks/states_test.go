@@ -0,0 +1,77 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package agenttasks
+
+import (
+	"testing"
+
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+)
+
+func TestCanTransition(t *testing.T) {
+	for _, c := range []struct {
+		from, to string
+		allowed  bool
+	}{
+		{"", setting.TASK_STATE_WAIT, true},
+		{setting.TASK_STATE_WAIT, setting.TASK_STATE_SETUP, true},
+		{setting.TASK_STATE_SETUP, setting.TASK_STATE_RUNNING, true},
+		{setting.TASK_STATE_RUNNING, setting.TASK_STATE_RUNNING, true},
+		{setting.TASK_STATE_RUNNING, setting.TASK_STATE_ASK_STOP, true},
+		{setting.TASK_STATE_ASK_STOP, setting.TASK_STATE_STOPPED, true},
+		{setting.TASK_STATE_DONE, setting.TASK_STATE_WAIT, true},
+		{setting.TASK_STATE_DONE, setting.TASK_STATE_QUEUED, true},
+		{setting.TASK_STATE_QUEUED, setting.TASK_STATE_WAIT, true},
+		{setting.TASK_STATE_WAIT, setting.TASK_STATE_QUEUED, true},
+		{setting.TASK_STATE_QUEUED, setting.TASK_STATE_STOPPED, true},
+		// A late agent update can't resurrect an aborted task
+		{setting.TASK_STATE_STOPPED, setting.TASK_STATE_RUNNING, false},
+		{setting.TASK_STATE_STOPPED, setting.TASK_STATE_DONE, false},
+		{setting.TASK_STATE_DONE, setting.TASK_STATE_SETUP, false},
+		{setting.TASK_STATE_RUNNING, setting.TASK_STATE_WAIT, false},
+		{setting.TASK_STATE_RUNNING, setting.TASK_STATE_QUEUED, false},
+		{setting.TASK_STATE_QUEUED, setting.TASK_STATE_RUNNING, false},
+		{setting.TASK_STATE_RUNNING, "foo", false},
+	} {
+		if CanTransition(c.from, c.to) != c.allowed {
+			t.Errorf("Transition from '%s' to '%s' should be %v", c.from, c.to, c.allowed)
+		}
+	}
+
+	for status, sendable := range map[string]bool{
+		"":                         true,
+		setting.TASK_STATE_QUEUED:  true,
+		setting.TASK_STATE_STOPPED: true,
+		setting.TASK_STATE_WAIT:    false,
+		setting.TASK_STATE_RUNNING: false,
+	} {
+		if IsSendable(status) != sendable {
+			t.Errorf("Task in state '%s' sendable should be %v", status, sendable)
+		}
+	}
+
+	task := &Task{ID: "1", Status: setting.TASK_STATE_STOPPED}
+	if err, ok := task.Transition(setting.TASK_STATE_RUNNING).(*TransitionError); !ok || err.From != setting.TASK_STATE_STOPPED {
+		t.Error("Expected a transition error", err)
+	}
+}
@@ -23,6 +23,7 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 package agenttasks
 
 import (
+	"bytes"
 	"encoding/json"
 
 	"github.com/ghodss/yaml"
@@ -82,6 +83,7 @@ type Task struct {
 	StartTime   string `json:"start_time" form:"start_time"`
 	EndTime     string `json:"end_time" form:"end_time"`
 	UpdatedTime string `json:"last_update_time" form:"last_update_time"`
+	QueuedTime  string `json:"queued_time" form:"queued_time"`
 	Queue       string `json:"queue" form:"queue"`
 	Retry       string `json:"retry" form:"retry"`
 
@@ -91,21 +93,79 @@ type Task struct {
 	Environment []string `json:"environment" form:"environment"`
 
 	Quota string `json:"quota" form:"quota"`
+
+	KubeNodeSelector []string `json:"kube_node_selector" form:"kube_node_selector"`
+	KubeTolerations  []string `json:"kube_tolerations" form:"kube_tolerations"`
+
+	// Constraints on the labels of the node running the task, see nodes.MatchLabel
+	NodeSelector []string `json:"node_selector" form:"node_selector"`
+
+	// Incremented on every status change, see CanTransition
+	Revision int `json:"revision" form:"revision"`
+
+	// Globs of the changed files which start the task from the webhooks,
+	// see MatchPaths
+	Paths       []string `json:"paths" form:"paths"`
+	PathsIgnore []string `json:"paths_ignore" form:"paths_ignore"`
+
+	// Rules of the notifications sent when the task is done, with the
+	// status of their delivery
+	Notifications      []Notification `json:"notifications" form:"notifications"`
+	NotificationStatus []string       `json:"notification_status" form:"notification_status"`
+
+	// Builds of the webhooks superseded by the newer ones of the same group,
+	// e.g. <webhook>/<repo>@refs/heads/master
+	BuildGroup string `json:"build_group" form:"build_group"`
+	// ID of the newer build which stopped this one
+	SupersededBy string `json:"superseded_by" form:"superseded_by"`
 }
 
 type Plan struct {
 	*Task
 	Planned string `json:"planned" form:"planned"`
+
+	// IANA name of the timezone of Planned, the server one if empty
+	Timezone      string `json:"timezone" form:"timezone"`
+	OverlapPolicy string `json:"overlap_policy" form:"overlap_policy"`
+	CatchUpPolicy string `json:"catch_up_policy" form:"catch_up_policy"`
+
+	// Local times in setting.Timeformat, like the task times, see Plan.Tick
+	LastRun      string `json:"last_run" form:"last_run"`
+	NextRun      string `json:"next_run" form:"next_run"`
+	LastTask     string `json:"last_task" form:"last_task"`
+	LastPipeline string `json:"last_pipeline" form:"last_pipeline"`
+
+	// Cloned on every run instead of the task, see IsPipeline
+	Pipeline *Pipeline `json:"pipeline,omitempty" form:"-"`
+
+	// Template instantiated on every run instead of the task, see HasTemplate
+	Template       string `json:"template" form:"template"`
+	TemplateParams string `json:"template_params" form:"template_params"`
 }
 
 func NewPlanFromMap(t map[string]interface{}) Plan {
 	tk := NewTaskFromMap(t)
-	var planned string
-	if str, ok := t["planned"].(string); ok {
-		planned = str
-	}
 	pl := Plan{Task: &tk}
-	pl.Planned = planned
+	for k, v := range map[string]*string{
+		"planned":         &pl.Planned,
+		"timezone":        &pl.Timezone,
+		"overlap_policy":  &pl.OverlapPolicy,
+		"catch_up_policy": &pl.CatchUpPolicy,
+		"last_run":        &pl.LastRun,
+		"next_run":        &pl.NextRun,
+		"last_task":       &pl.LastTask,
+		"last_pipeline":   &pl.LastPipeline,
+		"template":        &pl.Template,
+		"template_params": &pl.TemplateParams,
+	} {
+		if str, ok := t[k].(string); ok {
+			*v = str
+		}
+	}
+	if pip, ok := t["pipeline"].(map[string]interface{}); ok {
+		p := NewPipelineFromMap(pip)
+		pl.Pipeline = &p
+	}
 	return pl
 }
 
@@ -118,6 +178,12 @@ func (t *Plan) ToMap() map[string]interface{} {
 		typeField := val.Type().Field(i)
 		tag := typeField.Tag
 
+		if typeField.Name == "Pipeline" {
+			if t.Pipeline != nil {
+				ts["pipeline"] = t.Pipeline.ToMap(true)
+			}
+			continue
+		}
 		ts[tag.Get("form")] = valueField.Interface()
 	}
 	val = reflect.ValueOf(t.Task).Elem()
@@ -146,6 +212,12 @@ func (t *Task) ToMap() map[string]interface{} {
 	return ts
 }
 
+// MatchPaths reports whether the changed files start the task, see
+// utils.MatchPaths.
+func (t *Task) MatchPaths(files []string) bool {
+	return utils.MatchPaths(files, t.Paths, t.PathsIgnore)
+}
+
 func (t *Task) Trials() int {
 
 	ret, err := strconv.Atoi(t.Retry)
@@ -195,6 +267,7 @@ func NewTaskFromMap(t map[string]interface{}) Task {
 		start_time        string
 		end_time          string
 		last_update_time  string
+		queued_time       string
 		storage           string
 		storage_path      string
 		artefact_path     string
@@ -213,6 +286,13 @@ func NewTaskFromMap(t map[string]interface{}) Task {
 		binds             []string
 		namespace_filters []string
 		artefact_pfilters []string
+		kube_selector     []string
+		kube_tolerations  []string
+		node_selector     []string
+		paths             []string
+		paths_ignore      []string
+		notify_status     []string
+		revision          int
 	)
 
 	binds = make([]string, 0)
@@ -220,6 +300,12 @@ func NewTaskFromMap(t map[string]interface{}) Task {
 	script = make([]string, 0)
 	namespace_filters = make([]string, 0)
 	artefact_pfilters = make([]string, 0)
+	kube_selector = make([]string, 0)
+	kube_tolerations = make([]string, 0)
+	node_selector = make([]string, 0)
+	paths = make([]string, 0)
+	paths_ignore = make([]string, 0)
+	notify_status = make([]string, 0)
 	// Default mode maintains compatibility with first
 	// implementation where merged namespace was the
 	// logic
@@ -252,6 +338,36 @@ func NewTaskFromMap(t map[string]interface{}) Task {
 			artefact_pfilters = append(artefact_pfilters, v.(string))
 		}
 	}
+	if arr, ok := t["kube_node_selector"].([]interface{}); ok {
+		for _, v := range arr {
+			kube_selector = append(kube_selector, v.(string))
+		}
+	}
+	if arr, ok := t["kube_tolerations"].([]interface{}); ok {
+		for _, v := range arr {
+			kube_tolerations = append(kube_tolerations, v.(string))
+		}
+	}
+	if arr, ok := t["node_selector"].([]interface{}); ok {
+		for _, v := range arr {
+			node_selector = append(node_selector, v.(string))
+		}
+	}
+	if arr, ok := t["paths"].([]interface{}); ok {
+		for _, v := range arr {
+			paths = append(paths, v.(string))
+		}
+	}
+	if arr, ok := t["paths_ignore"].([]interface{}); ok {
+		for _, v := range arr {
+			paths_ignore = append(paths_ignore, v.(string))
+		}
+	}
+	if arr, ok := t["notification_status"].([]interface{}); ok {
+		for _, v := range arr {
+			notify_status = append(notify_status, v.(string))
+		}
+	}
 
 	if i, ok := t["name"].(string); ok {
 		name = i
@@ -271,6 +387,12 @@ func NewTaskFromMap(t map[string]interface{}) Task {
 	if str, ok := t["exit_status"].(string); ok {
 		exit_status = str
 	}
+	switch v := t["revision"].(type) {
+	case float64:
+		revision = int(v)
+	case int:
+		revision = v
+	}
 	if str, ok := t["source"].(string); ok {
 		source = str
 	}
@@ -325,6 +447,9 @@ func NewTaskFromMap(t map[string]interface{}) Task {
 	if str, ok := t["start_time"].(string); ok {
 		start_time = str
 	}
+	if str, ok := t["queued_time"].(string); ok {
+		queued_time = str
+	}
 	if str, ok := t["last_update_time"].(string); ok {
 		last_update_time = str
 	}
@@ -378,6 +503,13 @@ func NewTaskFromMap(t map[string]interface{}) Task {
 	if str, ok := t["retry"].(string); ok {
 		retry = str
 	}
+	var buildGroup, supersededBy string
+	if str, ok := t["build_group"].(string); ok {
+		buildGroup = str
+	}
+	if str, ok := t["superseded_by"].(string); ok {
+		supersededBy = str
+	}
 	task := Task{
 		Retry:               retry,
 		ID:                  id,
@@ -409,6 +541,7 @@ func NewTaskFromMap(t map[string]interface{}) Task {
 		StartTime:           start_time,
 		EndTime:             end_time,
 		UpdatedTime:         last_update_time,
+		QueuedTime:          queued_time,
 		RootTask:            root_task,
 		NamespaceMerged:     namespace_merged,
 		TagNamespace:        tag_namespace,
@@ -420,6 +553,16 @@ func NewTaskFromMap(t map[string]interface{}) Task {
 		CacheClean:          cache_clean,
 		Owner:               owner,
 		TimeOut:             timeout,
+		KubeNodeSelector:    kube_selector,
+		KubeTolerations:     kube_tolerations,
+		NodeSelector:        node_selector,
+		Paths:               paths,
+		PathsIgnore:         paths_ignore,
+		Notifications:       NewNotificationsFromMap(t["notifications"]),
+		NotificationStatus:  notify_status,
+		Revision:            revision,
+		BuildGroup:          buildGroup,
+		SupersededBy:        supersededBy,
 	}
 	return task
 }
@@ -481,6 +624,27 @@ func FromYamlFile(file string) (*Task, error) {
 	return t, nil
 }
 
+// NewTaskFromYaml parses a task from YAML or JSON, rejecting unknown fields.
+func NewTaskFromYaml(data []byte) (*Task, error) {
+	var t Task
+	if err := unmarshalStrict(data, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// unmarshalStrict decodes YAML (and thus JSON) into o, failing on the fields
+// that o doesn't have.
+func unmarshalStrict(data []byte, o interface{}) error {
+	j, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return err
+	}
+	d := json.NewDecoder(bytes.NewReader(j))
+	d.DisallowUnknownFields()
+	return d.Decode(o)
+}
+
 func PipelineFromYaml(file string) (*Pipeline, error) {
 	var t *Pipeline
 	content, err := ioutil.ReadFile(file)
@@ -501,9 +665,12 @@ func (t *Task) Reset() {
 	t.CreatedTime = time.Now().Format("20060102150405")
 	t.EndTime = ""
 	t.UpdatedTime = ""
+	t.QueuedTime = ""
 	t.Owner = ""
 	t.Node = ""
 	t.StartTime = ""
+	t.NotificationStatus = []string{}
+	t.SupersededBy = ""
 }
 
 func (t *Task) IsOwner(id string) bool {
@@ -536,6 +703,13 @@ func (t *Task) IsRunning() bool {
 	}
 	return false
 }
+func (t *Task) IsQueued() bool {
+
+	if t.Status == setting.TASK_STATE_QUEUED {
+		return true
+	}
+	return false
+}
 func (t *Task) IsWaiting() bool {
 
 	if t.Status == setting.TASK_STATE_WAIT {
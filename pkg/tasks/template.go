@@ -0,0 +1,358 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package agenttasks
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"regexp"
+	"strconv"
+)
+
+// Types of the parameters of a task template
+const (
+	TEMPLATE_PARAM_STRING = "string"
+	TEMPLATE_PARAM_INT    = "int"
+	TEMPLATE_PARAM_BOOL   = "bool"
+)
+
+// Parameters are referenced in the template as {{ name }}
+var templateParamRegexp = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+var templateParamName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+type TemplateParameter struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Default     string `json:"default"`
+	Required    bool   `json:"required"`
+	Description string `json:"description"`
+}
+
+// TaskTemplate is a named task, or pipeline, with declared parameters which
+// are substituted on every instance. Creating a template with the name of an
+// existing one adds a new version of it.
+type TaskTemplate struct {
+	ID          string `json:"ID"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Version     int    `json:"version"`
+	Owner       string `json:"owner_id"`
+	CreatedTime string `json:"created_time"`
+
+	Parameters []TemplateParameter `json:"parameters"`
+
+	// Only one of them is set, see IsPipeline
+	Task     *Task     `json:"task,omitempty"`
+	Pipeline *Pipeline `json:"pipeline,omitempty"`
+}
+
+func NewTaskTemplateFromJson(data []byte) TaskTemplate {
+	var t TaskTemplate
+	json.Unmarshal(data, &t)
+	return t
+}
+
+func NewTaskTemplateFromMap(t map[string]interface{}) TaskTemplate {
+	tmpl := TaskTemplate{}
+	for k, v := range map[string]*string{
+		"name":         &tmpl.Name,
+		"description":  &tmpl.Description,
+		"owner_id":     &tmpl.Owner,
+		"created_time": &tmpl.CreatedTime,
+	} {
+		if str, ok := t[k].(string); ok {
+			*v = str
+		}
+	}
+
+	switch v := t["version"].(type) {
+	case int:
+		tmpl.Version = v
+	case float64:
+		tmpl.Version = int(v)
+	}
+
+	if arr, ok := t["parameters"].([]interface{}); ok {
+		for _, p := range arr {
+			m, ok := p.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			param := TemplateParameter{}
+			param.Name, _ = m["name"].(string)
+			param.Type, _ = m["type"].(string)
+			param.Default, _ = m["default"].(string)
+			param.Required, _ = m["required"].(bool)
+			param.Description, _ = m["description"].(string)
+			tmpl.Parameters = append(tmpl.Parameters, param)
+		}
+	}
+
+	if task, ok := t["task"].(map[string]interface{}); ok {
+		tk := NewTaskFromMap(task)
+		tmpl.Task = &tk
+	}
+	if pip, ok := t["pipeline"].(map[string]interface{}); ok {
+		p := NewPipelineFromMap(pip)
+		tmpl.Pipeline = &p
+	}
+	return tmpl
+}
+
+func (t *TaskTemplate) ToMap() map[string]interface{} {
+	params := make([]interface{}, 0)
+	for _, p := range t.Parameters {
+		params = append(params, map[string]interface{}{
+			"name":        p.Name,
+			"type":        p.Type,
+			"default":     p.Default,
+			"required":    p.Required,
+			"description": p.Description,
+		})
+	}
+
+	ts := map[string]interface{}{
+		"name":         t.Name,
+		"description":  t.Description,
+		"version":      t.Version,
+		"owner_id":     t.Owner,
+		"created_time": t.CreatedTime,
+		"parameters":   params,
+	}
+	if t.Task != nil {
+		ts["task"] = t.Task.ToMap()
+	}
+	if t.Pipeline != nil {
+		ts["pipeline"] = t.Pipeline.ToMap(true)
+	}
+	return ts
+}
+
+// IsPipeline returns true if the template instantiates a pipeline instead
+// of a task.
+func (t *TaskTemplate) IsPipeline() bool {
+	return t.Pipeline != nil
+}
+
+func checkTemplateParamValue(p TemplateParameter, value string) error {
+	var err error
+	switch p.Type {
+	case TEMPLATE_PARAM_INT:
+		_, err = strconv.Atoi(value)
+	case TEMPLATE_PARAM_BOOL:
+		_, err = strconv.ParseBool(value)
+	}
+	if err != nil {
+		return errors.New("Invalid value for the " + p.Type + " template parameter " + p.Name + ": " + value)
+	}
+	return nil
+}
+
+// Validate checks the name, the parameters and the content of the template.
+func (t *TaskTemplate) Validate() error {
+	if len(t.Name) == 0 {
+		return errors.New("The template has no name")
+	}
+	if (t.Task == nil) == (t.Pipeline == nil) {
+		return errors.New("The template needs either a task or a pipeline")
+	}
+	if t.IsPipeline() && len(t.Pipeline.Tasks) == 0 {
+		return errors.New("The pipeline of the template has no tasks")
+	}
+
+	names := make(map[string]bool)
+	for _, p := range t.Parameters {
+		if !templateParamName.MatchString(p.Name) {
+			return errors.New("Invalid template parameter name: " + p.Name)
+		}
+		if names[p.Name] {
+			return errors.New("Duplicated template parameter: " + p.Name)
+		}
+		names[p.Name] = true
+
+		switch p.Type {
+		case "", TEMPLATE_PARAM_STRING, TEMPLATE_PARAM_INT, TEMPLATE_PARAM_BOOL:
+		default:
+			return errors.New("Invalid type of the template parameter " + p.Name + ": " + p.Type)
+		}
+		if len(p.Default) > 0 {
+			if err := checkTemplateParamValue(p, p.Default); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Values checks the given parameters against the declared ones and returns
+// the values to substitute, defaults included.
+func (t *TaskTemplate) Values(params map[string]string) (map[string]string, error) {
+	declared := make(map[string]bool)
+	values := make(map[string]string)
+	for _, p := range t.Parameters {
+		declared[p.Name] = true
+
+		value, ok := params[p.Name]
+		if !ok || len(value) == 0 {
+			if p.Required && len(p.Default) == 0 {
+				return nil, errors.New("Missing required template parameter: " + p.Name)
+			}
+			value = p.Default
+		}
+		if len(value) > 0 {
+			if err := checkTemplateParamValue(p, value); err != nil {
+				return nil, err
+			}
+		}
+		values[p.Name] = value
+	}
+
+	for name := range params {
+		if !declared[name] {
+			return nil, errors.New("Unknown template parameter: " + name)
+		}
+	}
+	return values, nil
+}
+
+func substitute(s string, values map[string]string) string {
+	return templateParamRegexp.ReplaceAllStringFunc(s, func(m string) string {
+		// Placeholders of undeclared parameters are left as they are
+		if v, ok := values[templateParamRegexp.FindStringSubmatch(m)[1]]; ok {
+			return v
+		}
+		return m
+	})
+}
+
+func substituteAll(s []string, values map[string]string) []string {
+	res := make([]string, len(s))
+	for i := range s {
+		res[i] = substitute(s[i], values)
+	}
+	return res
+}
+
+func (t *Task) substitute(values map[string]string) {
+	for _, f := range []*string{
+		&t.Name, &t.Source, &t.Directory, &t.Type, &t.Namespace, &t.Commit,
+		&t.Image, &t.Storage, &t.ArtefactPath, &t.StoragePath, &t.RootTask,
+		&t.TagNamespace, &t.CacheImage, &t.Queue, &t.Quota,
+	} {
+		*f = substitute(*f, values)
+	}
+	for _, f := range []*[]string{
+		&t.Script, &t.Entrypoint, &t.Environment, &t.Binds,
+		&t.NamespaceFilters, &t.ArtefactPushFilters, &t.NodeSelector,
+		&t.Paths, &t.PathsIgnore,
+	} {
+		*f = substituteAll(*f, values)
+	}
+}
+
+func (t *TaskTemplate) newTask(task Task, values map[string]string) Task {
+	task.substitute(values)
+	task.Reset()
+	task.ID = ""
+	task.PipelineID = ""
+	task.Revision = 0
+	return task
+}
+
+// NewTask instantiates the task of the template with the given parameters.
+func (t *TaskTemplate) NewTask(params map[string]string) (*Task, error) {
+	if t.IsPipeline() || t.Task == nil {
+		return nil, errors.New("The template " + t.Name + " is not a task template")
+	}
+	values, err := t.Values(params)
+	if err != nil {
+		return nil, err
+	}
+
+	task := t.newTask(*t.Task, values)
+	return &task, nil
+}
+
+// NewPipeline instantiates the pipeline of the template, and its tasks,
+// with the given parameters.
+func (t *TaskTemplate) NewPipeline(params map[string]string) (*Pipeline, error) {
+	if !t.IsPipeline() {
+		return nil, errors.New("The template " + t.Name + " is not a pipeline template")
+	}
+	values, err := t.Values(params)
+	if err != nil {
+		return nil, err
+	}
+
+	pip := *t.Pipeline
+	pip.ID = ""
+	pip.PlanID = ""
+	pip.Name = substitute(pip.Name, values)
+	pip.Queue = substitute(pip.Queue, values)
+	pip.Reset()
+
+	pip.Tasks = make(map[string]Task)
+	for name, task := range t.Pipeline.Tasks {
+		pip.Tasks[name] = t.newTask(task, values)
+	}
+	return &pip, nil
+}
+
+// NewTasks instantiates the template with the given parameters and returns
+// the tasks created, the task of the template or the ones of its pipeline.
+func (t *TaskTemplate) NewTasks(params map[string]string) ([]Task, error) {
+	if !t.IsPipeline() {
+		task, err := t.NewTask(params)
+		if err != nil {
+			return nil, err
+		}
+		return []Task{*task}, nil
+	}
+
+	pip, err := t.NewPipeline(params)
+	if err != nil {
+		return nil, err
+	}
+	tasks := make([]Task, 0, len(pip.Tasks))
+	for _, task := range pip.Tasks {
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+// ParseTemplateParams parses the template parameters referenced by plans
+// and webhooks, stored URL encoded (e.g. "version=1.0&debug=true").
+func ParseTemplateParams(s string) (map[string]string, error) {
+	values, err := url.ParseQuery(s)
+	if err != nil {
+		return nil, errors.New("Invalid template parameters: " + err.Error())
+	}
+	params := make(map[string]string)
+	for k, v := range values {
+		if len(v) > 0 {
+			params[k] = v[len(v)-1]
+		}
+	}
+	return params, nil
+}
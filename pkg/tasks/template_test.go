@@ -0,0 +1,129 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package agenttasks
+
+import (
+	"testing"
+)
+
+func TestTaskTemplateInstance(t *testing.T) {
+	tmpl := &TaskTemplate{
+		Name: "build",
+		Parameters: []TemplateParameter{
+			{Name: "version", Required: true},
+			{Name: "jobs", Type: TEMPLATE_PARAM_INT, Default: "2"},
+		},
+		Task: &Task{
+			Name:        "build {{ version }}",
+			Image:       "builder:{{version}}",
+			Script:      []string{"make -j{{ jobs }}", "docker inspect -f '{{.Id}}' {{ other }}"},
+			Environment: []string{"VERSION={{ version }}"},
+			Status:      "done",
+		},
+	}
+	if err := tmpl.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	task, err := tmpl.NewTask(map[string]string{"version": "1.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.Name != "build 1.0" || task.Image != "builder:1.0" || task.Environment[0] != "VERSION=1.0" {
+		t.Error("Parameters not substituted", task)
+	}
+	if task.Script[0] != "make -j2" {
+		t.Error("Default not substituted", task.Script[0])
+	}
+	if task.Script[1] != "docker inspect -f '{{.Id}}' {{ other }}" {
+		t.Error("Undeclared placeholders should be left as they are", task.Script[1])
+	}
+	if task.Status != "" || tmpl.Task.Name != "build {{ version }}" {
+		t.Error("The instance should be a fresh copy of the template task")
+	}
+
+	for _, params := range []map[string]string{
+		{},
+		{"version": "1.0", "jobs": "many"},
+		{"version": "1.0", "foo": "bar"},
+	} {
+		if _, err := tmpl.NewTask(params); err == nil {
+			t.Errorf("Parameters %v should be rejected", params)
+		}
+	}
+	if _, err := tmpl.NewPipeline(map[string]string{"version": "1.0"}); err == nil {
+		t.Error("A task template shouldn't instantiate pipelines")
+	}
+	if tasks, err := tmpl.NewTasks(map[string]string{"version": "1.0"}); err != nil || len(tasks) != 1 || tasks[0].Name != "build 1.0" {
+		t.Error("Task template instances should have its task", tasks, err)
+	}
+}
+
+func TestTaskTemplateValidate(t *testing.T) {
+	for _, tmpl := range []*TaskTemplate{
+		{Task: &Task{}},
+		{Name: "foo"},
+		{Name: "foo", Task: &Task{}, Pipeline: &Pipeline{Tasks: map[string]Task{"a": {}}}},
+		{Name: "foo", Pipeline: &Pipeline{}},
+		{Name: "foo", Task: &Task{}, Parameters: []TemplateParameter{{Name: "a b"}}},
+		{Name: "foo", Task: &Task{}, Parameters: []TemplateParameter{{Name: "a"}, {Name: "a"}}},
+		{Name: "foo", Task: &Task{}, Parameters: []TemplateParameter{{Name: "a", Type: "float"}}},
+		{Name: "foo", Task: &Task{}, Parameters: []TemplateParameter{{Name: "a", Type: "bool", Default: "maybe"}}},
+	} {
+		if tmpl.Validate() == nil {
+			t.Errorf("Template %+v should be invalid", tmpl)
+		}
+	}
+}
+
+func TestTaskTemplateMap(t *testing.T) {
+	tmpl := &TaskTemplate{
+		Name:       "deploy",
+		Version:    3,
+		Parameters: []TemplateParameter{{Name: "env", Required: true, Default: "staging"}},
+		Pipeline: &Pipeline{
+			Name:  "deploy {{ env }}",
+			Tasks: map[string]Task{"up": {Namespace: "{{ env }}"}},
+		},
+	}
+
+	res := NewTaskTemplateFromMap(tmpl.ToMap())
+	if res.Name != "deploy" || res.Version != 3 || len(res.Parameters) != 1 || !res.Parameters[0].Required {
+		t.Fatal("Template not restored", res)
+	}
+	pip, err := res.NewPipeline(map[string]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pip.Name != "deploy staging" || pip.Tasks["up"].Namespace != "staging" {
+		t.Error("Parameters not substituted in the pipeline", pip)
+	}
+	if tasks, err := res.NewTasks(map[string]string{"env": "prod"}); err != nil || len(tasks) != 1 || tasks[0].Namespace != "prod" {
+		t.Error("Pipeline template instances should have the pipeline tasks", tasks, err)
+	}
+
+	params, err := ParseTemplateParams("env=prod&debug=true")
+	if err != nil || params["env"] != "prod" || params["debug"] != "true" {
+		t.Error("Unexpected parameters", params, err)
+	}
+}
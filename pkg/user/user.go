@@ -25,10 +25,13 @@ package user
 import (
 	"encoding/json"
 	"reflect"
+	"strings"
 
 	passlib "github.com/MottainaiCI/passlib"
 )
 
+const NameSpacesPrefix = "::"
+
 type Identity struct {
 	ID        string `json:"identity_id" form:"identity_id"`
 	Provider  string `json:"provider" form:"provider"`
@@ -98,6 +101,15 @@ func (u *User) IsManagerOrAdmin() bool {
 	return false
 }
 
+// NamespaceBelongs returns true if the user can publish to the namespace:
+// managers and admins can publish everywhere, users only to the namespaces
+// prefixed by their name.
+func (u *User) NamespaceBelongs(namespace string) bool {
+	return len(namespace) == 0 ||
+		u.IsManagerOrAdmin() ||
+		strings.HasPrefix(namespace, u.Name+NameSpacesPrefix)
+}
+
 func (u *User) MakeAdmin() {
 	u.Admin = "yes"
 }
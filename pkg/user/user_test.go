@@ -67,3 +67,18 @@ func TestIdentities(t *testing.T) {
 	}
 	u.RemoveIdentity("github")
 }
+
+func TestNamespaceBelongs(t *testing.T) {
+	u := NewUserFromMap(map[string]interface{}{"name": "test"})
+	if !u.NamespaceBelongs("") || !u.NamespaceBelongs("test::foo") {
+		t.Error("User can't publish to its namespaces")
+	}
+	if u.NamespaceBelongs("foo") || u.NamespaceBelongs("other::foo") {
+		t.Error("User can publish to the namespaces of other users")
+	}
+
+	u.MakeManager()
+	if !u.NamespaceBelongs("other::foo") {
+		t.Error("Manager can't publish to the namespaces of other users")
+	}
+}
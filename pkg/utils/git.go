@@ -29,6 +29,8 @@ import (
 	git "gopkg.in/src-d/go-git.v4"
 	"gopkg.in/src-d/go-git.v4/config"
 	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
 )
 
 //TODO: Git* Can go in a separate object
@@ -94,6 +96,100 @@ func GitCheckoutMergeRequest(repo *git.Repository, remote, mergeRequest string)
 	return nil
 }
 
+// GitCheckoutRef fetches the reference from the remote and checks it out.
+// HEAD is detached unless the reference is a branch.
+func GitCheckoutRef(repo *git.Repository, remote, ref string) error {
+	if remote == "" {
+		remote = "origin"
+	}
+
+	err := GitFetch(repo, remote, []string{"+" + ref + ":" + ref})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return err
+	}
+
+	w, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	return w.Checkout(&git.CheckoutOptions{
+		Branch: plumbing.ReferenceName(ref),
+	})
+}
+
+// GitChangedFiles returns the files changed between the base and head
+// commits.
+func GitChangedFiles(repo *git.Repository, base, head string) ([]string, error) {
+	b, err := repo.CommitObject(plumbing.NewHash(base))
+	if err != nil {
+		return nil, err
+	}
+	h, err := repo.CommitObject(plumbing.NewHash(head))
+	if err != nil {
+		return nil, err
+	}
+	bt, err := b.Tree()
+	if err != nil {
+		return nil, err
+	}
+	ht, err := h.Tree()
+	if err != nil {
+		return nil, err
+	}
+	changes, err := object.DiffTree(bt, ht)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]string, 0)
+	for _, c := range changes {
+		if c.From.Name != "" {
+			files = append(files, c.From.Name)
+		}
+		if c.To.Name != "" && c.To.Name != c.From.Name {
+			files = append(files, c.To.Name)
+		}
+	}
+	return files, nil
+}
+
+// GitMergeBase returns the nearest common ancestor of the two commits, e.g.
+// where the branch of a pull request diverged from its base.
+func GitMergeBase(repo *git.Repository, a, b string) (string, error) {
+	ac, err := repo.CommitObject(plumbing.NewHash(a))
+	if err != nil {
+		return "", err
+	}
+	bc, err := repo.CommitObject(plumbing.NewHash(b))
+	if err != nil {
+		return "", err
+	}
+
+	ancestors := make(map[plumbing.Hash]bool)
+	err = object.NewCommitIterBSF(ac, nil, nil).ForEach(func(c *object.Commit) error {
+		ancestors[c.Hash] = true
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var base string
+	err = object.NewCommitIterBSF(bc, nil, nil).ForEach(func(c *object.Commit) error {
+		if ancestors[c.Hash] {
+			base = c.Hash.String()
+			return storer.ErrStop
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	} else if base == "" {
+		return "", errors.New("No common ancestor between " + a + " and " + b)
+	}
+	return base, nil
+}
+
 func GitFetch(r *git.Repository, remote string, args []string) error {
 	var refs []config.RefSpec
 	for _, ref := range args {
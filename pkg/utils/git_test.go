@@ -25,7 +25,13 @@ package utils
 import (
 	"io/ioutil"
 	"os"
+	"path"
 	"testing"
+	"time"
+
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
 )
 
 var testurl = "https://github.com/MottainaiCI/mottainai-server"
@@ -112,3 +118,101 @@ func TestGitFetch(t *testing.T) {
 		t.Fatal("File should exist now")
 	}
 }
+
+func TestGitChangedFiles(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	repo, err := git.PlainInit(tempdir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit := func(files ...string) string {
+		for _, f := range files {
+			os.MkdirAll(path.Dir(path.Join(tempdir, f)), os.ModePerm)
+			ioutil.WriteFile(path.Join(tempdir, f), []byte(f), os.ModePerm)
+			w.Add(f)
+		}
+		h, err := w.Commit("test", &git.CommitOptions{
+			Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h.String()
+	}
+
+	base := commit("README.md", "services/api/main.go")
+	head := commit("services/web/main.go", "docs/index.md")
+
+	files, err := GitChangedFiles(repo, base, head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || !MatchAnyGlob(files, "docs/index.md") || !MatchAnyGlob(files, "services/web/main.go") {
+		t.Fatal("Invalid changed files", files)
+	}
+}
+
+func TestGitMergeBase(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	repo, err := git.PlainInit(tempdir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit := func(files ...string) string {
+		for _, f := range files {
+			os.MkdirAll(path.Dir(path.Join(tempdir, f)), os.ModePerm)
+			ioutil.WriteFile(path.Join(tempdir, f), []byte(f), os.ModePerm)
+			w.Add(f)
+		}
+		h, err := w.Commit("test", &git.CommitOptions{
+			Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h.String()
+	}
+
+	fork := commit("README.md")
+	// The base branch moves on after the pull request is opened
+	base := commit("docs/index.md")
+	err = w.Reset(&git.ResetOptions{Commit: plumbing.NewHash(fork), Mode: git.HardReset})
+	if err != nil {
+		t.Fatal(err)
+	}
+	head := commit("services/web/main.go")
+
+	mb, err := GitMergeBase(repo, base, head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mb != fork {
+		t.Fatal("Invalid merge base", mb, fork)
+	}
+
+	files, err := GitChangedFiles(repo, mb, head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0] != "services/web/main.go" {
+		t.Fatal("Invalid changed files", files)
+	}
+}
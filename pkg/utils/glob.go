@@ -0,0 +1,93 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package utils
+
+import (
+	"path"
+	"strings"
+)
+
+// MatchGlob reports whether the slash separated file name matches the glob
+// pattern. Besides the path.Match syntax, a "**" element matches any number
+// of directories.
+func MatchGlob(pattern, name string) bool {
+	return matchGlobElems(strings.Split(strings.Trim(pattern, "/"), "/"),
+		strings.Split(strings.Trim(name, "/"), "/"))
+}
+
+func matchGlobElems(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchGlobElems(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// MatchAnyGlob reports whether the file name matches one of the patterns.
+func MatchAnyGlob(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if MatchGlob(p, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchPaths reports whether one of the changed files matches the paths
+// globs, or any path when empty, and none of the ignored ones.
+// A nil list of files means they are unknown, and always matches.
+func MatchPaths(files, paths, ignore []string) bool {
+	if files == nil || (len(paths) == 0 && len(ignore) == 0) {
+		return true
+	}
+	for _, f := range files {
+		if (len(paths) == 0 || MatchAnyGlob(paths, f)) && !MatchAnyGlob(ignore, f) {
+			return true
+		}
+	}
+	return false
+}
+
+// SplitGlobs returns the comma separated globs in s.
+func SplitGlobs(s string) []string {
+	globs := make([]string, 0)
+	for _, g := range strings.Split(s, ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			globs = append(globs, g)
+		}
+	}
+	return globs
+}
@@ -0,0 +1,70 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package utils
+
+import (
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	for _, c := range []struct {
+		pattern, name string
+		match         bool
+	}{
+		{"*.md", "README.md", true},
+		{"*.md", "docs/index.md", false},
+		{"**/*.md", "docs/index.md", true},
+		{"**/*.md", "README.md", true},
+		{"services/api/**", "services/api/main.go", true},
+		{"services/api/**", "services/web/main.go", false},
+		{"services/*/Dockerfile", "services/api/Dockerfile", true},
+		{"services/**/test/*.go", "services/api/pkg/test/a_test.go", true},
+	} {
+		if MatchGlob(c.pattern, c.name) != c.match {
+			t.Error("Unexpected match", c.pattern, c.name, c.match)
+		}
+	}
+}
+
+func TestMatchPaths(t *testing.T) {
+	files := []string{"docs/index.md", "services/api/main.go"}
+
+	if !MatchPaths(nil, []string{"services/web/**"}, nil) {
+		t.Error("Unknown changes should always match")
+	}
+	if !MatchPaths(files, []string{"services/api/**"}, nil) {
+		t.Error("Changed path should match")
+	}
+	if MatchPaths(files, []string{"services/web/**"}, nil) {
+		t.Error("Unchanged path shouldn't match")
+	}
+	if !MatchPaths(files, nil, []string{"docs/**"}) {
+		t.Error("Changes outside the ignored paths should match")
+	}
+	if MatchPaths(files, nil, []string{"docs/**", "**/*.go"}) {
+		t.Error("Ignored changes shouldn't match")
+	}
+	if g := SplitGlobs(" docs/**, ,*.md"); len(g) != 2 || g[0] != "docs/**" || g[1] != "*.md" {
+		t.Error("Invalid globs", g)
+	}
+}
@@ -0,0 +1,238 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Targets of the mappings of the generic webhooks, besides the env.NAME
+// environment variables
+var MappingTargets = []string{
+	"commit", "source", "image", "namespace", "tag_namespace", "directory",
+}
+
+// Mapping copies the value of a JSONPath-like expression of the payloads of
+// the generic webhooks into a task field or environment variable.
+type Mapping struct {
+	Target string
+	Expr   string
+}
+
+// IsEnv reports whether the mapping sets an environment variable, returning
+// its name.
+func (m Mapping) IsEnv() (string, bool) {
+	if strings.HasPrefix(m.Target, "env.") {
+		return strings.TrimPrefix(m.Target, "env."), true
+	}
+	return "", false
+}
+
+// ParseMapping parses the comma or newline separated target=expression
+// mappings of a generic webhook.
+func ParseMapping(s string) ([]Mapping, error) {
+	mappings := make([]Mapping, 0)
+	for _, entry := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == '\n' }) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kv := strings.SplitN(entry, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[1]) == "" {
+			return nil, fmt.Errorf("Invalid mapping %s", entry)
+		}
+		m := Mapping{Target: strings.TrimSpace(kv[0]), Expr: strings.TrimSpace(kv[1])}
+		if name, ok := m.IsEnv(); ok {
+			if name == "" {
+				return nil, fmt.Errorf("Invalid mapping %s", entry)
+			}
+		} else if !isMappingTarget(m.Target) {
+			return nil, fmt.Errorf("Invalid mapping target %s", m.Target)
+		}
+		mappings = append(mappings, m)
+	}
+	return mappings, nil
+}
+
+func isMappingTarget(target string) bool {
+	for _, t := range MappingTargets {
+		if t == target {
+			return true
+		}
+	}
+	return false
+}
+
+// Lookup returns the value of the JSONPath-like expression in the decoded
+// JSON document: $ is the document, .name and ['name'] select the members of
+// the objects and [n] the elements of the arrays. The leading $. may be
+// omitted.
+func Lookup(doc interface{}, expr string) (interface{}, bool) {
+	expr = strings.TrimSpace(expr)
+	if !strings.HasPrefix(expr, "$") {
+		expr = "$." + expr
+	}
+	expr = expr[1:]
+
+	cur := doc
+	for len(expr) > 0 {
+		var key string
+		index := -1
+
+		switch {
+		case expr[0] == '.':
+			end := strings.IndexAny(expr[1:], ".[")
+			if end < 0 {
+				end = len(expr) - 1
+			}
+			key, expr = expr[1:end+1], expr[end+1:]
+		case strings.HasPrefix(expr, "['"):
+			end := strings.Index(expr, "']")
+			if end < 0 {
+				return nil, false
+			}
+			key, expr = expr[2:end], expr[end+2:]
+		case expr[0] == '[':
+			end := strings.Index(expr, "]")
+			if end < 0 {
+				return nil, false
+			}
+			i, err := strconv.Atoi(expr[1:end])
+			if err != nil {
+				return nil, false
+			}
+			index, expr = i, expr[end+1:]
+		default:
+			return nil, false
+		}
+
+		if index >= 0 {
+			arr, ok := cur.([]interface{})
+			if !ok || index >= len(arr) {
+				return nil, false
+			}
+			cur = arr[index]
+		} else {
+			obj, ok := cur.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if cur, ok = obj[key]; !ok {
+				return nil, false
+			}
+		}
+	}
+	return cur, true
+}
+
+// LookupString returns the value of the expression in the document as a
+// string, the objects and arrays being encoded as JSON.
+func LookupString(doc interface{}, expr string) string {
+	v, ok := Lookup(doc, expr)
+	if !ok {
+		return ""
+	}
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(val)
+	default:
+		b, _ := json.Marshal(val)
+		return string(b)
+	}
+}
+
+// MatchFilter evaluates the filter expression of a generic webhook against
+// the decoded payload. Its conditions are joined by &&, each one being one
+// of:
+//
+//	expr == value
+//	expr != value
+//	expr =~ regex
+//	expr            (set, and neither false nor empty)
+//
+// Values may be double quoted. An empty filter matches any payload.
+func MatchFilter(doc interface{}, filter string) (bool, error) {
+	for _, cond := range strings.Split(filter, "&&") {
+		cond = strings.TrimSpace(cond)
+		if cond == "" {
+			continue
+		}
+
+		op := ""
+		for _, o := range []string{"==", "!=", "=~"} {
+			if strings.Contains(cond, o) {
+				op = o
+				break
+			}
+		}
+		if op == "" {
+			switch LookupString(doc, cond) {
+			case "", "false":
+				return false, nil
+			}
+			continue
+		}
+
+		parts := strings.SplitN(cond, op, 2)
+		actual := LookupString(doc, parts[0])
+		value := strings.TrimSpace(parts[1])
+		if strings.HasPrefix(value, "\"") {
+			v, err := strconv.Unquote(value)
+			if err != nil {
+				return false, errors.New("Invalid filter value " + value)
+			}
+			value = v
+		}
+
+		switch op {
+		case "==":
+			if actual != value {
+				return false, nil
+			}
+		case "!=":
+			if actual == value {
+				return false, nil
+			}
+		case "=~":
+			re, err := regexp.Compile(value)
+			if err != nil {
+				return false, errors.New("Invalid filter regex " + value)
+			}
+			if !re.MatchString(actual) {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,106 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package webhook
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const registryPayload = `{
+  "push_data": {"tag": "v1.2", "pushed_at": 1417566161},
+  "repository": {"repo_name": "mottainai/builder", "official": false},
+  "events": [{"action": "push", "target": {"digest": "sha256:abc"}}]
+}`
+
+func decodePayload(t *testing.T, payload string) interface{} {
+	var doc interface{}
+	if err := json.Unmarshal([]byte(payload), &doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestLookup(t *testing.T) {
+	doc := decodePayload(t, registryPayload)
+
+	for expr, value := range map[string]string{
+		"$.push_data.tag":              "v1.2",
+		"push_data.pushed_at":          "1417566161",
+		"$['repository']['repo_name']": "mottainai/builder",
+		"$.repository.official":        "false",
+		"$.events[0].target.digest":    "sha256:abc",
+		"$.events[0]['target']":        `{"digest":"sha256:abc"}`,
+		"$.events[1].action":           "",
+		"$.push_data.missing":          "",
+	} {
+		if v := LookupString(doc, expr); v != value {
+			t.Errorf("%s: expected %s, got %s", expr, value, v)
+		}
+	}
+}
+
+func TestMatchFilter(t *testing.T) {
+	doc := decodePayload(t, registryPayload)
+
+	for filter, match := range map[string]bool{
+		"":                             true,
+		`$.events[0].action == push`:   true,
+		`$.events[0].action == "pull"`: false,
+		`$.push_data.tag =~ ^v1\.`:     true,
+		`$.push_data.tag =~ ^v1\. && $.repository.official`: false,
+		`$.repository.repo_name != mottainai/builder`:       false,
+		`$.push_data.pushed_at`:                             true,
+	} {
+		ok, err := MatchFilter(doc, filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != match {
+			t.Errorf("%s: expected %v", filter, match)
+		}
+	}
+
+	if _, err := MatchFilter(doc, `$.push_data.tag =~ (`); err == nil {
+		t.Error("Invalid regex should fail")
+	}
+}
+
+func TestParseMapping(t *testing.T) {
+	m, err := ParseMapping("image=$.repository.repo_name, env.TAG=$.push_data.tag\ncommit=$.events[0].target.digest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m) != 3 || m[0].Target != "image" || m[1].Expr != "$.push_data.tag" {
+		t.Fatal("Invalid mapping", m)
+	}
+	if name, ok := m[1].IsEnv(); !ok || name != "TAG" {
+		t.Error("Invalid env mapping", m[1])
+	}
+
+	for _, invalid := range []string{"image", "owner=$.a", "env.=$.a", "image="} {
+		if _, err := ParseMapping(invalid); err == nil {
+			t.Error("Invalid mapping accepted", invalid)
+		}
+	}
+}
@@ -27,6 +27,7 @@ import (
 	"encoding/gob"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 
 	utils "github.com/MottainaiCI/mottainai-server/pkg/utils"
 
@@ -37,6 +38,19 @@ import (
 	"reflect"
 )
 
+// What to do with the builds of a pull request or branch still in progress
+// when a newer event of it arrives
+const (
+	SUPERSEDE_KEEP   = "keep"
+	SUPERSEDE_CANCEL = "cancel"
+)
+
+// Build is the task and the pipeline started by an event of a webhook.
+type Build struct {
+	Task     string `json:"task,omitempty"`
+	Pipeline string `json:"pipeline,omitempty"`
+}
+
 type WebHookSingle struct {
 	WebHook  *WebHook
 	Task     *task.Task
@@ -44,77 +58,236 @@ type WebHookSingle struct {
 }
 
 type WebHook struct {
-	ID       string `json:"id" form:"id"`
-	Name     string `json:"name" form:"name"`
-	Key      string `json:"key" form:"key"`
-	Type     string `json:"type" form:"type"`
-	URL      string `json:"url" form:"url"`
-	OwnerId  string `json:"owner_id" form:"owner_id"`
-	Task     string `json:"default_task" form:"default_task"`
-	Pipeline string `json:"default_pipeline" form:"default_pipeline"`
-	Filter   string `json:"filter" form:"filter"`
+	ID      string `json:"id" form:"id"`
+	Name    string `json:"name" form:"name"`
+	Key     string `json:"key" form:"key"`
+	Type    string `json:"type" form:"type"`
+	URL     string `json:"url" form:"url"`
+	OwnerId string `json:"owner_id" form:"owner_id"`
+	Filter  string `json:"filter" form:"filter"`
+
+	// Stored as documents in the default_task and default_pipeline fields,
+	// see ToMap
+	Task     *task.Task     `json:"default_task,omitempty" form:"-"`
+	Pipeline *task.Pipeline `json:"default_pipeline,omitempty" form:"-"`
+
+	// Default tasks and pipelines of specific kinds of events, e.g. tag or
+	// release, used in place of the default ones
+	EventTasks     map[string]*task.Task     `json:"event_tasks,omitempty" form:"-"`
+	EventPipelines map[string]*task.Pipeline `json:"event_pipelines,omitempty" form:"-"`
+
+	// Task template used instead of the default task or pipeline, with its
+	// URL encoded parameters
+	Template       string `json:"template" form:"template"`
+	TemplateParams string `json:"template_params" form:"template_params"`
 
 	Auth string `json:"auth" form:"auth"`
+
+	// Payload mappings of the generic webhooks, see ParseMapping. Their
+	// Filter is an expression on the payload, see MatchFilter.
+	Mapping string `json:"mapping" form:"mapping"`
+
+	// Comma separated globs of the changed files which start the builds,
+	// see MatchPaths
+	Paths       string `json:"paths" form:"paths"`
+	PathsIgnore string `json:"paths_ignore" form:"paths_ignore"`
+
+	// Policy on the superseded builds, SUPERSEDE_KEEP when empty
+	Supersede string `json:"supersede" form:"supersede"`
+
+	// task.BADGES_PUBLIC shows the status of the branches in their badges
+	// to the visitors which aren't signed in
+	Badges string `json:"badges" form:"badges"`
+
+	// Latest builds of the pushed branches, e.g. for their badges
+	BranchBuilds map[string]Build `json:"branch_builds,omitempty" form:"-"`
+
+	// Rules of the notifications added to the builds of the webhook
+	Notifications []task.Notification `json:"notifications,omitempty" form:"-"`
 }
 
 func (t *WebHook) HasTask() bool {
-	if len(t.Task) > 0 {
-		return true
-	}
-	return false
+	return t.Task != nil
 }
 
 func (t *WebHook) HasPipeline() bool {
-	if len(t.Pipeline) > 0 {
-		return true
-	}
-	return false
+	return t.Pipeline != nil
+}
+
+func (t *WebHook) HasTemplate() bool {
+	return len(t.Template) > 0
 }
 
 func (t *WebHook) SetPipeline(pipeline *task.Pipeline) error {
-	str, err := utils.SerializeToString(pipeline)
-	if err != nil {
-		t.Pipeline = ""
-		return err
+	if pipeline == nil {
+		return errors.New("No pipeline supplied")
 	}
-	t.Pipeline = str
+	p := *pipeline
+	t.Pipeline = &p
 	return nil
 }
 
+// ReadPipeline returns a copy of the default pipeline of the webhook.
 func (t *WebHook) ReadPipeline() (*task.Pipeline, error) {
-	var pipeline *task.Pipeline
-	buf, err := utils.DecodeString(t.Pipeline)
-	if err != nil {
-		return pipeline, err
+	if !t.HasPipeline() {
+		return nil, errors.New("No pipeline defined in the webhook")
 	}
-	d := gob.NewDecoder(buf)
-	if err := d.Decode(&pipeline); err != nil {
-		return nil, err
+	p := *t.Pipeline
+	p.Tasks = make(map[string]task.Task)
+	for k, v := range t.Pipeline.Tasks {
+		p.Tasks[k] = v
 	}
-	return pipeline, nil
+	return &p, nil
 }
 
 func (t *WebHook) SetTask(ta *task.Task) error {
-	str, err := utils.SerializeToString(ta)
-	if err != nil {
-		t.Task = ""
-		return err
+	if ta == nil {
+		return errors.New("No task supplied")
 	}
-	t.Task = str
+	tk := *ta
+	t.Task = &tk
 	return nil
 }
 
+// ReadTask returns a copy of the default task of the webhook.
 func (t *WebHook) ReadTask() (*task.Task, error) {
-	var Task *task.Task
-	buf, err := utils.DecodeString(t.Task)
+	if !t.HasTask() {
+		return nil, errors.New("No task defined in the webhook")
+	}
+	tk := *t.Task
+	return &tk, nil
+}
+
+// MatchPaths reports whether the changed files start the builds of the
+// webhook, see utils.MatchPaths.
+func (t *WebHook) MatchPaths(files []string) bool {
+	return utils.MatchPaths(files, utils.SplitGlobs(t.Paths), utils.SplitGlobs(t.PathsIgnore))
+}
+
+// CancelsSuperseded reports whether the builds of a pull request or branch
+// still in progress are stopped when a newer event of it arrives.
+func (t *WebHook) CancelsSuperseded() bool {
+	return t.Supersede == SUPERSEDE_CANCEL
+}
+
+// HasPublicBadges reports whether the owner of the webhook opted in to show
+// the status of its branches to the visitors which aren't signed in.
+func (t *WebHook) HasPublicBadges() bool {
+	return t.Badges == task.BADGES_PUBLIC
+}
+
+// ValidateSupersede checks a policy on the superseded builds.
+func ValidateSupersede(policy string) error {
+	switch policy {
+	case "", SUPERSEDE_KEEP, SUPERSEDE_CANCEL:
+		return nil
+	}
+	return errors.New("Invalid supersede policy: " + policy)
+}
+
+// SetBranchBuild records the latest build of the branch.
+func (t *WebHook) SetBranchBuild(branch string, b Build) {
+	if t.BranchBuilds == nil {
+		t.BranchBuilds = make(map[string]Build)
+	}
+	t.BranchBuilds[branch] = b
+}
+
+// SetEventTask sets the default task of the given kind of events, or the
+// default task of the webhook when kind is empty. A nil task removes it.
+func (t *WebHook) SetEventTask(kind string, ta *task.Task) {
+	var tk *task.Task
+	if ta != nil {
+		c := *ta
+		tk = &c
+	}
+	if kind == "" {
+		t.Task = tk
+		return
+	}
+	if t.EventTasks == nil {
+		t.EventTasks = make(map[string]*task.Task)
+	}
+	if tk == nil {
+		delete(t.EventTasks, kind)
+	} else {
+		t.EventTasks[kind] = tk
+	}
+}
+
+// SetEventPipeline sets the default pipeline of the given kind of events, or
+// the default pipeline of the webhook when kind is empty. A nil pipeline
+// removes it.
+func (t *WebHook) SetEventPipeline(kind string, pipeline *task.Pipeline) {
+	var p *task.Pipeline
+	if pipeline != nil {
+		c := *pipeline
+		p = &c
+	}
+	if kind == "" {
+		t.Pipeline = p
+		return
+	}
+	if t.EventPipelines == nil {
+		t.EventPipelines = make(map[string]*task.Pipeline)
+	}
+	if p == nil {
+		delete(t.EventPipelines, kind)
+	} else {
+		t.EventPipelines[kind] = p
+	}
+}
+
+// EventDefaults returns a copy of the webhook with only the default task and
+// pipeline of the given kind of events.
+func (t *WebHook) EventDefaults(kind string) *WebHook {
+	w := *t
+	if kind != "" {
+		w.Task = t.EventTasks[kind]
+		w.Pipeline = t.EventPipelines[kind]
+	}
+	return &w
+}
+
+// ForEvent returns a copy of the webhook with the default task and pipeline
+// to run for the given kind of events: the ones of the kind if any, else
+// the default ones.
+func (t *WebHook) ForEvent(kind string) *WebHook {
+	_, hasTask := t.EventTasks[kind]
+	_, hasPipeline := t.EventPipelines[kind]
+	if hasTask || hasPipeline {
+		return t.EventDefaults(kind)
+	}
+	w := *t
+	return &w
+}
+
+// DecodeLegacyTask decodes a default task stored as a gob blob, as done
+// before schema version 4.
+func DecodeLegacyTask(s string) (*task.Task, error) {
+	var t *task.Task
+	buf, err := utils.DecodeString(s)
 	if err != nil {
-		return Task, err
+		return nil, err
+	}
+	if err := gob.NewDecoder(buf).Decode(&t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// DecodeLegacyPipeline decodes a default pipeline stored as a gob blob, as
+// done before schema version 4.
+func DecodeLegacyPipeline(s string) (*task.Pipeline, error) {
+	var p *task.Pipeline
+	buf, err := utils.DecodeString(s)
+	if err != nil {
+		return nil, err
 	}
-	d := gob.NewDecoder(buf)
-	if err := d.Decode(&Task); err != nil {
-		return Task, err
+	if err := gob.NewDecoder(buf).Decode(&p); err != nil {
+		return nil, err
 	}
-	return Task, nil
+	return p, nil
 }
 
 func GenerateUserWebHook(id string) (*WebHook, error) {
@@ -191,6 +364,53 @@ func NewWebHookFromMap(t map[string]interface{}) WebHook {
 			}
 		}
 	}
+
+	switch v := t["default_task"].(type) {
+	case map[string]interface{}:
+		tk := task.NewTaskFromMap(v)
+		u.Task = &tk
+	case string:
+		// Not migrated yet, e.g. restored from an old backup
+		if len(v) > 0 {
+			u.Task, _ = DecodeLegacyTask(v)
+		}
+	}
+	switch v := t["default_pipeline"].(type) {
+	case map[string]interface{}:
+		p := task.NewPipelineFromMap(v)
+		u.Pipeline = &p
+	case string:
+		if len(v) > 0 {
+			u.Pipeline, _ = DecodeLegacyPipeline(v)
+		}
+	}
+	if m, ok := t["event_tasks"].(map[string]interface{}); ok {
+		for kind, v := range m {
+			if tm, ok := v.(map[string]interface{}); ok {
+				tk := task.NewTaskFromMap(tm)
+				u.SetEventTask(kind, &tk)
+			}
+		}
+	}
+	if m, ok := t["event_pipelines"].(map[string]interface{}); ok {
+		for kind, v := range m {
+			if pm, ok := v.(map[string]interface{}); ok {
+				p := task.NewPipelineFromMap(pm)
+				u.SetEventPipeline(kind, &p)
+			}
+		}
+	}
+	if m, ok := t["branch_builds"].(map[string]interface{}); ok {
+		for branch, v := range m {
+			if bm, ok := v.(map[string]interface{}); ok {
+				b := Build{}
+				b.Task, _ = bm["task"].(string)
+				b.Pipeline, _ = bm["pipeline"].(string)
+				u.SetBranchBuild(branch, b)
+			}
+		}
+	}
+	u.Notifications = task.NewNotificationsFromMap(t["notifications"])
 	return *u
 }
 
@@ -213,7 +433,40 @@ func (t *WebHook) ToMap() map[string]interface{} {
 
 		tag := typeField.Tag
 
-		ts[tag.Get("form")] = valueField.Interface()
+		switch typeField.Name {
+		case "Task":
+			ts["default_task"] = nil
+			if t.Task != nil {
+				ts["default_task"] = t.Task.ToMap()
+			}
+		case "Pipeline":
+			ts["default_pipeline"] = nil
+			if t.Pipeline != nil {
+				ts["default_pipeline"] = t.Pipeline.ToMap(true)
+			}
+		case "EventTasks":
+			tasks := make(map[string]interface{})
+			for kind, tk := range t.EventTasks {
+				tasks[kind] = tk.ToMap()
+			}
+			ts["event_tasks"] = tasks
+		case "EventPipelines":
+			pipelines := make(map[string]interface{})
+			for kind, p := range t.EventPipelines {
+				pipelines[kind] = p.ToMap(true)
+			}
+			ts["event_pipelines"] = pipelines
+		case "BranchBuilds":
+			builds := make(map[string]interface{})
+			for branch, b := range t.BranchBuilds {
+				builds[branch] = map[string]interface{}{"task": b.Task, "pipeline": b.Pipeline}
+			}
+			ts["branch_builds"] = builds
+		case "Notifications":
+			ts["notifications"] = task.NotificationsToMap(t.Notifications)
+		default:
+			ts[tag.Get("form")] = valueField.Interface()
+		}
 	}
 	return ts
 }
@@ -23,9 +23,11 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 package webhook
 
 import (
+	"encoding/json"
 	"testing"
 
 	task "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+	"github.com/MottainaiCI/mottainai-server/pkg/utils"
 )
 
 func TestTaskSerialization(t *testing.T) {
@@ -51,3 +53,132 @@ func TestTaskSerialization(t *testing.T) {
 		t.Fatal("Source not matching")
 	}
 }
+
+func TestDefaultsMap(t *testing.T) {
+	wh := NewWebHook()
+	wh.SetTask(&task.Task{Source: "Test", Script: []string{"make"}})
+	wh.SetPipeline(&task.Pipeline{Name: "deploy", Tasks: map[string]task.Task{"up": {Image: "alpine"}}})
+
+	// Stored as the drivers do
+	b, err := json.Marshal(wh.ToMap())
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := make(map[string]interface{})
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	w := NewWebHookFromMap(doc)
+	if !w.HasTask() || w.Task.Source != "Test" || len(w.Task.Script) != 1 {
+		t.Fatal("Task not restored", w.Task)
+	}
+	if !w.HasPipeline() || w.Pipeline.Tasks["up"].Image != "alpine" {
+		t.Fatal("Pipeline not restored", w.Pipeline)
+	}
+
+	w.Task = nil
+	if m := w.ToMap(); m["default_task"] != nil {
+		t.Fatal("Removed task still stored", m["default_task"])
+	}
+}
+
+func TestEventDefaults(t *testing.T) {
+	wh := NewWebHook()
+	wh.SetTask(&task.Task{Source: "Default"})
+	wh.SetEventPipeline("tag", &task.Pipeline{Name: "release", Tasks: map[string]task.Task{"up": {Image: "alpine"}}})
+	wh.SetEventTask("release", &task.Task{Source: "Release"})
+
+	b, err := json.Marshal(wh.ToMap())
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := make(map[string]interface{})
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+	w := NewWebHookFromMap(doc)
+
+	if push := w.ForEvent("push"); !push.HasTask() || push.Task.Source != "Default" || push.HasPipeline() {
+		t.Fatal("Push should run the default task", push.Task, push.Pipeline)
+	}
+	if tag := w.ForEvent("tag"); tag.HasTask() || !tag.HasPipeline() || tag.Pipeline.Name != "release" {
+		t.Fatal("Tag should run its pipeline only", tag.Task, tag.Pipeline)
+	}
+	if release := w.ForEvent("release"); !release.HasTask() || release.Task.Source != "Release" {
+		t.Fatal("Release should run its task", release.Task)
+	}
+
+	w.SetEventTask("release", nil)
+	if release := w.ForEvent("release"); release.Task.Source != "Default" {
+		t.Fatal("Removed event task still used", release.Task)
+	}
+}
+
+func TestLegacyDefaults(t *testing.T) {
+	blob, err := utils.SerializeToString(&task.Task{Source: "Legacy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := NewWebHookFromMap(map[string]interface{}{"default_task": blob})
+	if !w.HasTask() || w.Task.Source != "Legacy" {
+		t.Fatal("Legacy task not decoded", w.Task)
+	}
+	if _, err := DecodeLegacyPipeline("Zm9v"); err == nil {
+		t.Fatal("Invalid blobs should fail decoding")
+	}
+}
+
+func TestSupersedePolicy(t *testing.T) {
+	w := NewWebHookFromMap(map[string]interface{}{"supersede": SUPERSEDE_CANCEL})
+	if !w.CancelsSuperseded() {
+		t.Error("The superseded builds should be cancelled")
+	}
+	if NewWebHook().CancelsSuperseded() {
+		t.Error("The superseded builds are kept by default")
+	}
+	if ValidateSupersede("") != nil || ValidateSupersede(SUPERSEDE_KEEP) != nil || ValidateSupersede("stop") == nil {
+		t.Error("Invalid policy validation")
+	}
+}
+
+func TestBranchBuilds(t *testing.T) {
+	wh := NewWebHook()
+	wh.SetBranchBuild("master", Build{Task: "1"})
+	wh.SetBranchBuild("feature/x", Build{Task: "2", Pipeline: "3"})
+
+	b, err := json.Marshal(wh.ToMap())
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := make(map[string]interface{})
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+	w := NewWebHookFromMap(doc)
+
+	if w.BranchBuilds["master"] != (Build{Task: "1"}) ||
+		w.BranchBuilds["feature/x"] != (Build{Task: "2", Pipeline: "3"}) {
+		t.Error("Invalid branch builds", w.BranchBuilds)
+	}
+}
+
+func TestNotifications(t *testing.T) {
+	wh := NewWebHook()
+	wh.Notifications = []task.Notification{{On: task.NOTIFY_ON_FIXED, Channel: task.NOTIFY_IRC, Target: "irc://irc.example.com/ci"}}
+
+	b, err := json.Marshal(wh.ToMap())
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := make(map[string]interface{})
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+	w := NewWebHookFromMap(doc)
+
+	if len(w.Notifications) != 1 || w.Notifications[0] != wh.Notifications[0] {
+		t.Error("Invalid notifications", w.Notifications)
+	}
+}
@@ -23,6 +23,7 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 package api
 
 import (
+	eventsapi "github.com/MottainaiCI/mottainai-server/routes/api/events"
 	namespacesapi "github.com/MottainaiCI/mottainai-server/routes/api/namespaces"
 	nodesapi "github.com/MottainaiCI/mottainai-server/routes/api/nodes"
 	apisecret "github.com/MottainaiCI/mottainai-server/routes/api/secret"
@@ -48,4 +49,5 @@ func Setup(m *macaron.Macaron) {
 	settingsroute.Setup(m)
 	apiwebhook.Setup(m)
 	apisecret.Setup(m)
+	eventsapi.Setup(m)
 }
@@ -0,0 +1,126 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package eventsapi
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/MottainaiCI/mottainai-server/pkg/context"
+	database "github.com/MottainaiCI/mottainai-server/pkg/db"
+	event "github.com/MottainaiCI/mottainai-server/pkg/event"
+)
+
+// Interval of the comments keeping idle streams open
+const STREAM_KEEPALIVE = 30 * time.Second
+
+func writeEvent(ctx *context.Context, e event.Event) error {
+	data, err := e.ToJson()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(ctx.Resp, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+	return err
+}
+
+// Stream sends the events of the server as Server-Sent Events. Clients
+// resume with the Last-Event-ID header (or the last_event_id parameter) and
+// select the event types with the types parameter, e.g. types=task,node.lost
+//
+// The events are kept by each server process: resuming after a restart or
+// against another replica gets a comment telling that events were lost.
+func Stream(ctx *context.Context, db *database.Database) {
+	if db.Events == nil {
+		ctx.NotFound()
+		return
+	}
+
+	types := event.ParseTypes(ctx.Query("types"))
+	lastID := ctx.Req.Header.Get("Last-Event-ID")
+	if len(lastID) == 0 {
+		lastID = ctx.Query("last_event_id")
+	}
+	var since uint64
+	if len(lastID) > 0 {
+		id, err := strconv.ParseUint(lastID, 10, 64)
+		if err != nil {
+			ctx.Error(400, "Invalid event ID: "+lastID)
+			return
+		}
+		since = id
+	}
+
+	// Subscribe before replaying, so no event is lost in between
+	sub := db.Events.Subscribe(types)
+	defer db.Events.Unsubscribe(sub)
+
+	ctx.Resp.Header().Set("Content-Type", "text/event-stream")
+	ctx.Resp.Header().Set("Cache-Control", "no-cache")
+	ctx.Resp.Header().Set("X-Accel-Buffering", "no")
+	ctx.Resp.WriteHeader(200)
+
+	sent := since
+	if since > 0 {
+		events, complete := db.Events.Since(since)
+		if !complete {
+			fmt.Fprint(ctx.Resp, ": some events were lost\n\n")
+		}
+		for _, e := range events {
+			if !e.Matches(types) {
+				continue
+			}
+			if writeEvent(ctx, e) != nil {
+				return
+			}
+			sent = e.ID
+		}
+	}
+	ctx.Resp.Flush()
+
+	keepalive := time.NewTicker(STREAM_KEEPALIVE)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-ctx.Req.Context().Done():
+			return
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(ctx.Resp, ": ping\n\n"); err != nil {
+				return
+			}
+		case e, ok := <-sub.C:
+			if !ok {
+				// Dropped by the bus, the client resumes from the last ID
+				return
+			}
+			if e.ID <= sent {
+				continue
+			}
+			if writeEvent(ctx, e) != nil {
+				return
+			}
+			sent = e.ID
+		}
+		ctx.Resp.Flush()
+	}
+}
@@ -0,0 +1,90 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package eventsapi
+
+import (
+	"errors"
+
+	"github.com/MottainaiCI/mottainai-server/pkg/context"
+	database "github.com/MottainaiCI/mottainai-server/pkg/db"
+	event "github.com/MottainaiCI/mottainai-server/pkg/event"
+)
+
+func Subscribe(sub event.Subscription, ctx *context.Context, db *database.Database) error {
+	sub.ID = ""
+	sub.OwnerId = ctx.User.ID
+	sub.LastEventID = 0
+	sub.LastError = ""
+	if err := sub.Validate(); err != nil {
+		ctx.ServerError("Failed creating subscription", err)
+		return err
+	}
+
+	id, err := db.Driver.InsertEventSubscription(&sub)
+	if err != nil {
+		ctx.ServerError("Failed creating subscription", err)
+		return err
+	}
+
+	ctx.APIPayload(id, "subscription", sub.Secret)
+	return nil
+}
+
+// Subscriptions lists the subscriptions of the user, all of them for the
+// admins. The secrets are never shown again.
+func Subscriptions(ctx *context.Context, db *database.Database) {
+	subs := make([]event.Subscription, 0)
+	for _, s := range db.Driver.AllEventSubscriptions() {
+		if s.OwnerId != ctx.User.ID && !ctx.User.IsAdmin() {
+			continue
+		}
+		s.Secret = ""
+		subs = append(subs, s)
+	}
+
+	ctx.JSON(200, subs)
+}
+
+func Unsubscribe(ctx *context.Context, db *database.Database) error {
+	id := ctx.Params(":id")
+
+	sub, err := db.Driver.GetEventSubscription(id)
+	if err != nil {
+		ctx.NotFound()
+		return err
+	}
+	if sub.OwnerId != ctx.User.ID && !ctx.User.IsAdmin() {
+		e := errors.New("Insufficient permission to remove subscription")
+		ctx.ServerError("Failed removing subscription", e)
+		return e
+	}
+
+	err = db.Driver.DeleteEventSubscription(id)
+	if err != nil {
+		ctx.ServerError("Failed removing subscription", err)
+		return err
+	}
+
+	ctx.APIActionSuccess()
+	return nil
+}
@@ -56,6 +56,7 @@ func NamespaceTag(ctx *context.Context, db *database.Database) error {
 	if err != nil {
 		return err
 	}
+	db.NamespaceTagged(name, task.ID, false)
 	// artefacts, err := db.Driver.GetTaskArtefacts(taskid)
 	// if err != nil {
 	// 	return "", err
@@ -113,6 +114,7 @@ func NamespaceAppend(ctx *context.Context, db *database.Database) error {
 	if err != nil {
 		return err
 	}
+	db.NamespaceTagged(name, task.ID, true)
 
 	ctx.APIActionSuccess()
 	return nil
@@ -42,6 +42,10 @@ func Setup(m *macaron.Macaron) {
 			ManagerRequired: true,
 			Config:          config,
 			BaseURL:         config.GetWeb().AppSubURL})
+		reqAdmin := context.Toggle(&context.ToggleOptions{
+			AdminRequired: true,
+			Config:        config,
+			BaseURL:       config.GetWeb().AppSubURL})
 
 		m.Group(config.GetWeb().GroupAppPath(), func() {
 			v1.Schema.GetNodeRoute("show_all").ToMacaron(m, reqSignIn, ShowAll)
@@ -51,6 +55,8 @@ func Setup(m *macaron.Macaron) {
 			v1.Schema.GetNodeRoute("show_tasks").ToMacaron(m, reqSignIn, reqManager, ShowTasks)
 
 			v1.Schema.GetNodeRoute("delete").ToMacaron(m, reqSignIn, reqManager, Remove)
+			v1.Schema.GetNodeRoute("drain").ToMacaron(m, reqSignIn, reqAdmin, Drain)
+			v1.Schema.GetNodeRoute("resume").ToMacaron(m, reqSignIn, reqAdmin, Resume)
 			v1.Schema.GetNodeRoute("register").ToMacaron(m, reqSignIn, reqManager, bind(NodeUpdate{}), Register)
 		})
 
@@ -30,12 +30,56 @@ import (
 
 	"github.com/MottainaiCI/mottainai-server/pkg/context"
 	database "github.com/MottainaiCI/mottainai-server/pkg/db"
+	"github.com/MottainaiCI/mottainai-server/pkg/event"
+	"github.com/MottainaiCI/mottainai-server/pkg/mottainai"
+	"github.com/MottainaiCI/mottainai-server/pkg/nodes"
 )
 
 type NodeUpdate struct {
 	NodeID   string `form:"nodeid" json:"nodeid"`
 	Key      string `json:"key" form:"key"`
 	Hostname string `json:"hostname" form:"hostname"`
+
+	Labels       []string `json:"labels" form:"labels"`
+	PrivateQueue string   `json:"private_queue" form:"private_queue"`
+
+	Version      string   `json:"version" form:"version"`
+	Executors    []string `json:"executors" form:"executors"`
+	Queues       []string `json:"queues" form:"queues"`
+	Concurrency  int      `json:"concurrency" form:"concurrency"`
+	RunningTasks []string `json:"running_tasks" form:"running_tasks"`
+	Load         float64  `json:"load" form:"load"`
+	DiskTotal    uint64   `json:"disk_total" form:"disk_total"`
+	DiskFree     uint64   `json:"disk_free" form:"disk_free"`
+	MemTotal     uint64   `json:"mem_total" form:"mem_total"`
+	MemAvailable uint64   `json:"mem_available" form:"mem_available"`
+}
+
+func (n *NodeUpdate) Report(t string) nodes.NodeReport {
+	queues := make(map[string]int)
+	for _, q := range n.Queues {
+		kv := strings.SplitN(q, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		if c, err := strconv.Atoi(kv[1]); err == nil {
+			queues[kv[0]] = c
+		}
+	}
+
+	return nodes.NodeReport{
+		Time:         t,
+		Version:      n.Version,
+		Executors:    n.Executors,
+		Queues:       queues,
+		Concurrency:  n.Concurrency,
+		RunningTasks: n.RunningTasks,
+		Load:         n.Load,
+		DiskTotal:    n.DiskTotal,
+		DiskFree:     n.DiskFree,
+		MemTotal:     n.MemTotal,
+		MemAvailable: n.MemAvailable,
+	}
 }
 
 func Register(nodedata NodeUpdate, ctx *context.Context, db *database.Database) error {
@@ -64,12 +108,58 @@ func Register(nodedata NodeUpdate, ctx *context.Context, db *database.Database)
 	}
 
 	hb := time.Now().Format("20060102150405")
+	report := nodedata.Report(hb)
 	db.Driver.UpdateNode(nodefound.ID, map[string]interface{}{
-		"nodeid":      nodeid,
-		"hostname":    hostname,
-		"last_report": hb,
+		"nodeid":        nodeid,
+		"hostname":      hostname,
+		"last_report":   hb,
+		"labels":        nodes.ParseLabels(nodedata.Labels),
+		"private_queue": nodedata.PrivateQueue,
+		"report":        report,
+		"history":       nodes.AppendReport(nodefound.History, report),
+	})
+	reported := nodefound
+	reported.NodeID, reported.Hostname = nodeid, hostname
+	mottainai.NodeReported(db, reported)
+
+	status := "ok"
+	if nodefound.Draining {
+		status = nodes.NODE_STATUS_DRAINING
+	}
+
+	ctx.APIEventReport(event.APIResponse{
+		Data:      strings.Join([]string{strconv.Itoa(len(n)), strconv.Itoa(pos)}, ","),
+		Processed: "true",
+		Status:    status,
 	})
+	return nil
+}
+
+// SetDraining marks the node as draining: the agent completes the
+// running tasks and sends the new ones back to the queue.
+func SetDraining(ctx *context.Context, db *database.Database, draining bool) error {
+	id := ctx.Params(":id")
+	if _, err := db.Driver.GetNode(id); err != nil {
+		return err
+	}
+
+	return db.Driver.UpdateNode(id, map[string]interface{}{
+		"draining": draining,
+	})
+}
+
+func Drain(ctx *context.Context, db *database.Database) error {
+	if err := SetDraining(ctx, db, true); err != nil {
+		return err
+	}
+	ctx.APIActionSuccess()
+	return nil
+}
 
-	ctx.APIEventData(strings.Join([]string{strconv.Itoa(len(n)), strconv.Itoa(pos)}, ","))
+func Resume(ctx *context.Context, db *database.Database) error {
+	if err := SetDraining(ctx, db, false); err != nil {
+		return err
+	}
+	ctx.APIActionSuccess()
 	return nil
 }
@@ -0,0 +1,60 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package stats
+
+import (
+	"errors"
+
+	context "github.com/MottainaiCI/mottainai-server/pkg/context"
+	leader "github.com/MottainaiCI/mottainai-server/pkg/leader"
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+)
+
+type LeaderInfo struct {
+	// Replica answering the request
+	Replica  string `json:"replica"`
+	IsLeader bool   `json:"is_leader"`
+	// Current holder of the periodic jobs lease, empty if no replica holds it
+	Leader  string `json:"leader"`
+	Expires string `json:"expires"`
+}
+
+func Leader(ctx *context.Context) {
+	_, err := ctx.Invoke(func(e *leader.Elector) {
+		lease, err := e.Leader()
+		if err != nil {
+			ctx.ServerError("Failed getting the leader", err)
+			return
+		}
+
+		info := &LeaderInfo{Replica: e.ID, IsLeader: e.IsLeader()}
+		if len(lease.Holder) > 0 && !lease.Expired() {
+			info.Leader = lease.Holder
+			info.Expires = lease.ExpiresAt().UTC().Format(setting.Timeformat)
+		}
+		ctx.JSON(200, info)
+	})
+	if err != nil {
+		ctx.ServerError("Leader election is not running", errors.New("No elector available"))
+	}
+}
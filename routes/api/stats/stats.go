@@ -133,6 +133,7 @@ func Setup(m *macaron.Macaron) {
 	m.Invoke(func(config *setting.Config) {
 		m.Group(config.GetWeb().GroupAppPath(), func() {
 			v1.Schema.GetStatsRoute("info").ToMacaron(m, Info)
+			v1.Schema.GetStatsRoute("leader").ToMacaron(m, Leader)
 		})
 	})
 }
@@ -31,7 +31,6 @@ import (
 	"github.com/ghodss/yaml"
 
 	database "github.com/MottainaiCI/mottainai-server/pkg/db"
-	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
 	task "github.com/MottainaiCI/mottainai-server/pkg/tasks"
 
 	"github.com/MottainaiCI/mottainai-server/pkg/context"
@@ -137,6 +136,9 @@ func Pipeline(m *mottainai.Mottainai, c *cron.Cron, ctx *context.Context, db *da
 	}
 
 	opts := o.Pipeline
+	if err := task.ValidateBadges(opts.Badges); err != nil {
+		return err
+	}
 	opts.Tasks = tasks
 	opts.Reset()
 	// XX: aggiornare i task!
@@ -150,36 +152,18 @@ func Pipeline(m *mottainai.Mottainai, c *cron.Cron, ctx *context.Context, db *da
 			ctx.NoPermission()
 			return nil
 		}
-		f.Status = setting.TASK_STATE_WAIT
-
-		id, err := db.Driver.CreateTask(f.ToMap())
-		if err != nil {
-			return err
-		}
-		f.ID = id
 		opts.Tasks[i] = f
 	}
 	if ctx.IsLogged {
 		opts.Owner = ctx.User.ID
 	}
+	opts.PlanID = ""
 
-	fields := opts.ToMap(false)
-
-	docID, err := db.Driver.CreatePipeline(fields)
+	docID, err := db.CreatePipelineWithTasks(opts)
 	if err != nil {
 		return err
 	}
 
-	// Update pipeline ID in every tasks
-	for _, t := range opts.Tasks {
-		err := db.Driver.UpdateTask(t.ID, map[string]interface{}{
-			"pipeline_id": docID,
-		})
-		if err != nil {
-			return err
-		}
-	}
-
 	m.ProcessPipeline(docID)
 
 	ctx.APICreationSuccess(docID, "pipeline")
@@ -23,7 +23,10 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 package tasksapi
 
 import (
+	"bytes"
+	"encoding/gob"
 	"errors"
+	"time"
 
 	database "github.com/MottainaiCI/mottainai-server/pkg/db"
 	agenttasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
@@ -56,6 +59,9 @@ func PlannedTask(ctx *context.Context, db *database.Database) error {
 
 func Plan(m *mottainai.Mottainai, c *cron.Cron, ctx *context.Context, db *database.Database, opts agenttasks.Plan) error {
 	opts.Reset()
+	opts.LastRun = ""
+	opts.LastTask = ""
+	opts.NextRun = opts.NextRunAfter(time.Now())
 	fields := opts.ToMap()
 
 	if !ctx.CheckNamespaceBelongs(opts.TagNamespace) || !ctx.CheckPlanPermissions(&opts) {
@@ -63,6 +69,15 @@ func Plan(m *mottainai.Mottainai, c *cron.Cron, ctx *context.Context, db *databa
 		return nil
 	}
 
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	if opts.HasTemplate() {
+		if err := CheckTaskTemplateRef(ctx, db, opts.Template, opts.TemplateParams); err != nil {
+			return err
+		}
+	}
+
 	docID, err := db.Driver.CreatePlan(fields)
 	if err != nil {
 		return err
@@ -74,6 +89,60 @@ func Plan(m *mottainai.Mottainai, c *cron.Cron, ctx *context.Context, db *databa
 	return nil
 }
 
+func PipelinePlan(m *mottainai.Mottainai, ctx *context.Context, db *database.Database, o agenttasks.PipelinePlanForm) error {
+	var tasks map[string]agenttasks.Task
+
+	if o.PipelineForm == nil || o.Pipeline == nil {
+		return errors.New("No pipeline supplied")
+	}
+	d := gob.NewDecoder(bytes.NewBuffer([]byte(o.PipelineForm.Tasks)))
+	if err := d.Decode(&tasks); err != nil {
+		return err
+	}
+
+	pip := o.Pipeline
+	if err := agenttasks.ValidateBadges(pip.Badges); err != nil {
+		return err
+	}
+	pip.Tasks = tasks
+	pip.ID = ""
+	pip.PlanID = ""
+	for _, t := range pip.Tasks {
+		if !ctx.CheckNamespaceBelongs(t.TagNamespace) {
+			ctx.NoPermission()
+			return nil
+		}
+	}
+
+	plan := agenttasks.Plan{
+		Task:          &agenttasks.Task{Name: pip.Name},
+		Planned:       o.Planned,
+		Timezone:      o.Timezone,
+		OverlapPolicy: o.OverlapPolicy,
+		CatchUpPolicy: o.CatchUpPolicy,
+		Pipeline:      pip,
+	}
+	plan.Reset()
+	if ctx.IsLogged {
+		plan.Owner = ctx.User.ID
+	}
+	plan.NextRun = plan.NextRunAfter(time.Now())
+
+	if err := plan.Validate(); err != nil {
+		return err
+	}
+
+	docID, err := db.Driver.CreatePlan(plan.ToMap())
+	if err != nil {
+		return err
+	}
+
+	m.ReloadCron()
+
+	ctx.APICreationSuccess(docID, "plan")
+	return nil
+}
+
 func PlanDeleteById(id string, db *database.Database, m *mottainai.Mottainai, ctx *context.Context) error {
 	plan, err := db.Driver.GetPlan(db.Config, id)
 	if err != nil {
@@ -102,3 +171,47 @@ func PlanDelete(m *mottainai.Mottainai, ctx *context.Context, db *database.Datab
 	ctx.APIActionSuccess()
 	return nil
 }
+
+// PlanRunsPipeline returns true if the runs of the plan are pipelines,
+// following the template of the plan if any.
+func PlanRunsPipeline(db *database.Database, plan agenttasks.Plan) bool {
+	if plan.HasTemplate() {
+		tmpl, err := db.GetTaskTemplateByRef(plan.Template)
+		return err == nil && tmpl.IsPipeline()
+	}
+	return plan.IsPipeline()
+}
+
+// PlanRun runs the plan now, returning the plan and the ID of the task or
+// pipeline created.
+func PlanRun(m *mottainai.Mottainai, ctx *context.Context, db *database.Database) (agenttasks.Plan, string, error) {
+	id := ctx.Params(":id")
+	plan, err := db.Driver.GetPlan(db.Config, id)
+	if err != nil {
+		return plan, "", err
+	}
+
+	if !ctx.CheckNamespaceBelongs(plan.TagNamespace) || !ctx.CheckPlanPermissions(&plan) {
+		return plan, "", errors.New("Moar permissions are required for this user")
+	}
+
+	docID, err := m.RunPlan(id)
+	return plan, docID, err
+}
+
+func APIPlanRun(m *mottainai.Mottainai, ctx *context.Context, db *database.Database) error {
+	plan, docID, err := PlanRun(m, ctx, db)
+	if err == mottainai.ErrPlanOverlap {
+		ctx.Conflict(err)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if PlanRunsPipeline(db, plan) {
+		ctx.APICreationSuccess(docID, "pipeline")
+	} else {
+		ctx.APICreationSuccess(docID, "task")
+	}
+	return nil
+}
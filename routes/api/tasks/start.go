@@ -33,8 +33,12 @@ import (
 
 func APISendStartTask(m *mottainai.Mottainai, ctx *context.Context, db *database.Database) {
 	err := SendStartTask(m, ctx, db)
-	if err != nil {
+	if database.IsConflict(err) {
+		ctx.Conflict(err)
+		return
+	} else if err != nil {
 		ctx.ServerError("Failed starting task", err)
+		return
 	}
 	ctx.APIActionSuccess()
 }
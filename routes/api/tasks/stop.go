@@ -32,8 +32,12 @@ import (
 
 func APIStop(ctx *context.Context, db *database.Database) {
 	err := Stop(ctx, db)
-	if err != nil {
+	if database.IsConflict(err) {
+		ctx.Conflict(err)
+		return
+	} else if err != nil {
 		ctx.ServerError("Failed stopping task", err)
+		return
 	}
 	ctx.APIActionSuccess()
 }
@@ -54,10 +58,10 @@ func Stop(ctx *context.Context, db *database.Database) error {
 	if !ctx.CheckTaskPermissions(&mytask) {
 		return errors.New("More permissions required")
 	}
-	err = db.Driver.UpdateTask(id, map[string]interface{}{
-		"status": "stop",
-	})
-	if err != nil {
+	err = db.StopTask(id)
+	if database.IsConflict(err) {
+		return err
+	} else if err != nil {
 		return errors.New("Failed updating database")
 	}
 	//ctx.Redirect("/tasks")
@@ -47,7 +47,7 @@ func Setup(m *macaron.Macaron) {
 			v1.Schema.GetTaskRoute("as_yaml").ToMacaron(m, GetTaskYaml) // TEMP: For now, as js  calls aren't with auth
 			v1.Schema.GetTaskRoute("stream_output").ToMacaron(m, StreamOutputTask)
 			v1.Schema.GetTaskRoute("tail_output").ToMacaron(m, TailTask)
-			v1.Schema.GetTaskRoute("start").ToMacaron(m, reqSignIn, SendStartTask)
+			v1.Schema.GetTaskRoute("start").ToMacaron(m, reqSignIn, APISendStartTask)
 			v1.Schema.GetTaskRoute("clone").ToMacaron(m, reqSignIn, CloneTask)
 			v1.Schema.GetTaskRoute("status").ToMacaron(m, reqSignIn, APIShowTaskByStatus)
 			v1.Schema.GetTaskRoute("stop").ToMacaron(m, reqSignIn, APIStop)
@@ -61,10 +61,18 @@ func Setup(m *macaron.Macaron) {
 			v1.Schema.GetTaskRoute("artefact_upload").ToMacaron(m, reqSignIn, binding.MultipartForm(ArtefactForm{}), ArtefactUpload)
 
 			v1.Schema.GetTaskRoute("create_plan").ToMacaron(m, reqSignIn, bind(agenttasks.Plan{}), Plan)
+			v1.Schema.GetTaskRoute("create_pipeline_plan").ToMacaron(m, reqSignIn, bind(agenttasks.PipelinePlanForm{}), PipelinePlan)
 			v1.Schema.GetTaskRoute("plan_list").ToMacaron(m, reqSignIn, PlannedTasks)
 			v1.Schema.GetTaskRoute("plan_delete").ToMacaron(m, reqSignIn, PlanDelete)
+			v1.Schema.GetTaskRoute("plan_run").ToMacaron(m, reqSignIn, APIPlanRun)
 			v1.Schema.GetTaskRoute("plan_show").ToMacaron(m, reqSignIn, PlannedTask)
 
+			v1.Schema.GetTaskRoute("create_template").ToMacaron(m, reqSignIn, binding.Json(agenttasks.TaskTemplate{}), TaskTemplateCreate)
+			v1.Schema.GetTaskRoute("template_list").ToMacaron(m, reqSignIn, TaskTemplates)
+			v1.Schema.GetTaskRoute("template_delete").ToMacaron(m, reqSignIn, TaskTemplateDelete)
+			v1.Schema.GetTaskRoute("template_run").ToMacaron(m, reqSignIn, APITaskTemplateRun)
+			v1.Schema.GetTaskRoute("template_show").ToMacaron(m, reqSignIn, TaskTemplateShow)
+
 			v1.Schema.GetTaskRoute("create_pipeline").ToMacaron(m, reqSignIn, bind(agenttasks.PipelineForm{}), Pipeline)
 			v1.Schema.GetTaskRoute("pipeline_list").ToMacaron(m, reqSignIn, ShowAllPipelines)
 			v1.Schema.GetTaskRoute("pipeline_delete").ToMacaron(m, reqSignIn, PipelineDelete)
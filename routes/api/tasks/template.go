@@ -0,0 +1,224 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package tasksapi
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/MottainaiCI/mottainai-server/pkg/context"
+	database "github.com/MottainaiCI/mottainai-server/pkg/db"
+	"github.com/MottainaiCI/mottainai-server/pkg/mottainai"
+	agenttasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+)
+
+// Form fields which aren't template parameters
+var templateFormFields = map[string]bool{"_csrf": true}
+
+func AllTaskTemplates(db *database.Database) []agenttasks.TaskTemplate {
+	templates := db.Driver.AllTaskTemplates()
+	sort.Slice(templates, func(i, j int) bool {
+		if templates[i].Name == templates[j].Name {
+			return templates[i].Version > templates[j].Version
+		}
+		return templates[i].Name < templates[j].Name
+	})
+	return templates
+}
+
+func TaskTemplates(ctx *context.Context, db *database.Database) {
+	ctx.JSON(200, AllTaskTemplates(db))
+}
+
+func TaskTemplateShow(ctx *context.Context, db *database.Database) error {
+	tmpl, err := db.GetTaskTemplateByRef(ctx.Params(":id"))
+	if err != nil {
+		ctx.NotFound()
+		return nil
+	}
+
+	ctx.JSON(200, tmpl)
+	return nil
+}
+
+func TaskTemplateCreate(ctx *context.Context, db *database.Database, tmpl agenttasks.TaskTemplate) error {
+	tmpl.ID = ""
+	if ctx.IsLogged {
+		tmpl.Owner = ctx.User.ID
+	}
+
+	if err := tmpl.Validate(); err != nil {
+		return err
+	}
+
+	// Creating a new version of a template needs the same permissions of
+	// removing the previous ones
+	if templates, err := db.Driver.GetTaskTemplatesByName(tmpl.Name); err == nil {
+		for _, t := range templates {
+			if !ctx.CheckTaskTemplatePermissions(&t) {
+				return nil
+			}
+		}
+	}
+
+	docID, err := db.CreateTaskTemplateVersion(&tmpl)
+	if err != nil {
+		return err
+	}
+
+	ctx.APICreationSuccess(docID, "template")
+	return nil
+}
+
+func TaskTemplateDelete(ctx *context.Context, db *database.Database) error {
+	id := ctx.Params(":id")
+	tmpl, err := db.Driver.GetTaskTemplate(id)
+	if err != nil {
+		ctx.NotFound()
+		return nil
+	}
+
+	if !ctx.CheckTaskTemplatePermissions(&tmpl) {
+		return nil
+	}
+
+	if err := db.Driver.DeleteTaskTemplate(id); err != nil {
+		return err
+	}
+
+	ctx.APIActionSuccess()
+	return nil
+}
+
+// TemplateFormParams returns the template parameters sent in the request
+// form.
+func TemplateFormParams(ctx *context.Context) (map[string]string, error) {
+	params := make(map[string]string)
+	if err := ctx.Req.ParseForm(); err != nil {
+		return params, err
+	}
+	for k, v := range ctx.Req.Form {
+		if !templateFormFields[k] && len(v) > 0 {
+			params[k] = v[len(v)-1]
+		}
+	}
+	return params, nil
+}
+
+// CheckTaskTemplateRef checks that the template referenced by a plan exists
+// and can be instantiated with the given parameters, and that the user can
+// publish to the namespaces of the tasks created.
+func CheckTaskTemplateRef(ctx *context.Context, db *database.Database, ref, params string) error {
+	tmpl, err := db.GetTaskTemplateByRef(ref)
+	if err != nil {
+		return err
+	}
+	p, err := agenttasks.ParseTemplateParams(params)
+	if err != nil {
+		return err
+	}
+	tasks, err := tmpl.NewTasks(p)
+	if err != nil {
+		return err
+	}
+	for _, t := range tasks {
+		if !ctx.CheckNamespaceBelongs(t.TagNamespace) {
+			return errors.New("More permissions required")
+		}
+	}
+	return nil
+}
+
+// TaskTemplateRun instantiates the template with the given parameters and
+// sends the task, or the pipeline, created. It returns the template and the
+// ID of the task or pipeline.
+func TaskTemplateRun(m *mottainai.Mottainai, ctx *context.Context, db *database.Database, ref string, params map[string]string) (agenttasks.TaskTemplate, string, error) {
+	tmpl, err := db.GetTaskTemplateByRef(ref)
+	if err != nil {
+		return tmpl, "", err
+	}
+
+	var owner string
+	if ctx.IsLogged {
+		owner = ctx.User.ID
+	}
+
+	if tmpl.IsPipeline() {
+		pip, err := tmpl.NewPipeline(params)
+		if err != nil {
+			return tmpl, "", err
+		}
+		pip.Owner = owner
+		for name, t := range pip.Tasks {
+			if !ctx.CheckNamespaceBelongs(t.TagNamespace) {
+				return tmpl, "", errors.New("More permissions required")
+			}
+			t.Owner = owner
+			pip.Tasks[name] = t
+		}
+
+		docID, err := db.CreatePipelineWithTasks(pip)
+		if err != nil {
+			return tmpl, "", err
+		}
+		m.ProcessPipeline(docID)
+		return tmpl, docID, nil
+	}
+
+	task, err := tmpl.NewTask(params)
+	if err != nil {
+		return tmpl, "", err
+	}
+	task.Owner = owner
+	if !ctx.CheckNamespaceBelongs(task.TagNamespace) {
+		return tmpl, "", errors.New("More permissions required")
+	}
+
+	docID, err := db.Driver.InsertTask(task)
+	if err != nil {
+		return tmpl, "", err
+	}
+	if _, err := m.SendTask(docID); err != nil {
+		return tmpl, "", err
+	}
+	return tmpl, docID, nil
+}
+
+func APITaskTemplateRun(m *mottainai.Mottainai, ctx *context.Context, db *database.Database) error {
+	params, err := TemplateFormParams(ctx)
+	if err != nil {
+		return err
+	}
+
+	tmpl, docID, err := TaskTemplateRun(m, ctx, db, ctx.Params(":id"), params)
+	if err != nil {
+		return err
+	}
+
+	if tmpl.IsPipeline() {
+		ctx.APICreationSuccess(docID, "pipeline")
+	} else {
+		ctx.APICreationSuccess(docID, "task")
+	}
+	return nil
+}
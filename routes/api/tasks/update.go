@@ -31,6 +31,8 @@ import (
 
 	"github.com/MottainaiCI/mottainai-server/pkg/context"
 	database "github.com/MottainaiCI/mottainai-server/pkg/db"
+	"github.com/MottainaiCI/mottainai-server/pkg/mottainai"
+	agenttasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
 )
 
 type UpdateTaskForm struct {
@@ -50,7 +52,31 @@ func SyncTaskLastUpdate(id string, db *database.Database) {
 	})
 }
 
-func UpdateTaskField(f UpdateTaskForm, ctx *context.Context, db *database.Database) {
+// releaseNamespace sends the tasks queued behind the namespace of a task
+// which just ended.
+func releaseNamespace(m *mottainai.Mottainai, task agenttasks.Task, status string) {
+	if len(task.TagNamespace) > 0 && agenttasks.IsFinalState(status) {
+		go m.ReleaseNamespaces(task.TagNamespace)
+	}
+}
+
+// handleStatus publishes the artefacts of a task which ended successfully
+// to its namespace.
+func handleStatus(db *database.Database, t agenttasks.Task) {
+	t.HandleStatus(db.Config.GetStorage().NamespacePath, db.Config.GetStorage().ArtefactPath)
+	if t.IsDone() && t.IsSuccess() && len(t.TagNamespace) > 0 {
+		db.NamespaceTagged(t.TagNamespace, t.ID, t.IsPublishAppendMode())
+	}
+}
+
+// notifyTask sends the notifications of a task which just ended.
+func notifyTask(m *mottainai.Mottainai, task agenttasks.Task, status string) {
+	if agenttasks.IsFinalState(status) {
+		go m.NotifyTask(task.ID)
+	}
+}
+
+func UpdateTaskField(m *mottainai.Mottainai, f UpdateTaskForm, ctx *context.Context, db *database.Database) {
 	mytask, err := db.Driver.GetTask(db.Config, f.Id)
 	if err != nil {
 		ctx.ServerError("Failed getting task", err)
@@ -61,9 +87,26 @@ func UpdateTaskField(f UpdateTaskForm, ctx *context.Context, db *database.Databa
 		return
 	}
 	if len(f.Field) > 0 && len(f.Value) > 0 {
-		db.Driver.UpdateTask(f.Id, map[string]interface{}{
-			f.Field: f.Value,
-		})
+		switch f.Field {
+		case "status":
+			// Status changes have to follow the task state machine
+			if err := db.TransitionTask(f.Id, f.Value, nil); database.IsConflict(err) {
+				ctx.Conflict(err)
+				return
+			} else if err != nil {
+				ctx.ServerError("Failed updating task", err)
+				return
+			}
+			releaseNamespace(m, mytask, f.Value)
+			notifyTask(m, mytask, f.Value)
+		case "revision":
+			ctx.Conflict(errors.New("The task revision can't be set"))
+			return
+		default:
+			db.Driver.UpdateTask(f.Id, map[string]interface{}{
+				f.Field: f.Value,
+			})
+		}
 		// Set state once we have task's exit status
 		if f.Field == "exit_status" {
 
@@ -84,7 +127,7 @@ func UpdateTaskField(f UpdateTaskForm, ctx *context.Context, db *database.Databa
 					ctx.ServerError("Failed getting task", err)
 					return
 				}
-				t.HandleStatus(db.Config.GetStorage().NamespacePath, db.Config.GetStorage().ArtefactPath)
+				handleStatus(db, t)
 			}
 		}
 
@@ -145,32 +188,37 @@ func AppendToTask(logger *logging.Logger, f UpdateTaskForm, ctx *context.Context
 	return nil
 }
 
-func UpdateTask(f UpdateTaskForm, ctx *context.Context, db *database.Database) error {
-
-	if len(f.Status) > 0 {
-		db.Driver.UpdateTask(f.Id, map[string]interface{}{
-			"status": f.Status,
-		})
-	}
-
+func UpdateTask(m *mottainai.Mottainai, f UpdateTaskForm, ctx *context.Context, db *database.Database) error {
+	var err error
+	fields := make(map[string]interface{})
 	if len(f.Output) > 0 {
-		db.Driver.UpdateTask(f.Id, map[string]interface{}{
-			"output": f.Output,
-		})
+		fields["output"] = f.Output
 	}
-
 	if len(f.Result) > 0 {
-		db.Driver.UpdateTask(f.Id, map[string]interface{}{
-			"result":   f.Result,
-			"end_time": time.Now().Format("20060102150405"),
-		})
+		fields["result"] = f.Result
+		fields["end_time"] = time.Now().Format("20060102150405")
+	}
+
+	if len(f.Status) > 0 {
+		// Result and output are updated together with the status
+		err = db.TransitionTask(f.Id, f.Status, fields)
+	} else if len(fields) > 0 {
+		err = db.Driver.UpdateTask(f.Id, fields)
+	}
+	if database.IsConflict(err) {
+		ctx.Conflict(err)
+		return nil
+	} else if err != nil {
+		return err
 	}
 
 	t, err := db.Driver.GetTask(db.Config, f.Id)
 	if err != nil {
 		return errors.New("Task not found")
 	}
-	t.HandleStatus(db.Config.GetStorage().NamespacePath, db.Config.GetStorage().ArtefactPath)
+	handleStatus(db, t)
+	releaseNamespace(m, t, f.Status)
+	notifyTask(m, t, f.Status)
 	SyncTaskLastUpdate(f.Id, db)
 	ctx.APIActionSuccess()
 	return nil
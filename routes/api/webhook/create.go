@@ -37,7 +37,9 @@ func CreateWebHook(ctx *context.Context, db *database.Database) (*webhook.WebHoo
 
 	webtype := ctx.Params(":type")
 
-	if webtype != "github" && webtype != "gitlab" {
+	switch webtype {
+	case "github", "gitlab", "gitea", "forgejo", "bitbucket", "generic":
+	default:
 		err = errors.New("Invalid webtype")
 		ctx.ServerError("Failed creating webhook", err)
 		return t, err
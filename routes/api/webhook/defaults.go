@@ -0,0 +1,163 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package apiwebhook
+
+import (
+	"errors"
+
+	"github.com/MottainaiCI/mottainai-server/pkg/context"
+	database "github.com/MottainaiCI/mottainai-server/pkg/db"
+	agenttasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+	webhook "github.com/MottainaiCI/mottainai-server/pkg/webhook"
+	"github.com/ghodss/yaml"
+)
+
+// getOwnedWebHook returns the webhook in the :id parameter, if the user
+// owns it or is an admin.
+func getOwnedWebHook(ctx *context.Context, db *database.Database) (*webhook.WebHook, error) {
+	w, err := db.Driver.GetWebHook(ctx.Params(":id"))
+	if err != nil {
+		ctx.NotFound()
+		return nil, err
+	}
+	if !ctx.IsLogged || (w.OwnerId != ctx.User.ID && !ctx.User.IsAdmin()) {
+		ctx.NoPermission()
+		return nil, errors.New("Insufficient permission to access webhook")
+	}
+	return &w, nil
+}
+
+func renderDefault(ctx *context.Context, o interface{}, asYaml bool) error {
+	if !asYaml {
+		ctx.JSON(200, o)
+		return nil
+	}
+	y, err := yaml.Marshal(o)
+	if err != nil {
+		ctx.ServerError("Failed rendering webhook", err)
+		return err
+	}
+	ctx.Resp.Header().Set("Content-Type", "application/yaml")
+	ctx.Resp.Write(y)
+	return nil
+}
+
+func showTaskDefault(ctx *context.Context, db *database.Database, asYaml bool) error {
+	w, err := getOwnedWebHook(ctx, db)
+	if err != nil {
+		return nil
+	}
+	t, err := w.EventDefaults(ctx.Query("event")).ReadTask()
+	if err != nil {
+		ctx.NotFound()
+		return nil
+	}
+	return renderDefault(ctx, t, asYaml)
+}
+
+func showPipelineDefault(ctx *context.Context, db *database.Database, asYaml bool) error {
+	w, err := getOwnedWebHook(ctx, db)
+	if err != nil {
+		return nil
+	}
+	p, err := w.EventDefaults(ctx.Query("event")).ReadPipeline()
+	if err != nil {
+		ctx.NotFound()
+		return nil
+	}
+	return renderDefault(ctx, p, asYaml)
+}
+
+func ShowTaskDefault(ctx *context.Context, db *database.Database) error {
+	return showTaskDefault(ctx, db, false)
+}
+
+func ShowTaskDefaultYaml(ctx *context.Context, db *database.Database) error {
+	return showTaskDefault(ctx, db, true)
+}
+
+func ShowPipelineDefault(ctx *context.Context, db *database.Database) error {
+	return showPipelineDefault(ctx, db, false)
+}
+
+func ShowPipelineDefaultYaml(ctx *context.Context, db *database.Database) error {
+	return showPipelineDefault(ctx, db, true)
+}
+
+// PutTaskDefault replaces the default task of the webhook, or the one of the
+// kind of events in the event parameter, with the YAML or JSON document in
+// the request body.
+func PutTaskDefault(ctx *context.Context, db *database.Database) error {
+	w, err := getOwnedWebHook(ctx, db)
+	if err != nil {
+		return nil
+	}
+	data, err := ctx.Req.Body().Bytes()
+	if err != nil {
+		ctx.ServerError("Failed reading webhook task", err)
+		return err
+	}
+	t, err := agenttasks.NewTaskFromYaml(data)
+	if err != nil {
+		ctx.ServerError("Invalid webhook task", err)
+		return err
+	}
+	t.Reset()
+	w.SetEventTask(ctx.Query("event"), t)
+
+	if err := db.Driver.UpdateWebHook(w.ID, w.ToMap()); err != nil {
+		ctx.ServerError("Failed updating webhook task", err)
+		return err
+	}
+	ctx.APIActionSuccess()
+	return nil
+}
+
+// PutPipelineDefault replaces the default pipeline of the webhook, or the one
+// of the kind of events in the event parameter, with the YAML or JSON
+// document in the request body.
+func PutPipelineDefault(ctx *context.Context, db *database.Database) error {
+	w, err := getOwnedWebHook(ctx, db)
+	if err != nil {
+		return nil
+	}
+	data, err := ctx.Req.Body().Bytes()
+	if err != nil {
+		ctx.ServerError("Failed reading webhook pipeline", err)
+		return err
+	}
+	p, err := agenttasks.NewPipelineFromYaml(data)
+	if err != nil {
+		ctx.ServerError("Invalid webhook pipeline", err)
+		return err
+	}
+	p.Reset()
+	w.SetEventPipeline(ctx.Query("event"), p)
+
+	if err := db.Driver.UpdateWebHook(w.ID, w.ToMap()); err != nil {
+		ctx.ServerError("Failed updating webhook pipeline", err)
+		return err
+	}
+	ctx.APIActionSuccess()
+	return nil
+}
@@ -50,7 +50,7 @@ func DeleteTaskWebHook(ctx *context.Context, db *database.Database) error {
 		ctx.ServerError("Failed removing webhook task", e)
 		return e
 	}
-	webhook.Task = ""
+	webhook.SetEventTask(ctx.Query("event"), nil)
 	err = db.Driver.UpdateWebHook(id, webhook.ToMap())
 	if err != nil {
 		ctx.ServerError("Failed deleting webhook task", err)
@@ -79,7 +79,7 @@ func DeletePipelineWebHook(ctx *context.Context, db *database.Database) error {
 		ctx.ServerError("Failed removing webhook pipeline", e)
 		return e
 	}
-	webhook.Pipeline = ""
+	webhook.SetEventPipeline(ctx.Query("event"), nil)
 	err = db.Driver.UpdateWebHook(id, webhook.ToMap())
 	if err != nil {
 		ctx.ServerError("Failed deleting webhook pipeline", err)
@@ -29,6 +29,7 @@ import (
 
 	"github.com/MottainaiCI/mottainai-server/pkg/context"
 	agenttasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+	mhook "github.com/MottainaiCI/mottainai-server/pkg/webhook"
 
 	database "github.com/MottainaiCI/mottainai-server/pkg/db"
 )
@@ -128,9 +129,51 @@ func UpdateWebHook(upd WebhookUpdate, ctx *context.Context, db *database.Databas
 		return e
 	}
 
+	if upd.Key == "default_task" || upd.Key == "default_pipeline" {
+		err := errors.New("The default task and pipeline can't be set as fields")
+		ctx.ServerError("Failed updating webhook", err)
+		return err
+	}
+	if upd.Key == "template" && len(upd.Value) > 0 {
+		if _, err := db.GetTaskTemplateByRef(upd.Value); err != nil {
+			ctx.ServerError("Failed updating webhook", err)
+			return err
+		}
+	}
+
+	if upd.Key == "mapping" {
+		if _, err := mhook.ParseMapping(upd.Value); err != nil {
+			ctx.ServerError("Failed updating webhook", err)
+			return err
+		}
+	}
+
+	if upd.Key == "supersede" {
+		if err := mhook.ValidateSupersede(upd.Value); err != nil {
+			ctx.ServerError("Failed updating webhook", err)
+			return err
+		}
+	}
+
+	if upd.Key == "badges" {
+		if err := agenttasks.ValidateBadges(upd.Value); err != nil {
+			ctx.ServerError("Failed updating webhook", err)
+			return err
+		}
+	}
+
 	values := webhook.ToMap()
 	values[upd.Key] = upd.Value
 
+	if upd.Key == "notifications" {
+		notifications, err := agenttasks.ParseNotifications(upd.Value)
+		if err != nil {
+			ctx.ServerError("Failed updating webhook", err)
+			return err
+		}
+		values[upd.Key] = agenttasks.NotificationsToMap(notifications)
+	}
+
 	err = db.Driver.UpdateWebHook(id, values)
 	if err != nil {
 		ctx.ServerError("Failed updating webhook", err)
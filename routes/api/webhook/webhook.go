@@ -67,6 +67,12 @@ func Setup(m *macaron.Macaron) {
 			v1.Schema.GetWebHookRoute("delete_task").ToMacaron(m, RequiresWebHookSetting, reqSignIn, DeleteTask)
 			v1.Schema.GetWebHookRoute("delete_pipeline").ToMacaron(m, RequiresWebHookSetting, reqSignIn, DeletePipeline)
 			v1.Schema.GetWebHookRoute("set_field").ToMacaron(m, RequiresWebHookSetting, reqSignIn, bind(WebhookUpdate{}), SetWebHookField)
+			v1.Schema.GetWebHookRoute("task_yaml").ToMacaron(m, RequiresWebHookSetting, reqSignIn, ShowTaskDefaultYaml)
+			v1.Schema.GetWebHookRoute("task").ToMacaron(m, RequiresWebHookSetting, reqSignIn, ShowTaskDefault)
+			v1.Schema.GetWebHookRoute("put_task").ToMacaron(m, RequiresWebHookSetting, reqSignIn, PutTaskDefault)
+			v1.Schema.GetWebHookRoute("pipeline_yaml").ToMacaron(m, RequiresWebHookSetting, reqSignIn, ShowPipelineDefaultYaml)
+			v1.Schema.GetWebHookRoute("pipeline").ToMacaron(m, RequiresWebHookSetting, reqSignIn, ShowPipelineDefault)
+			v1.Schema.GetWebHookRoute("put_pipeline").ToMacaron(m, RequiresWebHookSetting, reqSignIn, PutPipelineDefault)
 		})
 	})
 }
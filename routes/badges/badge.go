@@ -0,0 +1,145 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package badges
+
+import (
+	"bytes"
+	"html/template"
+
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+	agenttasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+)
+
+// Statuses shown by the badges
+const (
+	BADGE_PASSING = "passing"
+	BADGE_FAILING = "failing"
+	BADGE_ERROR   = "error"
+	BADGE_STOPPED = "stopped"
+	BADGE_RUNNING = "running"
+	BADGE_PENDING = "pending"
+	BADGE_UNKNOWN = "unknown"
+)
+
+var badgeColors = map[string]string{
+	BADGE_PASSING: "#4c1",
+	BADGE_FAILING: "#e05d44",
+	BADGE_ERROR:   "#fe7d37",
+	BADGE_STOPPED: "#9f9f9f",
+	BADGE_RUNNING: "#007ec6",
+	BADGE_PENDING: "#dfb317",
+	BADGE_UNKNOWN: "#9f9f9f",
+}
+
+var badgeTemplate = template.Must(template.New("badge").Parse(`<svg xmlns="http://www.w3.org/2000/svg" width="{{.Width}}" height="20" role="img" aria-label="{{.Label}}: {{.Message}}">` +
+	`<title>{{.Label}}: {{.Message}}</title>` +
+	`<linearGradient id="s" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>` +
+	`<clipPath id="r"><rect width="{{.Width}}" height="20" rx="3" fill="#fff"/></clipPath>` +
+	`<g clip-path="url(#r)"><rect width="{{.LabelWidth}}" height="20" fill="#555"/>` +
+	`<rect x="{{.LabelWidth}}" width="{{.MessageWidth}}" height="20" fill="{{.Color}}"/>` +
+	`<rect width="{{.Width}}" height="20" fill="url(#s)"/></g>` +
+	`<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">` +
+	`<text x="{{.LabelX}}" y="14">{{.Label}}</text><text x="{{.MessageX}}" y="14">{{.Message}}</text></g></svg>`))
+
+// Badge is a flat status badge, with a label on the left and the message on
+// the right.
+type Badge struct {
+	Label   string
+	Message string
+	Color   string
+}
+
+// NewStatusBadge returns the badge of one of the statuses.
+func NewStatusBadge(label, status string) *Badge {
+	return &Badge{Label: label, Message: status, Color: badgeColors[status]}
+}
+
+// textWidth approximates the width in pixels of the text in the badge font.
+func textWidth(text string) int {
+	return len([]rune(text))*7 + 10
+}
+
+// SVG renders the badge.
+func (b *Badge) SVG() ([]byte, error) {
+	lw, mw := textWidth(b.Label), textWidth(b.Message)
+	data := map[string]interface{}{
+		"Label":        b.Label,
+		"Message":      b.Message,
+		"Color":        b.Color,
+		"Width":        lw + mw,
+		"LabelWidth":   lw,
+		"MessageWidth": mw,
+		"LabelX":       lw / 2,
+		"MessageX":     lw + mw/2,
+	}
+
+	var buf bytes.Buffer
+	if err := badgeTemplate.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// TaskStatus returns the badge status of the task.
+func TaskStatus(t *agenttasks.Task) string {
+	switch {
+	case t.IsRunning() || t.IsSetup():
+		return BADGE_RUNNING
+	case t.IsStopped():
+		return BADGE_STOPPED
+	case t.IsDone() && t.Result == setting.TASK_RESULT_ERROR:
+		return BADGE_ERROR
+	case t.IsDone() && t.IsSuccess():
+		return BADGE_PASSING
+	case t.IsDone():
+		return BADGE_FAILING
+	}
+	return BADGE_PENDING
+}
+
+// BuildStatus returns the badge status of a build made of the given tasks,
+// e.g. a pipeline: in progress until all its tasks end, then the worst
+// result of them.
+func BuildStatus(tasks []agenttasks.Task) string {
+	if len(tasks) == 0 {
+		return BADGE_UNKNOWN
+	}
+
+	ans := BADGE_PASSING
+	// From the worst to the best one
+	order := []string{BADGE_RUNNING, BADGE_PENDING, BADGE_FAILING, BADGE_ERROR, BADGE_STOPPED, BADGE_PASSING}
+	rank := func(s string) int {
+		for i, o := range order {
+			if o == s {
+				return i
+			}
+		}
+		return len(order)
+	}
+	for i := range tasks {
+		if s := TaskStatus(&tasks[i]); rank(s) < rank(ans) {
+			ans = s
+		}
+	}
+	return ans
+}
@@ -0,0 +1,77 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package badges
+
+import (
+	"strings"
+	"testing"
+
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+	agenttasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+)
+
+func TestTaskStatus(t *testing.T) {
+	for status, task := range map[string]agenttasks.Task{
+		BADGE_PENDING: {Status: setting.TASK_STATE_WAIT},
+		BADGE_RUNNING: {Status: setting.TASK_STATE_RUNNING},
+		BADGE_STOPPED: {Status: setting.TASK_STATE_STOPPED},
+		BADGE_PASSING: {Status: setting.TASK_STATE_DONE, Result: setting.TASK_RESULT_SUCCESS, ExitStatus: "0"},
+		BADGE_FAILING: {Status: setting.TASK_STATE_DONE, Result: setting.TASK_RESULT_FAILED, ExitStatus: "1"},
+		BADGE_ERROR:   {Status: setting.TASK_STATE_DONE, Result: setting.TASK_RESULT_ERROR},
+	} {
+		if s := TaskStatus(&task); s != status {
+			t.Errorf("Expected %s, got %s", status, s)
+		}
+	}
+}
+
+func TestBuildStatus(t *testing.T) {
+	passed := agenttasks.Task{Status: setting.TASK_STATE_DONE, ExitStatus: "0"}
+	failed := agenttasks.Task{Status: setting.TASK_STATE_DONE, ExitStatus: "1"}
+	running := agenttasks.Task{Status: setting.TASK_STATE_RUNNING}
+
+	if s := BuildStatus(nil); s != BADGE_UNKNOWN {
+		t.Error("Builds without tasks are unknown", s)
+	}
+	if s := BuildStatus([]agenttasks.Task{passed, passed}); s != BADGE_PASSING {
+		t.Error("Expected passing build", s)
+	}
+	if s := BuildStatus([]agenttasks.Task{passed, failed}); s != BADGE_FAILING {
+		t.Error("Expected failing build", s)
+	}
+	if s := BuildStatus([]agenttasks.Task{failed, running}); s != BADGE_RUNNING {
+		t.Error("Expected running build", s)
+	}
+}
+
+func TestBadgeSVG(t *testing.T) {
+	svg, err := NewStatusBadge("<docs>", BADGE_PASSING).SVG()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(svg)
+	if !strings.HasPrefix(s, "<svg") || !strings.Contains(s, "&lt;docs&gt;") ||
+		!strings.Contains(s, badgeColors[BADGE_PASSING]) || strings.Contains(s, "<docs>") {
+		t.Error("Invalid badge", s)
+	}
+}
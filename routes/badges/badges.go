@@ -0,0 +1,206 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package badges
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/MottainaiCI/mottainai-server/pkg/context"
+	database "github.com/MottainaiCI/mottainai-server/pkg/db"
+	"github.com/MottainaiCI/mottainai-server/pkg/namespace"
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+	agenttasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+	mhook "github.com/MottainaiCI/mottainai-server/pkg/webhook"
+
+	macaron "gopkg.in/macaron.v1"
+)
+
+// Seconds the badges are cached for at most, as they change with each build
+const BADGE_MAX_AGE = 60
+
+func Setup(m *macaron.Macaron) {
+	m.Invoke(func(config *setting.Config) {
+		m.Group(config.GetWeb().GroupAppPath(), func() {
+			m.Get("/badge/pipeline/*.*", PipelineBadge)
+			m.Get("/badge/webhook/:id/*.*", WebHookBadge)
+			m.Get("/badge/namespace/*.*", NamespaceBadge)
+		})
+	})
+}
+
+// PipelineBadge shows the status of the latest pipeline with the given name.
+// The visitors which aren't signed in see it only if the tasks publish to
+// public namespaces or the owner opted in to public badges.
+func PipelineBadge(ctx *context.Context, db *database.Database) {
+	name, ok := badgeName(ctx)
+	if !ok {
+		return
+	}
+
+	status := BADGE_UNKNOWN
+	if pip := db.LatestPipeline(name); pip != nil {
+		tasks := pipelineTasks(db, pip.ID)
+		if pip.HasPublicBadges() || canSeeTasks(ctx, db, tasks) {
+			status = BuildStatus(tasks)
+		}
+	}
+	writeBadge(ctx, NewStatusBadge(name, status))
+}
+
+// WebHookBadge shows the status of the latest build of a branch pushed to
+// the webhook, with the same visibility rules of PipelineBadge.
+func WebHookBadge(ctx *context.Context, db *database.Database) {
+	branch, ok := badgeName(ctx)
+	if !ok {
+		return
+	}
+
+	status := BADGE_UNKNOWN
+	if w, err := db.Driver.GetWebHook(ctx.Params(":id")); err == nil {
+		if b, ok := w.BranchBuilds[branch]; ok {
+			tasks := buildTasks(db, b)
+			if w.HasPublicBadges() || canSeeTasks(ctx, db, tasks) {
+				status = BuildStatus(tasks)
+			}
+		}
+	}
+	writeBadge(ctx, NewStatusBadge(branch, status))
+}
+
+// NamespaceBadge shows the task which published the content of the
+// namespace the last time.
+func NamespaceBadge(ctx *context.Context, db *database.Database) {
+	name, ok := badgeName(ctx)
+	if !ok {
+		return
+	}
+
+	badge := NewStatusBadge(name, BADGE_UNKNOWN)
+	if canSee(ctx, db, name) {
+		if t, err := db.LastNamespaceTag(name); err == nil && t != nil {
+			badge = &Badge{Label: name, Message: "task " + t.ID, Color: badgeColors[BADGE_PASSING]}
+		}
+	}
+	writeBadge(ctx, badge)
+}
+
+// badgeName returns the name in the path of the badge, which has to be an
+// SVG image.
+func badgeName(ctx *context.Context) (string, bool) {
+	if ctx.Params(":ext") != "svg" || ctx.Params(":path") == "" {
+		ctx.NotFound()
+		return "", false
+	}
+	return ctx.Params(":path"), true
+}
+
+func pipelineTasks(db *database.Database, id string) []agenttasks.Task {
+	tasks := make([]agenttasks.Task, 0)
+	pip, err := db.Driver.GetPipeline(db.Config, id)
+	if err != nil {
+		return tasks
+	}
+	// The tasks in the pipeline document aren't updated while running
+	for _, t := range pip.Tasks {
+		if task, err := db.Driver.GetTask(db.Config, t.ID); err == nil {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks
+}
+
+func buildTasks(db *database.Database, b mhook.Build) []agenttasks.Task {
+	tasks := make([]agenttasks.Task, 0)
+	if b.Task != "" {
+		if task, err := db.Driver.GetTask(db.Config, b.Task); err == nil {
+			tasks = append(tasks, task)
+		}
+	}
+	if b.Pipeline != "" {
+		tasks = append(tasks, pipelineTasks(db, b.Pipeline)...)
+	}
+	return tasks
+}
+
+// canSee reports whether the user of the request can see the results
+// published to the namespace. The visitors which aren't signed in see only
+// the namespaces made public, the signed in users see the ones without a
+// document too, i.e. the ones made by the tasks publishing to them.
+func canSee(ctx *context.Context, db *database.Database, name string) bool {
+	var ns namespace.Namespace
+	found := false
+	if name != "" {
+		ns, found = db.FindNamespace(name)
+	}
+	if found && ns.IsPublic() {
+		return true
+	}
+	if !ctx.IsLogged {
+		return false
+	}
+	if !found || ns.Visibility == "" {
+		return true
+	}
+	if ctx.User.ID == ns.Owner || ctx.User.NamespaceBelongs(name) {
+		return true
+	}
+	return ns.IsInternal()
+}
+
+func canSeeTasks(ctx *context.Context, db *database.Database, tasks []agenttasks.Task) bool {
+	for _, t := range tasks {
+		if !canSee(ctx, db, t.TagNamespace) {
+			return false
+		}
+	}
+	return true
+}
+
+// writeBadge replies with the badge, cached for BADGE_MAX_AGE seconds or
+// less when asked with the max_age parameter. The label can be replaced
+// with the label parameter.
+func writeBadge(ctx *context.Context, badge *Badge) {
+	if label := ctx.Query("label"); label != "" {
+		badge.Label = label
+	}
+	svg, err := badge.SVG()
+	if err != nil {
+		ctx.ServerError("Failed rendering the badge", err)
+		return
+	}
+
+	maxAge := BADGE_MAX_AGE
+	if v, err := strconv.Atoi(ctx.Query("max_age")); err == nil && v >= 0 && v < maxAge {
+		maxAge = v
+	}
+	// The badges of the signed in users may show what others can't see
+	cache := "public"
+	if ctx.IsLogged {
+		cache = "private"
+	}
+
+	ctx.Resp.Header().Set("Content-Type", "image/svg+xml")
+	ctx.Resp.Header().Set("Cache-Control", fmt.Sprintf("%s, max-age=%d", cache, maxAge))
+	ctx.Resp.Write(svg)
+}
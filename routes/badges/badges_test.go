@@ -0,0 +1,92 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package badges
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/MottainaiCI/mottainai-server/pkg/context"
+	database "github.com/MottainaiCI/mottainai-server/pkg/db"
+	"github.com/MottainaiCI/mottainai-server/pkg/namespace"
+	agenttasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+	"github.com/MottainaiCI/mottainai-server/pkg/user"
+)
+
+// namespaceDriver finds the given namespace documents by name
+type namespaceDriver struct {
+	database.DatabaseDriver
+	namespaces []namespace.Namespace
+}
+
+func (n *namespaceDriver) SearchNamespace(name string) (namespace.Namespace, error) {
+	for _, ns := range n.namespaces {
+		if ns.Name == name {
+			return ns, nil
+		}
+	}
+	return namespace.Namespace{}, errors.New("No namespaces found")
+}
+
+func TestCanSee(t *testing.T) {
+	db := &database.Database{Driver: &namespaceDriver{namespaces: []namespace.Namespace{
+		{Name: "public", Visibility: "public"},
+		{Name: "internal", Visibility: "internal"},
+		{Name: "private", Visibility: "private", Owner: "1"},
+		{Name: "unset"},
+	}}}
+	anonymous := &context.Context{}
+	owner := &context.Context{IsLogged: true, User: &user.User{ID: "1", Name: "foo"}}
+	other := &context.Context{IsLogged: true, User: &user.User{ID: "2", Name: "bar"}}
+
+	for _, c := range []struct {
+		ctx       *context.Context
+		namespace string
+		visible   bool
+	}{
+		{anonymous, "public", true},
+		{anonymous, "internal", false},
+		{anonymous, "private", false},
+		{anonymous, "unset", false},
+		{anonymous, "missing", false},
+		{anonymous, "", false},
+		{owner, "private", true},
+		{other, "private", false},
+		{other, "internal", true},
+		{other, "unset", true},
+		{other, "missing", true},
+		{other, "", true},
+	} {
+		if v := canSee(c.ctx, db, c.namespace); v != c.visible {
+			t.Errorf("Expected visibility %v of %q to signed in %v, got %v", c.visible, c.namespace, c.ctx.IsLogged, v)
+		}
+	}
+
+	tasks := []agenttasks.Task{{TagNamespace: "public"}, {TagNamespace: ""}}
+	if canSeeTasks(anonymous, db, tasks) {
+		t.Error("Expected the tasks which don't publish hidden to the visitors")
+	}
+	if !canSeeTasks(other, db, tasks) {
+		t.Error("Expected the tasks visible to the signed in users")
+	}
+}
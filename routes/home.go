@@ -39,11 +39,13 @@ import (
 	database "github.com/MottainaiCI/mottainai-server/pkg/db"
 	"github.com/MottainaiCI/mottainai-server/routes/api"
 	auth "github.com/MottainaiCI/mottainai-server/routes/auth"
+	"github.com/MottainaiCI/mottainai-server/routes/badges"
 	namespaceroute "github.com/MottainaiCI/mottainai-server/routes/namespaces"
 	nodesroute "github.com/MottainaiCI/mottainai-server/routes/nodes"
 	tokenroute "github.com/MottainaiCI/mottainai-server/routes/token"
 
 	"github.com/MottainaiCI/mottainai-server/routes/plans"
+	"github.com/MottainaiCI/mottainai-server/routes/tasktemplates"
 	"github.com/MottainaiCI/mottainai-server/routes/webhook"
 	macaron "gopkg.in/macaron.v1"
 
@@ -200,8 +202,10 @@ func Setup(m *macaron.Macaron) {
 
 	tasks.Setup(m)
 	plans.Setup(m)
+	tasktemplates.Setup(m)
 	nodesroute.Setup(m)
 	namespaceroute.Setup(m)
 	tokenroute.Setup(m)
+	badges.Setup(m)
 	api.Setup(m)
 }
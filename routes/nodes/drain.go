@@ -0,0 +1,51 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package nodesroute
+
+import (
+	"github.com/MottainaiCI/mottainai-server/pkg/context"
+	nodesapi "github.com/MottainaiCI/mottainai-server/routes/api/nodes"
+
+	database "github.com/MottainaiCI/mottainai-server/pkg/db"
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+)
+
+func setDraining(ctx *context.Context, db *database.Database, draining bool) {
+	err := nodesapi.SetDraining(ctx, db, draining)
+	if err != nil {
+		ctx.ServerError("Failed updating node", err)
+		return
+	}
+
+	ctx.Invoke(func(config *setting.Config) {
+		ctx.Redirect(config.GetWeb().BuildURI("/nodes/show/" + ctx.Params(":id")))
+	})
+}
+
+func Drain(ctx *context.Context, db *database.Database) {
+	setDraining(ctx, db, true)
+}
+
+func Resume(ctx *context.Context, db *database.Database) {
+	setDraining(ctx, db, false)
+}
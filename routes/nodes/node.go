@@ -35,12 +35,18 @@ func Setup(m *macaron.Macaron) {
 			SignInRequired: true,
 			Config:         config,
 			BaseURL:        config.GetWeb().AppSubURL})
+		reqAdmin := context.Toggle(&context.ToggleOptions{
+			AdminRequired: true,
+			Config:        config,
+			BaseURL:       config.GetWeb().AppSubURL})
 
 		m.Group(config.GetWeb().GroupAppPath(), func() {
 			m.Get("/nodes", reqSignIn, ShowAll)
 			m.Get("/nodes/add", reqSignIn, Create)
 			m.Get("/nodes/delete/:id", reqSignIn, Remove)
 			m.Get("/nodes/show/:id", reqSignIn, Show)
+			m.Get("/nodes/drain/:id", reqSignIn, reqAdmin, Drain)
+			m.Get("/nodes/resume/:id", reqSignIn, reqAdmin, Resume)
 		})
 	})
 }
@@ -41,6 +41,7 @@ func Setup(m *macaron.Macaron) {
 			m.Get("/plans", reqSignIn, ShowAll)
 			m.Get("/plan/:id", reqSignIn, Display)
 			m.Get("/plan/delete/:id", reqSignIn, Delete)
+			m.Get("/plan/run/:id", reqSignIn, Run)
 			m.Get("/plan/display/:id", reqSignIn, Display)
 		})
 	})
@@ -23,7 +23,10 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 package plans
 
 import (
+	"sort"
+
 	database "github.com/MottainaiCI/mottainai-server/pkg/db"
+	agenttasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
 
 	"github.com/MottainaiCI/mottainai-server/pkg/context"
 	"github.com/MottainaiCI/mottainai-server/pkg/template"
@@ -43,6 +46,17 @@ func Display(ctx *context.Context, db *database.Database) {
 
 	ctx.Data["Plan"] = plan
 
+	if plan.IsPipeline() {
+		runs := make([]agenttasks.Pipeline, 0)
+		for _, p := range db.Driver.AllPipelines(db.Config) {
+			if p.PlanID == plan.ID {
+				runs = append(runs, p)
+			}
+		}
+		sort.Slice(runs, func(i, j int) bool { return runs[i].CreatedTime > runs[j].CreatedTime })
+		ctx.Data["Runs"] = runs
+	}
+
 	template.TemplatePreview(ctx, "plans/display", db.Config)
 }
 
@@ -35,6 +35,9 @@ type Request struct {
 	Options map[string]interface{}
 	Target  interface{}
 	Body    io.Reader
+
+	// Content type of Body, if it isn't form encoded
+	ContentType string
 }
 
 func (req *Request) NewAPIHTTPRequest(endpoint string) (*http.Request, error) {
@@ -106,6 +109,9 @@ func (req *Request) NewAPIHTTPRequest(endpoint string) (*http.Request, error) {
 			}
 		}
 		httpRequest.URL.RawQuery = q.Encode()
+		if len(req.ContentType) > 0 {
+			httpRequest.Header.Set("Content-Type", req.ContentType)
+		}
 	}
 	return httpRequest, nil
 }
@@ -37,6 +37,7 @@ type RouteGenerator interface {
 	GetStorageRoute(s string) Route
 	GetStatsRoute(s string) Route
 	GetSettingRoute(s string) Route
+	GetEventRoute(s string) Route
 }
 
 type APIRouteGenerator struct {
@@ -50,6 +51,7 @@ type APIRouteGenerator struct {
 	Storage   map[string]Route
 	Stats     map[string]Route
 	Setting   map[string]Route
+	Event     map[string]Route
 }
 
 func (g *APIRouteGenerator) GetSecretRoute(s string) Route {
@@ -136,6 +138,15 @@ func (g *APIRouteGenerator) GetSettingRoute(s string) Route {
 	return nil
 }
 
+func (g *APIRouteGenerator) GetEventRoute(s string) Route {
+	r, ok := g.Event[s]
+	if ok {
+		return r
+	}
+
+	return nil
+}
+
 type Route interface {
 	InterpolatePath(map[string]interface{}) string
 	NewRequest(string, map[string]string, io.Reader) (*http.Request, error)
@@ -33,8 +33,15 @@ var Schema schema.RouteGenerator = &schema.APIRouteGenerator{
 		"show_all": &schema.APIRoute{Path: "/api/settings", Type: "get"},
 		"update":   &schema.APIRoute{Path: "/api/settings/update", Type: "post"},
 	},
+	Event: map[string]schema.Route{
+		"stream":        &schema.APIRoute{Path: "/api/events/stream", Type: "get"},
+		"subscriptions": &schema.APIRoute{Path: "/api/events/subscriptions", Type: "get"},
+		"subscribe":     &schema.APIRoute{Path: "/api/events/subscriptions", Type: "post"},
+		"unsubscribe":   &schema.APIRoute{Path: "/api/events/subscriptions/delete/:id", Type: "get"},
+	},
 	Stats: map[string]schema.Route{
-		"info": &schema.APIRoute{Path: "/api/stats", Type: "get"},
+		"info":   &schema.APIRoute{Path: "/api/stats", Type: "get"},
+		"leader": &schema.APIRoute{Path: "/api/stats/leader", Type: "get"},
 	},
 	Storage: map[string]schema.Route{
 		"show_all":       &schema.APIRoute{Path: "/api/storage/list", Type: "get"},
@@ -85,6 +92,12 @@ var Schema schema.RouteGenerator = &schema.APIRouteGenerator{
 		"delete_task":     &schema.APIRoute{Path: "/api/webhook/delete/task/:id", Type: "post"},
 		"delete_pipeline": &schema.APIRoute{Path: "/api/webhook/delete/pipeline/:id", Type: "post"},
 		"set_field":       &schema.APIRoute{Path: "/api/webhook/set", Type: "post"},
+		"task":            &schema.APIRoute{Path: "/api/webhook/task/:id", Type: "get"},
+		"task_yaml":       &schema.APIRoute{Path: "/api/webhook/task/:id.yaml", Type: "get"},
+		"put_task":        &schema.APIRoute{Path: "/api/webhook/task/:id", Type: "put"},
+		"pipeline":        &schema.APIRoute{Path: "/api/webhook/pipeline/:id", Type: "get"},
+		"pipeline_yaml":   &schema.APIRoute{Path: "/api/webhook/pipeline/:id.yaml", Type: "get"},
+		"put_pipeline":    &schema.APIRoute{Path: "/api/webhook/pipeline/:id", Type: "put"},
 	},
 	Secret: map[string]schema.Route{
 		"show_all":     &schema.APIRoute{Path: "/api/secret", Type: "get"},
@@ -100,6 +113,8 @@ var Schema schema.RouteGenerator = &schema.APIRouteGenerator{
 		"show":       &schema.APIRoute{Path: "/api/nodes/show/:id", Type: "get"},
 		"show_tasks": &schema.APIRoute{Path: "/api/nodes/tasks/:key", Type: "get"},
 		"delete":     &schema.APIRoute{Path: "/api/nodes/delete/:id", Type: "get"},
+		"drain":      &schema.APIRoute{Path: "/api/nodes/drain/:id", Type: "get"},
+		"resume":     &schema.APIRoute{Path: "/api/nodes/resume/:id", Type: "get"},
 
 		"register": &schema.APIRoute{Path: "/api/nodes/register", Type: "post"},
 	},
@@ -127,10 +142,18 @@ var Schema schema.RouteGenerator = &schema.APIRouteGenerator{
 		"artefact_list":     &schema.APIRoute{Path: "/api/tasks/:id/artefacts", Type: "get"},
 		"all_artefact_list": &schema.APIRoute{Path: "/api/artefacts", Type: "get"},
 
-		"create_plan": &schema.APIRoute{Path: "/api/tasks/plan", Type: "post"},
-		"plan_list":   &schema.APIRoute{Path: "/api/tasks/planned", Type: "get"},
-		"plan_delete": &schema.APIRoute{Path: "/api/tasks/plan/delete/:id", Type: "get"},
-		"plan_show":   &schema.APIRoute{Path: "/api/tasks/plan/:id", Type: "get"},
+		"create_plan":          &schema.APIRoute{Path: "/api/tasks/plan", Type: "post"},
+		"create_pipeline_plan": &schema.APIRoute{Path: "/api/tasks/plan/pipeline", Type: "post"},
+		"plan_list":            &schema.APIRoute{Path: "/api/tasks/planned", Type: "get"},
+		"plan_delete":          &schema.APIRoute{Path: "/api/tasks/plan/delete/:id", Type: "get"},
+		"plan_run":             &schema.APIRoute{Path: "/api/tasks/plan/run/:id", Type: "get"},
+		"plan_show":            &schema.APIRoute{Path: "/api/tasks/plan/:id", Type: "get"},
+
+		"create_template": &schema.APIRoute{Path: "/api/tasks/template", Type: "post"},
+		"template_list":   &schema.APIRoute{Path: "/api/tasks/templates", Type: "get"},
+		"template_delete": &schema.APIRoute{Path: "/api/tasks/template/delete/:id", Type: "get"},
+		"template_run":    &schema.APIRoute{Path: "/api/tasks/template/run/:id", Type: "post"},
+		"template_show":   &schema.APIRoute{Path: "/api/tasks/template/:id", Type: "get"},
 
 		// FIXME: Move task_log away from here
 		"task_log": &schema.APIRoute{Path: "/artefact/:id/build_:id.log", Type: "get"},
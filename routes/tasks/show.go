@@ -45,6 +45,10 @@ func DisplayTask(ctx *context.Context, db *database.Database) {
 	}
 	ctx.Data["Task"] = task
 
+	if pos, err := db.QueuePosition(task); err == nil && pos > 0 {
+		ctx.Data["QueuePosition"] = pos
+	}
+
 	if ctx.IsLogged && (ctx.User.IsAdmin() || ctx.User.IsManager()) {
 
 		u, err := db.Driver.GetUser(task.Owner)
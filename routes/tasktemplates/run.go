@@ -0,0 +1,89 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package tasktemplates
+
+import (
+	"html"
+
+	"github.com/MottainaiCI/mottainai-server/pkg/context"
+	database "github.com/MottainaiCI/mottainai-server/pkg/db"
+	"github.com/MottainaiCI/mottainai-server/pkg/mottainai"
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+	"github.com/MottainaiCI/mottainai-server/pkg/template"
+	tasksapi "github.com/MottainaiCI/mottainai-server/routes/api/tasks"
+)
+
+func Run(m *mottainai.Mottainai, ctx *context.Context, db *database.Database) {
+	id := ctx.Params(":id")
+
+	params, err := tasksapi.TemplateFormParams(ctx)
+	if err != nil {
+		ctx.ServerError("Failed reading the template parameters", err)
+		return
+	}
+
+	tmpl, docID, err := tasksapi.TaskTemplateRun(m, ctx, db, id, params)
+	if err != nil && ctx.Written() {
+		return
+	} else if err != nil && len(tmpl.ID) == 0 {
+		ctx.NotFound()
+		return
+	} else if err != nil {
+		// Show the form again, with the error and the values sent
+		ctx.Flash.ErrorMsg = html.EscapeString(err.Error())
+		ctx.Data["Flash"] = ctx.Flash
+		ctx.Data["Template"] = tmpl
+		ctx.Data["Params"] = formValues(tmpl, params)
+		template.TemplatePreview(ctx, "tasktemplates/display", db.Config)
+		return
+	}
+
+	ctx.Invoke(func(config *setting.Config) {
+		if tmpl.IsPipeline() {
+			ctx.Redirect(config.GetWeb().BuildURI("/pipeline/" + docID))
+		} else {
+			ctx.Redirect(config.GetWeb().BuildURI("/tasks/display/" + docID))
+		}
+	})
+}
+
+func Delete(ctx *context.Context, db *database.Database) {
+	id := ctx.Params(":id")
+
+	tmpl, err := db.Driver.GetTaskTemplate(id)
+	if err != nil {
+		ctx.NotFound()
+		return
+	}
+	if !ctx.CheckTaskTemplatePermissions(&tmpl) {
+		return
+	}
+	if err := db.Driver.DeleteTaskTemplate(id); err != nil {
+		ctx.ServerError("Failed removing the template", err)
+		return
+	}
+
+	ctx.Invoke(func(config *setting.Config) {
+		ctx.Redirect(config.GetWeb().BuildURI("/templates"))
+	})
+}
@@ -0,0 +1,64 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package tasktemplates
+
+import (
+	database "github.com/MottainaiCI/mottainai-server/pkg/db"
+	agenttasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+	tasksapi "github.com/MottainaiCI/mottainai-server/routes/api/tasks"
+
+	"github.com/MottainaiCI/mottainai-server/pkg/context"
+	"github.com/MottainaiCI/mottainai-server/pkg/template"
+)
+
+// formValues returns the values of the parameters shown in the run form:
+// the ones sent, or the defaults.
+func formValues(tmpl agenttasks.TaskTemplate, params map[string]string) map[string]string {
+	values := make(map[string]string)
+	for _, p := range tmpl.Parameters {
+		values[p.Name] = p.Default
+		if v, ok := params[p.Name]; ok {
+			values[p.Name] = v
+		}
+	}
+	return values
+}
+
+func Display(ctx *context.Context, db *database.Database) {
+	tmpl, err := db.GetTaskTemplateByRef(ctx.Params(":id"))
+	if err != nil {
+		ctx.NotFound()
+		return
+	}
+
+	ctx.Data["Template"] = tmpl
+	ctx.Data["Params"] = formValues(tmpl, nil)
+
+	template.TemplatePreview(ctx, "tasktemplates/display", db.Config)
+}
+
+func ShowAll(ctx *context.Context, db *database.Database) {
+	ctx.Data["Templates"] = tasksapi.AllTaskTemplates(db)
+
+	template.TemplatePreview(ctx, "tasktemplates", db.Config)
+}
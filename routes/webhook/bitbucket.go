@@ -0,0 +1,481 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/MottainaiCI/mottainai-server/pkg/context"
+	database "github.com/MottainaiCI/mottainai-server/pkg/db"
+	logging "github.com/MottainaiCI/mottainai-server/pkg/logging"
+	mottainai "github.com/MottainaiCI/mottainai-server/pkg/mottainai"
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+	tasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+	user "github.com/MottainaiCI/mottainai-server/pkg/user"
+	mhook "github.com/MottainaiCI/mottainai-server/pkg/webhook"
+
+	logrus "github.com/sirupsen/logrus"
+	webhooks "gopkg.in/go-playground/webhooks.v3"
+)
+
+// Bitbucket Server (and Data Center) event keys
+const (
+	BitbucketRefsChangedEvent      = "repo:refs_changed"
+	BitbucketPullRequestOpenEvent  = "pr:opened"
+	BitbucketPullRequestFromEvent  = "pr:from_ref_updated"
+	BitbucketPullRequestOtherEvent = "pr:modified"
+)
+
+type BitbucketUser struct {
+	ID           int64  `json:"id"`
+	Name         string `json:"name"`
+	Slug         string `json:"slug"`
+	DisplayName  string `json:"displayName"`
+	EmailAddress string `json:"emailAddress"`
+}
+
+type BitbucketLink struct {
+	Href string `json:"href"`
+	Name string `json:"name"`
+}
+
+type BitbucketProject struct {
+	ID   int64  `json:"id"`
+	Key  string `json:"key"`
+	Name string `json:"name"`
+}
+
+type BitbucketRepository struct {
+	ID      int64            `json:"id"`
+	Slug    string           `json:"slug"`
+	Name    string           `json:"name"`
+	Project BitbucketProject `json:"project"`
+	Links   struct {
+		Clone []BitbucketLink `json:"clone"`
+		Self  []BitbucketLink `json:"self"`
+	} `json:"links"`
+}
+
+// CloneURL returns the clone URL of the given protocol, http or ssh.
+func (r BitbucketRepository) CloneURL(name string) string {
+	for _, l := range r.Links.Clone {
+		if l.Name == name {
+			return l.Href
+		}
+	}
+	return ""
+}
+
+// BaseURL returns the URL of the Bitbucket instance hosting the repository.
+func (r BitbucketRepository) BaseURL() string {
+	for _, l := range r.Links.Self {
+		if i := strings.Index(l.Href, "/projects/"); i >= 0 {
+			return l.Href[:i]
+		}
+		if i := strings.Index(l.Href, "/users/"); i >= 0 {
+			return l.Href[:i]
+		}
+	}
+	if u := r.CloneURL("http"); u != "" {
+		if i := strings.Index(u, "/scm/"); i >= 0 {
+			return u[:i]
+		}
+	}
+	return ""
+}
+
+type BitbucketRef struct {
+	ID           string              `json:"id"`
+	DisplayID    string              `json:"displayId"`
+	Type         string              `json:"type"`
+	LatestCommit string              `json:"latestCommit"`
+	Repository   BitbucketRepository `json:"repository"`
+}
+
+type BitbucketRefChange struct {
+	Ref      BitbucketRef `json:"ref"`
+	RefID    string       `json:"refId"`
+	FromHash string       `json:"fromHash"`
+	ToHash   string       `json:"toHash"`
+	Type     string       `json:"type"`
+}
+
+type BitbucketPushPayload struct {
+	EventKey   string               `json:"eventKey"`
+	Actor      BitbucketUser        `json:"actor"`
+	Repository BitbucketRepository  `json:"repository"`
+	Changes    []BitbucketRefChange `json:"changes"`
+}
+
+// Change returns the first branch or tag which has been created or updated.
+func (p BitbucketPushPayload) Change() (BitbucketRefChange, bool) {
+	for _, c := range p.Changes {
+		if c.Type != "DELETE" {
+			return c, true
+		}
+	}
+	return BitbucketRefChange{}, false
+}
+
+type BitbucketPullRequest struct {
+	ID      int64        `json:"id"`
+	Title   string       `json:"title"`
+	State   string       `json:"state"`
+	FromRef BitbucketRef `json:"fromRef"`
+	ToRef   BitbucketRef `json:"toRef"`
+	Author  struct {
+		User BitbucketUser `json:"user"`
+	} `json:"author"`
+}
+
+type BitbucketPullRequestPayload struct {
+	EventKey    string               `json:"eventKey"`
+	Actor       BitbucketUser        `json:"actor"`
+	PullRequest BitbucketPullRequest `json:"pullRequest"`
+}
+
+func ParseBitbucketPayload(event string, payload []byte) (interface{}, error) {
+	if strings.HasPrefix(event, "pr:") {
+		var pl BitbucketPullRequestPayload
+		err := json.Unmarshal(payload, &pl)
+		return pl, err
+	}
+	var pl BitbucketPushPayload
+	err := json.Unmarshal(payload, &pl)
+	return pl, err
+}
+
+// NewBitbucketHookParser returns the parser of the Bitbucket Server events,
+// signed with the webhook secret.
+func NewBitbucketHookParser(secret string) *SignedWebhook {
+	return &SignedWebhook{
+		provider:         webhooks.Bitbucket,
+		secret:           secret,
+		eventHeaders:     []string{"X-Event-Key"},
+		signatureHeaders: []string{"X-Hub-Signature"},
+		signaturePrefix:  "sha256=",
+		parse:            ParseBitbucketPayload,
+		eventFuncs:       map[string]webhooks.ProcessPayloadFunc{},
+	}
+}
+
+func NewGitContextBitbucket(kindEvent string, payload interface{}) *GitContext {
+	var ans *GitContext
+
+	if kindEvent == "pull_request" {
+		pr := payload.(BitbucketPullRequestPayload).PullRequest
+		base := pr.ToRef.Repository
+		repo := base.Slug
+		id := strconv.FormatInt(pr.ID, 10)
+		ans = &GitContext{
+			Owner:        base.Project.Key,
+			CloneSSHUrl:  base.CloneURL("ssh"),
+			CloneHTTPUrl: base.CloneURL("http"),
+			UserRepo:     pr.FromRef.Repository.CloneURL("http"),
+			User:         strconv.FormatInt(pr.Author.User.ID, 10),
+			Commit:       pr.FromRef.LatestCommit,
+			Uid:          pr.FromRef.LatestCommit + id + repo,
+			Ref:          pr.FromRef.LatestCommit,
+			FilterRef:    kindEvent + "-" + pr.ToRef.DisplayID,
+			Repo:         repo,
+			Checkout:     id,
+			CheckoutRef:  "refs/pull-requests/" + id + "/from",
+			Base:         pr.ToRef.LatestCommit,
+			Message:      pr.Title,
+			BuildGroup:   repo + "#" + id,
+			Fork:         pr.FromRef.Repository.ID != base.ID,
+		}
+	} else {
+		push := payload.(BitbucketPushPayload)
+		change, _ := push.Change()
+		repo := push.Repository.Slug
+		ans = &GitContext{
+			Owner:        push.Repository.Project.Key,
+			CloneSSHUrl:  push.Repository.CloneURL("ssh"),
+			CloneHTTPUrl: push.Repository.CloneURL("http"),
+			UserRepo:     push.Repository.CloneURL("http"),
+			User:         strconv.FormatInt(push.Actor.ID, 10),
+			Uid:          change.ToHash + repo,
+			Commit:       change.ToHash,
+			Checkout:     change.ToHash,
+			Repo:         repo,
+			Ref:          change.ToHash,
+			FilterRef:    change.Ref.ID,
+			Base:         change.FromHash,
+		}
+		if kindEvent == "tag" {
+			// The tag may be annotated, its commit is known only after fetching it
+			ans.CheckoutRef = change.Ref.ID
+		} else {
+			ans.BuildGroup = repo + "@" + change.Ref.ID
+			ans.Branch = BranchName(change.Ref.ID)
+		}
+	}
+
+	ans.KindEvent = kindEvent
+
+	return ans
+}
+
+type BitbucketWebHook struct {
+	*GitWebHook
+
+	// Credentials of the build status API, from the auth:<user>:<token>
+	// webhook auth
+	Username string
+	Password string
+
+	// Link of the statuses without a target, required by Bitbucket
+	AppURL string
+
+	// Logger of the build status API errors
+	Logger *logging.Logger
+}
+
+func NewBitbucketWebHook(payload interface{}, w *mhook.WebHook, u *user.User, header webhooks.Header, kindEvent string) *BitbucketWebHook {
+	ans := &BitbucketWebHook{
+		GitWebHook: newGitWebHook(payload, w, u, header),
+	}
+	ans.Context = NewGitContext("bitbucket", kindEvent, payload)
+	ans.GitWebHook.CBHandler = ans
+	return ans
+}
+
+func (h *BitbucketWebHook) Repository() BitbucketRepository {
+	if pl, ok := h.Payload.(BitbucketPullRequestPayload); ok {
+		return pl.PullRequest.ToRef.Repository
+	}
+	return h.Payload.(BitbucketPushPayload).Repository
+}
+
+func (h *BitbucketWebHook) SetFailureStatus(errdescr string) {
+	h.SetStatus(&failure, &errdescr, nil)
+}
+
+func (h *BitbucketWebHook) SetPendingStatus() {
+	h.SetStatus(&pending, &pendingDesc, nil)
+}
+
+// SetStatus reports the build status of the commit, if the webhook has the
+// credentials to do so.
+func (h *BitbucketWebHook) SetStatus(state, descr, targetUrl *string) {
+	if h.Username == "" {
+		return
+	}
+
+	var s string
+	switch *state {
+	case pending:
+		s = "INPROGRESS"
+	case success:
+		s = "SUCCESSFUL"
+	default:
+		s = "FAILED"
+	}
+
+	url := h.AppURL
+	if targetUrl != nil {
+		url = *targetUrl
+	}
+	status := map[string]string{
+		"state":       s,
+		"key":         h.AppName,
+		"name":        h.AppName,
+		"url":         url,
+		"description": *descr,
+	}
+
+	err := postStatus(h.Repository().BaseURL()+"/rest/build-status/1.0/commits/"+h.Context.Ref,
+		h.Username, h.Password, status)
+	if err != nil && h.Logger != nil {
+		h.Logger.WithFields(h.GetLogFields(err.Error())).Error("Failed setting the build status")
+	}
+}
+
+func (h *BitbucketWebHook) LoadEventEnvs2Task(task *tasks.Task) {
+	var envs []string
+
+	if h.Context.KindEvent == "pull_request" {
+		pl := h.Payload.(BitbucketPullRequestPayload)
+		pr := pl.PullRequest
+
+		envs = []string{
+			"BITBUCKET_EVENT_TYPE=" + h.Context.KindEvent,
+			"BITBUCKET_EVENT_KEY=" + pl.EventKey,
+			"BITBUCKET_EVENT_USERNAME=" + pl.Actor.Name,
+			"BITBUCKET_EVENT_PROJECT_KEY=" + pr.ToRef.Repository.Project.Key,
+			"BITBUCKET_EVENT_REPO_NAME=" + pr.ToRef.Repository.Slug,
+			"BITBUCKET_EVENT_REPO_GITSSH_URL=" + pr.ToRef.Repository.CloneURL("ssh"),
+			"BITBUCKET_EVENT_REPO_GITHTTP_URL=" + pr.ToRef.Repository.CloneURL("http"),
+			"BITBUCKET_EVENT_PR_ID=" + strconv.FormatInt(pr.ID, 10),
+			"BITBUCKET_EVENT_PR_TITLE=" + pr.Title,
+			"BITBUCKET_EVENT_SOURCE_GITHTTP_URL=" + pr.FromRef.Repository.CloneURL("http"),
+			"BITBUCKET_EVENT_SOURCE_BRANCH=" + pr.FromRef.DisplayID,
+			"BITBUCKET_EVENT_TARGET_BRANCH=" + pr.ToRef.DisplayID,
+			"BITBUCKET_EVENT_REF=" + pr.ToRef.ID,
+			"BITBUCKET_EVENT_COMMIT=" + pr.FromRef.LatestCommit,
+		}
+	} else {
+		push := h.Payload.(BitbucketPushPayload)
+		change, _ := push.Change()
+
+		envs = []string{
+			"BITBUCKET_EVENT_TYPE=" + h.Context.KindEvent,
+			"BITBUCKET_EVENT_KEY=" + push.EventKey,
+			"BITBUCKET_EVENT_USERNAME=" + push.Actor.Name,
+			"BITBUCKET_EVENT_PROJECT_KEY=" + push.Repository.Project.Key,
+			"BITBUCKET_EVENT_REPO_NAME=" + push.Repository.Slug,
+			"BITBUCKET_EVENT_REPO_GITSSH_URL=" + push.Repository.CloneURL("ssh"),
+			"BITBUCKET_EVENT_REPO_GITHTTP_URL=" + push.Repository.CloneURL("http"),
+			"BITBUCKET_EVENT_REF=" + change.Ref.ID,
+			"BITBUCKET_EVENT_COMMIT_BEFORE=" + change.FromHash,
+			"BITBUCKET_EVENT_COMMIT=" + change.ToHash,
+		}
+		if h.Context.KindEvent == "tag" {
+			envs = append(envs, "BITBUCKET_EVENT_TAG="+change.Ref.DisplayID)
+		}
+	}
+
+	task.Environment = append(task.Environment, envs...)
+}
+
+func (h *BitbucketWebHook) GetLogFields(err string) logrus.Fields {
+	ans := logrus.Fields{
+		"component": "webhook",
+		"event":     fmt.Sprintf("bitbucket_%s", h.Context.KindEvent),
+		"wid":       h.Hook.ID,
+	}
+	if err != "" {
+		ans["error"] = err
+	}
+	return ans
+}
+
+func HandleBitbucketPullRequest(m *mottainai.Mottainai, sessionHook *BitbucketWebHook) {
+	pl := sessionHook.Payload.(BitbucketPullRequestPayload)
+
+	m.Invoke(func(l *logging.Logger, db *database.Database) {
+		l.WithFields(sessionHook.GetLogFields("")).Debug("Pull request received")
+
+		if pl.PullRequest.State != "OPEN" {
+			return
+		}
+
+		sessionHook.HandleEvent(m, l, db)
+	})
+}
+
+func HandleBitbucketPush(m *mottainai.Mottainai, sessionHook *BitbucketWebHook) {
+	m.Invoke(func(l *logging.Logger, db *database.Database) {
+		l.WithFields(sessionHook.GetLogFields("")).Debug("Push received")
+		sessionHook.HandleEvent(m, l, db)
+	})
+}
+
+func GenBitbucketHook(db *database.Database, m *mottainai.Mottainai, w *mhook.WebHook, u *user.User) *SignedWebhook {
+	hook := NewBitbucketHookParser(w.Key)
+
+	var appName, appURL, buildPath string
+	var logger *logging.Logger
+	m.Invoke(func(config *setting.Config, l *logging.Logger) {
+		appName = config.GetWeb().AppName
+		appURL = config.GetWeb().BuildAbsURL("/")
+		buildPath = config.GetAgent().BuildPath
+		logger = l
+	})
+
+	newSession := func(payload interface{}, header webhooks.Header, kindEvent string) *BitbucketWebHook {
+		sessionHook := NewBitbucketWebHook(payload, w, u, header, kindEvent)
+		sessionHook.AppName = appName
+		sessionHook.AppURL = appURL
+		sessionHook.BuildPath = buildPath
+		sessionHook.Logger = logger
+		sessionHook.Username, sessionHook.Password, _ = BasicAuthCredentials(sessionHook.GetAuth(db))
+		return sessionHook
+	}
+
+	uuu, err := db.Driver.GetSettingByKey(setting.SYSTEM_WEBHOOK_PR_ENABLED)
+	if err == nil && !uuu.IsDisabled() {
+		hook.RegisterEvents(func(payload interface{}, header webhooks.Header) {
+			HandleBitbucketPullRequest(m, newSession(payload, header, "pull_request"))
+		}, BitbucketPullRequestOpenEvent, BitbucketPullRequestFromEvent, BitbucketPullRequestOtherEvent)
+	}
+
+	hook.RegisterEvents(func(payload interface{}, header webhooks.Header) {
+		change, ok := payload.(BitbucketPushPayload).Change()
+		if !ok {
+			// Only deleted branches and tags
+			return
+		}
+		kindEvent := "push"
+		if change.Ref.Type == "TAG" {
+			kindEvent = "tag"
+		}
+		HandleBitbucketPush(m, newSession(payload, header, kindEvent))
+	}, BitbucketRefsChangedEvent)
+
+	return hook
+}
+
+func SetupBitbucket(m *mottainai.Mottainai) {
+	webHookHandler := func(l *logging.Logger, ctx *context.Context,
+		db *database.Database, resp http.ResponseWriter, req *http.Request) {
+		uid := ctx.Params(":uid")
+		l.WithFields(logrus.Fields{
+			"component": "webhook",
+			"event":     "bitbucket_post",
+			"uid":       uid,
+		}).Debug("Received payload")
+
+		w, err := db.Driver.GetWebHook(uid)
+		if err != nil {
+			l.WithFields(logrus.Fields{
+				"component": "webhook",
+				"event":     "bitbucket_post",
+				"uid":       uid,
+			}).Error("No webhook found")
+			return
+		}
+		u, err := db.Driver.GetUser(w.OwnerId)
+		if err != nil {
+			l.WithFields(logrus.Fields{
+				"component": "webhook",
+				"event":     "bitbucket_post",
+				"uid":       uid,
+			}).Error("No user found")
+			return
+		}
+		hook := GenBitbucketHook(db, m, &w, &u)
+		hook.ParsePayload(resp, req)
+	}
+
+	m.Invoke(func(config *setting.Config) {
+		m.Group(config.GetWeb().GroupAppPath(), func() {
+			m.Post("/webhook/:uid/bitbucket", RequiresWebHookSetting, webHookHandler)
+		})
+	})
+}
@@ -0,0 +1,163 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	tasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+	user "github.com/MottainaiCI/mottainai-server/pkg/user"
+	mhook "github.com/MottainaiCI/mottainai-server/pkg/webhook"
+	webhooks "gopkg.in/go-playground/webhooks.v3"
+)
+
+func newBitbucketTestHook(t *testing.T, file, event, kind string) *BitbucketWebHook {
+	pl, err := ParseBitbucketPayload(event, readPayload(t, file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewBitbucketWebHook(pl, &mhook.WebHook{ID: "1"}, &user.User{}, nil, kind)
+}
+
+func TestBitbucketSignature(t *testing.T) {
+	payload := readPayload(t, "bitbucket_refs_changed.json")
+
+	called := make(chan bool, 1)
+	hook := NewBitbucketHookParser("secret")
+	hook.RegisterEvents(func(pl interface{}, header webhooks.Header) {
+		called <- true
+	}, BitbucketRefsChangedEvent)
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(string(payload)))
+	req.Header.Set("X-Event-Key", BitbucketRefsChangedEvent)
+	req.Header.Set("X-Hub-Signature", "sha256="+sign("secret", payload))
+	rec := httptest.NewRecorder()
+	hook.ParsePayload(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatal("Signed payload not accepted", rec.Code)
+	}
+	select {
+	case <-called:
+	case <-time.After(5 * time.Second):
+		t.Error("Payload not processed")
+	}
+}
+
+func TestBitbucketPush(t *testing.T) {
+	h := newBitbucketTestHook(t, "bitbucket_refs_changed.json", BitbucketRefsChangedEvent, "push")
+
+	c := h.Context
+	if c.Owner != "PROJ" || c.Repo != "repository" ||
+		c.CloneHTTPUrl != "https://bitbucket.example.com/scm/proj/repository.git" ||
+		c.CloneSSHUrl != "ssh://git@bitbucket.example.com:7999/proj/repository.git" ||
+		c.Commit != "178864a7d521b6f5e720b386b2c2b0ef8563e0dc" ||
+		c.FilterRef != "refs/heads/master" || c.BuildGroup != "repository@refs/heads/master" {
+		t.Error("Invalid context, the deleted branch should be skipped", c)
+	}
+	if h.Repository().BaseURL() != "https://bitbucket.example.com" {
+		t.Error("Invalid base URL", h.Repository().BaseURL())
+	}
+
+	task := &tasks.Task{}
+	h.LoadEventEnvs2Task(task)
+	if !hasEnv(task.Environment, "BITBUCKET_EVENT_COMMIT_BEFORE=ecddabb624f6f5ba43816f5926e580a5f680a932") ||
+		!hasEnv(task.Environment, "BITBUCKET_EVENT_PROJECT_KEY=PROJ") {
+		t.Error("Invalid environment", task.Environment)
+	}
+}
+
+func TestBitbucketTag(t *testing.T) {
+	h := newBitbucketTestHook(t, "bitbucket_tag.json", BitbucketRefsChangedEvent, "tag")
+
+	if h.Context.CheckoutRef != "refs/tags/v2.0" {
+		t.Error("Invalid context", h.Context)
+	}
+
+	task := &tasks.Task{}
+	h.LoadEventEnvs2Task(task)
+	if !hasEnv(task.Environment, "BITBUCKET_EVENT_TAG=v2.0") {
+		t.Error("Invalid environment", task.Environment)
+	}
+}
+
+func TestBitbucketPullRequest(t *testing.T) {
+	h := newBitbucketTestHook(t, "bitbucket_pr_opened.json", BitbucketPullRequestOpenEvent, "pull_request")
+
+	c := h.Context
+	if c.Commit != "ef8755f06ee4b28c96a847a95cb8ec8ed6ddd1ca" ||
+		c.FilterRef != "pull_request-master" || c.CheckoutRef != "refs/pull-requests/1/from" ||
+		c.BuildGroup != "repository#1" || c.Fork {
+		t.Error("Invalid context", c)
+	}
+
+	task := &tasks.Task{}
+	h.LoadEventEnvs2Task(task)
+	if !hasEnv(task.Environment, "BITBUCKET_EVENT_PR_ID=1") ||
+		!hasEnv(task.Environment, "BITBUCKET_EVENT_SOURCE_BRANCH=a-branch") {
+		t.Error("Invalid environment", task.Environment)
+	}
+}
+
+func TestBitbucketStatus(t *testing.T) {
+	s := newStatusServer()
+	defer s.Close()
+
+	var pl BitbucketPushPayload
+	if err := json.Unmarshal(readPayload(t, "bitbucket_refs_changed.json"), &pl); err != nil {
+		t.Fatal(err)
+	}
+	pl.Repository.Links.Self[0].Href = s.URL + "/projects/PROJ/repos/repository/browse"
+
+	h := NewBitbucketWebHook(pl, &mhook.WebHook{ID: "1"}, &user.User{}, nil, "push")
+	h.AppName = "Mottainai"
+	h.AppURL = "http://ci/"
+	h.Username, h.Password = "ci", "token"
+
+	h.SetPendingStatus()
+	if s.Path != "/rest/build-status/1.0/commits/178864a7d521b6f5e720b386b2c2b0ef8563e0dc" {
+		t.Error("Invalid status endpoint", s.Path)
+	}
+	if s.Status["state"] != "INPROGRESS" || s.Status["key"] != "Mottainai" || s.Status["url"] != "http://ci/" {
+		t.Error("Invalid status", s.Status)
+	}
+
+	h.SetFailureStatus("Failed cloning")
+	if s.Status["state"] != "FAILED" || s.Status["description"] != "Failed cloning" {
+		t.Error("Invalid status", s.Status)
+	}
+
+	// Errors of the build status API are logged
+	var out *bytes.Buffer
+	h.Logger, out = newBufferLogger()
+	s.Code = http.StatusNotFound
+	h.SetPendingStatus()
+	if !strings.Contains(out.String(), "404 Not Found") {
+		t.Error("Build status error not logged", out.String())
+	}
+}
@@ -0,0 +1,403 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package webhook
+
+import (
+	stdctx "context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	database "github.com/MottainaiCI/mottainai-server/pkg/db"
+	logging "github.com/MottainaiCI/mottainai-server/pkg/logging"
+	mottainai "github.com/MottainaiCI/mottainai-server/pkg/mottainai"
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+	tasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+	user "github.com/MottainaiCI/mottainai-server/pkg/user"
+	mhook "github.com/MottainaiCI/mottainai-server/pkg/webhook"
+
+	ggithub "github.com/google/go-github/github"
+	webhooks "gopkg.in/go-playground/webhooks.v3"
+)
+
+const (
+	// The Checks API isn't in our go-github yet, it needs its preview
+	checksMediaType = "application/vnd.github.antiope-preview+json"
+
+	// GitHub accepts up to 50 annotations per request
+	checkRunAnnotationsBatch = 50
+	// Bytes of the build log shown in the check runs
+	checkRunLogTail = 60000
+
+	GitHubCheckRunEvent = "check_run"
+)
+
+type CheckRunOutput struct {
+	Title       string             `json:"title"`
+	Summary     string             `json:"summary"`
+	Text        string             `json:"text,omitempty"`
+	Annotations []tasks.Annotation `json:"annotations,omitempty"`
+}
+
+type CheckRun struct {
+	ID          int64           `json:"id,omitempty"`
+	Name        string          `json:"name,omitempty"`
+	HeadSHA     string          `json:"head_sha,omitempty"`
+	ExternalID  string          `json:"external_id,omitempty"`
+	DetailsURL  string          `json:"details_url,omitempty"`
+	Status      string          `json:"status,omitempty"`
+	Conclusion  string          `json:"conclusion,omitempty"`
+	StartedAt   string          `json:"started_at,omitempty"`
+	CompletedAt string          `json:"completed_at,omitempty"`
+	Output      *CheckRunOutput `json:"output,omitempty"`
+}
+
+func checkRunStatus(task *tasks.Task) string {
+	switch {
+	case task.IsDone() || task.IsStopped():
+		return "completed"
+	case task.Status == setting.TASK_STATE_RUNNING || task.Status == setting.TASK_STATE_SETUP:
+		return "in_progress"
+	default:
+		return "queued"
+	}
+}
+
+func checkRunConclusion(task *tasks.Task) (string, string) {
+	switch {
+	case task.IsStopped():
+		return "cancelled", "Build stopped."
+	case task.IsSuccess():
+		return "success", successDesc
+	default:
+		return "failure", failureDesc
+	}
+}
+
+// checkRunTime converts the task times to ISO 8601.
+func checkRunTime(t string) string {
+	parsed, err := time.ParseInLocation("20060102150405", t, time.Local)
+	if err != nil {
+		return ""
+	}
+	return parsed.UTC().Format(time.RFC3339)
+}
+
+func checkRunSummary(task *tasks.Task, url string) string {
+	name := task.Name
+	if name == "" {
+		name = task.ID
+	}
+	return fmt.Sprintf("| | |\n|---|---|\n| Task | [%s](%s) |\n| Status | %s |\n| Result | %s |\n| Exit status | %s |\n| Node | %s |\n",
+		name, url, task.Status, task.Result, task.ExitStatus, task.Node)
+}
+
+// checkRunLog returns the tail of the build log, starting at a whole line.
+func checkRunLog(task *tasks.Task, config *setting.Config) string {
+	log := strings.TrimRight(task.TailLog(checkRunLogTail,
+		config.GetStorage().ArtefactPath, config.GetWeb().LockPath), "\x00")
+	if len(log) == checkRunLogTail {
+		if i := strings.Index(log, "\n"); i >= 0 {
+			log = log[i+1:]
+		}
+	}
+	if strings.TrimSpace(log) == "" {
+		return ""
+	}
+	return "```\n" + log + "\n```"
+}
+
+// NewCheckRun returns the check run reporting the current state of the task.
+func (h *GitHubWebHook) NewCheckRun(config *setting.Config, task *tasks.Task) *CheckRun {
+	url := config.GetWeb().BuildAbsURL("/tasks/display/" + task.ID)
+	name := h.AppName
+	if task.Name != "" {
+		name += " / " + task.Name
+	}
+
+	run := &CheckRun{
+		Name:       name,
+		HeadSHA:    h.Context.Ref,
+		ExternalID: task.ID,
+		DetailsURL: url,
+		Status:     checkRunStatus(task),
+		StartedAt:  checkRunTime(task.StartTime),
+	}
+
+	switch run.Status {
+	case "completed":
+		conclusion, title := checkRunConclusion(task)
+		run.Conclusion = conclusion
+		run.CompletedAt = checkRunTime(task.EndTime)
+		run.Output = &CheckRunOutput{
+			Title:   title,
+			Summary: checkRunSummary(task, url),
+			Text:    checkRunLog(task, config),
+		}
+	case "in_progress":
+		run.Output = &CheckRunOutput{Title: pendingDesc, Summary: checkRunSummary(task, url)}
+	}
+	return run
+}
+
+// checksRequest sends a request of the Checks API, which only accepts the
+// installation tokens of the GitHub App.
+func (h *GitHubWebHook) checksRequest(method, urlStr string, run *CheckRun) (*CheckRun, error) {
+	client, err := h.App.Client(h.Context.Owner, h.Context.Repo)
+	if err != nil {
+		return nil, err
+	}
+	req, err := client.NewRequest(method, urlStr, run)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", checksMediaType)
+
+	res := &CheckRun{}
+	if _, err := client.Do(stdctx.Background(), req, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (h *GitHubWebHook) CreateCheckRun(run *CheckRun) (*CheckRun, error) {
+	return h.checksRequest("POST",
+		fmt.Sprintf("repos/%s/%s/check-runs", h.Context.Owner, h.Context.Repo), run)
+}
+
+func (h *GitHubWebHook) UpdateCheckRun(id int64, run *CheckRun) (*CheckRun, error) {
+	return h.checksRequest("PATCH",
+		fmt.Sprintf("repos/%s/%s/check-runs/%d", h.Context.Owner, h.Context.Repo, id), run)
+}
+
+// ReportTask creates or updates the check run of the task when its state
+// changed. The annotations of the task are sent once it's completed.
+func (h *GitHubWebHook) ReportTask(config *setting.Config, task *tasks.Task) error {
+	if !h.ChecksEnabled() {
+		return nil
+	}
+
+	h.checksLock.Lock()
+	defer h.checksLock.Unlock()
+	if h.CheckRuns == nil {
+		h.CheckRuns = make(map[string]*CheckRun)
+	}
+
+	run := h.NewCheckRun(config, task)
+	old, ok := h.CheckRuns[task.ID]
+	if ok && old.Status == run.Status {
+		return nil
+	}
+
+	var annotations []tasks.Annotation
+	if run.Status == "completed" {
+		annotations, _ = task.ReadAnnotations(config.GetStorage().ArtefactPath)
+		if len(annotations) > checkRunAnnotationsBatch {
+			run.Output.Annotations = annotations[:checkRunAnnotationsBatch]
+			annotations = annotations[checkRunAnnotationsBatch:]
+		} else {
+			run.Output.Annotations = annotations
+			annotations = nil
+		}
+	}
+
+	var res *CheckRun
+	var err error
+	if ok {
+		res, err = h.UpdateCheckRun(old.ID, run)
+	} else {
+		res, err = h.CreateCheckRun(run)
+	}
+	if err != nil {
+		return err
+	}
+	run.ID = res.ID
+	h.CheckRuns[task.ID] = run
+
+	// Annotations are appended by each update of the output
+	for len(annotations) > 0 {
+		n := len(annotations)
+		if n > checkRunAnnotationsBatch {
+			n = checkRunAnnotationsBatch
+		}
+		_, err := h.UpdateCheckRun(run.ID, &CheckRun{Output: &CheckRunOutput{
+			Title:       run.Output.Title,
+			Summary:     run.Output.Summary,
+			Annotations: annotations[:n],
+		}})
+		if err != nil {
+			return err
+		}
+		annotations = annotations[n:]
+	}
+	return nil
+}
+
+type GitHubCheckRunPayload struct {
+	Action   string `json:"action"`
+	CheckRun struct {
+		ID         int64  `json:"id"`
+		Name       string `json:"name"`
+		HeadSHA    string `json:"head_sha"`
+		ExternalID string `json:"external_id"`
+	} `json:"check_run"`
+	Repository struct {
+		Name  string `json:"name"`
+		Owner struct {
+			Login string `json:"login"`
+		} `json:"owner"`
+	} `json:"repository"`
+	Sender struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+	} `json:"sender"`
+}
+
+func ParseGitHubCheckRunPayload(event string, payload []byte) (interface{}, error) {
+	var pl GitHubCheckRunPayload
+	err := json.Unmarshal(payload, &pl)
+	return pl, err
+}
+
+// NewGitHubChecksHookParser returns the parser of the check_run events, which
+// the go-playground hooks don't know about.
+func NewGitHubChecksHookParser(secret string) *SignedWebhook {
+	return &SignedWebhook{
+		provider:         webhooks.GitHub,
+		secret:           secret,
+		eventHeaders:     []string{"X-GitHub-Event"},
+		signatureHeaders: []string{"X-Hub-Signature-256"},
+		signaturePrefix:  "sha256=",
+		parse:            ParseGitHubCheckRunPayload,
+		eventFuncs:       map[string]webhooks.ProcessPayloadFunc{},
+	}
+}
+
+func NewGitContextGitHubCheckRun(payload interface{}) *GitContext {
+	pl := payload.(GitHubCheckRunPayload)
+	return &GitContext{
+		Owner:     pl.Repository.Owner.Login,
+		Repo:      pl.Repository.Name,
+		User:      strconv.FormatInt(pl.Sender.ID, 10),
+		Commit:    pl.CheckRun.HeadSHA,
+		Ref:       pl.CheckRun.HeadSHA,
+		Uid:       pl.CheckRun.HeadSHA + pl.CheckRun.ExternalID + pl.Repository.Name,
+		KindEvent: GitHubCheckRunEvent,
+	}
+}
+
+// RerunTask clones the task of a check run which has been re-requested from
+// GitHub and reports the clone as a new check run.
+func (h *GitHubWebHook) RerunTask(m *mottainai.Mottainai, db *database.Database, l *logging.Logger) (string, error) {
+	pl := h.Payload.(GitHubCheckRunPayload)
+
+	task, err := db.Driver.GetTask(db.Config, pl.CheckRun.ExternalID)
+	if err != nil {
+		return "", err
+	}
+	if task.Owner != h.User.ID {
+		return "", errors.New("The task doesn't belong to the webhook owner")
+	}
+
+	docID, err := db.Driver.CloneTask(db.Config, task.ID)
+	if err != nil {
+		return "", err
+	}
+	if _, err := m.SendTask(docID); err != nil {
+		return "", err
+	}
+
+	clone, err := db.Driver.GetTask(db.Config, docID)
+	if err != nil {
+		return "", err
+	}
+	m.Invoke(func(config *setting.Config) {
+		reportTask(h, l, config, &clone)
+	})
+
+	h.Context.Uid = h.Context.Commit + docID + h.Context.Repo
+	addWatcherEvent(m, l, h.Context.Uid, NewWatcherEvent("task", docID, h))
+
+	return docID, nil
+}
+
+func HandleCheckRun(m *mottainai.Mottainai, sessionHook *GitHubWebHook) {
+	pl := sessionHook.Payload.(GitHubCheckRunPayload)
+
+	m.Invoke(func(l *logging.Logger, client *ggithub.Client, db *database.Database) {
+		sessionHook.Client = client
+		l.WithFields(sessionHook.GetLogFields("")).Debug("Check run received")
+
+		if pl.Action != "rerequested" || !sessionHook.ChecksEnabled() {
+			return
+		}
+
+		id, err := sessionHook.RerunTask(m, db, l)
+		if err != nil {
+			l.WithFields(sessionHook.GetLogFields(err.Error())).Error("Failed re-running task")
+			return
+		}
+		fields := sessionHook.GetLogFields("")
+		fields["task"] = id
+		l.WithFields(fields).Info("Task re-run from GitHub")
+	})
+}
+
+func GenGitHubChecksHook(db *database.Database, m *mottainai.Mottainai, w *mhook.WebHook, u *user.User) *SignedWebhook {
+	hook := NewGitHubChecksHookParser(w.Key)
+
+	var appName string
+	var app *mottainai.GitHubApp
+	m.Invoke(func(config *setting.Config, a *mottainai.GitHubApp) {
+		appName = config.GetWeb().AppName
+		app = a
+	})
+
+	hook.RegisterEvents(func(payload interface{}, header webhooks.Header) {
+		sessionHook := &GitHubWebHook{
+			GitWebHook: newGitWebHook(payload, w, u, header),
+			Checks:     GitHubChecksSetting(db),
+			App:        app,
+		}
+		sessionHook.Context = NewGitContextGitHubCheckRun(payload)
+		sessionHook.GitWebHook.CBHandler = sessionHook
+		sessionHook.AppName = appName
+		HandleCheckRun(m, sessionHook)
+	}, GitHubCheckRunEvent)
+
+	return hook
+}
+
+// ChecksEnabled reports whether the tasks are sent as check runs, which
+// needs a GitHub App. Only commit statuses are sent otherwise.
+func (h *GitHubWebHook) ChecksEnabled() bool {
+	return h.Checks && h.App != nil
+}
+
+func GitHubChecksSetting(db *database.Database) bool {
+	uuu, err := db.Driver.GetSettingByKey(setting.SYSTEM_WEBHOOK_GITHUB_CHECKS)
+	return err == nil && uuu.IsEnabled()
+}
@@ -0,0 +1,203 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package webhook
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+
+	mottainai "github.com/MottainaiCI/mottainai-server/pkg/mottainai"
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+	tasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+
+	webhooks "gopkg.in/go-playground/webhooks.v3"
+)
+
+// checksServer records the check runs sent by the webhooks, and issues the
+// installation tokens of the GitHub App.
+type checksServer struct {
+	*httptest.Server
+	sync.Mutex
+	Requests []string
+	Runs     []CheckRun
+	Tokens   int
+}
+
+func newChecksServer(t *testing.T) *checksServer {
+	s := &checksServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Lock()
+		defer s.Unlock()
+
+		switch r.URL.Path {
+		case "/repos/Codertocat/Hello-World/installation":
+			if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+				t.Error("The App JWT wasn't sent")
+			}
+			w.Write([]byte(`{"id": 3}`))
+			return
+		case "/app/installations/3/access_tokens":
+			s.Tokens++
+			w.Write([]byte(`{"token": "installation-token", "expires_at": "2100-01-01T00:00:00Z"}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer installation-token" {
+			t.Error("The check run wasn't sent with the installation token", r.Header.Get("Authorization"))
+		}
+
+		run := CheckRun{}
+		json.NewDecoder(r.Body).Decode(&run)
+		s.Requests = append(s.Requests, r.Method+" "+r.URL.Path)
+		s.Runs = append(s.Runs, run)
+		run.ID = 7
+		json.NewEncoder(w).Encode(run)
+	}))
+	return s
+}
+
+func (s *checksServer) App(t *testing.T) *mottainai.GitHubApp {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &mottainai.GitHubApp{ID: 1, Key: key}
+	app.BaseURL, _ = url.Parse(s.URL + "/")
+	return app
+}
+
+func TestReportTask(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := setting.NewConfig(nil)
+	config.GetWeb().AppURL = "https://mottainai.example.com/"
+	config.GetWeb().LockPath = path.Join(dir, "lock")
+	config.GetStorage().ArtefactPath = dir
+
+	server := newChecksServer(t)
+	defer server.Close()
+
+	h := &GitHubWebHook{
+		GitWebHook: &GitWebHook{
+			Context: &GitContext{Owner: "Codertocat", Repo: "Hello-World", Ref: "ec26c3e"},
+			AppName: "Mottainai",
+		},
+		Checks: true,
+	}
+
+	// Without an App only the commit statuses are sent
+	task := &tasks.Task{ID: "42", Name: "build", Status: setting.TASK_STATE_RUNNING}
+	if err := h.ReportTask(config, task); err != nil || len(server.Requests) != 0 {
+		t.Fatal("Check run sent without App", err, server.Requests)
+	}
+
+	h.App = server.App(t)
+	if err := h.ReportTask(config, task); err != nil {
+		t.Fatal(err)
+	}
+	h.ReportTask(config, task)
+	if len(server.Requests) != 1 || server.Requests[0] != "POST /repos/Codertocat/Hello-World/check-runs" {
+		t.Fatal("Invalid requests", server.Requests)
+	}
+	run := server.Runs[0]
+	if run.Name != "Mottainai / build" || run.HeadSHA != "ec26c3e" || run.ExternalID != "42" ||
+		run.Status != "in_progress" || run.DetailsURL != "https://mottainai.example.com/tasks/display/42" {
+		t.Error("Invalid check run", run)
+	}
+
+	os.MkdirAll(path.Join(dir, "42"), os.ModePerm)
+	ioutil.WriteFile(path.Join(dir, "42", "build_42.log"), []byte("make\nmain.go:3: unused variable\n"), os.ModePerm)
+	var annotations []string
+	for i := 1; i <= 60; i++ {
+		annotations = append(annotations,
+			fmt.Sprintf(`{"path": "main.go", "start_line": %d, "message": "lint"}`, i))
+	}
+	ioutil.WriteFile(path.Join(dir, "42", tasks.ANNOTATIONS_FILE),
+		[]byte("["+strings.Join(annotations, ",")+"]"), os.ModePerm)
+
+	task.Status = setting.TASK_STATE_DONE
+	task.Result = setting.TASK_RESULT_FAILED
+	task.ExitStatus = "1"
+	if err := h.ReportTask(config, task); err != nil {
+		t.Fatal(err)
+	}
+	if server.Tokens != 1 {
+		t.Error("The installation token wasn't reused", server.Tokens)
+	}
+	if len(server.Requests) != 3 ||
+		server.Requests[1] != "PATCH /repos/Codertocat/Hello-World/check-runs/7" ||
+		server.Requests[2] != "PATCH /repos/Codertocat/Hello-World/check-runs/7" {
+		t.Fatal("Invalid requests", server.Requests)
+	}
+	run = server.Runs[1]
+	if run.Status != "completed" || run.Conclusion != "failure" || run.Output == nil {
+		t.Fatal("Invalid check run", run)
+	}
+	if !strings.Contains(run.Output.Text, "main.go:3: unused variable") ||
+		!strings.Contains(run.Output.Summary, "| Result | failed |") {
+		t.Error("Invalid check run output", run.Output)
+	}
+	if len(run.Output.Annotations) != 50 || len(server.Runs[2].Output.Annotations) != 10 {
+		t.Error("Invalid annotations batches", len(run.Output.Annotations))
+	}
+}
+
+func TestParseGitHubCheckRun(t *testing.T) {
+	payload := readPayload(t, "github_check_run_rerequested.json")
+
+	received := make(chan interface{}, 1)
+	hook := NewGitHubChecksHookParser("secret")
+	hook.RegisterEvents(func(pl interface{}, header webhooks.Header) {
+		received <- pl
+	}, GitHubCheckRunEvent)
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(string(payload)))
+	req.Header.Set("X-GitHub-Event", GitHubCheckRunEvent)
+	req.Header.Set("X-Hub-Signature-256", "sha256="+sign("secret", payload))
+	hook.ParsePayload(httptest.NewRecorder(), req)
+
+	pl := <-received
+	ctx := NewGitContextGitHubCheckRun(pl)
+	if ctx.Owner != "Codertocat" || ctx.Repo != "Hello-World" ||
+		ctx.Ref != "ec26c3e57ca3a959ca5aad62de7213c562f8c821" || ctx.KindEvent != GitHubCheckRunEvent {
+		t.Error("Invalid context", ctx)
+	}
+	if pl.(GitHubCheckRunPayload).Action != "rerequested" ||
+		pl.(GitHubCheckRunPayload).CheckRun.ExternalID != "42" {
+		t.Error("Invalid payload", pl)
+	}
+}
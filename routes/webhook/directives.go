@@ -0,0 +1,139 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package webhook
+
+import (
+	"regexp"
+	"strings"
+
+	tasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+)
+
+var directiveRegex = regexp.MustCompile(`(?i)\[(skip ci|ci skip|no ci|ci only:[^\]]*|ci env [^\]]*)\]`)
+
+// Directives are the options of the builds written in the head commit
+// message or in the pull request title: [skip ci], [ci only: lint,test] and
+// [ci env FOO=bar].
+type Directives struct {
+	Skip bool
+	// Names of the pipeline tasks to run, all of them when nil
+	Only []string
+	Env  []string
+
+	// As written, to report them in the task logs
+	Applied []string
+}
+
+func ParseDirectives(text string) *Directives {
+	d := &Directives{}
+	for _, match := range directiveRegex.FindAllStringSubmatch(text, -1) {
+		directive := strings.TrimSpace(match[1])
+		lower := strings.ToLower(directive)
+
+		switch {
+		case strings.HasPrefix(lower, "ci only:"):
+			if d.Only == nil {
+				d.Only = make([]string, 0)
+			}
+			for _, name := range strings.Split(directive[len("ci only:"):], ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					d.Only = append(d.Only, name)
+				}
+			}
+		case strings.HasPrefix(lower, "ci env "):
+			for _, env := range strings.Fields(directive[len("ci env "):]) {
+				if strings.Contains(env, "=") {
+					d.Env = append(d.Env, env)
+				}
+			}
+		default:
+			d.Skip = true
+		}
+		d.Applied = append(d.Applied, match[0])
+	}
+	return d
+}
+
+func (d *Directives) IsEmpty() bool {
+	return d == nil || len(d.Applied) == 0
+}
+
+func (d *Directives) String() string {
+	if d == nil {
+		return ""
+	}
+	return strings.Join(d.Applied, " ")
+}
+
+// FilterPipeline keeps only the tasks named by the [ci only] directives.
+func (d *Directives) FilterPipeline(p *tasks.Pipeline) {
+	if d == nil || d.Only == nil {
+		return
+	}
+	p.Retain(func(name string, task tasks.Task) bool {
+		for _, n := range d.Only {
+			if n == name {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// IgnoreEnv drops the [ci env] directives, e.g. of the pull requests from
+// forks.
+func (d *Directives) IgnoreEnv() {
+	d.Env = nil
+	applied := make([]string, 0, len(d.Applied))
+	for _, a := range d.Applied {
+		if !strings.HasPrefix(strings.ToLower(a), "[ci env ") {
+			applied = append(applied, a)
+		}
+	}
+	d.Applied = applied
+}
+
+func envKey(env string) string {
+	return strings.SplitN(env, "=", 2)[0]
+}
+
+// ApplyTask adds the environment of the [ci env] directives to the task.
+// The directives can't override the variables set by the task, by the
+// event or by Mottainai.
+func (d *Directives) ApplyTask(task *tasks.Task) {
+	if d.IsEmpty() {
+		return
+	}
+	set := make(map[string]bool)
+	for _, env := range task.Environment {
+		set[envKey(env)] = true
+	}
+	for _, env := range d.Env {
+		key := envKey(env)
+		if set[key] || strings.HasPrefix(key, "MOTTAINAI_") {
+			continue
+		}
+		task.Environment = append(task.Environment, env)
+	}
+	task.Environment = append(task.Environment, "MOTTAINAI_CI_DIRECTIVES="+d.String())
+}
@@ -0,0 +1,103 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package webhook
+
+import (
+	"reflect"
+	"testing"
+
+	tasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+)
+
+func TestParseDirectives(t *testing.T) {
+	d := ParseDirectives("Fix the docs [skip ci]")
+	if !d.Skip || d.String() != "[skip ci]" {
+		t.Errorf("Skip directive not parsed: %+v", d)
+	}
+
+	d = ParseDirectives("Update deps [CI only: lint, test] [ci env FOO=bar BAZ=1 broken]")
+	if d.Skip {
+		t.Error("Unexpected skip")
+	}
+	if !reflect.DeepEqual(d.Only, []string{"lint", "test"}) {
+		t.Errorf("Unexpected only directive: %v", d.Only)
+	}
+	if !reflect.DeepEqual(d.Env, []string{"FOO=bar", "BAZ=1"}) {
+		t.Errorf("Unexpected env directive: %v", d.Env)
+	}
+
+	if d = ParseDirectives("Plain message [wip]"); !d.IsEmpty() || d.Only != nil {
+		t.Errorf("Unexpected directives: %+v", d)
+	}
+}
+
+func TestDirectivesFilterPipeline(t *testing.T) {
+	p := &tasks.Pipeline{
+		Chain: []string{"lint", "test", "deploy"},
+		Tasks: map[string]tasks.Task{"lint": {}, "test": {}, "deploy": {}},
+	}
+
+	var none *Directives
+	none.FilterPipeline(p)
+	if len(p.Tasks) != 3 {
+		t.Error("Pipeline filtered without directives")
+	}
+
+	ParseDirectives("[ci only: lint,test]").FilterPipeline(p)
+	if len(p.Tasks) != 2 || !reflect.DeepEqual(p.Chain, []string{"lint", "test"}) {
+		t.Errorf("Unexpected pipeline: %+v", p)
+	}
+}
+
+func TestDirectivesApplyTask(t *testing.T) {
+	task := &tasks.Task{Environment: []string{"A=1"}}
+	ParseDirectives("Release [ci env FOO=bar]").ApplyTask(task)
+
+	expected := []string{"A=1", "FOO=bar", "MOTTAINAI_CI_DIRECTIVES=[ci env FOO=bar]"}
+	if !reflect.DeepEqual(task.Environment, expected) {
+		t.Errorf("Unexpected environment: %v", task.Environment)
+	}
+
+	// Variables of the task, of the event and of Mottainai aren't overridden
+	task = &tasks.Task{Environment: []string{"PATH=/bin", "GITEA_EVENT_REF=master"}}
+	ParseDirectives("[ci env PATH=/tmp GITEA_EVENT_REF=evil MOTTAINAI_TASK_ID=1 FOO=bar]").ApplyTask(task)
+	expected = []string{"PATH=/bin", "GITEA_EVENT_REF=master", "FOO=bar",
+		"MOTTAINAI_CI_DIRECTIVES=[ci env PATH=/tmp GITEA_EVENT_REF=evil MOTTAINAI_TASK_ID=1 FOO=bar]"}
+	if !reflect.DeepEqual(task.Environment, expected) {
+		t.Errorf("Unexpected environment: %v", task.Environment)
+	}
+}
+
+func TestDirectivesIgnoreEnv(t *testing.T) {
+	d := ParseDirectives("Fork [ci env LD_PRELOAD=/tmp/x.so] [ci only: lint]")
+	d.IgnoreEnv()
+	if d.Env != nil || d.String() != "[ci only: lint]" {
+		t.Error("Env directives not ignored", d)
+	}
+
+	task := &tasks.Task{}
+	d.ApplyTask(task)
+	if len(task.Environment) != 1 || task.Environment[0] != "MOTTAINAI_CI_DIRECTIVES=[ci only: lint]" {
+		t.Errorf("Unexpected environment: %v", task.Environment)
+	}
+}
@@ -0,0 +1,157 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	webhooks "gopkg.in/go-playground/webhooks.v3"
+)
+
+// PayloadParser decodes the payload of an event.
+type PayloadParser func(event string, payload []byte) (interface{}, error)
+
+// SignedWebhook receives the events of the forges which sign the payloads
+// with a SHA256 HMAC, like Gitea and Bitbucket Server.
+type SignedWebhook struct {
+	provider webhooks.Provider
+	secret   string
+
+	// Headers carrying the event and the signature, in order of preference
+	eventHeaders     []string
+	signatureHeaders []string
+	signaturePrefix  string
+
+	parse      PayloadParser
+	eventFuncs map[string]webhooks.ProcessPayloadFunc
+}
+
+func (hook *SignedWebhook) Provider() webhooks.Provider {
+	return hook.provider
+}
+
+func (hook *SignedWebhook) RegisterEvents(fn webhooks.ProcessPayloadFunc, events ...string) {
+	for _, event := range events {
+		hook.eventFuncs[event] = fn
+	}
+}
+
+// ParsePayload verifies the payload and calls the function registered for
+// its event, if any.
+func (hook *SignedWebhook) ParsePayload(w http.ResponseWriter, r *http.Request) {
+	event := firstHeader(r.Header, hook.eventHeaders)
+	if len(event) == 0 {
+		http.Error(w, "400 Bad Request - Missing event header", http.StatusBadRequest)
+		return
+	}
+
+	fn, ok := hook.eventFuncs[event]
+	if !ok {
+		return
+	}
+
+	payload, err := ioutil.ReadAll(r.Body)
+	if err != nil || len(payload) == 0 {
+		http.Error(w, "Issue reading Payload", http.StatusInternalServerError)
+		return
+	}
+
+	if len(hook.secret) > 0 {
+		signature := firstHeader(r.Header, hook.signatureHeaders)
+		if len(signature) == 0 {
+			http.Error(w, "403 Forbidden - Missing signature", http.StatusForbidden)
+			return
+		}
+		if !VerifySignature(hook.secret, payload, strings.TrimPrefix(signature, hook.signaturePrefix)) {
+			http.Error(w, "403 Forbidden - HMAC verification failed", http.StatusForbidden)
+			return
+		}
+	}
+
+	pl, err := hook.parse(event, payload)
+	if err != nil {
+		http.Error(w, "Issue parsing Payload", http.StatusInternalServerError)
+		return
+	}
+
+	// Like the go-playground hooks, reply before processing the event
+	go fn(pl, webhooks.Header(r.Header))
+}
+
+func firstHeader(header http.Header, names []string) string {
+	for _, name := range names {
+		if v := header.Get(name); len(v) > 0 {
+			return v
+		}
+	}
+	return ""
+}
+
+// VerifySignature checks the hex encoded SHA256 HMAC of the payload.
+func VerifySignature(secret string, payload []byte, signature string) bool {
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+var statusClient = &http.Client{Timeout: 30 * time.Second}
+
+// postStatus sends a commit status to the API of a forge, authenticating
+// with the webhook credentials when available.
+func postStatus(url, username, password string, status interface{}) error {
+	b, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(username) > 0 {
+		req.SetBasicAuth(username, password)
+	}
+
+	resp, err := statusClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Failed setting status: %s", resp.Status)
+	}
+	return nil
+}
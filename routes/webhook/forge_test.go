@@ -0,0 +1,145 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	logging "github.com/MottainaiCI/mottainai-server/pkg/logging"
+	webhooks "gopkg.in/go-playground/webhooks.v3"
+)
+
+func readPayload(t *testing.T, name string) []byte {
+	b, err := ioutil.ReadFile(path.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func hasEnv(envs []string, env string) bool {
+	for _, e := range envs {
+		if e == env {
+			return true
+		}
+	}
+	return false
+}
+
+// statusServer records the last status posted by the webhooks, answering
+// with Code if set.
+type statusServer struct {
+	*httptest.Server
+	Path     string
+	User     string
+	Password string
+	Status   map[string]string
+	Code     int
+}
+
+func newStatusServer() *statusServer {
+	s := &statusServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Path = r.URL.Path
+		s.User, s.Password, _ = r.BasicAuth()
+		s.Status = map[string]string{}
+		json.NewDecoder(r.Body).Decode(&s.Status)
+		if s.Code != 0 {
+			w.WriteHeader(s.Code)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	return s
+}
+
+// newBufferLogger returns a logger writing to the returned buffer.
+func newBufferLogger() (*logging.Logger, *bytes.Buffer) {
+	var b bytes.Buffer
+	l := logging.New()
+	l.Out = &b
+	return l, &b
+}
+
+func TestSignedWebhook(t *testing.T) {
+	payload := readPayload(t, "gitea_push.json")
+
+	received := make(chan interface{}, 1)
+	hook := NewGiteaHookParser("secret")
+	hook.RegisterEvents(func(pl interface{}, header webhooks.Header) {
+		received <- pl
+	}, GiteaPushEvent)
+
+	post := func(event, signature string) int {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(string(payload)))
+		req.Header.Set("X-Forgejo-Event", event)
+		if signature != "" {
+			req.Header.Set("X-Forgejo-Signature", signature)
+		}
+		rec := httptest.NewRecorder()
+		hook.ParsePayload(rec, req)
+		return rec.Code
+	}
+
+	if code := post("push", ""); code != http.StatusForbidden {
+		t.Error("Unsigned payloads should be rejected", code)
+	}
+	if code := post("push", sign("wrong", payload)); code != http.StatusForbidden {
+		t.Error("Payloads with a wrong signature should be rejected", code)
+	}
+	if code := post("issues", sign("secret", payload)); code != http.StatusOK {
+		t.Error("Unregistered events should be ignored", code)
+	}
+	if len(received) != 0 {
+		t.Fatal("Rejected payloads processed")
+	}
+
+	if code := post("push", sign("secret", payload)); code != http.StatusOK {
+		t.Error("Signed payloads should be accepted", code)
+	}
+	select {
+	case pl := <-received:
+		if pl.(GiteaPushPayload).Repository.FullName != "gitea/webhooks" {
+			t.Error("Invalid payload", pl)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Payload not processed")
+	}
+}
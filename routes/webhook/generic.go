@@ -0,0 +1,250 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package webhook
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MottainaiCI/mottainai-server/pkg/context"
+	database "github.com/MottainaiCI/mottainai-server/pkg/db"
+	logging "github.com/MottainaiCI/mottainai-server/pkg/logging"
+	mottainai "github.com/MottainaiCI/mottainai-server/pkg/mottainai"
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+	tasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+	user "github.com/MottainaiCI/mottainai-server/pkg/user"
+	mhook "github.com/MottainaiCI/mottainai-server/pkg/webhook"
+
+	logrus "github.com/sirupsen/logrus"
+)
+
+const GenericEvent = "generic"
+
+// Headers authenticating the generic payloads, with the key of the webhook
+// or a SHA256 HMAC of the payload signed with it. Senders which can't set
+// headers, like some registries, may pass the key as the token parameter.
+var (
+	genericTokenHeaders     = []string{"X-Mottainai-Token"}
+	genericSignatureHeaders = []string{"X-Mottainai-Signature", "X-Hub-Signature-256"}
+)
+
+// AuthenticateGeneric checks the token or the signature of a generic
+// payload.
+func AuthenticateGeneric(key string, req *http.Request, payload []byte) bool {
+	if len(key) == 0 {
+		return false
+	}
+	token := firstHeader(req.Header, genericTokenHeaders)
+	if len(token) == 0 {
+		token = req.URL.Query().Get("token")
+	}
+	if len(token) > 0 {
+		return hmac.Equal([]byte(token), []byte(key))
+	}
+	if signature := firstHeader(req.Header, genericSignatureHeaders); len(signature) > 0 {
+		return VerifySignature(key, payload, strings.TrimPrefix(signature, "sha256="))
+	}
+	return false
+}
+
+// GenericWebHook starts the default task or pipeline of the webhook for any
+// JSON payload, copying its values as defined by the webhook mapping.
+type GenericWebHook struct {
+	*GitWebHook
+	Document interface{}
+	Mappings []mhook.Mapping
+}
+
+func NewGenericWebHook(payload []byte, w *mhook.WebHook, u *user.User) (*GenericWebHook, error) {
+	var doc interface{}
+	if err := json.Unmarshal(payload, &doc); err != nil {
+		return nil, err
+	}
+	mappings, err := mhook.ParseMapping(w.Mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	ans := &GenericWebHook{
+		GitWebHook: newGitWebHook(payload, w, u, nil),
+		Document:   doc,
+		Mappings:   mappings,
+	}
+	ans.Context = &GitContext{
+		Uid:       GenericEvent + "-" + w.ID + "-" + strconv.FormatInt(time.Now().UnixNano(), 10),
+		KindEvent: GenericEvent,
+	}
+	for _, m := range mappings {
+		switch m.Target {
+		case "commit":
+			ans.Context.Commit = mhook.LookupString(doc, m.Expr)
+		case "source":
+			ans.Context.UserRepo = mhook.LookupString(doc, m.Expr)
+		}
+	}
+	ans.GitWebHook.CBHandler = ans
+	return ans, nil
+}
+
+// The senders of generic payloads have no statuses
+func (h *GenericWebHook) SetFailureStatus(errdescr string)          {}
+func (h *GenericWebHook) SetStatus(state, descr, targetUrl *string) {}
+func (h *GenericWebHook) SetPendingStatus()                         {}
+
+func (h *GenericWebHook) LoadEventEnvs2Task(task *tasks.Task) {
+	envs := []string{
+		"GENERIC_EVENT_TYPE=" + h.Context.KindEvent,
+		"GENERIC_EVENT_HOOK=" + h.Hook.ID,
+	}
+
+	for _, m := range h.Mappings {
+		value := mhook.LookupString(h.Document, m.Expr)
+		if name, ok := m.IsEnv(); ok {
+			envs = append(envs, name+"="+value)
+			continue
+		} else if value == "" {
+			continue
+		}
+
+		switch m.Target {
+		case "image":
+			task.Image = value
+		case "namespace":
+			task.Namespace = value
+		case "tag_namespace":
+			task.TagNamespace = value
+		case "directory":
+			task.Directory = value
+		}
+	}
+
+	(*task).Environment = append(task.Environment, envs...)
+}
+
+func (h *GenericWebHook) GetLogFields(err string) logrus.Fields {
+	ans := logrus.Fields{
+		"component": "webhook",
+		"event":     GenericEvent,
+		"wid":       h.Hook.ID,
+	}
+	if err != "" {
+		ans["error"] = err
+	}
+	return ans
+}
+
+// Handle starts the default task or pipeline of the webhook when the
+// payload matches its filter, returning their IDs.
+func (h *GenericWebHook) Handle(m *mottainai.Mottainai, l *logging.Logger, db *database.Database) (string, string, error) {
+	match, err := mhook.MatchFilter(h.Document, h.Hook.Filter)
+	if err != nil {
+		return "", "", err
+	} else if !match {
+		l.WithFields(h.GetLogFields("")).Debug("Payload filtered")
+		return "", "", nil
+	}
+
+	h.Context.StoredUser = h.User
+	h.Hook = h.Hook.ForEvent(h.Context.KindEvent)
+
+	// There is no repository to look the task and the pipeline up in
+	if !h.Hook.HasTemplate() && !h.Hook.HasTask() && !h.Hook.HasPipeline() {
+		return "", "", errors.New("No default task or pipeline defined in the webhook")
+	}
+
+	var idTask, idPipeline string
+	if h.Hook.HasTemplate() || h.Hook.HasTask() {
+		if idTask, err = h.CreateHookTask(m, db, l); err != nil {
+			return "", "", err
+		}
+	}
+	if h.Hook.HasTemplate() || h.Hook.HasPipeline() {
+		if idPipeline, err = h.CreateHookPipeline(m, db, l); err != nil {
+			return idTask, "", err
+		}
+	}
+	return idTask, idPipeline, nil
+}
+
+func SetupGeneric(m *mottainai.Mottainai) {
+	webHookHandler := func(l *logging.Logger, ctx *context.Context,
+		db *database.Database, resp http.ResponseWriter, req *http.Request) {
+		uid := ctx.Params(":uid")
+		fields := logrus.Fields{
+			"component": "webhook",
+			"event":     "generic_post",
+			"uid":       uid,
+		}
+		l.WithFields(fields).Debug("Received payload")
+
+		w, err := db.Driver.GetWebHook(uid)
+		if err != nil || w.Type != GenericEvent {
+			l.WithFields(fields).Error("No webhook found")
+			http.Error(resp, "404 Not Found", http.StatusNotFound)
+			return
+		}
+
+		payload, err := ioutil.ReadAll(req.Body)
+		if err != nil || len(payload) == 0 {
+			http.Error(resp, "Issue reading Payload", http.StatusBadRequest)
+			return
+		}
+		if !AuthenticateGeneric(w.Key, req, payload) {
+			http.Error(resp, "403 Forbidden - Authentication failed", http.StatusForbidden)
+			return
+		}
+
+		u, err := db.Driver.GetUser(w.OwnerId)
+		if err != nil {
+			l.WithFields(fields).Error("No user found")
+			http.Error(resp, "404 Not Found", http.StatusNotFound)
+			return
+		}
+
+		hook, err := NewGenericWebHook(payload, &w, &u)
+		if err != nil {
+			http.Error(resp, "Issue parsing Payload: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		idTask, idPipeline, err := hook.Handle(m, l, db)
+		if err != nil {
+			l.WithFields(hook.GetLogFields(err.Error())).Error("Failed handling payload")
+			http.Error(resp, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		ctx.JSON(http.StatusOK, map[string]string{"task": idTask, "pipeline": idPipeline})
+	}
+
+	m.Invoke(func(config *setting.Config) {
+		m.Group(config.GetWeb().GroupAppPath(), func() {
+			m.Post("/webhook/:uid/generic", RequiresWebHookSetting, webHookHandler)
+		})
+	})
+}
@@ -0,0 +1,85 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package webhook
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	tasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+	user "github.com/MottainaiCI/mottainai-server/pkg/user"
+	mhook "github.com/MottainaiCI/mottainai-server/pkg/webhook"
+)
+
+func TestAuthenticateGeneric(t *testing.T) {
+	payload := readPayload(t, "generic_registry.json")
+
+	req := httptest.NewRequest("POST", "/", bytes.NewReader(payload))
+	if AuthenticateGeneric("secret", req, payload) {
+		t.Error("Payloads without credentials should be refused")
+	}
+	req.Header.Set("X-Mottainai-Token", "secret")
+	if !AuthenticateGeneric("secret", req, payload) || AuthenticateGeneric("other", req, payload) {
+		t.Error("Invalid token check")
+	}
+
+	req = httptest.NewRequest("POST", "/?token=secret", bytes.NewReader(payload))
+	if !AuthenticateGeneric("secret", req, payload) {
+		t.Error("Token parameter refused")
+	}
+
+	req = httptest.NewRequest("POST", "/", bytes.NewReader(payload))
+	req.Header.Set("X-Mottainai-Signature", "sha256="+sign("secret", payload))
+	if !AuthenticateGeneric("secret", req, payload) || AuthenticateGeneric("other", req, payload) {
+		t.Error("Invalid signature check")
+	}
+}
+
+func TestGenericMapping(t *testing.T) {
+	w := &mhook.WebHook{
+		ID:      "1",
+		Type:    GenericEvent,
+		Mapping: "image=$.repository.repo_name, env.TAG=$.push_data.tag, commit=$.push_data.tag, namespace=$.missing",
+	}
+	h, err := NewGenericWebHook(readPayload(t, "generic_registry.json"), w, &user.User{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Context.Commit != "v1.2" || h.Context.KindEvent != GenericEvent {
+		t.Error("Invalid context", h.Context)
+	}
+
+	task := &tasks.Task{Image: "alpine", Namespace: "builds"}
+	h.LoadEventEnvs2Task(task)
+	if task.Image != "mottainai/builder" || task.Namespace != "builds" {
+		t.Error("Invalid mapped task", task)
+	}
+	if !hasEnv(task.Environment, "TAG=v1.2") || !hasEnv(task.Environment, "GENERIC_EVENT_HOOK=1") {
+		t.Error("Invalid environment", task.Environment)
+	}
+
+	if _, err := NewGenericWebHook([]byte("not json"), w, &user.User{}); err == nil {
+		t.Error("Invalid payloads should be refused")
+	}
+}
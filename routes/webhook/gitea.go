@@ -0,0 +1,441 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/MottainaiCI/mottainai-server/pkg/context"
+	database "github.com/MottainaiCI/mottainai-server/pkg/db"
+	logging "github.com/MottainaiCI/mottainai-server/pkg/logging"
+	mottainai "github.com/MottainaiCI/mottainai-server/pkg/mottainai"
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+	tasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+	user "github.com/MottainaiCI/mottainai-server/pkg/user"
+	mhook "github.com/MottainaiCI/mottainai-server/pkg/webhook"
+
+	logrus "github.com/sirupsen/logrus"
+	webhooks "gopkg.in/go-playground/webhooks.v3"
+)
+
+// Gitea and Forgejo share the payloads, Forgejo sending both its headers and
+// the Gitea ones.
+const (
+	GiteaPushEvent        = "push"
+	GiteaPullRequestEvent = "pull_request"
+)
+
+type GiteaUser struct {
+	ID       int64  `json:"id"`
+	Login    string `json:"login"`
+	UserName string `json:"username"`
+	Email    string `json:"email"`
+}
+
+func (u GiteaUser) Name() string {
+	if u.Login != "" {
+		return u.Login
+	}
+	return u.UserName
+}
+
+type GiteaRepository struct {
+	ID            int64     `json:"id"`
+	Owner         GiteaUser `json:"owner"`
+	Name          string    `json:"name"`
+	FullName      string    `json:"full_name"`
+	HTMLURL       string    `json:"html_url"`
+	SSHURL        string    `json:"ssh_url"`
+	CloneURL      string    `json:"clone_url"`
+	DefaultBranch string    `json:"default_branch"`
+}
+
+// APIURL returns the URL of the API of the instance hosting the repository.
+func (r GiteaRepository) APIURL() string {
+	return strings.TrimSuffix(r.HTMLURL, "/"+r.FullName) + "/api/v1"
+}
+
+type GiteaCommit struct {
+	ID      string `json:"id"`
+	Message string `json:"message"`
+	URL     string `json:"url"`
+}
+
+type GiteaPushPayload struct {
+	Ref        string          `json:"ref"`
+	Before     string          `json:"before"`
+	After      string          `json:"after"`
+	CompareURL string          `json:"compare_url"`
+	Commits    []GiteaCommit   `json:"commits"`
+	HeadCommit *GiteaCommit    `json:"head_commit"`
+	Repository GiteaRepository `json:"repository"`
+	Pusher     GiteaUser       `json:"pusher"`
+	Sender     GiteaUser       `json:"sender"`
+}
+
+type GiteaPullRequestBranch struct {
+	Label  string          `json:"label"`
+	Ref    string          `json:"ref"`
+	Sha    string          `json:"sha"`
+	RepoID int64           `json:"repo_id"`
+	Repo   GiteaRepository `json:"repo"`
+}
+
+type GiteaPullRequest struct {
+	ID      int64                  `json:"id"`
+	Number  int64                  `json:"number"`
+	User    GiteaUser              `json:"user"`
+	Title   string                 `json:"title"`
+	State   string                 `json:"state"`
+	HTMLURL string                 `json:"html_url"`
+	Merged  bool                   `json:"merged"`
+	Head    GiteaPullRequestBranch `json:"head"`
+	Base    GiteaPullRequestBranch `json:"base"`
+}
+
+type GiteaPullRequestPayload struct {
+	Action      string           `json:"action"`
+	Number      int64            `json:"number"`
+	PullRequest GiteaPullRequest `json:"pull_request"`
+	Repository  GiteaRepository  `json:"repository"`
+	Sender      GiteaUser        `json:"sender"`
+}
+
+func ParseGiteaPayload(event string, payload []byte) (interface{}, error) {
+	switch event {
+	case GiteaPullRequestEvent:
+		var pl GiteaPullRequestPayload
+		err := json.Unmarshal(payload, &pl)
+		return pl, err
+	default:
+		var pl GiteaPushPayload
+		err := json.Unmarshal(payload, &pl)
+		return pl, err
+	}
+}
+
+// NewGiteaHookParser returns the parser of the Gitea and Forgejo events,
+// signed with the webhook secret.
+func NewGiteaHookParser(secret string) *SignedWebhook {
+	return &SignedWebhook{
+		provider:         webhooks.Gogs,
+		secret:           secret,
+		eventHeaders:     []string{"X-Forgejo-Event", "X-Gitea-Event", "X-Gogs-Event"},
+		signatureHeaders: []string{"X-Forgejo-Signature", "X-Gitea-Signature", "X-Gogs-Signature"},
+		parse:            ParseGiteaPayload,
+		eventFuncs:       map[string]webhooks.ProcessPayloadFunc{},
+	}
+}
+
+func NewGitContextGitea(kindEvent string, payload interface{}) *GitContext {
+	var ans *GitContext
+
+	if kindEvent == "pull_request" {
+		pl := payload.(GiteaPullRequestPayload)
+		pr := pl.PullRequest
+		repo := pr.Base.Repo.Name
+		number := strconv.FormatInt(pr.Number, 10)
+		ans = &GitContext{
+			Owner:        pr.Base.Repo.Owner.Name(),
+			CloneSSHUrl:  pr.Base.Repo.SSHURL,
+			CloneHTTPUrl: pr.Base.Repo.CloneURL,
+			UserRepo:     pr.Head.Repo.CloneURL,
+			User:         strconv.FormatInt(pr.User.ID, 10),
+			Commit:       pr.Head.Sha,
+			Uid:          pr.Head.Sha + number + repo,
+			Ref:          pr.Head.Sha,
+			FilterRef:    kindEvent + "-" + pr.Base.Ref,
+			Repo:         repo,
+			Checkout:     number,
+			CheckoutRef:  "refs/pull/" + number + "/head",
+			Base:         pr.Base.Sha,
+			Message:      pr.Title,
+			BuildGroup:   repo + "#" + number,
+			Fork:         pr.Head.RepoID != pr.Base.RepoID,
+		}
+	} else {
+		push := payload.(GiteaPushPayload)
+		repo := push.Repository.Name
+		ans = &GitContext{
+			Owner:        push.Repository.Owner.Name(),
+			CloneSSHUrl:  push.Repository.SSHURL,
+			CloneHTTPUrl: push.Repository.CloneURL,
+			UserRepo:     push.Repository.CloneURL,
+			User:         strconv.FormatInt(push.Sender.ID, 10),
+			Uid:          push.After + repo,
+			Commit:       push.After,
+			Checkout:     push.After,
+			Repo:         repo,
+			Ref:          push.After,
+			FilterRef:    push.Ref,
+			Base:         push.Before,
+		}
+		if push.HeadCommit != nil {
+			ans.Message = push.HeadCommit.Message
+		}
+		if kindEvent == "tag" {
+			// The tag may be annotated, its commit is known only after fetching it
+			ans.CheckoutRef = push.Ref
+		} else {
+			ans.BuildGroup = repo + "@" + push.Ref
+			ans.Branch = BranchName(push.Ref)
+		}
+	}
+
+	ans.KindEvent = kindEvent
+
+	return ans
+}
+
+// GiteaWebHook handles the events of Gitea and of its fork Forgejo.
+type GiteaWebHook struct {
+	*GitWebHook
+	Forge string
+
+	// Credentials of the status API, from the auth:<user>:<token> webhook auth
+	Username string
+	Password string
+
+	// Logger of the status API errors
+	Logger *logging.Logger
+}
+
+func NewGiteaWebHook(forge string, payload interface{}, w *mhook.WebHook, u *user.User, header webhooks.Header, kindEvent string) *GiteaWebHook {
+	ans := &GiteaWebHook{
+		GitWebHook: newGitWebHook(payload, w, u, header),
+		Forge:      forge,
+	}
+	ans.Context = NewGitContext(forge, kindEvent, payload)
+	ans.GitWebHook.CBHandler = ans
+	return ans
+}
+
+func (h *GiteaWebHook) Repository() GiteaRepository {
+	if pl, ok := h.Payload.(GiteaPullRequestPayload); ok {
+		return pl.PullRequest.Base.Repo
+	}
+	return h.Payload.(GiteaPushPayload).Repository
+}
+
+func (h *GiteaWebHook) SetFailureStatus(errdescr string) {
+	h.SetStatus(&failure, &errdescr, nil)
+}
+
+func (h *GiteaWebHook) SetPendingStatus() {
+	h.SetStatus(&pending, &pendingDesc, nil)
+}
+
+// SetStatus reports the commit status, if the webhook has the credentials to
+// do so.
+func (h *GiteaWebHook) SetStatus(state, descr, targetUrl *string) {
+	if h.Username == "" {
+		return
+	}
+
+	status := map[string]string{
+		"state":       *state,
+		"description": *descr,
+		"context":     h.AppName,
+	}
+	if targetUrl != nil {
+		status["target_url"] = *targetUrl
+	}
+
+	url := fmt.Sprintf("%s/repos/%s/%s/statuses/%s",
+		h.Repository().APIURL(), h.Context.Owner, h.Context.Repo, h.Context.Ref)
+	if err := postStatus(url, h.Username, h.Password, status); err != nil && h.Logger != nil {
+		h.Logger.WithFields(h.GetLogFields(err.Error())).Error("Failed setting the commit status")
+	}
+}
+
+func (h *GiteaWebHook) LoadEventEnvs2Task(task *tasks.Task) {
+	var envs []string
+	prefix := strings.ToUpper(h.Forge) + "_EVENT_"
+
+	if h.Context.KindEvent == "pull_request" {
+		pl := h.Payload.(GiteaPullRequestPayload)
+		pr := pl.PullRequest
+
+		envs = []string{
+			prefix + "TYPE=" + h.Context.KindEvent,
+			prefix + "USERNAME=" + pr.User.Name(),
+			prefix + "REPO_NAME=" + pr.Base.Repo.Name,
+			prefix + "REPO_FULL_NAME=" + pr.Base.Repo.FullName,
+			prefix + "REPO_GITSSH_URL=" + pr.Base.Repo.SSHURL,
+			prefix + "REPO_GITHTTP_URL=" + pr.Base.Repo.CloneURL,
+			prefix + "PR_NUMBER=" + strconv.FormatInt(pr.Number, 10),
+			prefix + "PR_TITLE=" + pr.Title,
+			prefix + "PR_ACTION=" + pl.Action,
+			prefix + "SOURCE_GITHTTP_URL=" + pr.Head.Repo.CloneURL,
+			prefix + "SOURCE_BRANCH=" + pr.Head.Ref,
+			prefix + "TARGET_BRANCH=" + pr.Base.Ref,
+			prefix + "REF=" + pr.Base.Ref,
+			prefix + "COMMIT=" + pr.Head.Sha,
+		}
+	} else {
+		push := h.Payload.(GiteaPushPayload)
+
+		envs = []string{
+			prefix + "TYPE=" + h.Context.KindEvent,
+			prefix + "USERNAME=" + push.Pusher.Name(),
+			prefix + "REPO_NAME=" + push.Repository.Name,
+			prefix + "REPO_FULL_NAME=" + push.Repository.FullName,
+			prefix + "REPO_GITSSH_URL=" + push.Repository.SSHURL,
+			prefix + "REPO_GITHTTP_URL=" + push.Repository.CloneURL,
+			prefix + "REF=" + push.Ref,
+			prefix + "COMMIT_BEFORE=" + push.Before,
+			prefix + "COMMIT=" + push.After,
+		}
+		if h.Context.KindEvent == "tag" {
+			envs = append(envs, prefix+"TAG="+strings.TrimPrefix(push.Ref, "refs/tags/"))
+		}
+	}
+
+	task.Environment = append(task.Environment, envs...)
+}
+
+func (h *GiteaWebHook) GetLogFields(err string) logrus.Fields {
+	ans := logrus.Fields{
+		"component": "webhook",
+		"event":     fmt.Sprintf("%s_%s", h.Forge, h.Context.KindEvent),
+		"wid":       h.Hook.ID,
+	}
+	if err != "" {
+		ans["error"] = err
+	}
+	return ans
+}
+
+func HandleGiteaPullRequest(m *mottainai.Mottainai, sessionHook *GiteaWebHook) {
+	pl := sessionHook.Payload.(GiteaPullRequestPayload)
+
+	m.Invoke(func(l *logging.Logger, db *database.Database) {
+		l.WithFields(sessionHook.GetLogFields("")).Debug("Pull request received")
+
+		if pl.Action == "closed" {
+			return
+		}
+
+		sessionHook.HandleEvent(m, l, db)
+	})
+}
+
+func HandleGiteaPush(m *mottainai.Mottainai, sessionHook *GiteaWebHook) {
+	push := sessionHook.Payload.(GiteaPushPayload)
+
+	m.Invoke(func(l *logging.Logger, db *database.Database) {
+		l.WithFields(sessionHook.GetLogFields("")).Debug("Push received")
+
+		// Deleted branches and tags
+		if strings.Trim(push.After, "0") == "" {
+			return
+		}
+
+		sessionHook.HandleEvent(m, l, db)
+	})
+}
+
+func GenGiteaHook(forge string, db *database.Database, m *mottainai.Mottainai, w *mhook.WebHook, u *user.User) *SignedWebhook {
+	hook := NewGiteaHookParser(w.Key)
+
+	var appName, buildPath string
+	var logger *logging.Logger
+	m.Invoke(func(config *setting.Config, l *logging.Logger) {
+		appName = config.GetWeb().AppName
+		buildPath = config.GetAgent().BuildPath
+		logger = l
+	})
+
+	newSession := func(payload interface{}, header webhooks.Header, kindEvent string) *GiteaWebHook {
+		sessionHook := NewGiteaWebHook(forge, payload, w, u, header, kindEvent)
+		sessionHook.AppName = appName
+		sessionHook.BuildPath = buildPath
+		sessionHook.Logger = logger
+		sessionHook.Username, sessionHook.Password, _ = BasicAuthCredentials(sessionHook.GetAuth(db))
+		return sessionHook
+	}
+
+	uuu, err := db.Driver.GetSettingByKey(setting.SYSTEM_WEBHOOK_PR_ENABLED)
+	if err == nil && !uuu.IsDisabled() {
+		hook.RegisterEvents(func(payload interface{}, header webhooks.Header) {
+			HandleGiteaPullRequest(m, newSession(payload, header, "pull_request"))
+		}, GiteaPullRequestEvent)
+	}
+
+	hook.RegisterEvents(func(payload interface{}, header webhooks.Header) {
+		kindEvent := "push"
+		if strings.HasPrefix(payload.(GiteaPushPayload).Ref, "refs/tags/") {
+			kindEvent = "tag"
+		}
+		HandleGiteaPush(m, newSession(payload, header, kindEvent))
+	}, GiteaPushEvent)
+
+	return hook
+}
+
+func SetupGitea(m *mottainai.Mottainai) {
+	webHookHandler := func(forge string) interface{} {
+		event := forge + "_post"
+		return func(l *logging.Logger, ctx *context.Context,
+			db *database.Database, resp http.ResponseWriter, req *http.Request) {
+			uid := ctx.Params(":uid")
+			l.WithFields(logrus.Fields{
+				"component": "webhook",
+				"event":     event,
+				"uid":       uid,
+			}).Debug("Received payload")
+
+			w, err := db.Driver.GetWebHook(uid)
+			if err != nil {
+				l.WithFields(logrus.Fields{
+					"component": "webhook",
+					"event":     event,
+					"uid":       uid,
+				}).Error("No webhook found")
+				return
+			}
+			u, err := db.Driver.GetUser(w.OwnerId)
+			if err != nil {
+				l.WithFields(logrus.Fields{
+					"component": "webhook",
+					"event":     event,
+					"uid":       uid,
+				}).Error("No user found")
+				return
+			}
+			hook := GenGiteaHook(forge, db, m, &w, &u)
+			hook.ParsePayload(resp, req)
+		}
+	}
+
+	m.Invoke(func(config *setting.Config) {
+		m.Group(config.GetWeb().GroupAppPath(), func() {
+			m.Post("/webhook/:uid/gitea", RequiresWebHookSetting, webHookHandler("gitea"))
+			m.Post("/webhook/:uid/forgejo", RequiresWebHookSetting, webHookHandler("forgejo"))
+		})
+	})
+}
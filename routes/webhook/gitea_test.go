@@ -0,0 +1,143 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	tasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+	user "github.com/MottainaiCI/mottainai-server/pkg/user"
+	mhook "github.com/MottainaiCI/mottainai-server/pkg/webhook"
+)
+
+func newGiteaTestHook(t *testing.T, forge, file, event, kind string) *GiteaWebHook {
+	pl, err := ParseGiteaPayload(event, readPayload(t, file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewGiteaWebHook(forge, pl, &mhook.WebHook{ID: "1"}, &user.User{}, nil, kind)
+}
+
+func TestGiteaPush(t *testing.T) {
+	h := newGiteaTestHook(t, "gitea", "gitea_push.json", GiteaPushEvent, "push")
+
+	c := h.Context
+	if c.Owner != "gitea" || c.Repo != "webhooks" ||
+		c.CloneHTTPUrl != "http://localhost:3000/gitea/webhooks.git" ||
+		c.Commit != "bffeb74224043ba2feb48d137756c8a9331c449a" ||
+		c.FilterRef != "refs/heads/develop" || c.CheckoutRef != "" ||
+		c.BuildGroup != "webhooks@refs/heads/develop" {
+		t.Error("Invalid context", c)
+	}
+
+	task := &tasks.Task{}
+	h.LoadEventEnvs2Task(task)
+	if !hasEnv(task.Environment, "GITEA_EVENT_REF=refs/heads/develop") ||
+		!hasEnv(task.Environment, "GITEA_EVENT_REPO_FULL_NAME=gitea/webhooks") {
+		t.Error("Invalid environment", task.Environment)
+	}
+}
+
+func TestGiteaTag(t *testing.T) {
+	h := newGiteaTestHook(t, "forgejo", "gitea_tag.json", GiteaPushEvent, "tag")
+
+	if h.Context.CheckoutRef != "refs/tags/v1.2.0" || h.Context.KindEvent != "tag" ||
+		h.Context.BuildGroup != "" {
+		t.Error("Invalid context", h.Context)
+	}
+
+	task := &tasks.Task{}
+	h.LoadEventEnvs2Task(task)
+	if !hasEnv(task.Environment, "FORGEJO_EVENT_TAG=v1.2.0") ||
+		!hasEnv(task.Environment, "FORGEJO_EVENT_TYPE=tag") {
+		t.Error("Invalid environment", task.Environment)
+	}
+}
+
+func TestGiteaPullRequest(t *testing.T) {
+	h := newGiteaTestHook(t, "gitea", "gitea_pull_request.json", GiteaPullRequestEvent, "pull_request")
+
+	c := h.Context
+	if c.Owner != "gitea" || c.Commit != "a2ed7b7c59ce4d4b69ab7d6f2fd6f1e61d0e4e1a" ||
+		c.CloneHTTPUrl != "http://localhost:3000/gitea/webhooks.git" ||
+		c.UserRepo != "http://localhost:3000/contributor/webhooks.git" ||
+		c.FilterRef != "pull_request-master" || c.CheckoutRef != "refs/pull/7/head" ||
+		c.BuildGroup != "webhooks#7" || !c.Fork {
+		t.Error("Invalid context", c)
+	}
+
+	task := &tasks.Task{}
+	h.LoadEventEnvs2Task(task)
+	if !hasEnv(task.Environment, "GITEA_EVENT_PR_NUMBER=7") ||
+		!hasEnv(task.Environment, "GITEA_EVENT_SOURCE_BRANCH=changelog") ||
+		!hasEnv(task.Environment, "GITEA_EVENT_PR_ACTION=synchronized") {
+		t.Error("Invalid environment", task.Environment)
+	}
+}
+
+func TestGiteaStatus(t *testing.T) {
+	s := newStatusServer()
+	defer s.Close()
+
+	var pl GiteaPushPayload
+	if err := json.Unmarshal(readPayload(t, "gitea_push.json"), &pl); err != nil {
+		t.Fatal(err)
+	}
+	pl.Repository.HTMLURL = s.URL + "/gitea/webhooks"
+
+	h := NewGiteaWebHook("gitea", pl, &mhook.WebHook{ID: "1"}, &user.User{}, nil, "push")
+	h.AppName = "Mottainai"
+
+	// Without credentials the status isn't reported
+	h.SetPendingStatus()
+	if s.Status != nil {
+		t.Fatal("Status reported without credentials")
+	}
+
+	h.Username, h.Password = "ci", "token"
+	url := "http://ci/tasks/display/1"
+	h.SetStatus(&success, &successDesc, &url)
+
+	if s.Path != "/api/v1/repos/gitea/webhooks/statuses/bffeb74224043ba2feb48d137756c8a9331c449a" {
+		t.Error("Invalid status endpoint", s.Path)
+	}
+	if s.User != "ci" || s.Password != "token" {
+		t.Error("Invalid credentials", s.User, s.Password)
+	}
+	if s.Status["state"] != "success" || s.Status["context"] != "Mottainai" || s.Status["target_url"] != url {
+		t.Error("Invalid status", s.Status)
+	}
+
+	// Errors of the status API are logged
+	var out *bytes.Buffer
+	h.Logger, out = newBufferLogger()
+	s.Code = http.StatusUnauthorized
+	h.SetPendingStatus()
+	if !strings.Contains(out.String(), "401 Unauthorized") {
+		t.Error("Status error not logged", out.String())
+	}
+}
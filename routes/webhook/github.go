@@ -27,6 +27,9 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	user "github.com/MottainaiCI/mottainai-server/pkg/user"
 	mhook "github.com/MottainaiCI/mottainai-server/pkg/webhook"
@@ -70,9 +73,120 @@ func HandlePush(m *mottainai.Mottainai, sessionHook *GitHubWebHook) {
 	})
 }
 
+// GitHub sends both a push and a create event for a new tag: the first one
+// received starts the build. Tags pushed again later are built again.
+var githubTags = struct {
+	sync.Mutex
+	seen map[string]time.Time
+}{seen: make(map[string]time.Time)}
+
+func claimGitHubTag(uid string) bool {
+	githubTags.Lock()
+	defer githubTags.Unlock()
+
+	now := time.Now()
+	for k, t := range githubTags.seen {
+		if now.Sub(t) > 10*time.Minute {
+			delete(githubTags.seen, k)
+		}
+	}
+	if _, ok := githubTags.seen[uid]; ok {
+		return false
+	}
+	githubTags.seen[uid] = now
+	return true
+}
+
+// HandleTag handles the GitHub push events on tags and the create events of
+// tags
+func HandleTag(m *mottainai.Mottainai, sessionHook *GitHubWebHook) {
+	m.Invoke(func(client *ggithub.Client, l *logging.Logger, db *database.Database) {
+		sessionHook.Client = client
+		l.WithFields(sessionHook.GetLogFields("")).Debug("Tag received")
+
+		if !claimGitHubTag(sessionHook.Context.Uid) {
+			return
+		}
+		sessionHook.HandleEvent(m, l, db)
+	})
+}
+
+// HandleRelease handles GitHub release events
+func HandleRelease(m *mottainai.Mottainai, sessionHook *GitHubWebHook) {
+	pl := sessionHook.Payload.(github.ReleasePayload)
+
+	m.Invoke(func(client *ggithub.Client, l *logging.Logger, db *database.Database) {
+		sessionHook.Client = client
+		l.WithFields(sessionHook.GetLogFields("")).Debug("Release received")
+
+		if pl.Action != "published" {
+			return
+		}
+		sessionHook.HandleEvent(m, l, db)
+	})
+}
+
+// GitHubTagName returns the name of the tag of a push or create event.
+func GitHubTagName(payload interface{}) string {
+	switch pl := payload.(type) {
+	case github.PushPayload:
+		return strings.TrimPrefix(pl.Ref, "refs/tags/")
+	case github.CreatePayload:
+		return pl.Ref
+	}
+	return ""
+}
+
 func NewGitContextGitHub(kind string, payload interface{}) *GitContext {
 	var ans *GitContext
-	if kind == "pull_request" {
+	switch kind {
+	case "tag":
+		tag := GitHubTagName(payload)
+		switch pl := payload.(type) {
+		case github.PushPayload:
+			ans = &GitContext{
+				Owner:        pl.Repository.Owner.Name,
+				CloneSSHUrl:  pl.Repository.CloneURL,
+				CloneHTTPUrl: pl.Repository.CloneURL,
+				UserRepo:     pl.Repository.CloneURL,
+				User:         strconv.FormatInt(pl.Sender.ID, 10),
+				Commit:       pl.HeadCommit.ID,
+				Checkout:     pl.HeadCommit.ID,
+				Repo:         pl.Repository.Name,
+				Ref:          pl.HeadCommit.ID,
+			}
+		case github.CreatePayload:
+			// The commit is known once the tag is fetched
+			ans = &GitContext{
+				Owner:        pl.Repository.Owner.Login,
+				CloneSSHUrl:  pl.Repository.CloneURL,
+				CloneHTTPUrl: pl.Repository.CloneURL,
+				UserRepo:     pl.Repository.CloneURL,
+				User:         strconv.FormatInt(pl.Sender.ID, 10),
+				Repo:         pl.Repository.Name,
+			}
+		}
+		ans.CheckoutRef = "refs/tags/" + tag
+		ans.Uid = kind + "-" + tag + ans.Repo
+		// allow to create complex filters: tag-v*
+		ans.FilterRef = kind + "-" + tag
+
+	case "release":
+		pl := payload.(github.ReleasePayload)
+		ans = &GitContext{
+			Owner:        pl.Repository.Owner.Login,
+			CloneSSHUrl:  pl.Repository.CloneURL,
+			CloneHTTPUrl: pl.Repository.CloneURL,
+			UserRepo:     pl.Repository.CloneURL,
+			User:         strconv.FormatInt(pl.Sender.ID, 10),
+			Repo:         pl.Repository.Name,
+			Uid:          kind + "-" + strconv.FormatInt(pl.Release.ID, 10) + pl.Repository.Name,
+			CheckoutRef:  "refs/tags/" + pl.Release.TagName,
+			// allow to create complex filters: release-published, release-published-v1.*
+			FilterRef: kind + "-" + pl.Action + "-" + pl.Release.TagName,
+		}
+
+	case "pull_request":
 		pl := payload.(github.PullRequestPayload)
 		repo := pl.PullRequest.Base.Repo.Name
 		ans = &GitContext{
@@ -86,12 +200,16 @@ func NewGitContextGitHub(kind string, payload interface{}) *GitContext {
 			Owner:        pl.PullRequest.Base.User.Login,
 			Ref:          pl.PullRequest.Head.Sha,
 			// allow to create complex filters: pull_request-develop, pull_request-master
-			FilterRef: kind + "-" + pl.PullRequest.Base.Ref,
-			Repo:      repo,
-			Checkout:  strconv.FormatInt(pl.PullRequest.Number, 10),
+			FilterRef:  kind + "-" + pl.PullRequest.Base.Ref,
+			Repo:       repo,
+			Checkout:   strconv.FormatInt(pl.PullRequest.Number, 10),
+			Base:       pl.PullRequest.Base.Sha,
+			Message:    pl.PullRequest.Title,
+			BuildGroup: repo + "#" + strconv.FormatInt(pl.PullRequest.Number, 10),
+			Fork:       pl.PullRequest.Head.Repo.ID != pl.PullRequest.Base.Repo.ID,
 		}
 
-	} else {
+	default:
 		push := payload.(github.PushPayload)
 		ans = &GitContext{
 			Owner:        push.Repository.Owner.Name,
@@ -105,7 +223,16 @@ func NewGitContextGitHub(kind string, payload interface{}) *GitContext {
 			Repo:         push.Repository.Name,
 			Ref:          push.HeadCommit.ID,
 			FilterRef:    push.Ref,
+			Base:         push.Before,
+			Message:      push.HeadCommit.Message,
+			BuildGroup:   push.Repository.Name + "@" + push.Ref,
+			Branch:       BranchName(push.Ref),
+		}
+		var lists [][]string
+		for _, c := range push.Commits {
+			lists = append(lists, c.Added, c.Removed, c.Modified)
 		}
+		ans.ChangedFiles = PayloadChangedFiles(lists...)
 	}
 
 	ans.KindEvent = kind
@@ -117,6 +244,13 @@ func NewGitContextGitHub(kind string, payload interface{}) *GitContext {
 type GitHubWebHook struct {
 	*GitWebHook
 	Client *ggithub.Client
+
+	// Checks enables the check runs of the tasks, sent by App, see
+	// ReportTask
+	Checks     bool
+	App        *mottainai.GitHubApp
+	CheckRuns  map[string]*CheckRun
+	checksLock sync.Mutex
 }
 
 func (h *GitHubWebHook) SetFailureStatus(errdescr string) {
@@ -145,8 +279,8 @@ func (h *GitHubWebHook) SetStatus(state, descr, targetUrl *string) {
 func (h *GitHubWebHook) LoadEventEnvs2Task(task *tasks.Task) {
 	var envs []string
 
-	if h.Context.KindEvent == "pull_request" {
-
+	switch h.Context.KindEvent {
+	case "pull_request":
 		pl := h.Payload.(github.PullRequestPayload)
 
 		envs = []string{
@@ -158,7 +292,35 @@ func (h *GitHubWebHook) LoadEventEnvs2Task(task *tasks.Task) {
 			"GITHUB_EVENT_COMMIT=" + pl.PullRequest.Head.Sha,
 		}
 
-	} else {
+	case "tag":
+		envs = []string{
+			"GITHUB_EVENT_TYPE=" + h.Context.KindEvent,
+			"GITHUB_EVENT_REPO_NAME=" + h.Context.Repo,
+			"GITHUB_EVENT_REF=" + h.Context.Commit,
+			"GITHUB_EVENT_TAG=" + GitHubTagName(h.Payload),
+		}
+
+	case "release":
+		pl := h.Payload.(github.ReleasePayload)
+		var name string
+		if pl.Release.Name != nil {
+			name = *pl.Release.Name
+		}
+
+		envs = []string{
+			"GITHUB_EVENT_TYPE=" + h.Context.KindEvent,
+			"GITHUB_EVENT_REPO_NAME=" + h.Context.Repo,
+			"GITHUB_EVENT_REF=" + h.Context.Commit,
+			"GITHUB_EVENT_TAG=" + pl.Release.TagName,
+			"GITHUB_EVENT_RELEASE_ACTION=" + pl.Action,
+			"GITHUB_EVENT_RELEASE_ID=" + strconv.FormatInt(pl.Release.ID, 10),
+			"GITHUB_EVENT_RELEASE_NAME=" + name,
+			"GITHUB_EVENT_RELEASE_TAG_NAME=" + pl.Release.TagName,
+			"GITHUB_EVENT_RELEASE_PRERELEASE=" + strconv.FormatBool(pl.Release.Prerelease),
+			"GITHUB_EVENT_RELEASE_URL=" + pl.Release.HTMLURL,
+		}
+
+	default:
 		push := h.Payload.(github.PushPayload)
 
 		envs = []string{
@@ -181,6 +343,9 @@ func (h *GitHubWebHook) GetLogFields(err string) logrus.Fields {
 		"event":     fmt.Sprintf("github_%s", h.Context.KindEvent),
 		"wid":       h.Hook.ID,
 	}
+	if h.Context != nil {
+		ans["repo"] = h.Context.Owner + "/" + h.Context.Repo
+	}
 	if err != "" {
 		ans["error"] = err
 	}
@@ -201,10 +366,13 @@ func GenGitHubHook(db *database.Database, m *mottainai.Mottainai, w *mhook.WebHo
 	hook := github.New(&github.Config{Secret: secret})
 
 	var appName, buildPath string
-	m.Invoke(func(config *setting.Config) {
+	var app *mottainai.GitHubApp
+	m.Invoke(func(config *setting.Config, a *mottainai.GitHubApp) {
 		appName = config.GetWeb().AppName
 		buildPath = config.GetAgent().BuildPath
+		app = a
 	})
+	checks := GitHubChecksSetting(db)
 
 	uuu, err := db.Driver.GetSettingByKey(setting.SYSTEM_WEBHOOK_PR_ENABLED)
 	if err == nil && !uuu.IsDisabled() {
@@ -212,17 +380,55 @@ func GenGitHubHook(db *database.Database, m *mottainai.Mottainai, w *mhook.WebHo
 			sessionHook := NewGitHubWebHook(payload, w, u, header, "pull_request")
 			sessionHook.AppName = appName
 			sessionHook.BuildPath = buildPath
+			sessionHook.Checks = checks
+			sessionHook.App = app
 			HandlePullRequest(m, sessionHook)
 		}, github.PullRequestEvent)
 	}
 
 	hook.RegisterEvents(func(payload interface{}, header webhooks.Header) {
-		sessionHook := NewGitHubWebHook(payload, w, u, header, "push")
+		push := payload.(github.PushPayload)
+		if push.Deleted && strings.HasPrefix(push.Ref, "refs/tags/") {
+			return
+		}
+
+		kind := "push"
+		if strings.HasPrefix(push.Ref, "refs/tags/") {
+			kind = "tag"
+		}
+		sessionHook := NewGitHubWebHook(payload, w, u, header, kind)
 		sessionHook.AppName = appName
 		sessionHook.BuildPath = buildPath
-		HandlePush(m, sessionHook)
+		sessionHook.Checks = checks
+		sessionHook.App = app
+		if kind == "tag" {
+			HandleTag(m, sessionHook)
+		} else {
+			HandlePush(m, sessionHook)
+		}
 	}, github.PushEvent)
 
+	hook.RegisterEvents(func(payload interface{}, header webhooks.Header) {
+		if payload.(github.CreatePayload).RefType != "tag" {
+			return
+		}
+		sessionHook := NewGitHubWebHook(payload, w, u, header, "tag")
+		sessionHook.AppName = appName
+		sessionHook.BuildPath = buildPath
+		sessionHook.Checks = checks
+		sessionHook.App = app
+		HandleTag(m, sessionHook)
+	}, github.CreateEvent)
+
+	hook.RegisterEvents(func(payload interface{}, header webhooks.Header) {
+		sessionHook := NewGitHubWebHook(payload, w, u, header, "release")
+		sessionHook.AppName = appName
+		sessionHook.BuildPath = buildPath
+		sessionHook.Checks = checks
+		sessionHook.App = app
+		HandleRelease(m, sessionHook)
+	}, github.ReleaseEvent)
+
 	return hook
 }
 
@@ -257,6 +463,10 @@ func SetupGitHub(m *mottainai.Mottainai) {
 			}).Error("No user found")
 			return
 		}
+		if req.Header.Get("X-GitHub-Event") == GitHubCheckRunEvent {
+			GenGitHubChecksHook(db, m, &w, &u).ParsePayload(resp, req)
+			return
+		}
 		hook := GenGitHubHook(db, m, &w, &u)
 		hook.ParsePayload(resp, req)
 	}
@@ -0,0 +1,131 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package webhook
+
+import (
+	"encoding/json"
+	"testing"
+
+	tasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+	user "github.com/MottainaiCI/mottainai-server/pkg/user"
+	mhook "github.com/MottainaiCI/mottainai-server/pkg/webhook"
+
+	"gopkg.in/go-playground/webhooks.v3/github"
+)
+
+func newGitHubTestHook(t *testing.T, file string, payload interface{}, kind string) *GitHubWebHook {
+	if err := json.Unmarshal(readPayload(t, file), payload); err != nil {
+		t.Fatal(err)
+	}
+	switch pl := payload.(type) {
+	case *github.PushPayload:
+		payload = *pl
+	case *github.CreatePayload:
+		payload = *pl
+	case *github.ReleasePayload:
+		payload = *pl
+	}
+	return NewGitHubWebHook(payload, &mhook.WebHook{ID: "1"}, &user.User{}, nil, kind)
+}
+
+func TestGitHubPushChangedFiles(t *testing.T) {
+	h := newGitHubTestHook(t, "github_push.json", &github.PushPayload{}, "push")
+
+	c := h.Context
+	if c.Base != "6113728f27ae82c7b1a177c8d03f9e96e0adf246" || len(c.ChangedFiles) != 3 {
+		t.Fatal("Invalid changed files", c.Base, c.ChangedFiles)
+	}
+	if c.Branch != BranchName(c.FilterRef) || c.Branch == "" {
+		t.Error("Invalid branch", c.Branch, c.FilterRef)
+	}
+
+	h.Hook.Paths = "services/api/**"
+	if !h.Hook.MatchPaths(c.ChangedFiles) {
+		t.Error("Changed service should be built")
+	}
+	h.Hook.Paths = "services/web/**, docs/*.txt"
+	if h.Hook.MatchPaths(c.ChangedFiles) {
+		t.Error("Unchanged service shouldn't be built")
+	}
+}
+
+func TestGitHubTagPush(t *testing.T) {
+	h := newGitHubTestHook(t, "github_tag_push.json", &github.PushPayload{}, "tag")
+
+	c := h.Context
+	if c.Owner != "Codertocat" || c.Repo != "Hello-World" ||
+		c.Commit != "ec26c3e57ca3a959ca5aad62de7213c562f8c821" ||
+		c.CheckoutRef != "refs/tags/v1.0.0" || c.FilterRef != "tag-v1.0.0" {
+		t.Error("Invalid context", c)
+	}
+	if filtered, _ := c.IsEventFiltered("^tag-v.*"); filtered {
+		t.Error("Tag should match its filter")
+	}
+
+	task := &tasks.Task{}
+	h.LoadEventEnvs2Task(task)
+	if !hasEnv(task.Environment, "GITHUB_EVENT_TAG=v1.0.0") ||
+		!hasEnv(task.Environment, "GITHUB_EVENT_TYPE=tag") {
+		t.Error("Invalid environment", task.Environment)
+	}
+}
+
+func TestGitHubCreateTag(t *testing.T) {
+	h := newGitHubTestHook(t, "github_create_tag.json", &github.CreatePayload{}, "tag")
+	push := newGitHubTestHook(t, "github_tag_push.json", &github.PushPayload{}, "tag")
+
+	c := h.Context
+	if c.Owner != "Codertocat" || c.Commit != "" ||
+		c.CheckoutRef != "refs/tags/v1.0.0" || c.FilterRef != "tag-v1.0.0" {
+		t.Error("Invalid context", c)
+	}
+
+	// Only the first of the push and create events of a tag is built
+	if c.Uid != push.Context.Uid {
+		t.Fatal("Tag events should share their uid", c.Uid, push.Context.Uid)
+	}
+	if !claimGitHubTag(c.Uid) || claimGitHubTag(push.Context.Uid) {
+		t.Error("Tag built twice")
+	}
+}
+
+func TestGitHubRelease(t *testing.T) {
+	h := newGitHubTestHook(t, "github_release_published.json", &github.ReleasePayload{}, "release")
+
+	c := h.Context
+	if c.Owner != "Codertocat" || c.CheckoutRef != "refs/tags/v1.0.0" ||
+		c.FilterRef != "release-published-v1.0.0" {
+		t.Error("Invalid context", c)
+	}
+	if filtered, _ := c.IsEventFiltered("release-published"); filtered {
+		t.Error("Release should match its filter")
+	}
+
+	task := &tasks.Task{}
+	h.LoadEventEnvs2Task(task)
+	if !hasEnv(task.Environment, "GITHUB_EVENT_RELEASE_NAME=First release") ||
+		!hasEnv(task.Environment, "GITHUB_EVENT_RELEASE_ACTION=published") ||
+		!hasEnv(task.Environment, "GITHUB_EVENT_TAG=v1.0.0") {
+		t.Error("Invalid environment", task.Environment)
+	}
+}
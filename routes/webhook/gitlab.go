@@ -224,14 +224,17 @@ func NewGitContextGitLab(kindEvent string, payload interface{}) *GitContext {
 			CloneSSHUrl:  mr.ObjectAttributes.Source.GitSSHURL,
 			CloneHTTPUrl: mr.ObjectAttributes.Source.GitHTTPURL,
 			// TODO: Show what url to use
-			UserRepo:  mr.ObjectAttributes.Source.GitHTTPURL,
-			User:      strconv.FormatInt(mr.ObjectAttributes.AuthorID, 10),
-			Uid:       mr.ObjectAttributes.LastCommit.ID + repo,
-			Commit:    mr.ObjectAttributes.LastCommit.ID,
-			Checkout:  strconv.FormatInt(mr.ObjectAttributes.IID, 10),
-			Repo:      repo,
-			Ref:       mr.ObjectAttributes.SourceBranch,
-			FilterRef: fmt.Sprintf("%s-%s", kindEvent, mr.ObjectAttributes.SourceBranch),
+			UserRepo:   mr.ObjectAttributes.Source.GitHTTPURL,
+			User:       strconv.FormatInt(mr.ObjectAttributes.AuthorID, 10),
+			Uid:        mr.ObjectAttributes.LastCommit.ID + repo,
+			Commit:     mr.ObjectAttributes.LastCommit.ID,
+			Checkout:   strconv.FormatInt(mr.ObjectAttributes.IID, 10),
+			Repo:       repo,
+			Ref:        mr.ObjectAttributes.SourceBranch,
+			FilterRef:  fmt.Sprintf("%s-%s", kindEvent, mr.ObjectAttributes.SourceBranch),
+			Message:    mr.ObjectAttributes.Title,
+			BuildGroup: repo + "!" + strconv.FormatInt(mr.ObjectAttributes.IID, 10),
+			Fork:       mr.ObjectAttributes.SourceProjectID != mr.ObjectAttributes.TargetProjectID,
 		}
 
 	} else if kindEvent == "push" {
@@ -245,15 +248,26 @@ func NewGitContextGitLab(kindEvent string, payload interface{}) *GitContext {
 			CloneSSHUrl:  push.Project.GitSSSHURL,
 			CloneHTTPUrl: push.Project.GitHTTPURL,
 			// TODO: Show what url to use
-			UserRepo:  push.Project.GitHTTPURL,
-			User:      strconv.FormatInt(push.UserID, 10),
-			Uid:       push.CheckoutSHA + repo,
-			Commit:    push.CheckoutSHA,
-			Checkout:  push.CheckoutSHA,
-			Repo:      repo,
-			Ref:       push.Ref,
-			FilterRef: fmt.Sprintf("%s-%s", kindEvent, push.Ref),
+			UserRepo:   push.Project.GitHTTPURL,
+			User:       strconv.FormatInt(push.UserID, 10),
+			Uid:        push.CheckoutSHA + repo,
+			Commit:     push.CheckoutSHA,
+			Checkout:   push.CheckoutSHA,
+			Repo:       repo,
+			Ref:        push.Ref,
+			FilterRef:  fmt.Sprintf("%s-%s", kindEvent, push.Ref),
+			Base:       push.Before,
+			BuildGroup: repo + "@" + push.Ref,
+			Branch:     BranchName(push.Ref),
+		}
+		var lists [][]string
+		for _, c := range push.Commits {
+			lists = append(lists, c.Added, c.Modified, c.Removed)
+			if c.ID == push.CheckoutSHA {
+				ans.Message = c.Message
+			}
 		}
+		ans.ChangedFiles = PayloadChangedFiles(lists...)
 
 	} else if kindEvent == "tag" {
 		tag := payload.(gitlab.TagEventPayload)
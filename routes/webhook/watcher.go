@@ -64,6 +64,9 @@ func GetDefaultLogFields(pipelineId, taskId, status, err string, handler WebHook
 	return ans
 }
 
+// GlobalWatcher reports the status of the watched events. Events are kept in
+// memory by the replica that received the webhook, so unlike the plans and the
+// healthcheck the watcher runs on every replica, not only on the leader.
 func GlobalWatcher(client *ggithub.Client, a *anagent.Anagent, db *database.Database, config *setting.Config, logger *logging.Logger) {
 	logger.WithFields(logrus.Fields{
 		"component": "webhook_global_watcher",
@@ -101,6 +104,7 @@ func GlobalWatcher(client *ggithub.Client, a *anagent.Anagent, db *database.Data
 						delete(w, k)
 						return
 					}
+					reportTask(v.Handler, logger, config, &ta)
 
 					if ta.IsDone() || ta.IsStopped() {
 						done++
@@ -113,7 +117,11 @@ func GlobalWatcher(client *ggithub.Client, a *anagent.Anagent, db *database.Data
 
 				if done == len(pip.Tasks) {
 					delete(w, k)
-					if fail == false {
+					if pip.SupersededBy != "" {
+						fields := GetDefaultLogFields(v.EventId, "", "superseded", "", v.Handler)
+						logger.WithFields(fields).Info("Pipeline superseded")
+						v.Handler.SetStatus(&failure, &supersededDesc, &url)
+					} else if fail == false {
 						fields := GetDefaultLogFields(v.EventId, "", "success", "", v.Handler)
 						logger.WithFields(fields).Info("Pipeline successfully executed")
 
@@ -133,8 +141,13 @@ func GlobalWatcher(client *ggithub.Client, a *anagent.Anagent, db *database.Data
 				url := config.GetWeb().BuildAbsURL("/tasks/display/" + v.EventId)
 				task, err := db.Driver.GetTask(db.Config, v.EventId)
 				if err == nil {
+					reportTask(v.Handler, logger, config, &task)
 					if task.IsDone() || task.IsStopped() {
-						if task.IsSuccess() {
+						if task.SupersededBy != "" {
+							fields := GetDefaultLogFields("", v.EventId, "superseded", "", v.Handler)
+							logger.WithFields(fields).Info("Task superseded")
+							v.Handler.SetStatus(&failure, &supersededDesc, &url)
+						} else if task.IsSuccess() {
 							fields := GetDefaultLogFields("", v.EventId, "success", "", v.Handler)
 							logger.WithFields(fields).Info("Task succeeded")
 							v.Handler.SetStatus(&success, &successDesc, &url)
@@ -152,7 +165,7 @@ func GlobalWatcher(client *ggithub.Client, a *anagent.Anagent, db *database.Data
 				}
 
 			default:
-				logger.Error("Unknown event %s", v)
+				logger.Errorf("Unknown event %s", v.EventType)
 				delete(w, k)
 			}
 		}
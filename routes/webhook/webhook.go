@@ -56,16 +56,18 @@ import (
 )
 
 var (
-	pending       = "pending"
-	success       = "success"
-	failure       = "error"
-	pendingDesc   = "Build in progress, please wait."
-	noPermDesc    = "Insufficient permissions"
-	successDesc   = "Build successful."
-	failureDesc   = "Build failed."
-	notfoundDesc  = "No mottainai file found on repo"
-	task_file     = ".mottainai"
-	pipeline_file = ".mottainai-pipeline"
+	pending        = "pending"
+	success        = "success"
+	failure        = "error"
+	pendingDesc    = "Build in progress, please wait."
+	noPermDesc     = "Insufficient permissions"
+	successDesc    = "Build successful."
+	failureDesc    = "Build failed."
+	skippedDesc    = "No changed paths to build."
+	supersededDesc = "Build superseded by a newer one."
+	notfoundDesc   = "No mottainai file found on repo"
+	task_file      = ".mottainai"
+	pipeline_file  = ".mottainai-pipeline"
 )
 
 type GitContext struct {
@@ -84,6 +86,32 @@ type GitContext struct {
 	FilterRef    string
 	KindEvent    string
 
+	// Reference fetched and checked out in place of Checkout, e.g. the
+	// pull request and tag refs of the forges
+	CheckoutRef string
+
+	// Files changed by the event, diffing Commit from its merge base with
+	// Base when Base is known, else as listed by the payload. Nil when
+	// unknown.
+	Base         string
+	ChangedFiles []string
+
+	// Head commit message or pull request title, with the build directives
+	Message    string
+	Directives *Directives
+
+	// Pull request sent from another repository, whose title is written by
+	// users without access to the repository
+	Fork bool
+
+	// The pull request or branch of the event, e.g. repo#42 or
+	// repo@refs/heads/master, whose newer builds supersede the older ones.
+	// Empty when the builds of the event are never superseded.
+	BuildGroup string
+
+	// Name of the pushed branch, empty for the other events
+	Branch string
+
 	Envs []string
 
 	StoredUser *user.User
@@ -97,6 +125,24 @@ type WebHookCallbacks interface {
 	GetLogFields(string) logrus.Fields
 }
 
+// TaskReporter is implemented by the callbacks which report each task of
+// the watched events, besides the status of the whole event.
+type TaskReporter interface {
+	ReportTask(*setting.Config, *tasks.Task) error
+}
+
+func reportTask(handler WebHookCallbacks, l *logging.Logger, config *setting.Config, task *tasks.Task) {
+	r, ok := handler.(TaskReporter)
+	if !ok {
+		return
+	}
+	if err := r.ReportTask(config, task); err != nil {
+		fields := handler.GetLogFields(err.Error())
+		fields["task"] = task.ID
+		l.WithFields(fields).Error("Failed reporting task")
+	}
+}
+
 type GitWebHook struct {
 	Context   *GitContext
 	Payload   interface{}
@@ -118,9 +164,14 @@ func newGitWebHook(payload interface{}, w *mhook.WebHook, u *user.User, header w
 }
 
 func NewGitContext(hookType, kindEvent string, payload interface{}) *GitContext {
-	if hookType == "github" {
+	switch hookType {
+	case "github":
 		return NewGitContextGitHub(kindEvent, payload)
-	} else {
+	case "gitea", "forgejo":
+		return NewGitContextGitea(kindEvent, payload)
+	case "bitbucket":
+		return NewGitContextBitbucket(kindEvent, payload)
+	default:
 		return NewGitContextGitLab(kindEvent, payload)
 	}
 }
@@ -152,6 +203,20 @@ func (h *GitWebHook) HandleEvent(m *mottainai.Mottainai, l *logging.Logger, db *
 		return "", ""
 	}
 
+	h.Context.Directives = ParseDirectives(h.Context.Message)
+	if h.Context.Fork {
+		h.Context.Directives.IgnoreEnv()
+	}
+	if h.Context.Directives.Skip {
+		fields := h.CBHandler.GetLogFields("")
+		fields["directives"] = h.Context.Directives.String()
+		l.WithFields(fields).Info("Build skipped by the directives")
+		return "", ""
+	}
+
+	// The defaults of the kind of event, if any, replace the default ones
+	h.Hook = h.Hook.ForEvent(h.Context.KindEvent)
+
 	if idTask, err = h.SendTask(db, m, l); err != nil {
 		l.WithFields(h.CBHandler.GetLogFields(err.Error())).Error("Failed sending task")
 	}
@@ -160,6 +225,18 @@ func (h *GitWebHook) HandleEvent(m *mottainai.Mottainai, l *logging.Logger, db *
 		l.WithFields(h.CBHandler.GetLogFields(err.Error())).Error("Failed sending pipeline")
 	}
 
+	// Only a build actually sent replaces the older ones
+	if h.Hook.CancelsSuperseded() && (idTask != "" || idPipeline != "") {
+		h.CancelSuperseded(db, l, idTask, idPipeline)
+	}
+
+	if h.Context.Branch != "" && (idTask != "" || idPipeline != "") {
+		err = h.RecordBranchBuild(db, mhook.Build{Task: idTask, Pipeline: idPipeline})
+		if err != nil {
+			l.WithFields(h.CBHandler.GetLogFields(err.Error())).Error("Failed recording the branch build")
+		}
+	}
+
 	return idTask, idPipeline
 }
 
@@ -227,25 +304,15 @@ func (h *GitWebHook) PrepareGitDir(db *database.Database) error {
 	}
 
 	if h.Hook.Auth != "" {
-		auth := h.Hook.Auth
-		secret, err := db.Driver.GetSecret(h.Hook.Auth)
-		if err == nil {
-			auth = secret.Secret
-		} else {
-			secret, err := db.Driver.GetSecretByName(h.Hook.Auth)
-			if err == nil {
-				auth = secret.Secret
-			}
-		}
+		auth := h.GetAuth(db)
 
 		if strings.HasPrefix(auth, "auth:") {
-			a := strings.TrimPrefix(auth, "auth:")
-			data := strings.Split(a, ":")
-			if len(data) != 2 {
+			username, password, ok := BasicAuthCredentials(auth)
+			if !ok {
 				err = errors.New("Invalid credentials")
 				return err
 			}
-			opts.Auth = &gith.BasicAuth{Username: data[0], Password: data[1]}
+			opts.Auth = &gith.BasicAuth{Username: username, Password: password}
 
 		} else {
 			signer, err := ssh.ParsePrivateKey([]byte(auth))
@@ -278,7 +345,26 @@ func (h *GitWebHook) PrepareGitDir(db *database.Database) error {
 		return err
 	}
 
-	if h.Context.KindEvent == "pull_request" {
+	if h.Context.CheckoutRef != "" {
+		err = utils.GitCheckoutRef(r, "origin", h.Context.CheckoutRef)
+		if err != nil {
+			os.RemoveAll(h.Context.Dir)
+			err = errors.New("Failed checkout repo: " + err.Error())
+			h.CBHandler.SetFailureStatus(err.Error())
+			return err
+		}
+		if h.Context.Commit == "" {
+			// e.g. the tags of the GitHub create and release events
+			head, err := r.Head()
+			if err != nil {
+				os.RemoveAll(h.Context.Dir)
+				return errors.New("Failed resolving " + h.Context.CheckoutRef + ": " + err.Error())
+			}
+			h.Context.Commit = head.Hash().String()
+			h.Context.Checkout = h.Context.Commit
+			h.Context.Ref = h.Context.Commit
+		}
+	} else if h.Context.KindEvent == "pull_request" {
 		err = utils.GitCheckoutPullRequest(r, "origin", h.Context.Checkout)
 		if err != nil {
 			os.RemoveAll(h.Context.Dir)
@@ -304,15 +390,99 @@ func (h *GitWebHook) PrepareGitDir(db *database.Database) error {
 		}
 	}
 
+	// Branches and tags pushed for the first time have a zero base
+	if strings.Trim(h.Context.Base, "0") != "" {
+		// The base branch of a pull request can move on after it's opened,
+		// only the changes since they diverged belong to the pull request
+		base := h.Context.Base
+		if mb, err := utils.GitMergeBase(r, base, h.Context.Commit); err == nil {
+			base = mb
+		}
+		if files, err := utils.GitChangedFiles(r, base, h.Context.Commit); err == nil {
+			h.Context.ChangedFiles = files
+		}
+	}
+
 	return nil
 }
 
+// PayloadChangedFiles returns the files added, modified or removed by the
+// commits of a push payload.
+func PayloadChangedFiles(lists ...[]string) []string {
+	files := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, l := range lists {
+		for _, f := range l {
+			if !seen[f] {
+				seen[f] = true
+				files = append(files, f)
+			}
+		}
+	}
+	return files
+}
+
+// GetAuth returns the credentials of the webhook, looking them up in the
+// secrets when Auth is the ID or the name of a secret.
+func (h *GitWebHook) GetAuth(db *database.Database) string {
+	if h.Hook.Auth == "" {
+		return ""
+	}
+	if secret, err := db.Driver.GetSecret(h.Hook.Auth); err == nil {
+		return secret.Secret
+	}
+	if secret, err := db.Driver.GetSecretByName(h.Hook.Auth); err == nil {
+		return secret.Secret
+	}
+	return h.Hook.Auth
+}
+
+// BasicAuthCredentials splits credentials in the auth:<user>:<password>
+// format.
+func BasicAuthCredentials(auth string) (string, string, bool) {
+	if !strings.HasPrefix(auth, "auth:") {
+		return "", "", false
+	}
+	data := strings.Split(strings.TrimPrefix(auth, "auth:"), ":")
+	if len(data) != 2 {
+		return "", "", false
+	}
+	return data[0], data[1], true
+}
+
+// GetHookTemplate returns the task template of the webhook, with the
+// parameters to instantiate it.
+func (h *GitWebHook) GetHookTemplate(db *database.Database) (*tasks.TaskTemplate, map[string]string, error) {
+	tmpl, err := db.GetTaskTemplateByRef(h.Hook.Template)
+	if err != nil {
+		return nil, nil, err
+	}
+	params, err := tasks.ParseTemplateParams(h.Hook.TemplateParams)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &tmpl, params, nil
+}
+
 func (h *GitWebHook) GetHookTask(db *database.Database) (*tasks.Task, error) {
 	var t *tasks.Task
 	var err error
 
 	exists := false
-	if h.Hook.HasTask() {
+	if h.Hook.HasTemplate() {
+		tmpl, params, err := h.GetHookTemplate(db)
+		if err != nil {
+			return nil, err
+		} else if tmpl.IsPipeline() {
+			// The template is run by CreateHookPipeline
+			return nil, nil
+		}
+		t, err = tmpl.NewTask(params)
+		if err != nil {
+			return nil, err
+		}
+		exists = true
+	} else if h.Hook.HasTask() {
 		t, err = h.Hook.ReadTask()
 		if err != nil {
 			return nil, err
@@ -341,8 +511,13 @@ func (h *GitWebHook) GetHookTask(db *database.Database) (*tasks.Task, error) {
 	}
 
 	t.Owner = h.Context.StoredUser.ID
-	t.Source = h.Context.UserRepo
-	t.Commit = h.Context.Commit
+	// Kept as defined by the task when unknown, e.g. in generic webhooks
+	if h.Context.UserRepo != "" {
+		t.Source = h.Context.UserRepo
+	}
+	if h.Context.Commit != "" {
+		t.Commit = h.Context.Commit
+	}
 	t.Queue = QueueSetting(db)
 	t.CreatedTime = time.Now().Format("20060102150405")
 
@@ -354,7 +529,19 @@ func (h *GitWebHook) GetHookPipeline(db *database.Database) (*tasks.Pipeline, er
 	var err error
 
 	exists := false
-	if h.Hook.HasPipeline() {
+	if h.Hook.HasTemplate() {
+		tmpl, params, err := h.GetHookTemplate(db)
+		if err != nil {
+			return nil, err
+		} else if !tmpl.IsPipeline() {
+			return nil, nil
+		}
+		t, err = tmpl.NewPipeline(params)
+		if err != nil {
+			return nil, err
+		}
+		exists = true
+	} else if h.Hook.HasPipeline() {
 		t, err = h.Hook.ReadPipeline()
 		if err != nil {
 			return nil, err
@@ -383,6 +570,11 @@ func (h *GitWebHook) GetHookPipeline(db *database.Database) (*tasks.Pipeline, er
 		return nil, nil
 	}
 
+	h.Context.Directives.FilterPipeline(t)
+	if len(t.Tasks) == 0 {
+		return nil, nil
+	}
+
 	t.Owner = h.Context.StoredUser.ID
 	// XXX:
 	t.Queue = QueueSetting(db)
@@ -399,9 +591,15 @@ func (h *GitWebHook) CreateHookTask(m *mottainai.Mottainai, db *database.Databas
 	} else if t == nil {
 		// POST: no pipeline available
 		return "", nil
+	} else if !t.MatchPaths(h.Context.ChangedFiles) {
+		h.CBHandler.SetStatus(&success, &skippedDesc, nil)
+		return "", nil
 	}
 
 	h.CBHandler.LoadEventEnvs2Task(t)
+	h.Context.Directives.ApplyTask(t)
+	t.Notifications = append(t.Notifications, h.Hook.Notifications...)
+	t.BuildGroup = h.buildGroup()
 
 	docID, err := db.Driver.CreateTask(t.ToMap())
 	if err != nil {
@@ -410,27 +608,19 @@ func (h *GitWebHook) CreateHookTask(m *mottainai.Mottainai, db *database.Databas
 	}
 
 	m.SendTask(docID)
+	t.ID = docID
 
 	var url string
 	m.Invoke(func(config *setting.Config) {
 		url = config.GetWeb().BuildAbsURL("/tasks/display/" + docID)
+		h.logDirectives(config, t)
+		reportTask(h.CBHandler, l, config, t)
 	})
 
 	// Create the 'pending' status and send it
 	h.CBHandler.SetStatus(&pending, &pendingDesc, &url)
 
-	m.Invoke(func(a *anagent.Anagent) {
-		data := NewWatcherEvent("task", docID, h.CBHandler)
-		a.Invoke(func(w map[string]*WatcherEvent) {
-			l.WithFields(logrus.Fields{
-				"component": "webhook_global_watcher",
-				"event":     "add",
-			}).Debug("Add event to global watcher")
-			a.Lock()
-			defer a.Unlock()
-			w[h.Context.Uid] = data
-		})
-	})
+	h.watch(m, l, NewWatcherEvent("task", docID, h.CBHandler))
 
 	return docID, nil
 }
@@ -444,6 +634,12 @@ func (h *GitWebHook) CreateHookPipeline(m *mottainai.Mottainai, db *database.Dat
 		return "", nil
 	}
 
+	t.FilterPaths(h.Context.ChangedFiles)
+	if len(t.Tasks) == 0 {
+		h.CBHandler.SetStatus(&success, &skippedDesc, nil)
+		return "", nil
+	}
+
 	// do not allow automatic tag from PR
 	for i, p := range t.Tasks { // Duplicated in API.
 		if h.Context.KindEvent == "pull_request" || h.Context.KindEvent == "merge_request" {
@@ -454,11 +650,16 @@ func (h *GitWebHook) CreateHookPipeline(m *mottainai.Mottainai, db *database.Dat
 			p.RootTask = ""
 		}
 		p.Owner = h.Context.StoredUser.ID
-		p.Source = h.Context.UserRepo
-		p.Commit = h.Context.Commit
+		if h.Context.UserRepo != "" {
+			p.Source = h.Context.UserRepo
+		}
+		if h.Context.Commit != "" {
+			p.Commit = h.Context.Commit
+		}
 		p.Status = setting.TASK_STATE_WAIT
 
 		h.CBHandler.LoadEventEnvs2Task(&p)
+		h.Context.Directives.ApplyTask(&p)
 
 		id, err := db.Driver.CreateTask(p.ToMap())
 		if err != nil {
@@ -467,6 +668,8 @@ func (h *GitWebHook) CreateHookPipeline(m *mottainai.Mottainai, db *database.Dat
 		p.ID = id
 		t.Tasks[i] = p
 	}
+	t.Notifications = append(t.Notifications, h.Hook.Notifications...)
+	t.BuildGroup = h.buildGroup()
 
 	docID, err := db.Driver.CreatePipeline(t.ToMap(false))
 	if err != nil {
@@ -487,13 +690,140 @@ func (h *GitWebHook) CreateHookPipeline(m *mottainai.Mottainai, db *database.Dat
 	var url string
 	m.Invoke(func(config *setting.Config) {
 		url = config.GetWeb().BuildURI("/pipeline/" + docID)
+		for _, p := range t.Tasks {
+			h.logDirectives(config, &p)
+			reportTask(h.CBHandler, l, config, &p)
+		}
 	})
 
 	// Create the 'pending' status and send it
 	h.CBHandler.SetStatus(&pending, &pendingDesc, &url)
 
+	h.watch(m, l, NewWatcherEvent("pipeline", docID, h.CBHandler))
+
+	return docID, nil
+}
+
+// logDirectives records the directives applied to the task in its log.
+func (h *GitWebHook) logDirectives(config *setting.Config, task *tasks.Task) {
+	if h.Context.Directives.IsEmpty() {
+		return
+	}
+	task.AppendBuildLog("Webhook directives applied: "+h.Context.Directives.String(),
+		config.GetStorage().ArtefactPath, config.GetWeb().LockPath)
+}
+
+// RecordBranchBuild records the build as the latest one of the pushed
+// branch in the webhook.
+func (h *GitWebHook) RecordBranchBuild(db *database.Database, b mhook.Build) error {
+	// The hook of the event is a copy, the recorded builds may be stale
+	w, err := db.Driver.GetWebHook(h.Hook.ID)
+	if err != nil {
+		return err
+	}
+	w.SetBranchBuild(h.Context.Branch, b)
+	return db.Driver.UpdateWebHook(w.ID, map[string]interface{}{
+		"branch_builds": w.ToMap()["branch_builds"],
+	})
+}
+
+// BranchName returns the name of the branch of a ref, or an empty string if
+// the ref isn't a branch.
+func BranchName(ref string) string {
+	if !strings.HasPrefix(ref, "refs/heads/") {
+		return ""
+	}
+	return strings.TrimPrefix(ref, "refs/heads/")
+}
+
+// watch adds the task or pipeline of the event to the global watcher.
+func (h *GitWebHook) watch(m *mottainai.Mottainai, l *logging.Logger, event *WatcherEvent) {
+	addWatcherEvent(m, l, h.Context.Uid, event)
+}
+
+// buildGroup returns the build group of the event, scoped to the webhook.
+func (h *GitWebHook) buildGroup() string {
+	if h.Context.BuildGroup == "" {
+		return ""
+	}
+	return h.Hook.ID + "/" + h.Context.BuildGroup
+}
+
+// unfinishedTasks returns the tasks of the IDs still in progress.
+func unfinishedTasks(db *database.Database, ids []string) []string {
+	res := make([]string, 0)
+	for _, id := range ids {
+		t, err := db.Driver.GetTask(db.Config, id)
+		if err == nil && !tasks.IsFinalState(t.Status) {
+			res = append(res, id)
+		}
+	}
+	return res
+}
+
+// CancelSuperseded stops the tasks and pipelines of the build group of the
+// event still in progress, except the ones just sent. They are marked as
+// superseded by the new build, so the watcher of the replica which sent them
+// reports their commits as superseded.
+func (h *GitWebHook) CancelSuperseded(db *database.Database, l *logging.Logger, idTask, idPipeline string) {
+	group := h.buildGroup()
+	if group == "" {
+		return
+	}
+	newer := idPipeline
+	if newer == "" {
+		newer = idTask
+	}
+
+	stop := func(kind, id string, ids []string) {
+		fields := h.CBHandler.GetLogFields("")
+		fields[kind] = id
+		l.WithFields(fields).Info("Stopping the superseded build")
+
+		for _, tid := range ids {
+			if err := db.StopTask(tid); err != nil && !database.IsConflict(err) {
+				fields["error"] = err.Error()
+				l.WithFields(fields).Error("Failed stopping the superseded task " + tid)
+			}
+		}
+	}
+
+	groupTasks, err := db.Driver.AllBuildGroupTasks(db.Config, group)
+	if err != nil {
+		l.WithFields(h.CBHandler.GetLogFields(err.Error())).Error("Failed looking up the superseded tasks")
+	}
+	for _, t := range groupTasks {
+		if t.ID == idTask || tasks.IsFinalState(t.Status) {
+			continue
+		}
+		db.Driver.UpdateTask(t.ID, map[string]interface{}{"superseded_by": newer})
+		stop("task", t.ID, []string{t.ID})
+	}
+
+	pipelines, err := db.Driver.AllBuildGroupPipelines(db.Config, group)
+	if err != nil {
+		l.WithFields(h.CBHandler.GetLogFields(err.Error())).Error("Failed looking up the superseded pipelines")
+	}
+	for _, p := range pipelines {
+		if p.ID == idPipeline {
+			continue
+		}
+		ids := make([]string, 0)
+		for _, t := range p.Tasks {
+			ids = append(ids, t.ID)
+		}
+		ids = unfinishedTasks(db, ids)
+		if len(ids) == 0 {
+			continue
+		}
+		db.Driver.UpdatePipeline(p.ID, map[string]interface{}{"superseded_by": newer})
+		stop("pipeline", p.ID, ids)
+	}
+}
+
+// addWatcherEvent makes the global watcher report the event once done.
+func addWatcherEvent(m *mottainai.Mottainai, l *logging.Logger, uid string, data *WatcherEvent) {
 	m.Invoke(func(a *anagent.Anagent) {
-		data := NewWatcherEvent("pipeline", docID, h.CBHandler)
 		a.Invoke(func(w map[string]*WatcherEvent) {
 			l.WithFields(logrus.Fields{
 				"component": "webhook_global_watcher",
@@ -501,11 +831,9 @@ func (h *GitWebHook) CreateHookPipeline(m *mottainai.Mottainai, db *database.Dat
 			}).Debug("Add event to global watcher")
 			a.Lock()
 			defer a.Unlock()
-			w[h.Context.Uid] = data
+			w[uid] = data
 		})
 	})
-
-	return docID, nil
 }
 
 func (h *GitWebHook) GetLogFields(err string) logrus.Fields {
@@ -536,6 +864,12 @@ func (h *GitWebHook) SendTask(db *database.Database, m *mottainai.Mottainai, log
 	}
 	defer os.RemoveAll(h.Context.Dir)
 
+	if !h.Hook.MatchPaths(h.Context.ChangedFiles) {
+		logger.WithFields(h.CBHandler.GetLogFields("")).Info("No changed paths match the webhook, skipping")
+		h.CBHandler.SetStatus(&success, &skippedDesc, nil)
+		return "", nil
+	}
+
 	// Create the 'pending' status and send it
 	h.CBHandler.SetPendingStatus()
 
@@ -561,6 +895,12 @@ func (h *GitWebHook) SendPipeline(db *database.Database, m *mottainai.Mottainai,
 	}
 	defer os.RemoveAll(h.Context.Dir)
 
+	if !h.Hook.MatchPaths(h.Context.ChangedFiles) {
+		logger.WithFields(h.CBHandler.GetLogFields("")).Info("No changed paths match the webhook, skipping")
+		h.CBHandler.SetStatus(&success, &skippedDesc, nil)
+		return "", nil
+	}
+
 	pipelineId, err = h.CreateHookPipeline(m, db, logger)
 	if err != nil {
 		return "", err
@@ -593,4 +933,7 @@ func QueueSetting(db *database.Database) string {
 func Setup(m *mottainai.Mottainai) {
 	SetupGitHub(m)
 	SetupGitLab(m)
+	SetupGitea(m)
+	SetupBitbucket(m)
+	SetupGeneric(m)
 }
@@ -0,0 +1,97 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package webhook
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	database "github.com/MottainaiCI/mottainai-server/pkg/db"
+	tiedot "github.com/MottainaiCI/mottainai-server/pkg/db/tiedot"
+	logging "github.com/MottainaiCI/mottainai-server/pkg/logging"
+	setting "github.com/MottainaiCI/mottainai-server/pkg/settings"
+	tasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+	mhook "github.com/MottainaiCI/mottainai-server/pkg/webhook"
+)
+
+func TestCancelSuperseded(t *testing.T) {
+	dir, err := ioutil.TempDir("", "webhook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := setting.NewConfig(nil)
+	driver := tiedot.New(dir)
+	driver.GetAgent().Map(config)
+	driver.Init()
+	db := &database.Database{Backend: "tiedot", Config: config, Driver: driver}
+
+	const group = "1/Hello-World@refs/heads/master"
+	newTask := func(status, group string) string {
+		id, err := db.Driver.InsertTask(&tasks.Task{Status: status, BuildGroup: group})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	running := newTask(setting.TASK_STATE_RUNNING, group)
+	done := newTask(setting.TASK_STATE_DONE, group)
+	other := newTask(setting.TASK_STATE_RUNNING, "1/Hello-World@refs/heads/dev")
+	sent := newTask(setting.TASK_STATE_RUNNING, group)
+
+	pipelineTask := newTask(setting.TASK_STATE_QUEUED, "")
+	pipeline, err := db.Driver.InsertPipeline(&tasks.Pipeline{
+		BuildGroup: group,
+		Tasks:      map[string]tasks.Task{"build": {ID: pipelineTask}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := &GitHubWebHook{GitWebHook: &GitWebHook{
+		Context: &GitContext{BuildGroup: "Hello-World@refs/heads/master"},
+		Hook:    &mhook.WebHook{ID: "1"},
+	}}
+	h.CBHandler = h
+	h.CancelSuperseded(db, logging.New(), sent, "")
+
+	status := func(id string) string {
+		task, _ := db.Driver.GetTask(db.Config, id)
+		return task.Status
+	}
+	if status(running) != setting.TASK_STATE_ASK_STOP || status(pipelineTask) != setting.TASK_STATE_STOPPED {
+		t.Error("The superseded builds weren't stopped", status(running), status(pipelineTask))
+	}
+	if status(done) != setting.TASK_STATE_DONE || status(other) != setting.TASK_STATE_RUNNING ||
+		status(sent) != setting.TASK_STATE_RUNNING {
+		t.Error("Builds stopped outside of the superseded ones")
+	}
+
+	task, _ := db.Driver.GetTask(db.Config, running)
+	pip, _ := db.Driver.GetPipeline(db.Config, pipeline)
+	if task.SupersededBy != sent || pip.SupersededBy != sent {
+		t.Error("The superseded builds weren't marked", task.SupersededBy, pip.SupersededBy)
+	}
+}
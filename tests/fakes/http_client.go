@@ -7,6 +7,7 @@ import (
 
 	"github.com/MottainaiCI/mottainai-server/pkg/client"
 	"github.com/MottainaiCI/mottainai-server/pkg/event"
+	"github.com/MottainaiCI/mottainai-server/pkg/nodes"
 	"github.com/MottainaiCI/mottainai-server/routes/schema"
 	"github.com/mudler/anagent"
 )
@@ -368,6 +369,32 @@ type FakeHttpClient struct {
 		result1 event.APIResponse
 		result2 error
 	}
+	PipelinePlanCreateStub        func(map[string]interface{}) (event.APIResponse, error)
+	pipelinePlanCreateMutex       sync.RWMutex
+	pipelinePlanCreateArgsForCall []struct {
+		arg1 map[string]interface{}
+	}
+	pipelinePlanCreateReturns struct {
+		result1 event.APIResponse
+		result2 error
+	}
+	pipelinePlanCreateReturnsOnCall map[int]struct {
+		result1 event.APIResponse
+		result2 error
+	}
+	TaskTemplateCreateStub        func(map[string]interface{}) (event.APIResponse, error)
+	taskTemplateCreateMutex       sync.RWMutex
+	taskTemplateCreateArgsForCall []struct {
+		arg1 map[string]interface{}
+	}
+	taskTemplateCreateReturns struct {
+		result1 event.APIResponse
+		result2 error
+	}
+	taskTemplateCreateReturnsOnCall map[int]struct {
+		result1 event.APIResponse
+		result2 error
+	}
 	PlanCreateStub        func(map[string]interface{}) (event.APIResponse, error)
 	planCreateMutex       sync.RWMutex
 	planCreateArgsForCall []struct {
@@ -394,11 +421,38 @@ type FakeHttpClient struct {
 		result1 event.APIResponse
 		result2 error
 	}
-	RegisterNodeStub        func(string, string) (event.APIResponse, error)
+	TaskTemplateDeleteStub        func(string) (event.APIResponse, error)
+	taskTemplateDeleteMutex       sync.RWMutex
+	taskTemplateDeleteArgsForCall []struct {
+		arg1 string
+	}
+	taskTemplateDeleteReturns struct {
+		result1 event.APIResponse
+		result2 error
+	}
+	taskTemplateDeleteReturnsOnCall map[int]struct {
+		result1 event.APIResponse
+		result2 error
+	}
+	PlanRunStub        func(string) (event.APIResponse, error)
+	planRunMutex       sync.RWMutex
+	planRunArgsForCall []struct {
+		arg1 string
+	}
+	planRunReturns struct {
+		result1 event.APIResponse
+		result2 error
+	}
+	planRunReturnsOnCall map[int]struct {
+		result1 event.APIResponse
+		result2 error
+	}
+	RegisterNodeStub        func(string, string, nodes.NodeReport) (event.APIResponse, error)
 	registerNodeMutex       sync.RWMutex
 	registerNodeArgsForCall []struct {
 		arg1 string
 		arg2 string
+		arg3 nodes.NodeReport
 	}
 	registerNodeReturns struct {
 		result1 event.APIResponse
@@ -733,6 +787,32 @@ type FakeHttpClient struct {
 		result1 []byte
 		result2 error
 	}
+	WebHookPipelineYamlStub        func(string) ([]byte, error)
+	webHookPipelineYamlMutex       sync.RWMutex
+	webHookPipelineYamlArgsForCall []struct {
+		arg1 string
+	}
+	webHookPipelineYamlReturns struct {
+		result1 []byte
+		result2 error
+	}
+	webHookPipelineYamlReturnsOnCall map[int]struct {
+		result1 []byte
+		result2 error
+	}
+	WebHookTaskYamlStub        func(string) ([]byte, error)
+	webHookTaskYamlMutex       sync.RWMutex
+	webHookTaskYamlArgsForCall []struct {
+		arg1 string
+	}
+	webHookTaskYamlReturns struct {
+		result1 []byte
+		result2 error
+	}
+	webHookTaskYamlReturnsOnCall map[int]struct {
+		result1 []byte
+		result2 error
+	}
 	TaskStreamStub        func(string, string) ([]byte, error)
 	taskStreamMutex       sync.RWMutex
 	taskStreamArgsForCall []struct {
@@ -996,6 +1076,48 @@ type FakeHttpClient struct {
 		result1 event.APIResponse
 		result2 error
 	}
+	WebHookPipelinePutStub        func(string, []byte) (event.APIResponse, error)
+	webHookPipelinePutMutex       sync.RWMutex
+	webHookPipelinePutArgsForCall []struct {
+		arg1 string
+		arg2 []byte
+	}
+	webHookPipelinePutReturns struct {
+		result1 event.APIResponse
+		result2 error
+	}
+	webHookPipelinePutReturnsOnCall map[int]struct {
+		result1 event.APIResponse
+		result2 error
+	}
+	WebHookTaskPutStub        func(string, []byte) (event.APIResponse, error)
+	webHookTaskPutMutex       sync.RWMutex
+	webHookTaskPutArgsForCall []struct {
+		arg1 string
+		arg2 []byte
+	}
+	webHookTaskPutReturns struct {
+		result1 event.APIResponse
+		result2 error
+	}
+	webHookTaskPutReturnsOnCall map[int]struct {
+		result1 event.APIResponse
+		result2 error
+	}
+	TaskTemplateRunStub        func(string, map[string]string) (event.APIResponse, error)
+	taskTemplateRunMutex       sync.RWMutex
+	taskTemplateRunArgsForCall []struct {
+		arg1 string
+		arg2 map[string]string
+	}
+	taskTemplateRunReturns struct {
+		result1 event.APIResponse
+		result2 error
+	}
+	taskTemplateRunReturnsOnCall map[int]struct {
+		result1 event.APIResponse
+		result2 error
+	}
 	invocations      map[string][][]interface{}
 	invocationsMutex sync.RWMutex
 }
@@ -2728,6 +2850,134 @@ func (fake *FakeHttpClient) PipelineDeleteReturnsOnCall(i int, result1 event.API
 	}{result1, result2}
 }
 
+func (fake *FakeHttpClient) PipelinePlanCreate(arg1 map[string]interface{}) (event.APIResponse, error) {
+	fake.pipelinePlanCreateMutex.Lock()
+	ret, specificReturn := fake.pipelinePlanCreateReturnsOnCall[len(fake.pipelinePlanCreateArgsForCall)]
+	fake.pipelinePlanCreateArgsForCall = append(fake.pipelinePlanCreateArgsForCall, struct {
+		arg1 map[string]interface{}
+	}{arg1})
+	fake.recordInvocation("PipelinePlanCreate", []interface{}{arg1})
+	fake.pipelinePlanCreateMutex.Unlock()
+	if fake.PipelinePlanCreateStub != nil {
+		return fake.PipelinePlanCreateStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.pipelinePlanCreateReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeHttpClient) PipelinePlanCreateCallCount() int {
+	fake.pipelinePlanCreateMutex.RLock()
+	defer fake.pipelinePlanCreateMutex.RUnlock()
+	fake.taskTemplateCreateMutex.RLock()
+	defer fake.taskTemplateCreateMutex.RUnlock()
+	return len(fake.pipelinePlanCreateArgsForCall)
+}
+
+func (fake *FakeHttpClient) PipelinePlanCreateCalls(stub func(map[string]interface{}) (event.APIResponse, error)) {
+	fake.pipelinePlanCreateMutex.Lock()
+	defer fake.pipelinePlanCreateMutex.Unlock()
+	fake.PipelinePlanCreateStub = stub
+}
+
+func (fake *FakeHttpClient) PipelinePlanCreateArgsForCall(i int) map[string]interface{} {
+	fake.pipelinePlanCreateMutex.RLock()
+	defer fake.pipelinePlanCreateMutex.RUnlock()
+	argsForCall := fake.pipelinePlanCreateArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeHttpClient) PipelinePlanCreateReturns(result1 event.APIResponse, result2 error) {
+	fake.pipelinePlanCreateMutex.Lock()
+	defer fake.pipelinePlanCreateMutex.Unlock()
+	fake.PipelinePlanCreateStub = nil
+	fake.pipelinePlanCreateReturns = struct {
+		result1 event.APIResponse
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeHttpClient) PipelinePlanCreateReturnsOnCall(i int, result1 event.APIResponse, result2 error) {
+	fake.pipelinePlanCreateMutex.Lock()
+	defer fake.pipelinePlanCreateMutex.Unlock()
+	fake.PipelinePlanCreateStub = nil
+	if fake.pipelinePlanCreateReturnsOnCall == nil {
+		fake.pipelinePlanCreateReturnsOnCall = make(map[int]struct {
+			result1 event.APIResponse
+			result2 error
+		})
+	}
+	fake.pipelinePlanCreateReturnsOnCall[i] = struct {
+		result1 event.APIResponse
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeHttpClient) TaskTemplateCreate(arg1 map[string]interface{}) (event.APIResponse, error) {
+	fake.taskTemplateCreateMutex.Lock()
+	ret, specificReturn := fake.taskTemplateCreateReturnsOnCall[len(fake.taskTemplateCreateArgsForCall)]
+	fake.taskTemplateCreateArgsForCall = append(fake.taskTemplateCreateArgsForCall, struct {
+		arg1 map[string]interface{}
+	}{arg1})
+	fake.recordInvocation("TaskTemplateCreate", []interface{}{arg1})
+	fake.taskTemplateCreateMutex.Unlock()
+	if fake.TaskTemplateCreateStub != nil {
+		return fake.TaskTemplateCreateStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.taskTemplateCreateReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeHttpClient) TaskTemplateCreateCallCount() int {
+	fake.taskTemplateCreateMutex.RLock()
+	defer fake.taskTemplateCreateMutex.RUnlock()
+	return len(fake.taskTemplateCreateArgsForCall)
+}
+
+func (fake *FakeHttpClient) TaskTemplateCreateCalls(stub func(map[string]interface{}) (event.APIResponse, error)) {
+	fake.taskTemplateCreateMutex.Lock()
+	defer fake.taskTemplateCreateMutex.Unlock()
+	fake.TaskTemplateCreateStub = stub
+}
+
+func (fake *FakeHttpClient) TaskTemplateCreateArgsForCall(i int) map[string]interface{} {
+	fake.taskTemplateCreateMutex.RLock()
+	defer fake.taskTemplateCreateMutex.RUnlock()
+	argsForCall := fake.taskTemplateCreateArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeHttpClient) TaskTemplateCreateReturns(result1 event.APIResponse, result2 error) {
+	fake.taskTemplateCreateMutex.Lock()
+	defer fake.taskTemplateCreateMutex.Unlock()
+	fake.TaskTemplateCreateStub = nil
+	fake.taskTemplateCreateReturns = struct {
+		result1 event.APIResponse
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeHttpClient) TaskTemplateCreateReturnsOnCall(i int, result1 event.APIResponse, result2 error) {
+	fake.taskTemplateCreateMutex.Lock()
+	defer fake.taskTemplateCreateMutex.Unlock()
+	fake.TaskTemplateCreateStub = nil
+	if fake.taskTemplateCreateReturnsOnCall == nil {
+		fake.taskTemplateCreateReturnsOnCall = make(map[int]struct {
+			result1 event.APIResponse
+			result2 error
+		})
+	}
+	fake.taskTemplateCreateReturnsOnCall[i] = struct {
+		result1 event.APIResponse
+		result2 error
+	}{result1, result2}
+}
+
 func (fake *FakeHttpClient) PlanCreate(arg1 map[string]interface{}) (event.APIResponse, error) {
 	fake.planCreateMutex.Lock()
 	ret, specificReturn := fake.planCreateReturnsOnCall[len(fake.planCreateArgsForCall)]
@@ -2812,6 +3062,8 @@ func (fake *FakeHttpClient) PlanDelete(arg1 string) (event.APIResponse, error) {
 func (fake *FakeHttpClient) PlanDeleteCallCount() int {
 	fake.planDeleteMutex.RLock()
 	defer fake.planDeleteMutex.RUnlock()
+	fake.taskTemplateDeleteMutex.RLock()
+	defer fake.taskTemplateDeleteMutex.RUnlock()
 	return len(fake.planDeleteArgsForCall)
 }
 
@@ -2854,17 +3106,144 @@ func (fake *FakeHttpClient) PlanDeleteReturnsOnCall(i int, result1 event.APIResp
 	}{result1, result2}
 }
 
-func (fake *FakeHttpClient) RegisterNode(arg1 string, arg2 string) (event.APIResponse, error) {
+func (fake *FakeHttpClient) TaskTemplateDelete(arg1 string) (event.APIResponse, error) {
+	fake.taskTemplateDeleteMutex.Lock()
+	ret, specificReturn := fake.taskTemplateDeleteReturnsOnCall[len(fake.taskTemplateDeleteArgsForCall)]
+	fake.taskTemplateDeleteArgsForCall = append(fake.taskTemplateDeleteArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	fake.recordInvocation("TaskTemplateDelete", []interface{}{arg1})
+	fake.taskTemplateDeleteMutex.Unlock()
+	if fake.TaskTemplateDeleteStub != nil {
+		return fake.TaskTemplateDeleteStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.taskTemplateDeleteReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeHttpClient) TaskTemplateDeleteCallCount() int {
+	fake.taskTemplateDeleteMutex.RLock()
+	defer fake.taskTemplateDeleteMutex.RUnlock()
+	return len(fake.taskTemplateDeleteArgsForCall)
+}
+
+func (fake *FakeHttpClient) TaskTemplateDeleteCalls(stub func(string) (event.APIResponse, error)) {
+	fake.taskTemplateDeleteMutex.Lock()
+	defer fake.taskTemplateDeleteMutex.Unlock()
+	fake.TaskTemplateDeleteStub = stub
+}
+
+func (fake *FakeHttpClient) TaskTemplateDeleteArgsForCall(i int) string {
+	fake.taskTemplateDeleteMutex.RLock()
+	defer fake.taskTemplateDeleteMutex.RUnlock()
+	argsForCall := fake.taskTemplateDeleteArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeHttpClient) TaskTemplateDeleteReturns(result1 event.APIResponse, result2 error) {
+	fake.taskTemplateDeleteMutex.Lock()
+	defer fake.taskTemplateDeleteMutex.Unlock()
+	fake.TaskTemplateDeleteStub = nil
+	fake.taskTemplateDeleteReturns = struct {
+		result1 event.APIResponse
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeHttpClient) TaskTemplateDeleteReturnsOnCall(i int, result1 event.APIResponse, result2 error) {
+	fake.taskTemplateDeleteMutex.Lock()
+	defer fake.taskTemplateDeleteMutex.Unlock()
+	fake.TaskTemplateDeleteStub = nil
+	if fake.taskTemplateDeleteReturnsOnCall == nil {
+		fake.taskTemplateDeleteReturnsOnCall = make(map[int]struct {
+			result1 event.APIResponse
+			result2 error
+		})
+	}
+	fake.taskTemplateDeleteReturnsOnCall[i] = struct {
+		result1 event.APIResponse
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeHttpClient) PlanRun(arg1 string) (event.APIResponse, error) {
+	fake.planRunMutex.Lock()
+	ret, specificReturn := fake.planRunReturnsOnCall[len(fake.planRunArgsForCall)]
+	fake.planRunArgsForCall = append(fake.planRunArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	fake.recordInvocation("PlanRun", []interface{}{arg1})
+	fake.planRunMutex.Unlock()
+	if fake.PlanRunStub != nil {
+		return fake.PlanRunStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.planRunReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeHttpClient) PlanRunCallCount() int {
+	fake.planRunMutex.RLock()
+	defer fake.planRunMutex.RUnlock()
+	return len(fake.planRunArgsForCall)
+}
+
+func (fake *FakeHttpClient) PlanRunCalls(stub func(string) (event.APIResponse, error)) {
+	fake.planRunMutex.Lock()
+	defer fake.planRunMutex.Unlock()
+	fake.PlanRunStub = stub
+}
+
+func (fake *FakeHttpClient) PlanRunArgsForCall(i int) string {
+	fake.planRunMutex.RLock()
+	defer fake.planRunMutex.RUnlock()
+	argsForCall := fake.planRunArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeHttpClient) PlanRunReturns(result1 event.APIResponse, result2 error) {
+	fake.planRunMutex.Lock()
+	defer fake.planRunMutex.Unlock()
+	fake.PlanRunStub = nil
+	fake.planRunReturns = struct {
+		result1 event.APIResponse
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeHttpClient) PlanRunReturnsOnCall(i int, result1 event.APIResponse, result2 error) {
+	fake.planRunMutex.Lock()
+	defer fake.planRunMutex.Unlock()
+	fake.PlanRunStub = nil
+	if fake.planRunReturnsOnCall == nil {
+		fake.planRunReturnsOnCall = make(map[int]struct {
+			result1 event.APIResponse
+			result2 error
+		})
+	}
+	fake.planRunReturnsOnCall[i] = struct {
+		result1 event.APIResponse
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeHttpClient) RegisterNode(arg1 string, arg2 string, arg3 nodes.NodeReport) (event.APIResponse, error) {
 	fake.registerNodeMutex.Lock()
 	ret, specificReturn := fake.registerNodeReturnsOnCall[len(fake.registerNodeArgsForCall)]
 	fake.registerNodeArgsForCall = append(fake.registerNodeArgsForCall, struct {
 		arg1 string
 		arg2 string
-	}{arg1, arg2})
-	fake.recordInvocation("RegisterNode", []interface{}{arg1, arg2})
+		arg3 nodes.NodeReport
+	}{arg1, arg2, arg3})
+	fake.recordInvocation("RegisterNode", []interface{}{arg1, arg2, arg3})
 	fake.registerNodeMutex.Unlock()
 	if fake.RegisterNodeStub != nil {
-		return fake.RegisterNodeStub(arg1, arg2)
+		return fake.RegisterNodeStub(arg1, arg2, arg3)
 	}
 	if specificReturn {
 		return ret.result1, ret.result2
@@ -2879,17 +3258,17 @@ func (fake *FakeHttpClient) RegisterNodeCallCount() int {
 	return len(fake.registerNodeArgsForCall)
 }
 
-func (fake *FakeHttpClient) RegisterNodeCalls(stub func(string, string) (event.APIResponse, error)) {
+func (fake *FakeHttpClient) RegisterNodeCalls(stub func(string, string, nodes.NodeReport) (event.APIResponse, error)) {
 	fake.registerNodeMutex.Lock()
 	defer fake.registerNodeMutex.Unlock()
 	fake.RegisterNodeStub = stub
 }
 
-func (fake *FakeHttpClient) RegisterNodeArgsForCall(i int) (string, string) {
+func (fake *FakeHttpClient) RegisterNodeArgsForCall(i int) (string, string, nodes.NodeReport) {
 	fake.registerNodeMutex.RLock()
 	defer fake.registerNodeMutex.RUnlock()
 	argsForCall := fake.registerNodeArgsForCall[i]
-	return argsForCall.arg1, argsForCall.arg2
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
 }
 
 func (fake *FakeHttpClient) RegisterNodeReturns(result1 event.APIResponse, result2 error) {
@@ -4488,6 +4867,10 @@ func (fake *FakeHttpClient) TaskLogArtefact(arg1 string) ([]byte, error) {
 func (fake *FakeHttpClient) TaskLogArtefactCallCount() int {
 	fake.taskLogArtefactMutex.RLock()
 	defer fake.taskLogArtefactMutex.RUnlock()
+	fake.webHookPipelineYamlMutex.RLock()
+	defer fake.webHookPipelineYamlMutex.RUnlock()
+	fake.webHookTaskYamlMutex.RLock()
+	defer fake.webHookTaskYamlMutex.RUnlock()
 	return len(fake.taskLogArtefactArgsForCall)
 }
 
@@ -4530,6 +4913,134 @@ func (fake *FakeHttpClient) TaskLogArtefactReturnsOnCall(i int, result1 []byte,
 	}{result1, result2}
 }
 
+func (fake *FakeHttpClient) WebHookPipelineYaml(arg1 string) ([]byte, error) {
+	fake.webHookPipelineYamlMutex.Lock()
+	ret, specificReturn := fake.webHookPipelineYamlReturnsOnCall[len(fake.webHookPipelineYamlArgsForCall)]
+	fake.webHookPipelineYamlArgsForCall = append(fake.webHookPipelineYamlArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	fake.recordInvocation("WebHookPipelineYaml", []interface{}{arg1})
+	fake.webHookPipelineYamlMutex.Unlock()
+	if fake.WebHookPipelineYamlStub != nil {
+		return fake.WebHookPipelineYamlStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.webHookPipelineYamlReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeHttpClient) WebHookPipelineYamlCallCount() int {
+	fake.webHookPipelineYamlMutex.RLock()
+	defer fake.webHookPipelineYamlMutex.RUnlock()
+	fake.webHookTaskYamlMutex.RLock()
+	defer fake.webHookTaskYamlMutex.RUnlock()
+	return len(fake.webHookPipelineYamlArgsForCall)
+}
+
+func (fake *FakeHttpClient) WebHookPipelineYamlCalls(stub func(string) ([]byte, error)) {
+	fake.webHookPipelineYamlMutex.Lock()
+	defer fake.webHookPipelineYamlMutex.Unlock()
+	fake.WebHookPipelineYamlStub = stub
+}
+
+func (fake *FakeHttpClient) WebHookPipelineYamlArgsForCall(i int) string {
+	fake.webHookPipelineYamlMutex.RLock()
+	defer fake.webHookPipelineYamlMutex.RUnlock()
+	argsForCall := fake.webHookPipelineYamlArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeHttpClient) WebHookPipelineYamlReturns(result1 []byte, result2 error) {
+	fake.webHookPipelineYamlMutex.Lock()
+	defer fake.webHookPipelineYamlMutex.Unlock()
+	fake.WebHookPipelineYamlStub = nil
+	fake.webHookPipelineYamlReturns = struct {
+		result1 []byte
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeHttpClient) WebHookPipelineYamlReturnsOnCall(i int, result1 []byte, result2 error) {
+	fake.webHookPipelineYamlMutex.Lock()
+	defer fake.webHookPipelineYamlMutex.Unlock()
+	fake.WebHookPipelineYamlStub = nil
+	if fake.webHookPipelineYamlReturnsOnCall == nil {
+		fake.webHookPipelineYamlReturnsOnCall = make(map[int]struct {
+			result1 []byte
+			result2 error
+		})
+	}
+	fake.webHookPipelineYamlReturnsOnCall[i] = struct {
+		result1 []byte
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeHttpClient) WebHookTaskYaml(arg1 string) ([]byte, error) {
+	fake.webHookTaskYamlMutex.Lock()
+	ret, specificReturn := fake.webHookTaskYamlReturnsOnCall[len(fake.webHookTaskYamlArgsForCall)]
+	fake.webHookTaskYamlArgsForCall = append(fake.webHookTaskYamlArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	fake.recordInvocation("WebHookTaskYaml", []interface{}{arg1})
+	fake.webHookTaskYamlMutex.Unlock()
+	if fake.WebHookTaskYamlStub != nil {
+		return fake.WebHookTaskYamlStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.webHookTaskYamlReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeHttpClient) WebHookTaskYamlCallCount() int {
+	fake.webHookTaskYamlMutex.RLock()
+	defer fake.webHookTaskYamlMutex.RUnlock()
+	return len(fake.webHookTaskYamlArgsForCall)
+}
+
+func (fake *FakeHttpClient) WebHookTaskYamlCalls(stub func(string) ([]byte, error)) {
+	fake.webHookTaskYamlMutex.Lock()
+	defer fake.webHookTaskYamlMutex.Unlock()
+	fake.WebHookTaskYamlStub = stub
+}
+
+func (fake *FakeHttpClient) WebHookTaskYamlArgsForCall(i int) string {
+	fake.webHookTaskYamlMutex.RLock()
+	defer fake.webHookTaskYamlMutex.RUnlock()
+	argsForCall := fake.webHookTaskYamlArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeHttpClient) WebHookTaskYamlReturns(result1 []byte, result2 error) {
+	fake.webHookTaskYamlMutex.Lock()
+	defer fake.webHookTaskYamlMutex.Unlock()
+	fake.WebHookTaskYamlStub = nil
+	fake.webHookTaskYamlReturns = struct {
+		result1 []byte
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeHttpClient) WebHookTaskYamlReturnsOnCall(i int, result1 []byte, result2 error) {
+	fake.webHookTaskYamlMutex.Lock()
+	defer fake.webHookTaskYamlMutex.Unlock()
+	fake.WebHookTaskYamlStub = nil
+	if fake.webHookTaskYamlReturnsOnCall == nil {
+		fake.webHookTaskYamlReturnsOnCall = make(map[int]struct {
+			result1 []byte
+			result2 error
+		})
+	}
+	fake.webHookTaskYamlReturnsOnCall[i] = struct {
+		result1 []byte
+		result2 error
+	}{result1, result2}
+}
+
 func (fake *FakeHttpClient) TaskStream(arg1 string, arg2 string) ([]byte, error) {
 	fake.taskStreamMutex.Lock()
 	ret, specificReturn := fake.taskStreamReturnsOnCall[len(fake.taskStreamArgsForCall)]
@@ -5739,6 +6250,12 @@ func (fake *FakeHttpClient) WebHookTaskUpdate(arg1 string, arg2 map[string]inter
 func (fake *FakeHttpClient) WebHookTaskUpdateCallCount() int {
 	fake.webHookTaskUpdateMutex.RLock()
 	defer fake.webHookTaskUpdateMutex.RUnlock()
+	fake.webHookPipelinePutMutex.RLock()
+	defer fake.webHookPipelinePutMutex.RUnlock()
+	fake.webHookTaskPutMutex.RLock()
+	defer fake.webHookTaskPutMutex.RUnlock()
+	fake.taskTemplateRunMutex.RLock()
+	defer fake.taskTemplateRunMutex.RUnlock()
 	return len(fake.webHookTaskUpdateArgsForCall)
 }
 
@@ -5781,6 +6298,204 @@ func (fake *FakeHttpClient) WebHookTaskUpdateReturnsOnCall(i int, result1 event.
 	}{result1, result2}
 }
 
+func (fake *FakeHttpClient) WebHookPipelinePut(arg1 string, arg2 []byte) (event.APIResponse, error) {
+	fake.webHookPipelinePutMutex.Lock()
+	ret, specificReturn := fake.webHookPipelinePutReturnsOnCall[len(fake.webHookPipelinePutArgsForCall)]
+	fake.webHookPipelinePutArgsForCall = append(fake.webHookPipelinePutArgsForCall, struct {
+		arg1 string
+		arg2 []byte
+	}{arg1, arg2})
+	fake.recordInvocation("WebHookPipelinePut", []interface{}{arg1, arg2})
+	fake.webHookPipelinePutMutex.Unlock()
+	if fake.WebHookPipelinePutStub != nil {
+		return fake.WebHookPipelinePutStub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.webHookPipelinePutReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeHttpClient) WebHookPipelinePutCallCount() int {
+	fake.webHookPipelinePutMutex.RLock()
+	defer fake.webHookPipelinePutMutex.RUnlock()
+	fake.webHookTaskPutMutex.RLock()
+	defer fake.webHookTaskPutMutex.RUnlock()
+	fake.taskTemplateRunMutex.RLock()
+	defer fake.taskTemplateRunMutex.RUnlock()
+	return len(fake.webHookPipelinePutArgsForCall)
+}
+
+func (fake *FakeHttpClient) WebHookPipelinePutCalls(stub func(string, []byte) (event.APIResponse, error)) {
+	fake.webHookPipelinePutMutex.Lock()
+	defer fake.webHookPipelinePutMutex.Unlock()
+	fake.WebHookPipelinePutStub = stub
+}
+
+func (fake *FakeHttpClient) WebHookPipelinePutArgsForCall(i int) (string, []byte) {
+	fake.webHookPipelinePutMutex.RLock()
+	defer fake.webHookPipelinePutMutex.RUnlock()
+	argsForCall := fake.webHookPipelinePutArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeHttpClient) WebHookPipelinePutReturns(result1 event.APIResponse, result2 error) {
+	fake.webHookPipelinePutMutex.Lock()
+	defer fake.webHookPipelinePutMutex.Unlock()
+	fake.WebHookPipelinePutStub = nil
+	fake.webHookPipelinePutReturns = struct {
+		result1 event.APIResponse
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeHttpClient) WebHookPipelinePutReturnsOnCall(i int, result1 event.APIResponse, result2 error) {
+	fake.webHookPipelinePutMutex.Lock()
+	defer fake.webHookPipelinePutMutex.Unlock()
+	fake.WebHookPipelinePutStub = nil
+	if fake.webHookPipelinePutReturnsOnCall == nil {
+		fake.webHookPipelinePutReturnsOnCall = make(map[int]struct {
+			result1 event.APIResponse
+			result2 error
+		})
+	}
+	fake.webHookPipelinePutReturnsOnCall[i] = struct {
+		result1 event.APIResponse
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeHttpClient) WebHookTaskPut(arg1 string, arg2 []byte) (event.APIResponse, error) {
+	fake.webHookTaskPutMutex.Lock()
+	ret, specificReturn := fake.webHookTaskPutReturnsOnCall[len(fake.webHookTaskPutArgsForCall)]
+	fake.webHookTaskPutArgsForCall = append(fake.webHookTaskPutArgsForCall, struct {
+		arg1 string
+		arg2 []byte
+	}{arg1, arg2})
+	fake.recordInvocation("WebHookTaskPut", []interface{}{arg1, arg2})
+	fake.webHookTaskPutMutex.Unlock()
+	if fake.WebHookTaskPutStub != nil {
+		return fake.WebHookTaskPutStub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.webHookTaskPutReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeHttpClient) WebHookTaskPutCallCount() int {
+	fake.webHookTaskPutMutex.RLock()
+	defer fake.webHookTaskPutMutex.RUnlock()
+	fake.taskTemplateRunMutex.RLock()
+	defer fake.taskTemplateRunMutex.RUnlock()
+	return len(fake.webHookTaskPutArgsForCall)
+}
+
+func (fake *FakeHttpClient) WebHookTaskPutCalls(stub func(string, []byte) (event.APIResponse, error)) {
+	fake.webHookTaskPutMutex.Lock()
+	defer fake.webHookTaskPutMutex.Unlock()
+	fake.WebHookTaskPutStub = stub
+}
+
+func (fake *FakeHttpClient) WebHookTaskPutArgsForCall(i int) (string, []byte) {
+	fake.webHookTaskPutMutex.RLock()
+	defer fake.webHookTaskPutMutex.RUnlock()
+	argsForCall := fake.webHookTaskPutArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeHttpClient) WebHookTaskPutReturns(result1 event.APIResponse, result2 error) {
+	fake.webHookTaskPutMutex.Lock()
+	defer fake.webHookTaskPutMutex.Unlock()
+	fake.WebHookTaskPutStub = nil
+	fake.webHookTaskPutReturns = struct {
+		result1 event.APIResponse
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeHttpClient) WebHookTaskPutReturnsOnCall(i int, result1 event.APIResponse, result2 error) {
+	fake.webHookTaskPutMutex.Lock()
+	defer fake.webHookTaskPutMutex.Unlock()
+	fake.WebHookTaskPutStub = nil
+	if fake.webHookTaskPutReturnsOnCall == nil {
+		fake.webHookTaskPutReturnsOnCall = make(map[int]struct {
+			result1 event.APIResponse
+			result2 error
+		})
+	}
+	fake.webHookTaskPutReturnsOnCall[i] = struct {
+		result1 event.APIResponse
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeHttpClient) TaskTemplateRun(arg1 string, arg2 map[string]string) (event.APIResponse, error) {
+	fake.taskTemplateRunMutex.Lock()
+	ret, specificReturn := fake.taskTemplateRunReturnsOnCall[len(fake.taskTemplateRunArgsForCall)]
+	fake.taskTemplateRunArgsForCall = append(fake.taskTemplateRunArgsForCall, struct {
+		arg1 string
+		arg2 map[string]string
+	}{arg1, arg2})
+	fake.recordInvocation("TaskTemplateRun", []interface{}{arg1, arg2})
+	fake.taskTemplateRunMutex.Unlock()
+	if fake.TaskTemplateRunStub != nil {
+		return fake.TaskTemplateRunStub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.taskTemplateRunReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeHttpClient) TaskTemplateRunCallCount() int {
+	fake.taskTemplateRunMutex.RLock()
+	defer fake.taskTemplateRunMutex.RUnlock()
+	return len(fake.taskTemplateRunArgsForCall)
+}
+
+func (fake *FakeHttpClient) TaskTemplateRunCalls(stub func(string, map[string]string) (event.APIResponse, error)) {
+	fake.taskTemplateRunMutex.Lock()
+	defer fake.taskTemplateRunMutex.Unlock()
+	fake.TaskTemplateRunStub = stub
+}
+
+func (fake *FakeHttpClient) TaskTemplateRunArgsForCall(i int) (string, map[string]string) {
+	fake.taskTemplateRunMutex.RLock()
+	defer fake.taskTemplateRunMutex.RUnlock()
+	argsForCall := fake.taskTemplateRunArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeHttpClient) TaskTemplateRunReturns(result1 event.APIResponse, result2 error) {
+	fake.taskTemplateRunMutex.Lock()
+	defer fake.taskTemplateRunMutex.Unlock()
+	fake.TaskTemplateRunStub = nil
+	fake.taskTemplateRunReturns = struct {
+		result1 event.APIResponse
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeHttpClient) TaskTemplateRunReturnsOnCall(i int, result1 event.APIResponse, result2 error) {
+	fake.taskTemplateRunMutex.Lock()
+	defer fake.taskTemplateRunMutex.Unlock()
+	fake.TaskTemplateRunStub = nil
+	if fake.taskTemplateRunReturnsOnCall == nil {
+		fake.taskTemplateRunReturnsOnCall = make(map[int]struct {
+			result1 event.APIResponse
+			result2 error
+		})
+	}
+	fake.taskTemplateRunReturnsOnCall[i] = struct {
+		result1 event.APIResponse
+		result2 error
+	}{result1, result2}
+}
+
 func (fake *FakeHttpClient) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
@@ -5846,10 +6561,14 @@ func (fake *FakeHttpClient) Invocations() map[string][][]interface{} {
 	defer fake.pipelineCreateMutex.RUnlock()
 	fake.pipelineDeleteMutex.RLock()
 	defer fake.pipelineDeleteMutex.RUnlock()
+	fake.pipelinePlanCreateMutex.RLock()
+	defer fake.pipelinePlanCreateMutex.RUnlock()
 	fake.planCreateMutex.RLock()
 	defer fake.planCreateMutex.RUnlock()
 	fake.planDeleteMutex.RLock()
 	defer fake.planDeleteMutex.RUnlock()
+	fake.planRunMutex.RLock()
+	defer fake.planRunMutex.RUnlock()
 	fake.registerNodeMutex.RLock()
 	defer fake.registerNodeMutex.RUnlock()
 	fake.removeNodeMutex.RLock()
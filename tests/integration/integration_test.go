@@ -79,6 +79,7 @@ func TestUpload(t *testing.T) {
 		t.Error(err)
 	}
 
+	report := node.NodeReport{Version: "test"}
 	node := &node.Node{Key: "test"}
 	nodeid, err := db.Driver.InsertNode(node)
 	if err != nil {
@@ -125,7 +126,7 @@ func TestUpload(t *testing.T) {
 	defer os.RemoveAll(testFile)
 
 	config.GetAgent().AgentKey = node.Key
-	fetcher.RegisterNode("foo", "bar")
+	fetcher.RegisterNode("foo", "bar", report)
 
 	nd, err := db.Driver.GetNode(nodeid)
 	if err != nil {
@@ -135,6 +136,9 @@ func TestUpload(t *testing.T) {
 	if nd.NodeID != "foo" {
 		t.Error("Failed registering node", nd)
 	}
+	if nd.Report.Version != "test" || len(nd.History) != 1 {
+		t.Error("Failed storing node report", nd)
+	}
 
 	err = fetcher.UploadArtefactRetry(testFile, "/", 5)
 	if err != nil {
@@ -0,0 +1,73 @@
+/*
+
+Copyright (C) 2020  Ettore Di Giacinto <mudler@gentoo.org>
+Credits goes also to Gogs authors, some code portions and re-implemented design
+are also coming from the Gogs project, which is using the go-macaron framework
+and was really source of ispiration. Kudos to them!
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package client
+
+import (
+	"os"
+	"testing"
+
+	tasks "github.com/MottainaiCI/mottainai-server/pkg/tasks"
+	webhook "github.com/MottainaiCI/mottainai-server/pkg/webhook"
+	helpers "github.com/MottainaiCI/mottainai-server/tests/helpers"
+)
+
+// The defaults of the webhooks are nested documents: keys removed from them
+// must not survive an update, whatever the engine.
+func TestWebHookDefaultsUpdate(t *testing.T) {
+	defer os.RemoveAll(config.GetDatabase().DBPath)
+	db := helpers.InitDB(config)
+	defer helpers.CleanDB()
+
+	w := &webhook.WebHook{Key: "defaults"}
+	w.SetEventPipeline("", &tasks.Pipeline{Tasks: map[string]tasks.Task{
+		"build": {Name: "build"},
+		"test":  {Name: "test"},
+	}})
+	w.SetEventPipeline("pull_request", &tasks.Pipeline{Tasks: map[string]tasks.Task{
+		"lint": {Name: "lint"},
+	}})
+	id, err := db.Driver.InsertWebHook(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.ID = id
+
+	w.SetEventPipeline("", &tasks.Pipeline{Tasks: map[string]tasks.Task{
+		"build": {Name: "build"},
+	}})
+	w.SetEventPipeline("pull_request", nil)
+	if err := db.Driver.UpdateWebHook(w.ID, w.ToMap()); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := db.Driver.GetWebHook(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Pipeline == nil || len(stored.Pipeline.Tasks) != 1 {
+		t.Error("Removed pipeline task still stored", stored.Pipeline)
+	}
+	if _, ok := stored.EventPipelines["pull_request"]; ok {
+		t.Error("Removed event pipeline still stored", stored.EventPipelines)
+	}
+}